@@ -1,16 +1,18 @@
-module github.com/sudankdk/firecracker
-
-go 1.25.5
-
-require (
-	github.com/google/uuid v1.6.0
-	gorm.io/driver/sqlite v1.6.0
-	gorm.io/gorm v1.30.0
-)
-
-require (
-	github.com/jinzhu/inflection v1.0.0 // indirect
-	github.com/jinzhu/now v1.1.5 // indirect
-	github.com/mattn/go-sqlite3 v1.14.33 // indirect
-	golang.org/x/text v0.20.0 // indirect
-)
+module github.com/sudankdk/firecracker
+
+go 1.25.5
+
+require (
+	github.com/google/uuid v1.6.0
+	github.com/hillu/go-yara/v4 v4.3.4
+	golang.org/x/sys v0.38.0
+	gorm.io/driver/sqlite v1.6.0
+	gorm.io/gorm v1.30.0
+)
+
+require (
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
+	github.com/mattn/go-sqlite3 v1.14.33 // indirect
+	golang.org/x/text v0.20.0 // indirect
+)
@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sudankdk/firecracker/internal/database"
+	"github.com/sudankdk/firecracker/internal/domain"
+	"github.com/sudankdk/firecracker/internal/hashing"
+	"github.com/sudankdk/firecracker/internal/similarity"
+	"github.com/sudankdk/firecracker/internal/unpack"
+	"github.com/sudankdk/firecracker/internal/verdict"
+)
+
+// unpack extracts an archive job's members into child jobs and reports
+// whether it did; if so the job waits on them instead of booting a VM.
+// Archives that yield nothing, or fail to open, go to a sandbox as before.
+func (h *UploadHandler) unpack(job *database.Job, report *domain.StaticReport) bool {
+	if h.Unpack == nil || report == nil || report.Archive == nil || job.Depth >= h.Unpack.Limits.MaxDepth {
+		return false
+	}
+	rootID := job.RootID
+	if rootID == "" {
+		rootID = job.ID
+	}
+	files, bytes, err := database.TreeUsage(rootID)
+	if err != nil {
+		log.Printf("archive usage lookup failed: job=%s err=%v", job.ID, err)
+		return false
+	}
+	budget := unpack.Budget{
+		Files: h.Unpack.Limits.MaxFiles - int(files),
+		Bytes: h.Unpack.Limits.MaxTotalBytes - bytes,
+	}
+	if budget.Files <= 0 || budget.Bytes <= 0 {
+		log.Printf("archive not unpacked: job=%s root=%s reason=tree limits reached", job.ID, rootID)
+		return false
+	}
+
+	dir := job.DiskPath + ".unpack"
+	if err := os.Mkdir(dir, 0700); err != nil {
+		log.Printf("archive not unpacked: job=%s err=%v", job.ID, err)
+		return false
+	}
+	defer os.RemoveAll(dir)
+
+	res, err := h.Unpack.Extract(context.Background(), job.DiskPath, report.FileType.Kind, dir, budget)
+	if errors.Is(err, unpack.ErrUnsupported) {
+		return false
+	}
+	ex := &domain.Extraction{Format: report.FileType.Kind}
+	if res != nil {
+		ex = &domain.Extraction{
+			Format:   res.Format,
+			Members:  len(res.Members),
+			Bytes:    res.Bytes,
+			Password: res.Password,
+			Skipped:  res.Skipped,
+			Stopped:  res.Stopped,
+		}
+	}
+	if err != nil {
+		ex.Error = err.Error()
+	}
+	report.Extraction = ex
+	if err := database.SaveStaticReport(job.ID, report); err != nil {
+		log.Printf("static report not saved: job=%s err=%v", job.ID, err)
+	}
+	log.Printf("archive unpacked: job=%s format=%s members=%d bytes=%d skipped=%d stopped=%q err=%v",
+		job.ID, ex.Format, ex.Members, ex.Bytes, len(ex.Skipped), ex.Stopped, err)
+	if err != nil || len(res.Members) == 0 {
+		return false
+	}
+
+	// Every child row exists before any child runs, so none can settle
+	// the parent while its siblings are still being recorded
+	var children []*database.Job
+	for _, m := range res.Members {
+		child, err := h.childJob(job, rootID, m)
+		if err != nil {
+			log.Printf("child job not recorded: job=%s member=%s err=%v", job.ID, m.Name, err)
+			continue
+		}
+		children = append(children, child)
+	}
+	if len(children) == 0 {
+		return false
+	}
+	database.SetJobState(job.ID, database.JobWaiting, "")
+	for _, child := range children {
+		if err := h.submit(child, 0); err != nil {
+			log.Printf("child job not queued: job=%s child=%s err=%v", job.ID, child.ID, err)
+			database.SetJobState(child.ID, database.JobFailed, "not queued: "+err.Error())
+			os.Remove(child.DiskPath)
+			ex.NotQueued++
+		}
+	}
+	if ex.NotQueued > 0 {
+		if err := database.SaveStaticReport(job.ID, report); err != nil {
+			log.Printf("static report not saved: job=%s err=%v", job.ID, err)
+		}
+	}
+	h.settle(job.ID)
+	return true
+}
+
+// childJob moves one extracted member into the upload directory and records
+// it as a job under parent.
+func (h *UploadHandler) childJob(parent *database.Job, rootID string, m unpack.Member) (*database.Job, error) {
+	digests, err := hashing.File(m.Path)
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.New().String()
+	path := filepath.Join(h.VM.BaseUploadDir, id)
+	if err := os.Rename(m.Path, path); err != nil {
+		return nil, err
+	}
+	child := &database.Job{
+		ID:         id,
+		Hash:       digests.SHA256,
+		MD5:        digests.MD5,
+		SHA1:       digests.SHA1,
+		SHA512:     digests.SHA512,
+		SSDeep:     digests.SSDeep,
+		TLSH:       digests.TLSH,
+		FileName:   m.Name,
+		FileSize:   m.Size,
+		DiskPath:   path,
+		VMStatus:   database.JobQueued,
+		TimeoutSec: parent.TimeoutSec,
+		Network:    parent.Network,
+		ParentID:   parent.ID,
+		RootID:     rootID,
+		Depth:      parent.Depth + 1,
+	}
+	if err := database.CreateJob(child); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	if err := similarity.Index(child.Hash, child.SSDeep, child.TLSH); err != nil {
+		log.Printf("similarity index failed: id=%s err=%v", child.ID, err)
+	}
+	return child, nil
+}
+
+// settle rolls the verdicts of parentID's children up into its archive
+// verdict, completing it once every child has finished, and carries on up
+// the tree while that completes each ancestor in turn.
+func (h *UploadHandler) settle(parentID string) {
+	h.settleMu.Lock()
+	defer h.settleMu.Unlock()
+
+	for parentID != "" {
+		parent, err := database.GetJob(parentID)
+		if err != nil {
+			log.Printf("archive verdict not updated: job=%s err=%v", parentID, err)
+			return
+		}
+		children, err := database.GetChildJobs(parentID)
+		if err != nil {
+			log.Printf("archive verdict not updated: job=%s err=%v", parentID, err)
+			return
+		}
+
+		av := &domain.ArchiveVerdict{
+			Verdict:  domain.VerdictClean,
+			Children: len(children),
+			Flagged:  []string{},
+			Updated:  time.Now(),
+		}
+		if parent.Verdict != nil {
+			av.Verdict, av.Score = parent.Verdict.Verdict, parent.Verdict.Score
+		}
+		for _, c := range children {
+			switch {
+			case !database.IsTerminal(c.VMStatus):
+				av.Pending++
+			case c.VMStatus != database.JobCompleted:
+				av.Failed++
+			}
+			label, score := jobVerdict(&c)
+			if verdict.Rank(label) > 0 {
+				av.Flagged = append(av.Flagged, c.ID)
+			}
+			av.Verdict = verdict.Worse(av.Verdict, label)
+			av.Score = max(av.Score, score)
+		}
+		if err := database.SaveArchiveVerdict(parentID, av); err != nil {
+			log.Printf("archive verdict not saved: job=%s err=%v", parentID, err)
+			return
+		}
+		if av.Pending > 0 || parent.VMStatus != database.JobWaiting {
+			return
+		}
+		database.SetJobState(parentID, database.JobCompleted, "")
+		log.Printf("archive settled: job=%s children=%d verdict=%s flagged=%d",
+			parentID, av.Children, av.Verdict, len(av.Flagged))
+		parentID = parent.ParentID
+	}
+}
+
+// jobVerdict is a job's own verdict, or its archive verdict if it has one.
+func jobVerdict(job *database.Job) (string, int) {
+	if job.ArchiveVerdict != nil {
+		return job.ArchiveVerdict.Verdict, job.ArchiveVerdict.Score
+	}
+	if job.Verdict != nil {
+		return job.Verdict.Verdict, job.Verdict.Score
+	}
+	return domain.VerdictClean, 0
+}
+
+// cancelChildren cancels every unfinished job unpacked from jobID, however
+// deeply nested.
+func (h *UploadHandler) cancelChildren(jobID string) {
+	children, err := database.GetChildJobs(jobID)
+	if err != nil {
+		log.Printf("child jobs not cancelled: job=%s err=%v", jobID, err)
+		return
+	}
+	for _, c := range children {
+		h.cancelChildren(c.ID)
+		if database.IsTerminal(c.VMStatus) {
+			continue
+		}
+		if h.Scheduler != nil && h.Scheduler.Cancel(c.ID) {
+			os.Remove(c.DiskPath)
+		}
+		database.SetJobState(c.ID, database.JobCancelled, "parent cancelled")
+		if vm := h.activeVM(c.ID); vm != nil {
+			if err := h.VM.DestroyVM(vm); err != nil {
+				log.Printf("vm teardown failed: job=%s vm=%s err=%v", c.ID, vm.ID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+
+	"github.com/sudankdk/firecracker/internal/database"
+	"github.com/sudankdk/firecracker/internal/sandboxing"
+)
+
+// artifactTypes are the content types of artifacts mime does not know.
+var artifactTypes = map[string]string{
+	".pcapng": "application/x-pcapng",
+}
+
+// ListArtifacts serves GET /jobs/{id}/artifacts
+func (h *UploadHandler) ListArtifacts(w http.ResponseWriter, r *http.Request) {
+	jobID := r.PathValue("id")
+	if _, err := database.GetJob(jobID); err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	list, err := h.VM.Artifacts(jobID)
+	if err != nil {
+		log.Printf("artifact listing failed: job=%s err=%v", jobID, err)
+		http.Error(w, "artifact listing failed", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []sandboxing.Artifact{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// GetArtifact serves GET /jobs/{id}/artifacts/{name} as a download.
+func (h *UploadHandler) GetArtifact(w http.ResponseWriter, r *http.Request) {
+	jobID, name := r.PathValue("id"), r.PathValue("name")
+	if _, err := database.GetJob(jobID); err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	f, err := h.VM.OpenArtifact(jobID, name)
+	if errors.Is(err, sandboxing.ErrNoArtifact) {
+		http.Error(w, "artifact not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("artifact open failed: job=%s name=%s err=%v", jobID, name, err)
+		http.Error(w, "artifact unavailable", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "artifact unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	ctype := artifactTypes[filepath.Ext(name)]
+	if ctype == "" {
+		ctype = mime.TypeByExtension(filepath.Ext(name))
+	}
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": jobID + "-" + name,
+	}))
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
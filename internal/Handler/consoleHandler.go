@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sudankdk/firecracker/internal/database"
+	"github.com/sudankdk/firecracker/internal/sandboxing"
+)
+
+const consoleKeepalive = 15 * time.Second
+
+// StreamConsole serves GET /jobs/{id}/console as server-sent events: each
+// "console" event carries a chunk of output and an "end" event follows
+// the last. A running VM's console is followed live from its recent
+// backlog; a finished job's is replayed from its artifact.
+func (h *UploadHandler) StreamConsole(w http.ResponseWriter, r *http.Request) {
+	jobID := r.PathValue("id")
+	if _, err := database.GetJob(jobID); err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	if vm := h.activeVM(jobID); vm != nil && vm.Console != nil {
+		backlog, live, cancel, err := vm.Console.Subscribe()
+		if err == nil {
+			defer cancel()
+			startEvents(w)
+			events := &consoleEvents{w: w}
+			events.write(backlog)
+			flusher.Flush()
+
+			keepalive := time.NewTicker(consoleKeepalive)
+			defer keepalive.Stop()
+			for {
+				select {
+				case chunk, ok := <-live:
+					if !ok {
+						if !vm.Console.Closed() {
+							writeEvent(w, "error", "console stream fell behind")
+							return
+						}
+						events.flush()
+						writeEvent(w, "end", "")
+						return
+					}
+					events.write(chunk)
+				case <-keepalive.C:
+					io.WriteString(w, ": keepalive\n\n")
+				case <-r.Context().Done():
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+
+	f, err := h.VM.OpenArtifact(jobID, sandboxing.ArtifactConsole)
+	if errors.Is(err, sandboxing.ErrNoArtifact) {
+		http.Error(w, "no console output for this job", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("console artifact unreadable: job=%s err=%v", jobID, err)
+		http.Error(w, "console unavailable", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	startEvents(w)
+	events := &consoleEvents{w: w}
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := f.Read(buf)
+		events.write(buf[:n])
+		if err != nil {
+			break
+		}
+	}
+	events.flush()
+	writeEvent(w, "end", "")
+	flusher.Flush()
+}
+
+func startEvents(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+}
+
+// consoleNewlines turns the serial console's CRLFs into LF and drops
+// stray CRs, which would end an event line early. A CRLF split across
+// chunks still comes out as one LF.
+var consoleNewlines = strings.NewReplacer("\r\n", "\n", "\r", "")
+
+// consoleEvents sends console chunks as events. A client joining each
+// event's data lines with LF gets the chunk back as valid UTF-8. A
+// character split across chunks is held back until the rest arrives, so
+// only bytes that are really invalid become U+FFFD.
+type consoleEvents struct {
+	w       io.Writer
+	pending []byte
+}
+
+func (c *consoleEvents) write(chunk []byte) {
+	data := chunk
+	if len(c.pending) > 0 {
+		data = append(c.pending, chunk...)
+		c.pending = nil
+	}
+	if n := partialRune(data); n > 0 {
+		c.pending = bytes.Clone(data[len(data)-n:])
+		data = data[:len(data)-n]
+	}
+	c.send(data)
+}
+
+// flush sends whatever is held back once the stream has ended.
+func (c *consoleEvents) flush() {
+	data := c.pending
+	c.pending = nil
+	c.send(data)
+}
+
+func (c *consoleEvents) send(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	text := consoleNewlines.Replace(strings.ToValidUTF8(string(data), "�"))
+	writeEvent(c.w, "console", text)
+}
+
+// partialRune is the length of the incomplete UTF-8 sequence ending b,
+// or 0 if b ends on a character boundary.
+func partialRune(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i > len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if utf8.FullRune(b[i:]) {
+				return 0
+			}
+			return len(b) - i
+		}
+	}
+	return 0
+}
+
+func writeEvent(w io.Writer, event, data string) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "event: %s\n", event)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	w.Write(b.Bytes())
+}
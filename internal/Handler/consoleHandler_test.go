@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// consoleText joins the data lines of every console event in out.
+func consoleText(out string) string {
+	var text strings.Builder
+	for _, event := range strings.Split(strings.TrimSuffix(out, "\n\n"), "\n\n") {
+		lines := strings.Split(event, "\n")
+		if lines[0] != "event: console" {
+			continue
+		}
+		for i, line := range lines[1:] {
+			if i > 0 {
+				text.WriteString("\n")
+			}
+			text.WriteString(strings.TrimPrefix(line, "data: "))
+		}
+	}
+	return text.String()
+}
+
+func TestConsoleEventsSplitCharacters(t *testing.T) {
+	// "é" is 2 bytes, "€" 3 and "😀" 4; every split point is tried
+	input := []byte("boot: é € 😀\r\nok")
+	want := "boot: é € 😀\nok"
+	for size := 1; size <= len(input); size++ {
+		var out bytes.Buffer
+		events := &consoleEvents{w: &out}
+		for i := 0; i < len(input); i += size {
+			events.write(input[i:min(i+size, len(input))])
+		}
+		events.flush()
+		if got := consoleText(out.String()); got != want {
+			t.Errorf("chunks of %d: got %q, want %q", size, got, want)
+		}
+	}
+}
+
+func TestConsoleEventsInvalidBytes(t *testing.T) {
+	var out bytes.Buffer
+	events := &consoleEvents{w: &out}
+	events.write([]byte("a\xffb"))
+	// A character cut off by the end of the stream is sent on flush
+	events.write([]byte("c\xe2\x82"))
+	events.flush()
+	if got, want := consoleText(out.String()), "a�bc�"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
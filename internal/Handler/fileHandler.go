@@ -1,60 +1,530 @@
-package handler
-
-import (
-	"io"
-	"log"
-	"net/http"
-	"os"
-	"path/filepath"
-
-	"github.com/google/uuid"
-	"github.com/sudankdk/firecracker/internal/sandboxing"
-)
-
-type UploadHandler struct {
-	VM *sandboxing.VMManager
-}
-
-func (h *UploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// 1. Parse file
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		log.Printf("upload rejected: missing file part: %v", err)
-		http.Error(w, "file required", http.StatusBadRequest)
-		return
-	}
-	defer file.Close()
-
-	// 2. Save upload to disk
-	uploadID := uuid.New().String()
-	uploadPath := filepath.Join(h.VM.BaseUploadDir, uploadID)
-	log.Printf("upload received: id=%s name=%s", uploadID, header.Filename)
-
-	out, err := os.Create(uploadPath)
-	if err != nil {
-		log.Printf("upload storage failed: id=%s path=%s err=%v", uploadID, uploadPath, err)
-		http.Error(w, "cannot save file", http.StatusInternalServerError)
-		return
-	}
-	defer out.Close()
-
-	bytesWritten, err := io.Copy(out, file)
-	if err != nil {
-		log.Printf("upload write failed: id=%s err=%v", uploadID, err)
-		http.Error(w, "upload failed", http.StatusInternalServerError)
-		return
-	}
-	log.Printf("upload stored: id=%s path=%s bytes=%d", uploadID, uploadPath, bytesWritten)
-
-	// 3. Spawn sandbox VM
-	vm, err := h.VM.SpawnVM(uploadPath)
-	if err != nil {
-		log.Printf("sandbox launch failed: upload=%s err=%v", uploadID, err)
-		http.Error(w, "sandbox failed", http.StatusInternalServerError)
-		return
-	}
-	log.Printf("sandbox running: upload=%s vm=%s", uploadID, vm.ID)
-
-	w.WriteHeader(http.StatusAccepted)
-	w.Write([]byte("file accepted and sandboxed"))
-}
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sudankdk/firecracker/internal/database"
+	"github.com/sudankdk/firecracker/internal/domain"
+	"github.com/sudankdk/firecracker/internal/hashing"
+	"github.com/sudankdk/firecracker/internal/netsig"
+	"github.com/sudankdk/firecracker/internal/quota"
+	"github.com/sudankdk/firecracker/internal/rescan"
+	"github.com/sudankdk/firecracker/internal/samples"
+	"github.com/sudankdk/firecracker/internal/sandboxing"
+	"github.com/sudankdk/firecracker/internal/scanner"
+	"github.com/sudankdk/firecracker/internal/similarity"
+	"github.com/sudankdk/firecracker/internal/triage"
+	"github.com/sudankdk/firecracker/internal/unpack"
+	"github.com/sudankdk/firecracker/internal/verdict"
+)
+
+type UploadHandler struct {
+	VM        *sandboxing.VMManager
+	Scheduler *sandboxing.Scheduler
+	Scanner   scanner.Scanner // optional host-side YARA scan before boot
+	Verdicts  verdict.Config
+	Samples   *samples.Store   // optional; keeps uploads for later rescans
+	Triage    *triage.Pipeline // optional static analysis before boot
+	Unpack    *unpack.Config   // optional; archives become child jobs
+	Quota     *quota.Limiter   // optional size, daily quota and free disk limits
+	NetRules  *netsig.Ruleset  // optional signatures over guest traffic
+
+	mu       sync.Mutex
+	settleMu sync.Mutex            // serialises rolling child verdicts up the tree
+	active   map[string]*domain.VM // jobID -> running VM
+	inflight map[string]string     // claimKey -> queued or running jobID
+}
+
+type JobResponse struct {
+	JobID     string           `json:"jobID"`
+	Hash      string           `json:"hash"`
+	Status    string           `json:"status"`
+	Digests   *hashing.Digests `json:"digests,omitempty"`
+	Cached    bool             `json:"cached,omitempty"`    // answered from an earlier completed job
+	Coalesced bool             `json:"coalesced,omitempty"` // joined a job already analysing this file
+	Result    *database.Job    `json:"result,omitempty"`    // the cached job
+}
+
+func (h *UploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 0. Shed load before reading the body
+	if h.Scheduler != nil && h.Scheduler.Full() {
+		h.rejectBusy(w)
+		return
+	}
+
+	priority, err := intParam(r.URL.Query().Get("priority"), 0)
+	if err != nil {
+		http.Error(w, "invalid priority", http.StatusBadRequest)
+		return
+	}
+	timeout, err := durationParam(r.URL.Query().Get("timeout"))
+	if err != nil || timeout < 0 {
+		http.Error(w, "invalid timeout", http.StatusBadRequest)
+		return
+	}
+	force, err := boolParam(r.URL.Query().Get("force"))
+	if err != nil {
+		http.Error(w, "invalid force", http.StatusBadRequest)
+		return
+	}
+	network := r.URL.Query().Get("network")
+	if !sandboxing.ValidNetwork(network) {
+		http.Error(w, "invalid network", http.StatusBadRequest)
+		return
+	}
+	if network == sandboxing.NetworkNone {
+		network = ""
+	}
+	if network != "" && !h.VM.Network.Enabled {
+		http.Error(w, "guest networking is disabled", http.StatusBadRequest)
+		return
+	}
+
+	// 1. Check size, quota and free disk before reading the body
+	var ticket *quota.Ticket
+	if h.Quota != nil {
+		client := h.Quota.Client(r)
+		if ticket, err = h.Quota.Admit(client, r.ContentLength); err != nil {
+			h.rejectQuota(w, client, err)
+			return
+		}
+		if ticket.Limit >= 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, ticket.Limit+quota.Framing)
+		}
+	}
+	var charged int64
+	if ticket != nil {
+		defer func() {
+			if err := ticket.Done(charged); err != nil {
+				log.Printf("upload usage not recorded: client=%s err=%v", ticket.Client, err)
+			}
+		}()
+	}
+
+	// 2. Stream the file part straight to disk
+	jobID := uuid.New().String()
+	uploadPath := filepath.Join(h.VM.BaseUploadDir, jobID)
+	hasher := hashing.New()
+	fileName, bytesWritten, err := h.receive(r, uploadPath, ticket, hasher)
+	if err != nil {
+		os.Remove(uploadPath)
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.Is(err, quota.ErrTooLarge), errors.As(err, &tooLarge):
+			log.Printf("upload rejected: id=%s err=%v", jobID, err)
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		case errors.Is(err, errNoFile):
+			log.Printf("upload rejected: id=%s err=%v", jobID, err)
+			http.Error(w, "file required", http.StatusBadRequest)
+		default:
+			log.Printf("upload write failed: id=%s err=%v", jobID, err)
+			http.Error(w, "upload failed", http.StatusInternalServerError)
+		}
+		return
+	}
+	// Every received upload is charged, including ones answered from
+	// the cache or by a job already in flight
+	charged = bytesWritten
+	digests := hasher.Sum()
+	hash := digests.SHA256
+	log.Printf("upload stored: id=%s name=%s path=%s bytes=%d sha256=%s", jobID, fileName, uploadPath, bytesWritten, hash)
+
+	// 3. Reuse an earlier analysis of the same file unless forced
+	if !force {
+		if cached := h.cachedJob(hash, network); cached != nil {
+			os.Remove(uploadPath)
+			log.Printf("upload served from cache: id=%s sha256=%s job=%s", jobID, hash, cached.ID)
+			w.Header().Set("Location", "/jobs/"+cached.ID)
+			writeJSON(w, http.StatusOK, JobResponse{
+				JobID:   cached.ID,
+				Hash:    hash,
+				Status:  cached.VMStatus,
+				Digests: &digests,
+				Cached:  true,
+				Result:  cached,
+			})
+			return
+		}
+	}
+	key := claimKey(hash, network)
+	if owner, claimed := h.claim(key, jobID); !claimed && !force {
+		os.Remove(uploadPath)
+		status := database.JobQueued
+		if current, err := database.GetJob(owner); err == nil {
+			status = current.VMStatus
+		}
+		log.Printf("upload coalesced: id=%s sha256=%s job=%s", jobID, hash, owner)
+		w.Header().Set("Location", "/jobs/"+owner)
+		writeJSON(w, http.StatusAccepted, JobResponse{
+			JobID:     owner,
+			Hash:      hash,
+			Status:    status,
+			Digests:   &digests,
+			Coalesced: true,
+		})
+		return
+	}
+
+	// 4. Record the job
+	job := &database.Job{
+		ID:         jobID,
+		Hash:       hash,
+		MD5:        digests.MD5,
+		SHA1:       digests.SHA1,
+		SHA512:     digests.SHA512,
+		SSDeep:     digests.SSDeep,
+		TLSH:       digests.TLSH,
+		FileName:   fileName,
+		FileSize:   bytesWritten,
+		DiskPath:   uploadPath,
+		VMStatus:   database.JobQueued,
+		TimeoutSec: int(h.VM.ResolveTimeout(timeout).Seconds()),
+		Network:    network,
+	}
+	if err := database.CreateJob(job); err != nil {
+		log.Printf("job not recorded: id=%s err=%v", jobID, err)
+		h.release(key, jobID)
+		os.Remove(uploadPath)
+		http.Error(w, "cannot create job", http.StatusInternalServerError)
+		return
+	}
+
+	// 5. Queue it for a sandbox VM
+	if err := h.submit(job, priority); err != nil {
+		h.release(key, jobID)
+		database.DeleteJob(jobID)
+		os.Remove(uploadPath)
+		if errors.Is(err, sandboxing.ErrQueueFull) {
+			h.rejectBusy(w)
+			return
+		}
+		log.Printf("job not queued: id=%s err=%v", jobID, err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	// 6. Make it findable by similarity search
+	if err := similarity.Index(hash, digests.SSDeep, digests.TLSH); err != nil {
+		log.Printf("similarity index failed: id=%s err=%v", jobID, err)
+	}
+
+	w.Header().Set("Location", "/jobs/"+jobID)
+	writeJSON(w, http.StatusAccepted, JobResponse{
+		JobID:   jobID,
+		Hash:    hash,
+		Status:  database.JobQueued,
+		Digests: &digests,
+	})
+}
+
+var errNoFile = errors.New("no file part in the request")
+
+// receive streams the multipart "file" part to path through hasher without
+// buffering it anywhere else, stopping as soon as it passes the ticket's
+// limit. It returns the client's file name and the bytes written.
+func (h *UploadHandler) receive(r *http.Request, path string, ticket *quota.Ticket, hasher io.Writer) (string, int64, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %v", errNoFile, err)
+	}
+	for {
+		part, err := mr.NextPart()
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return "", 0, err
+		}
+		if err != nil {
+			return "", 0, fmt.Errorf("%w: %v", errNoFile, err)
+		}
+		if part.FormName() != "file" {
+			continue // NextPart discards what is left of it
+		}
+
+		out, err := os.Create(path)
+		if err != nil {
+			return "", 0, err
+		}
+		var src io.Reader = part
+		if ticket != nil && ticket.Limit >= 0 {
+			src = io.LimitReader(part, ticket.Limit+1)
+		}
+		n, err := io.Copy(io.MultiWriter(out, hasher), src)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil && ticket != nil && ticket.Limit >= 0 && n > ticket.Limit {
+			err = fmt.Errorf("%w: %s", quota.ErrTooLarge, ticket.Reason)
+		}
+		return part.FileName(), n, err
+	}
+}
+
+// rejectQuota answers an upload Limiter.Admit turned away.
+func (h *UploadHandler) rejectQuota(w http.ResponseWriter, client string, err error) {
+	log.Printf("upload rejected: client=%s err=%v", client, err)
+	switch {
+	case errors.Is(err, quota.ErrTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, quota.ErrQuotaExhausted):
+		w.Header().Set("Retry-After", strconv.Itoa(int(quota.UntilReset().Seconds())+1))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	case errors.Is(err, quota.ErrLowDisk):
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+	default:
+		http.Error(w, "upload quota check failed", http.StatusInternalServerError)
+	}
+}
+
+func (h *UploadHandler) submit(job *database.Job, priority int) error {
+	if h.Scheduler == nil {
+		go h.runJob(job)
+		return nil
+	}
+	return h.Scheduler.Submit(&sandboxing.Task{
+		ID:       job.ID,
+		Priority: priority,
+		VCPUs:    h.VM.VMVcpus(),
+		MemMiB:   h.VM.VMMemMib(),
+		Run:      func() { h.runJob(job) },
+	})
+}
+
+func (h *UploadHandler) rejectBusy(w http.ResponseWriter) {
+	retry := int(h.Scheduler.RetryAfter().Seconds())
+	w.Header().Set("Retry-After", strconv.Itoa(retry))
+	http.Error(w, "sandbox queue full, retry later", http.StatusTooManyRequests)
+}
+
+// runJob boots a VM for job and records its outcome.
+func (h *UploadHandler) runJob(job *database.Job) {
+	defer h.settle(job.ParentID)
+	defer h.release(claimKey(job.Hash, job.Network), job.ID)
+	defer os.Remove(job.DiskPath)
+
+	if current, err := database.GetJob(job.ID); err == nil && database.IsTerminal(current.VMStatus) {
+		return
+	}
+	h.storeSample(job)
+	v := h.scanUpload(job)
+	report, proceed := h.triage(job, v)
+	if !proceed || h.unpack(job, report) {
+		return
+	}
+
+	var plan domain.ExecPlan
+	if h.Triage != nil {
+		plan = h.Triage.Policy.Plan(report)
+	}
+
+	database.SetJobState(job.ID, database.JobBooting, "")
+	vm, err := h.VM.SpawnVM(job.DiskPath, sandboxing.SpawnOptions{
+		JobID:    job.ID,
+		FileName: job.FileName,
+		SHA256:   job.Hash,
+		Timeout:  time.Duration(job.TimeoutSec) * time.Second,
+		Network:  job.Network,
+		Exec:     plan,
+	})
+	if err != nil {
+		log.Printf("sandbox launch failed: job=%s err=%v", job.ID, err)
+		database.SetJobState(job.ID, database.JobFailed, err.Error())
+		return
+	}
+	log.Printf("sandbox running: job=%s vm=%s diskBytesWritten=%d", job.ID, vm.ID, vm.DiskBytesWritten)
+
+	h.track(job.ID, vm)
+	defer h.untrack(job.ID)
+
+	// DELETE may have landed while the VM was booting
+	if current, err := database.GetJob(job.ID); err == nil && database.IsTerminal(current.VMStatus) {
+		if err := h.VM.DestroyVM(vm); err != nil {
+			log.Printf("vm teardown failed: job=%s vm=%s err=%v", job.ID, vm.ID, err)
+		}
+		log.Printf("sandbox cancelled during boot: job=%s vm=%s", job.ID, vm.ID)
+		return
+	}
+
+	if err := database.SetJobVM(job.ID, vm.ID, vm.DiskBytesWritten); err != nil {
+		log.Printf("job vm not saved: job=%s err=%v", job.ID, err)
+	}
+	if err := database.SetJobState(job.ID, database.JobRunning, ""); err != nil {
+		log.Printf("job state not saved: job=%s err=%v", job.ID, err)
+	}
+
+	<-vm.Done
+	h.inspectNetwork(job, vm, v)
+	if err := database.SaveJobReport(job.ID, vm.Report); err != nil {
+		log.Printf("job report not saved: job=%s err=%v", job.ID, err)
+	}
+
+	switch {
+	case vm.TimedOut:
+		database.SetJobState(job.ID, database.JobTimedOut, "deadline exceeded")
+	case vm.Report.Exit == nil:
+		database.SetJobState(job.ID, database.JobFailed, "guest exited without reporting results")
+	default:
+		database.SetJobState(job.ID, database.JobCompleted, "")
+	}
+	log.Printf("sandbox finished: job=%s vm=%s detections=%d", job.ID, vm.ID, len(vm.Report.Detections))
+}
+
+// storeSample keeps an encrypted copy of the upload, which runJob is about
+// to delete, so it can be rescanned when the rules change.
+func (h *UploadHandler) storeSample(job *database.Job) {
+	if h.Samples == nil {
+		return
+	}
+	if err := h.Samples.Put(job.Hash, job.DiskPath); err != nil {
+		log.Printf("sample not stored: job=%s hash=%s err=%v", job.ID, job.Hash, err)
+	}
+}
+
+// scanUpload runs the host YARA rules over the upload and returns the
+// verdict. A failed scan is logged and the job still goes to a sandbox.
+func (h *UploadHandler) scanUpload(job *database.Job) *domain.Verdict {
+	if h.Scanner == nil {
+		return nil
+	}
+	res, err := h.Scanner.ScanFile(context.Background(), job.DiskPath)
+	if err != nil {
+		log.Printf("yara scan failed: job=%s err=%v", job.ID, err)
+		return nil
+	}
+	v := h.Verdicts.Evaluate(res.Matches)
+	if err := database.SaveScanResult(job.ID, res.RulesVersion, res.Matches, v); err != nil {
+		log.Printf("scan result not saved: job=%s err=%v", job.ID, err)
+	}
+	if err := rescan.RecordScan(job.Hash, res, v); err != nil {
+		log.Printf("sample verdict not saved: job=%s err=%v", job.ID, err)
+	}
+	log.Printf("yara scan done: job=%s rules=%s matches=%d verdict=%s score=%d",
+		job.ID, res.RulesVersion, len(res.Matches), v.Verdict, v.Score)
+	return v
+}
+
+// triage runs static analysis and reports whether the job still needs a
+// VM. Benign files are completed and out-of-policy ones rejected here. A
+// failed analysis is logged and the job goes to a sandbox.
+func (h *UploadHandler) triage(job *database.Job, v *domain.Verdict) (*domain.StaticReport, bool) {
+	if h.Triage == nil {
+		return nil, true
+	}
+	report, err := h.Triage.Run(context.Background(), job.DiskPath)
+	if err != nil {
+		log.Printf("static triage failed: job=%s err=%v", job.ID, err)
+		return nil, true
+	}
+	report.Decision, report.Reason = h.Triage.Policy.Decide(report, v)
+	if err := database.SaveStaticReport(job.ID, report); err != nil {
+		log.Printf("static report not saved: job=%s err=%v", job.ID, err)
+	}
+	log.Printf("static triage done: job=%s type=%s entropy=%.2f urls=%d ips=%d decision=%s",
+		job.ID, report.FileType.Kind, report.Entropy, len(report.URLs), len(report.IPs), report.Decision)
+
+	switch report.Decision {
+	case domain.TriageSkip:
+		database.SetJobState(job.ID, database.JobCompleted, "")
+		return report, false
+	case domain.TriageReject:
+		database.SetJobState(job.ID, database.JobRejected, report.Reason)
+		return report, false
+	}
+	return report, true
+}
+
+// cachedJob returns the newest completed job for hash, run with the same
+// network mode, whose host scan used the rules now loaded, so its verdict
+// still stands. A networked job must also have had its traffic matched
+// against the network signatures now loaded.
+func (h *UploadHandler) cachedJob(hash, network string) *database.Job {
+	rulesVersion := ""
+	if h.Scanner != nil {
+		rulesVersion = h.Scanner.Info().Version
+	}
+	netRulesVersion := ""
+	if h.NetRules != nil {
+		netRulesVersion = h.NetRules.Version
+	}
+	jobs, err := database.GetJobsByHash(hash)
+	if err != nil {
+		log.Printf("verdict cache lookup failed: sha256=%s err=%v", hash, err)
+		return nil
+	}
+	for i := range jobs {
+		j := &jobs[i]
+		if j.VMStatus != database.JobCompleted || j.RulesVersion != rulesVersion || j.Network != network {
+			continue
+		}
+		if network != "" && j.NetRulesVersion != netRulesVersion {
+			continue
+		}
+		return j
+	}
+	return nil
+}
+
+// claimKey identifies an analysis for coalescing. A networked run sees
+// different behaviour from an offline one, so the two never stand in for
+// each other.
+func claimKey(hash, network string) string {
+	if network == "" {
+		return hash
+	}
+	return hash + "/" + network
+}
+
+// claim makes jobID the in-flight analysis under key. If another job
+// already holds it, that job's ID is returned instead.
+func (h *UploadHandler) claim(key, jobID string) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if owner, ok := h.inflight[key]; ok {
+		return owner, false
+	}
+	if h.inflight == nil {
+		h.inflight = make(map[string]string)
+	}
+	h.inflight[key] = jobID
+	return jobID, true
+}
+
+// release ends jobID's claim on key, if it holds one.
+func (h *UploadHandler) release(key, jobID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.inflight[key] == jobID {
+		delete(h.inflight, key)
+	}
+}
+
+func (h *UploadHandler) track(jobID string, vm *domain.VM) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.active == nil {
+		h.active = make(map[string]*domain.VM)
+	}
+	h.active[jobID] = vm
+}
+
+func (h *UploadHandler) untrack(jobID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.active, jobID)
+}
+
+func (h *UploadHandler) activeVM(jobID string) *domain.VM {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.active[jobID]
+}
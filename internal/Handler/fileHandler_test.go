@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sudankdk/firecracker/internal/database"
+	"github.com/sudankdk/firecracker/internal/quota"
+	"github.com/sudankdk/firecracker/internal/sandboxing"
+)
+
+// multipartUpload builds an upload request with a form field either side
+// of the file part.
+func multipartUpload(t *testing.T, field string, file []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("comment", field)
+	fw, err := mw.CreateFormFile("file", "sample.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(file)
+	mw.WriteField("after", "ignored")
+	mw.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func ticket(t *testing.T, maxBytes int64) *quota.Ticket {
+	t.Helper()
+	tk, err := quota.New(quota.Config{MaxUploadBytes: maxBytes}, t.TempDir()).Admit("client", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tk
+}
+
+func TestReceiveCountsOnlyTheFile(t *testing.T) {
+	file := bytes.Repeat([]byte("MZ"), 2500)
+	r := multipartUpload(t, strings.Repeat("x", 3000), file)
+	path := filepath.Join(t.TempDir(), "upload")
+	hasher := sha256.New()
+
+	name, n, err := (&UploadHandler{}).receive(r, path, ticket(t, int64(len(file))), hasher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(file)
+	if name != "sample.exe" || n != int64(len(file)) || hex.EncodeToString(hasher.Sum(nil)) != hex.EncodeToString(sum[:]) {
+		t.Errorf("got name %q, %d bytes; want sample.exe, %d bytes of the file alone", name, n, len(file))
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, file) {
+		t.Error("stored file differs from the upload")
+	}
+}
+
+func TestReceiveLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upload")
+
+	// One byte over the ticket's limit
+	r := multipartUpload(t, "", make([]byte, 101))
+	if _, n, err := (&UploadHandler{}).receive(r, path, ticket(t, 100), sha256.New()); !errors.Is(err, quota.ErrTooLarge) {
+		t.Errorf("file over the limit: got %d bytes, err %v; want ErrTooLarge", n, err)
+	}
+
+	// Form fields count against the framing allowance, not the file limit
+	tk := ticket(t, 100)
+	r = multipartUpload(t, strings.Repeat("x", quota.Framing), make([]byte, 10))
+	r.Body = http.MaxBytesReader(httptest.NewRecorder(), r.Body, tk.Limit+quota.Framing)
+	var tooLarge *http.MaxBytesError
+	if _, _, err := (&UploadHandler{}).receive(r, path, tk, sha256.New()); !errors.As(err, &tooLarge) {
+		t.Errorf("oversized form field: got %v, want a MaxBytesError", err)
+	}
+
+	r = multipartUpload(t, "", nil)
+	r.Header.Set("Content-Type", "application/octet-stream")
+	if _, _, err := (&UploadHandler{}).receive(r, path, nil, sha256.New()); !errors.Is(err, errNoFile) {
+		t.Errorf("not multipart: got %v, want errNoFile", err)
+	}
+}
+
+func openDB(t *testing.T) {
+	t.Helper()
+	if err := database.InitDatabase(filepath.Join(t.TempDir(), "jobs.db")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUploadChargesAnsweredUploads(t *testing.T) {
+	openDB(t)
+	uploads := t.TempDir()
+	h := &UploadHandler{
+		VM:    &sandboxing.VMManager{BaseUploadDir: uploads},
+		Quota: quota.New(quota.Config{DailyBytes: 1 << 20}, uploads),
+	}
+	upload := func(file []byte) JobResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, multipartUpload(t, "", file))
+		var resp JobResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		return resp
+	}
+	used := func() int64 {
+		t.Helper()
+		n, err := database.UploadUsageBytes("192.0.2.1", quota.Today())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	cached := []byte("MZ analysed before")
+	sum := sha256.Sum256(cached)
+	database.CreateJob(&database.Job{ID: "done", Hash: hex.EncodeToString(sum[:]), VMStatus: database.JobCompleted})
+	if resp := upload(cached); !resp.Cached || resp.JobID != "done" {
+		t.Fatalf("re-upload: %+v, want the cached job", resp)
+	}
+	if got := used(); got != int64(len(cached)) {
+		t.Errorf("cached re-upload charged %d bytes, want %d", got, len(cached))
+	}
+
+	running := []byte("MZ being analysed")
+	sum = sha256.Sum256(running)
+	h.claim(claimKey(hex.EncodeToString(sum[:]), ""), "running")
+	if resp := upload(running); !resp.Coalesced || resp.JobID != "running" {
+		t.Fatalf("duplicate upload: %+v, want the running job", resp)
+	}
+	if got, want := used(), int64(len(cached)+len(running)); got != want {
+		t.Errorf("coalesced upload: %d bytes charged in all, want %d", got, want)
+	}
+
+	if left, _ := os.ReadDir(uploads); len(left) != 0 {
+		t.Errorf("answered uploads left on disk: %v", left)
+	}
+}
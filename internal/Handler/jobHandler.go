@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/database"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type JobListResponse struct {
+	Jobs   []database.Job `json:"jobs"`
+	Total  int64          `json:"total"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+}
+
+// QueueStats serves GET /queue
+func (h *UploadHandler) QueueStats(w http.ResponseWriter, r *http.Request) {
+	if h.Scheduler == nil {
+		http.Error(w, "scheduler disabled", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.Scheduler.Stats())
+}
+
+// PoolStats serves GET /pool
+func (h *UploadHandler) PoolStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.VM.PoolStats())
+}
+
+// StorageStats serves GET /metrics/storage
+func (h *UploadHandler) StorageStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.VM.CloneMetrics())
+}
+
+// GetJob serves GET /jobs/{id}
+func (h *UploadHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := database.GetJob(r.PathValue("id"))
+	if err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// ListJobs serves GET /jobs?state=&parent=&hash=&name=&since=&until=&limit=&offset=
+func (h *UploadHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := database.JobFilter{
+		State:    q.Get("state"),
+		Parent:   q.Get("parent"),
+		Hash:     q.Get("hash"),
+		FileName: q.Get("name"),
+	}
+
+	var err error
+	if filter.Limit, err = intParam(q.Get("limit"), defaultPageSize); err != nil || filter.Limit < 1 {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+	if filter.Limit > maxPageSize {
+		filter.Limit = maxPageSize
+	}
+	if filter.Offset, err = intParam(q.Get("offset"), 0); err != nil || filter.Offset < 0 {
+		http.Error(w, "invalid offset", http.StatusBadRequest)
+		return
+	}
+	if filter.Since, err = timeParam(q.Get("since")); err != nil {
+		http.Error(w, "invalid since (RFC 3339 expected)", http.StatusBadRequest)
+		return
+	}
+	if filter.Until, err = timeParam(q.Get("until")); err != nil {
+		http.Error(w, "invalid until (RFC 3339 expected)", http.StatusBadRequest)
+		return
+	}
+
+	jobs, total, err := database.ListJobs(filter)
+	if err != nil {
+		log.Printf("job list failed: %v", err)
+		http.Error(w, "failed to retrieve jobs", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, JobListResponse{
+		Jobs:   jobs,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	})
+}
+
+// CancelJob serves DELETE /jobs/{id}: the job is marked cancelled and its
+// VM, if one is running, is torn down, along with those of any jobs
+// unpacked from it.
+func (h *UploadHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	jobID := r.PathValue("id")
+	job, err := database.GetJob(jobID)
+	if err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	if database.IsTerminal(job.VMStatus) {
+		http.Error(w, "job already "+job.VMStatus, http.StatusConflict)
+		return
+	}
+	if h.Scheduler != nil && h.Scheduler.Cancel(jobID) {
+		// It will never run, so runJob won't release the hash
+		h.release(claimKey(job.Hash, job.Network), jobID)
+		os.Remove(job.DiskPath)
+	}
+
+	if err := database.SetJobState(jobID, database.JobCancelled, "cancelled by client"); err != nil {
+		log.Printf("job cancel failed: job=%s err=%v", jobID, err)
+		http.Error(w, "cancel failed", http.StatusInternalServerError)
+		return
+	}
+	if vm := h.activeVM(jobID); vm != nil {
+		if err := h.VM.DestroyVM(vm); err != nil {
+			log.Printf("vm teardown failed: job=%s vm=%s err=%v", jobID, vm.ID, err)
+		}
+	}
+	h.cancelChildren(jobID)
+	h.settle(job.ParentID)
+	log.Printf("job cancelled: job=%s", jobID)
+
+	job, err = database.GetJob(jobID)
+	if err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeLookupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("job lookup failed: %v", err)
+	http.Error(w, "job lookup failed", http.StatusInternalServerError)
+}
+
+func intParam(v string, def int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func boolParam(v string) (bool, error) {
+	if v == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+// durationParam accepts a Go duration ("90s", "5m") or plain seconds.
+func durationParam(v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	return time.ParseDuration(v)
+}
+
+func timeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/database"
+	"github.com/sudankdk/firecracker/internal/domain"
+	"github.com/sudankdk/firecracker/internal/sandboxing"
+)
+
+func jobRoutes(h *UploadHandler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs", h.ListJobs)
+	mux.HandleFunc("DELETE /jobs/{id}", h.CancelJob)
+	return mux
+}
+
+func createJobs(t *testing.T, jobs ...database.Job) {
+	t.Helper()
+	for i := range jobs {
+		if err := database.CreateJob(&jobs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestListJobs(t *testing.T) {
+	openDB(t)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	createJobs(t,
+		database.Job{ID: "a", Hash: "h1", FileName: "setup.exe", VMStatus: database.JobCompleted, CreatedAt: base},
+		database.Job{ID: "b", Hash: "h2", FileName: "bundle.zip", VMStatus: database.JobWaiting, CreatedAt: base.Add(time.Hour)},
+		database.Job{ID: "c", Hash: "h3", FileName: "inner.exe", VMStatus: database.JobQueued, ParentID: "b", CreatedAt: base.Add(2 * time.Hour)},
+		database.Job{ID: "d", Hash: "h1", FileName: "setup.exe", VMStatus: database.JobCompleted, CreatedAt: base.Add(3 * time.Hour)},
+		database.Job{ID: "e", Hash: "h4", FileName: "run.dll", VMStatus: database.JobRunning, CreatedAt: base.Add(4 * time.Hour)},
+	)
+	h := jobRoutes(&UploadHandler{})
+
+	tests := []struct {
+		query string
+		want  []string // newest first
+		total int64
+	}{
+		{"", []string{"e", "d", "c", "b", "a"}, 5},
+		{"state=completed", []string{"d", "a"}, 2},
+		{"parent=b", []string{"c"}, 1},
+		{"hash=h1", []string{"d", "a"}, 2},
+		{"name=.EXE", []string{"d", "c", "a"}, 3},
+		{"since=2026-01-01T02:00:00Z", []string{"e", "d", "c"}, 3},
+		{"until=2026-01-01T02:00:00Z", []string{"b", "a"}, 2},
+		{"state=completed&hash=h1&until=2026-01-01T02:00:00Z", []string{"a"}, 1},
+		{"state=failed", nil, 0},
+		{"limit=2", []string{"e", "d"}, 5},
+		{"limit=2&offset=2", []string{"c", "b"}, 5},
+		{"limit=2&offset=4", []string{"a"}, 5},
+		{"offset=9", nil, 5},
+		{"name=exe&limit=1&offset=1", []string{"c"}, 3},
+	}
+	for _, tc := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs?"+tc.query, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%q: status %d: %s", tc.query, rec.Code, rec.Body)
+			continue
+		}
+		var resp JobListResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, j := range resp.Jobs {
+			got = append(got, j.ID)
+		}
+		if !slices.Equal(got, tc.want) || resp.Total != tc.total {
+			t.Errorf("%q: got %v (total %d), want %v (total %d)", tc.query, got, resp.Total, tc.want, tc.total)
+		}
+	}
+
+	// Clients read the state from vmStatus
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs?limit=1", nil))
+	if !strings.Contains(rec.Body.String(), `"vmStatus":"running"`) {
+		t.Errorf("job list without vmStatus: %s", rec.Body)
+	}
+}
+
+func TestListJobsParams(t *testing.T) {
+	openDB(t)
+	h := jobRoutes(&UploadHandler{})
+
+	for _, query := range []string{"limit=0", "limit=x", "offset=-1", "since=yesterday", "until=2026-01-01"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: status %d, want 400", query, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs?limit=100000", nil))
+	var resp JobListResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if resp.Limit != maxPageSize || resp.Offset != 0 {
+		t.Errorf("got limit %d, offset %d; want %d, 0", resp.Limit, resp.Offset, maxPageSize)
+	}
+}
+
+// cancel sends DELETE /jobs/{id} and returns the status and the job it
+// answered with, if any.
+func cancel(t *testing.T, h *UploadHandler, id string) (int, *database.Job) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	jobRoutes(h).ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/jobs/"+id, nil))
+	if rec.Code != http.StatusOK {
+		return rec.Code, nil
+	}
+	var job database.Job
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, &job
+}
+
+func TestCancelQueuedJob(t *testing.T) {
+	openDB(t)
+	h := &UploadHandler{Scheduler: sandboxing.NewScheduler(sandboxing.SchedulerConfig{MaxVMs: 1})}
+
+	// Hold the only slot so the job stays queued
+	started, hold := make(chan struct{}), make(chan struct{})
+	defer close(hold)
+	h.Scheduler.Submit(&sandboxing.Task{ID: "blocker", Run: func() {
+		close(started)
+		<-hold
+	}})
+	<-started
+
+	disk := filepath.Join(t.TempDir(), "upload")
+	os.WriteFile(disk, []byte("MZ"), 0o600)
+	createJobs(t,
+		database.Job{ID: "q", Hash: "h", DiskPath: disk, VMStatus: database.JobQueued},
+		database.Job{ID: "child", ParentID: "q", VMStatus: database.JobQueued},
+	)
+	h.claim(claimKey("h", ""), "q")
+	ran := make(chan struct{}, 1)
+	h.Scheduler.Submit(&sandboxing.Task{ID: "q", Run: func() { ran <- struct{}{} }})
+
+	status, job := cancel(t, h, "q")
+	if status != http.StatusOK || job.VMStatus != database.JobCancelled || job.FinishedAt == nil {
+		t.Fatalf("got %d, %+v; want the job cancelled", status, job)
+	}
+	if st := h.Scheduler.Stats(); st.Queued != 0 {
+		t.Errorf("job still queued: %+v", st)
+	}
+	if _, err := os.Stat(disk); !os.IsNotExist(err) {
+		t.Errorf("upload left on disk: %v", err)
+	}
+	if _, ok := h.claim(claimKey("h", ""), "next"); !ok {
+		t.Error("cancelled job still holds its hash")
+	}
+	if child, err := database.GetJob("child"); err != nil || child.VMStatus != database.JobCancelled {
+		t.Errorf("child job: %+v, %v; want it cancelled", child, err)
+	}
+	select {
+	case <-ran:
+		t.Error("cancelled job ran")
+	default:
+	}
+}
+
+func TestCancelRunningJob(t *testing.T) {
+	openDB(t)
+	h := &UploadHandler{VM: &sandboxing.VMManager{}}
+	createJobs(t, database.Job{ID: "r", Hash: "h", VMStatus: database.JobRunning})
+
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	h.track("r", &domain.VM{ID: "vm-r", Cmd: cmd})
+	defer cmd.Process.Kill()
+
+	status, job := cancel(t, h, "r")
+	if status != http.StatusOK || job.VMStatus != database.JobCancelled {
+		t.Fatalf("got %d, %+v; want the job cancelled", status, job)
+	}
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Error("VM still running after cancel")
+	}
+}
+
+func TestCancelFinishedJob(t *testing.T) {
+	openDB(t)
+	h := &UploadHandler{}
+	createJobs(t, database.Job{ID: "f", VMStatus: database.JobCompleted, ScanResult: "clean"})
+
+	if status, _ := cancel(t, h, "f"); status != http.StatusConflict {
+		t.Errorf("finished job: status %d, want 409", status)
+	}
+	if job, err := database.GetJob("f"); err != nil || job.VMStatus != database.JobCompleted {
+		t.Errorf("finished job changed: %+v, %v", job, err)
+	}
+	if status, _ := cancel(t, h, "missing"); status != http.StatusNotFound {
+		t.Errorf("unknown job: status %d, want 404", status)
+	}
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/sudankdk/firecracker/internal/database"
+	"github.com/sudankdk/firecracker/internal/domain"
+	"github.com/sudankdk/firecracker/internal/netioc"
+)
+
+// inspectNetwork parses a finished VM's packet capture into its report
+// and runs the network signatures over the flows, folding any hits into
+// v, the upload's YARA verdict or nil. A capture that cannot be read is
+// logged and the report left without a network section.
+func (h *UploadHandler) inspectNetwork(job *database.Job, vm *domain.VM, v *domain.Verdict) {
+	if vm.CapturePath == "" {
+		return
+	}
+	trace, err := netioc.Parse(vm.CapturePath)
+	if err != nil {
+		log.Printf("network capture not parsed: job=%s err=%v", job.ID, err)
+		return
+	}
+	trace.Report.Capture = filepath.Base(vm.CapturePath)
+	vm.Report.Network = trace.Report
+
+	if h.NetRules == nil {
+		return
+	}
+	hits := h.NetRules.Match(trace.Flows)
+	nv := h.Verdicts.WithNetwork(v, hits)
+	if err := database.SaveNetworkDetections(job.ID, h.NetRules.Version, hits, nv); err != nil {
+		log.Printf("network detections not saved: job=%s err=%v", job.ID, err)
+	}
+	log.Printf("network signatures done: job=%s rules=%s hits=%d verdict=%s score=%d",
+		job.ID, h.NetRules.Version, len(hits), nv.Verdict, nv.Score)
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/sudankdk/firecracker/internal/database"
+	"github.com/sudankdk/firecracker/internal/rescan"
+	"gorm.io/gorm"
+)
+
+type RescanHandler struct {
+	Rescanner *rescan.Rescanner
+}
+
+type RescanResponse struct {
+	Run     *database.RescanRun      `json:"run"`
+	Changes []database.VerdictChange `json:"changes"`
+}
+
+// StartRescan serves POST /rescan?force=true. Without force, samples
+// already scanned with the current rules are skipped. Results land in the
+// run's changes and the per-sample verdicts; job records are not updated.
+func (h *RescanHandler) StartRescan(w http.ResponseWriter, r *http.Request) {
+	force := false
+	if v := r.URL.Query().Get("force"); v != "" {
+		var err error
+		if force, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "invalid force", http.StatusBadRequest)
+			return
+		}
+	}
+
+	run, err := h.Rescanner.Start(force)
+	if errors.Is(err, rescan.ErrRunning) {
+		w.Header().Set("Location", "/rescan/"+run.ID)
+		writeJSON(w, http.StatusConflict, run)
+		return
+	}
+	if err != nil {
+		log.Printf("rescan not started: %v", err)
+		http.Error(w, "rescan failed to start", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", "/rescan/"+run.ID)
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+// ListRescans serves GET /rescan?limit=
+func (h *RescanHandler) ListRescans(w http.ResponseWriter, r *http.Request) {
+	limit, err := intParam(r.URL.Query().Get("limit"), defaultPageSize)
+	if err != nil || limit < 1 {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+	runs, err := database.ListRescanRuns(min(limit, maxPageSize))
+	if err != nil {
+		log.Printf("rescan list failed: %v", err)
+		http.Error(w, "failed to list rescans", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// GetRescan serves GET /rescan/{id} with the verdict diffs found so far
+func (h *RescanHandler) GetRescan(w http.ResponseWriter, r *http.Request) {
+	run, err := database.GetRescanRun(r.PathValue("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "rescan not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("rescan lookup failed: %v", err)
+		http.Error(w, "rescan lookup failed", http.StatusInternalServerError)
+		return
+	}
+	changes, err := database.ListVerdictChanges(run.ID)
+	if err != nil {
+		log.Printf("rescan changes lookup failed: %v", err)
+		http.Error(w, "rescan lookup failed", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, RescanResponse{Run: run, Changes: changes})
+}
@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/database"
+	"github.com/sudankdk/firecracker/internal/scanner"
+	"gorm.io/gorm"
+)
+
+const maxRulesetSize = 1 << 20
+
+// RuleHandler serves the YARA ruleset API. Every change that alters the
+// live rules records a database.RuleVersion with the full sources.
+type RuleHandler struct {
+	Rules *scanner.RuleStore
+}
+
+type RuleListResponse struct {
+	Version  string            `json:"version"`
+	Engine   string            `json:"engine"`
+	LoadedAt time.Time         `json:"loadedAt"`
+	Rulesets []scanner.Ruleset `json:"rulesets"`
+}
+
+type RuleChangeResponse struct {
+	Ruleset *scanner.Ruleset `json:"ruleset,omitempty"`
+	Version string           `json:"version"`
+}
+
+// RecordVersion stores the scanner's current ruleset as a version.
+func (h *RuleHandler) RecordVersion(change string) (string, error) {
+	info := h.Rules.Scanner.Info()
+	sources, err := h.Rules.Snapshot()
+	if err != nil {
+		return info.Version, err
+	}
+	v := &database.RuleVersion{
+		ID:       info.Version,
+		Change:   change,
+		Rulesets: sources,
+	}
+	if err := database.RecordRuleVersion(v); err != nil {
+		return info.Version, err
+	}
+	return info.Version, nil
+}
+
+// ListRules serves GET /rules
+func (h *RuleHandler) ListRules(w http.ResponseWriter, r *http.Request) {
+	rulesets, err := h.Rules.List()
+	if err != nil {
+		log.Printf("ruleset list failed: %v", err)
+		http.Error(w, "failed to list rulesets", http.StatusInternalServerError)
+		return
+	}
+	info := h.Rules.Scanner.Info()
+	writeJSON(w, http.StatusOK, RuleListResponse{
+		Version:  info.Version,
+		Engine:   info.Engine,
+		LoadedAt: info.LoadedAt,
+		Rulesets: rulesets,
+	})
+}
+
+// GetRules serves GET /rules/{name} with the ruleset source
+func (h *RuleHandler) GetRules(w http.ResponseWriter, r *http.Request) {
+	rs, src, err := h.Rules.Get(r.PathValue("name"))
+	if err != nil {
+		writeRuleError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("ETag", `"`+rs.SHA256+`"`)
+	w.Write(src)
+}
+
+// UploadRules serves POST /rules with a multipart "file"; the ruleset is
+// named after the file unless a "name" field is given.
+func (h *RuleHandler) UploadRules(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRulesetSize+64<<10)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	name := r.FormValue("name")
+	if name == "" {
+		base := filepath.Base(header.Filename)
+		name = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	h.save(w, name, file)
+}
+
+// PutRules serves PUT /rules/{name} with the ruleset source as the body
+func (h *RuleHandler) PutRules(w http.ResponseWriter, r *http.Request) {
+	h.save(w, r.PathValue("name"), http.MaxBytesReader(w, r.Body, maxRulesetSize))
+}
+
+func (h *RuleHandler) save(w http.ResponseWriter, name string, body io.Reader) {
+	src, err := io.ReadAll(io.LimitReader(body, maxRulesetSize+1))
+	if err != nil {
+		http.Error(w, "failed to read rules", http.StatusBadRequest)
+		return
+	}
+	if len(src) > maxRulesetSize {
+		http.Error(w, "ruleset too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	rs, err := h.Rules.Put(name, src)
+	if err != nil {
+		writeRuleError(w, err)
+		return
+	}
+	log.Printf("ruleset saved: name=%s sha256=%s rules=%d", rs.Name, rs.SHA256, len(rs.Rules))
+	h.respondChange(w, &rs, "put "+name)
+}
+
+// EnableRules serves POST /rules/{name}/enable
+func (h *RuleHandler) EnableRules(w http.ResponseWriter, r *http.Request) {
+	h.setEnabled(w, r.PathValue("name"), true)
+}
+
+// DisableRules serves POST /rules/{name}/disable
+func (h *RuleHandler) DisableRules(w http.ResponseWriter, r *http.Request) {
+	h.setEnabled(w, r.PathValue("name"), false)
+}
+
+func (h *RuleHandler) setEnabled(w http.ResponseWriter, name string, enabled bool) {
+	rs, err := h.Rules.SetEnabled(name, enabled)
+	if err != nil {
+		writeRuleError(w, err)
+		return
+	}
+	change := "disable " + name
+	if enabled {
+		change = "enable " + name
+	}
+	log.Printf("ruleset changed: %s", change)
+	h.respondChange(w, &rs, change)
+}
+
+// DeleteRules serves DELETE /rules/{name}
+func (h *RuleHandler) DeleteRules(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := h.Rules.Delete(name); err != nil {
+		writeRuleError(w, err)
+		return
+	}
+	log.Printf("ruleset deleted: name=%s", name)
+	h.respondChange(w, nil, "delete "+name)
+}
+
+func (h *RuleHandler) respondChange(w http.ResponseWriter, rs *scanner.Ruleset, change string) {
+	version, err := h.RecordVersion(change)
+	if err != nil {
+		log.Printf("rule version not recorded: version=%s err=%v", version, err)
+	}
+	writeJSON(w, http.StatusOK, RuleChangeResponse{Ruleset: rs, Version: version})
+}
+
+// ListRuleVersions serves GET /rules/versions?limit=
+func (h *RuleHandler) ListRuleVersions(w http.ResponseWriter, r *http.Request) {
+	limit, err := intParam(r.URL.Query().Get("limit"), defaultPageSize)
+	if err != nil || limit < 1 {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+	versions, err := database.ListRuleVersions(min(limit, maxPageSize))
+	if err != nil {
+		log.Printf("rule version list failed: %v", err)
+		http.Error(w, "failed to list rule versions", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, versions)
+}
+
+// GetRuleVersion serves GET /rules/versions/{id} with every source in it
+func (h *RuleHandler) GetRuleVersion(w http.ResponseWriter, r *http.Request) {
+	v, err := database.GetRuleVersion(r.PathValue("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "rule version not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("rule version lookup failed: %v", err)
+		http.Error(w, "rule version lookup failed", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func writeRuleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, scanner.ErrInvalidName):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, scanner.ErrRulesetNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, scanner.ErrRulesRejected):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		log.Printf("ruleset change failed: %v", err)
+		http.Error(w, "ruleset change failed", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/sudankdk/firecracker/internal/database"
+	"github.com/sudankdk/firecracker/internal/similarity"
+)
+
+// SampleHandler serves lookups across every sample seen so far.
+type SampleHandler struct {
+	MinScore int // default similarity threshold, 0-100
+}
+
+type SimilarResponse struct {
+	Hash      string             `json:"hash"`
+	SSDeep    string             `json:"ssdeep"`
+	TLSH      string             `json:"tlsh,omitempty"`
+	Threshold int                `json:"threshold"`
+	Matches   []similarity.Match `json:"matches"`
+}
+
+// Similar serves GET /samples/{hash}/similar?threshold=&limit=, ranking
+// earlier samples by fuzzy-hash similarity to the one with this SHA-256.
+func (h *SampleHandler) Similar(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+	threshold, err := intParam(r.URL.Query().Get("threshold"), h.MinScore)
+	if err != nil || threshold < 0 || threshold > 100 {
+		http.Error(w, "invalid threshold", http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(r.URL.Query().Get("limit"), defaultPageSize)
+	if err != nil || limit < 1 {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	jobs, err := database.GetJobsByHash(hash)
+	if err != nil {
+		log.Printf("sample lookup failed: hash=%s err=%v", hash, err)
+		http.Error(w, "sample lookup failed", http.StatusInternalServerError)
+		return
+	}
+	if len(jobs) == 0 {
+		http.Error(w, "sample not found", http.StatusNotFound)
+		return
+	}
+	var sample *database.Job
+	for i := range jobs {
+		if jobs[i].SSDeep != "" {
+			sample = &jobs[i]
+			break
+		}
+	}
+	if sample == nil {
+		http.Error(w, "sample has no fuzzy hashes", http.StatusUnprocessableEntity)
+		return
+	}
+
+	matches, err := similarity.Search(hash, sample.SSDeep, sample.TLSH, threshold, min(limit, maxPageSize))
+	if err != nil {
+		log.Printf("similarity search failed: hash=%s err=%v", hash, err)
+		http.Error(w, "similarity search failed", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, SimilarResponse{
+		Hash:      hash,
+		SSDeep:    sample.SSDeep,
+		TLSH:      sample.TLSH,
+		Threshold: threshold,
+		Matches:   matches,
+	})
+}
@@ -0,0 +1,212 @@
+// Package console records a VM's serial console: output goes to a
+// size-capped log file that is rotated when it fills, and is fanned out
+// to live subscribers with a short backlog so they join mid-stream.
+package console
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	DefaultMaxBytes = 1 << 20 // per log file
+	DefaultKeep     = 3       // rotated files kept besides the current one
+
+	backlogBytes = 64 << 10 // replayed to each new subscriber
+	subBuffer    = 256      // chunks a subscriber may fall behind by
+)
+
+// ErrClosed is returned by Subscribe once the log is closed.
+var ErrClosed = errors.New("console closed")
+
+// Log is one VM's console. It is an io.Writer for the Firecracker
+// process's stdout and stderr; writes never fail, so a full disk or a
+// slow reader cannot stall the VM.
+type Log struct {
+	path     string
+	maxBytes int64
+	keep     int
+
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	dropped int64 // bytes rotated out of the oldest file
+	err     error // first write error; the file is abandoned after it
+	backlog []byte
+	subs    map[chan []byte]struct{}
+	closed  bool
+}
+
+// Open creates the log at path, rotating files to path.1 .. path.keep as
+// each reaches maxBytes; a zero maxBytes takes the default.
+func Open(path string, maxBytes int64, keep int) (*Log, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	keep = max(keep, 0)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{
+		path:     path,
+		maxBytes: maxBytes,
+		keep:     keep,
+		f:        f,
+		subs:     make(map[chan []byte]struct{}),
+	}, nil
+}
+
+// Write records p and passes it to subscribers.
+func (l *Log) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed || len(p) == 0 {
+		return len(p), nil
+	}
+	l.writeFile(p)
+
+	l.backlog = append(l.backlog, p...)
+	if over := len(l.backlog) - backlogBytes; over > 0 {
+		l.backlog = append(l.backlog[:0], l.backlog[over:]...)
+	}
+	for ch := range l.subs {
+		select {
+		case ch <- append([]byte(nil), p...):
+		default:
+			// Fallen too far behind; its reader sees the channel close
+			delete(l.subs, ch)
+			close(ch)
+		}
+	}
+	return len(p), nil
+}
+
+func (l *Log) writeFile(p []byte) {
+	if l.err != nil {
+		return
+	}
+	for len(p) > 0 {
+		if l.size >= l.maxBytes {
+			if l.err = l.rotate(); l.err != nil {
+				return
+			}
+		}
+		n := int(min(int64(len(p)), l.maxBytes-l.size))
+		if _, l.err = l.f.Write(p[:n]); l.err != nil {
+			return
+		}
+		l.size += int64(n)
+		p = p[n:]
+	}
+}
+
+// rotate shifts path.N to path.N+1, dropping the oldest, and starts a new
+// current file.
+func (l *Log) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	if l.keep == 0 {
+		l.dropped += l.size
+	} else {
+		oldest := fmt.Sprintf("%s.%d", l.path, l.keep)
+		if info, err := os.Stat(oldest); err == nil {
+			l.dropped += info.Size()
+		}
+		for i := l.keep - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		}
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	l.f, l.size = f, 0
+	return nil
+}
+
+// Subscribe returns the recent backlog and a channel carrying everything
+// written after it. The channel is closed when the log closes or the
+// subscriber falls too far behind; cancel releases it early.
+func (l *Log) Subscribe() (backlog []byte, live <-chan []byte, cancel func(), err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, nil, nil, ErrClosed
+	}
+	ch := make(chan []byte, subBuffer)
+	l.subs[ch] = struct{}{}
+	cancel = func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if _, ok := l.subs[ch]; ok {
+			delete(l.subs, ch)
+			close(ch)
+		}
+	}
+	return append([]byte(nil), l.backlog...), ch, cancel, nil
+}
+
+// Closed reports whether the log is closed, which tells a subscriber
+// whose channel closed that the VM is gone rather than that it lagged.
+func (l *Log) Closed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
+
+// CopyTo writes the whole retained log to w, oldest first, preceded by a
+// note when earlier output was rotated out. It is meant for after the
+// VM has exited.
+func (l *Log) CopyTo(w io.Writer) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.dropped > 0 {
+		fmt.Fprintf(w, "[console: %d earlier bytes rotated out]\n", l.dropped)
+	}
+	for i := l.keep; i >= 0; i-- {
+		path := l.path
+		if i > 0 {
+			path = fmt.Sprintf("%s.%d", l.path, i)
+		}
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if l.err != nil {
+		fmt.Fprintf(w, "\n[console: recording stopped: %v]\n", l.err)
+	}
+	return nil
+}
+
+// Close ends every subscription and closes the file. Later writes are
+// discarded.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	for ch := range l.subs {
+		close(ch)
+	}
+	l.subs = nil
+	return l.f.Close()
+}
@@ -0,0 +1,400 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var db *gorm.DB
+
+// Job lifecycle states stored in Job.VMStatus
+const (
+	JobQueued    = "queued"
+	JobBooting   = "booting"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobTimedOut  = "timed_out"
+	JobCancelled = "cancelled"
+	JobRejected  = "rejected" // refused by the triage policy before boot
+	JobWaiting   = "waiting"  // unpacked; waiting on the jobs for its members
+)
+
+// Job represents a file upload and scan job in the database
+type Job struct {
+	ID               string                    `gorm:"primaryKey" json:"id"`
+	Hash             string                    `gorm:"index" json:"hash"` // SHA-256
+	MD5              string                    `gorm:"index" json:"md5,omitempty"`
+	SHA1             string                    `gorm:"index" json:"sha1,omitempty"`
+	SHA512           string                    `json:"sha512,omitempty"`
+	SSDeep           string                    `gorm:"column:ssdeep" json:"ssdeep,omitempty"`
+	TLSH             string                    `json:"tlsh,omitempty"`
+	FileName         string                    `json:"fileName"`
+	FileSize         int64                     `json:"fileSize"`
+	DiskPath         string                    `json:"diskPath"`
+	VMStatus         string                    `gorm:"index" json:"vmStatus"`
+	VMID             string                    `json:"vmID,omitempty"`
+	DiskBytesWritten int64                     `json:"diskBytesWritten,omitempty"` // image bytes written to prepare the VM
+	ScanResult       string                    `json:"scanResult"`
+	Error            string                    `json:"error,omitempty"`
+	TimeoutSec       int                       `json:"timeoutSeconds"`
+	Network          string                    `json:"network,omitempty"`               // guest network mode; "" is none
+	ParentID         string                    `gorm:"index" json:"parentID,omitempty"` // archive this file was unpacked from
+	RootID           string                    `gorm:"index" json:"rootID,omitempty"`   // the upload at the top of the tree
+	Depth            int                       `json:"depth,omitempty"`
+	Report           *domain.GuestReport       `gorm:"serializer:json" json:"report,omitempty"`
+	YaraMatches      []domain.YaraMatch        `gorm:"serializer:json" json:"yaraMatches,omitempty"`
+	NetworkHits      []domain.NetworkDetection `gorm:"serializer:json" json:"networkDetections,omitempty"`
+	Verdict          *domain.Verdict           `gorm:"serializer:json" json:"verdict,omitempty"`
+	Static           *domain.StaticReport      `gorm:"serializer:json" json:"static,omitempty"`
+	ArchiveVerdict   *domain.ArchiveVerdict    `gorm:"serializer:json" json:"archiveVerdict,omitempty"`
+	RulesVersion     string                    `json:"rulesVersion,omitempty"`
+	NetRulesVersion  string                    `json:"netRulesVersion,omitempty"`
+	CreatedAt        time.Time                 `gorm:"index" json:"createdAt"`
+	UpdatedAt        time.Time                 `json:"updatedAt"`
+	StartedAt        *time.Time                `json:"startedAt,omitempty"`
+	FinishedAt       *time.Time                `json:"finishedAt,omitempty"`
+}
+
+// IsTerminal reports whether state is a final job state
+func IsTerminal(state string) bool {
+	switch state {
+	case JobCompleted, JobFailed, JobTimedOut, JobCancelled, JobRejected:
+		return true
+	}
+	return false
+}
+
+// InitDatabase initializes the SQLite database with GORM
+func InitDatabase(dbPath string) error {
+	var err error
+
+	db, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent), // Reduce log noise
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	// Auto-migrate the schema
+	if err := db.AutoMigrate(&Job{}, &RuleVersion{}, &SampleVerdict{}, &RescanRun{}, &VerdictChange{}, &SimilarityKey{}, &UploadUsage{}); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	log.Printf("Database initialized: %s", dbPath)
+	return nil
+}
+
+// CreateJob creates a new job in the database
+func CreateJob(job *Job) error {
+	result := db.Create(job)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create job: %w", result.Error)
+	}
+	return nil
+}
+
+// GetJob retrieves a job by ID
+func GetJob(jobID string) (*Job, error) {
+	var job Job
+	result := db.First(&job, "id = ?", jobID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &job, nil
+}
+
+// UpdateJob updates an existing job
+func UpdateJob(job *Job) error {
+	result := db.Save(job)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update job: %w", result.Error)
+	}
+	return nil
+}
+
+// UpdateJobStatus updates specific fields of a job
+func UpdateJobStatus(jobID, vmStatus, scanResult string) error {
+	result := db.Model(&Job{}).Where("id = ?", jobID).Updates(map[string]interface{}{
+		"vm_status":   vmStatus,
+		"scan_result": scanResult,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update job status: %w", result.Error)
+	}
+	return nil
+}
+
+// SetJobState moves a job to state, stamping StartedAt on the first
+// non-queued state and FinishedAt on a terminal one. Jobs that already
+// reached a terminal state are left untouched.
+func SetJobState(jobID, state, errMsg string) error {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"vm_status": state,
+	}
+	if errMsg != "" {
+		updates["error"] = errMsg
+	}
+	if IsTerminal(state) {
+		updates["finished_at"] = now
+	}
+
+	result := db.Model(&Job{}).
+		Where("id = ? AND vm_status NOT IN ?", jobID, []string{JobCompleted, JobFailed, JobTimedOut, JobCancelled, JobRejected}).
+		Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update job state: %w", result.Error)
+	}
+
+	if state != JobQueued {
+		db.Model(&Job{}).Where("id = ? AND started_at IS NULL", jobID).Update("started_at", now)
+	}
+	return nil
+}
+
+// SetJobVM records which VM is running a job and the image bytes written
+// to prepare it
+func SetJobVM(jobID, vmID string, diskBytesWritten int64) error {
+	result := db.Model(&Job{ID: jobID}).Select("vm_id", "disk_bytes_written").Updates(&Job{
+		VMID:             vmID,
+		DiskBytesWritten: diskBytesWritten,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update job vm: %w", result.Error)
+	}
+	return nil
+}
+
+// SaveJobReport attaches the guest agent report to a job
+func SaveJobReport(jobID string, report *domain.GuestReport) error {
+	result := db.Model(&Job{ID: jobID}).Select("report").Updates(&Job{Report: report})
+	if result.Error != nil {
+		return fmt.Errorf("failed to save job report: %w", result.Error)
+	}
+	return nil
+}
+
+// SaveScanResult records the host-side YARA matches for a job, the rules
+// version they came from and the verdict computed from them; ScanResult
+// carries the verdict label
+func SaveScanResult(jobID, rulesVersion string, matches []domain.YaraMatch, verdict *domain.Verdict) error {
+	result := db.Model(&Job{ID: jobID}).Select("yara_matches", "verdict", "scan_result", "rules_version").Updates(&Job{
+		YaraMatches:  matches,
+		Verdict:      verdict,
+		ScanResult:   verdict.Verdict,
+		RulesVersion: rulesVersion,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to save scan result: %w", result.Error)
+	}
+	return nil
+}
+
+// SaveNetworkDetections records the network signature hits on a job's
+// traffic, the ruleset version they came from and the verdict with them
+// folded in; ScanResult carries its label
+func SaveNetworkDetections(jobID, rulesVersion string, hits []domain.NetworkDetection, verdict *domain.Verdict) error {
+	result := db.Model(&Job{ID: jobID}).Select("network_hits", "net_rules_version", "verdict", "scan_result").Updates(&Job{
+		NetworkHits:     hits,
+		NetRulesVersion: rulesVersion,
+		Verdict:         verdict,
+		ScanResult:      verdict.Verdict,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to save network detections: %w", result.Error)
+	}
+	return nil
+}
+
+// SaveStaticReport records a job's static triage
+func SaveStaticReport(jobID string, report *domain.StaticReport) error {
+	result := db.Model(&Job{ID: jobID}).Select("static").Updates(&Job{Static: report})
+	if result.Error != nil {
+		return fmt.Errorf("failed to save static report: %w", result.Error)
+	}
+	return nil
+}
+
+// SaveArchiveVerdict records the verdict aggregated over an archive's
+// children; ScanResult carries its label
+func SaveArchiveVerdict(jobID string, v *domain.ArchiveVerdict) error {
+	result := db.Model(&Job{ID: jobID}).Select("archive_verdict", "scan_result").Updates(&Job{
+		ArchiveVerdict: v,
+		ScanResult:     v.Verdict,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to save archive verdict: %w", result.Error)
+	}
+	return nil
+}
+
+// GetChildJobs returns the jobs for files unpacked from parentID
+func GetChildJobs(parentID string) ([]Job, error) {
+	var jobs []Job
+	result := db.Where("parent_id = ?", parentID).Order("created_at").Find(&jobs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return jobs, nil
+}
+
+// TreeUsage counts the files and bytes already unpacked under rootID
+func TreeUsage(rootID string) (files, bytes int64, err error) {
+	var usage struct {
+		Files int64
+		Bytes int64
+	}
+	result := db.Model(&Job{}).Select("COUNT(*) AS files, COALESCE(SUM(file_size), 0) AS bytes").
+		Where("root_id = ?", rootID).Scan(&usage)
+	if result.Error != nil {
+		return 0, 0, result.Error
+	}
+	return usage.Files, usage.Bytes, nil
+}
+
+// JobFilter narrows ListJobs; zero fields are ignored
+type JobFilter struct {
+	State    string
+	Parent   string
+	Hash     string
+	FileName string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+	Offset   int
+}
+
+// ListJobs returns one page of jobs matching f plus the total match count
+func ListJobs(f JobFilter) ([]Job, int64, error) {
+	q := db.Model(&Job{})
+	if f.State != "" {
+		q = q.Where("vm_status = ?", f.State)
+	}
+	if f.Parent != "" {
+		q = q.Where("parent_id = ?", f.Parent)
+	}
+	if f.Hash != "" {
+		q = q.Where("hash = ?", f.Hash)
+	}
+	if f.FileName != "" {
+		q = q.Where(`file_name LIKE ? ESCAPE '\'`, "%"+likeEscaper.Replace(f.FileName)+"%")
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("created_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		q = q.Where("created_at < ?", f.Until)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+
+	var jobs []Job
+	result := q.Order("created_at DESC").Limit(limit).Offset(f.Offset).Find(&jobs)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return jobs, total, nil
+}
+
+// likeEscaper makes LIKE treat %, _ and \ in search text literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// GetAllJobs retrieves all jobs from the database
+func GetAllJobs() ([]Job, error) {
+	var jobs []Job
+	result := db.Order("created_at DESC").Find(&jobs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return jobs, nil
+}
+
+// DeleteJob removes a job from the database
+func DeleteJob(jobID string) error {
+	result := db.Delete(&Job{}, "id = ?", jobID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete job: %w", result.Error)
+	}
+	return nil
+}
+
+// GetJobsByStatus retrieves jobs filtered by status
+func GetJobsByStatus(status string) ([]Job, error) {
+	var jobs []Job
+	result := db.Where("vm_status = ?", status).Order("created_at DESC").Find(&jobs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return jobs, nil
+}
+
+// GetJobsByHash retrieves jobs with a specific hash (detect duplicates)
+func GetJobsByHash(hash string) ([]Job, error) {
+	var jobs []Job
+	result := db.Where("hash = ?", hash).Order("created_at DESC").Find(&jobs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return jobs, nil
+}
+
+// GetRecentJobs retrieves the N most recent jobs
+func GetRecentJobs(limit int) ([]Job, error) {
+	var jobs []Job
+	result := db.Order("created_at DESC").Limit(limit).Find(&jobs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return jobs, nil
+}
+
+// JobStats returns statistics about jobs. The verdict counts go by the
+// label in ScanResult; MalwareDetected is malicious and critical together.
+type JobStats struct {
+	Total           int64 `json:"total"`
+	Clean           int64 `json:"clean"`
+	Suspicious      int64 `json:"suspicious"`
+	MalwareDetected int64 `json:"malwareDetected"`
+	Running         int64 `json:"running"`
+	Failed          int64 `json:"failed"`
+}
+
+// GetJobStats returns database statistics
+func GetJobStats() (*JobStats, error) {
+	stats := &JobStats{}
+	counts := []struct {
+		n     *int64
+		query string
+		args  []any
+	}{
+		{&stats.Total, "1 = 1", nil},
+		{&stats.Clean, "scan_result = ?", []any{domain.VerdictClean}},
+		{&stats.Suspicious, "scan_result = ?", []any{domain.VerdictSuspicious}},
+		{&stats.MalwareDetected, "scan_result IN ?", []any{[]string{domain.VerdictMalicious, domain.VerdictCritical}}},
+		{&stats.Running, "vm_status = ?", []any{JobRunning}},
+		{&stats.Failed, "vm_status = ?", []any{JobFailed}},
+	}
+	for _, c := range counts {
+		if err := db.Model(&Job{}).Where(c.query, c.args...).Count(c.n).Error; err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+func TestListJobsFileNameIsLiteral(t *testing.T) {
+	if err := InitDatabase(filepath.Join(t.TempDir(), "jobs.db")); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"100%.exe", "1000.exe", "a_b.dll", "axb.dll", `dir\x.bin`, "dirx.bin"} {
+		job := &Job{ID: name, Hash: string(rune('a' + i)), FileName: name, VMStatus: JobQueued}
+		if err := CreateJob(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		search string
+		want   []string
+	}{
+		{"%", []string{"100%.exe"}},
+		{"0%.", []string{"100%.exe"}},
+		{"_", []string{"a_b.dll"}},
+		{`\`, []string{`dir\x.bin`}},
+		{".DLL", []string{"a_b.dll", "axb.dll"}},
+	}
+	for _, tc := range tests {
+		jobs, total, err := ListJobs(JobFilter{FileName: tc.search})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, j := range jobs {
+			got = append(got, j.FileName)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tc.want) || total != int64(len(tc.want)) {
+			t.Errorf("search %q: got %v (total %d), want %v", tc.search, got, total, tc.want)
+		}
+	}
+}
+
+func TestGetJobStats(t *testing.T) {
+	if err := InitDatabase(filepath.Join(t.TempDir(), "jobs.db")); err != nil {
+		t.Fatal(err)
+	}
+	jobs := []struct{ state, verdict string }{
+		{JobCompleted, domain.VerdictClean},
+		{JobCompleted, domain.VerdictSuspicious},
+		{JobCompleted, domain.VerdictMalicious},
+		{JobRunning, domain.VerdictCritical},
+		{JobFailed, ""},
+	}
+	for i, j := range jobs {
+		job := &Job{ID: string(rune('a' + i)), VMStatus: j.state, ScanResult: j.verdict}
+		if err := CreateJob(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := GetJobStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := JobStats{Total: 5, Clean: 1, Suspicious: 1, MalwareDetected: 2, Running: 1, Failed: 1}
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+}
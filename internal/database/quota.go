@@ -0,0 +1,45 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UploadUsage is what one client uploaded on one UTC day
+type UploadUsage struct {
+	Client    string    `gorm:"primaryKey" json:"client"`
+	Day       string    `gorm:"primaryKey" json:"day"` // YYYY-MM-DD
+	Bytes     int64     `json:"bytes"`
+	Uploads   int       `json:"uploads"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// AddUploadUsage charges n bytes and one upload to client's day
+func AddUploadUsage(client, day string, n int64) error {
+	usage := &UploadUsage{Client: client, Day: day, Bytes: n, Uploads: 1}
+	result := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "client"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"bytes":      gorm.Expr("bytes + ?", n),
+			"uploads":    gorm.Expr("uploads + 1"),
+			"updated_at": time.Now(),
+		}),
+	}).Create(usage)
+	if result.Error != nil {
+		return fmt.Errorf("failed to record upload usage: %w", result.Error)
+	}
+	return nil
+}
+
+// UploadUsageBytes returns the bytes client uploaded on day
+func UploadUsageBytes(client, day string) (int64, error) {
+	var usage UploadUsage
+	result := db.Where("client = ? AND day = ?", client, day).Limit(1).Find(&usage)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return usage.Bytes, nil
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+// RuleVersion is a snapshot of the enabled YARA rulesets. ID is the
+// scanner's content hash, so returning to an earlier set of rules reuses
+// that version rather than creating a new one.
+type RuleVersion struct {
+	ID        string               `gorm:"primaryKey" json:"id"`
+	Change    string               `json:"change"`
+	Rulesets  []domain.YaraRuleset `gorm:"serializer:json" json:"rulesets,omitempty"`
+	CreatedAt time.Time            `gorm:"index" json:"createdAt"`
+}
+
+// RecordRuleVersion stores v unless a version with the same ID exists
+func RecordRuleVersion(v *RuleVersion) error {
+	result := db.Where(RuleVersion{ID: v.ID}).FirstOrCreate(v)
+	if result.Error != nil {
+		return fmt.Errorf("failed to record rule version: %w", result.Error)
+	}
+	return nil
+}
+
+// GetRuleVersion retrieves a rule version with its sources
+func GetRuleVersion(id string) (*RuleVersion, error) {
+	var v RuleVersion
+	result := db.First(&v, "id = ?", id)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get rule version: %w", result.Error)
+	}
+	return &v, nil
+}
+
+// ListRuleVersions returns versions newest first, without their sources
+func ListRuleVersions(limit int) ([]RuleVersion, error) {
+	var versions []RuleVersion
+	result := db.Omit("rulesets").Order("created_at DESC").Limit(limit).Find(&versions)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list rule versions: %w", result.Error)
+	}
+	return versions, nil
+}
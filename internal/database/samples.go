@@ -0,0 +1,157 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+	"gorm.io/gorm/clause"
+)
+
+// Rescan run states
+const (
+	RescanRunning     = "running"
+	RescanCompleted   = "completed"
+	RescanInterrupted = "interrupted" // the process stopped mid-run
+)
+
+// SampleVerdict is the latest host-side scan of a stored sample
+type SampleVerdict struct {
+	Hash         string          `gorm:"primaryKey" json:"hash"`
+	RulesVersion string          `gorm:"index" json:"rulesVersion"`
+	Verdict      *domain.Verdict `gorm:"serializer:json" json:"verdict"`
+	Rules        []string        `gorm:"serializer:json" json:"rules"` // every matched rule
+	ScannedAt    time.Time       `json:"scannedAt"`
+}
+
+// RescanRun is one pass of the current rules over the sample store.
+// RulesVersion is the version loaded when the run started; each sample is
+// scanned with whatever is loaded when its turn comes.
+type RescanRun struct {
+	ID           string     `gorm:"primaryKey" json:"id"`
+	RulesVersion string     `json:"rulesVersion"`
+	State        string     `gorm:"index" json:"state"`
+	Force        bool       `json:"force"`
+	Total        int        `json:"total"`
+	Scanned      int        `json:"scanned"`
+	Skipped      int        `json:"skipped"`
+	Changed      int        `json:"changed"`
+	Failed       int        `json:"failed"`
+	StartedAt    time.Time  `gorm:"index" json:"startedAt"`
+	FinishedAt   *time.Time `json:"finishedAt,omitempty"`
+}
+
+// VerdictChange is a sample whose result differs from its prior scan
+type VerdictChange struct {
+	ID               uint      `gorm:"primaryKey" json:"-"`
+	RunID            string    `gorm:"index" json:"runID"`
+	Hash             string    `gorm:"index" json:"hash"`
+	PrevRulesVersion string    `json:"prevRulesVersion"`
+	PrevVerdict      string    `json:"prevVerdict"`
+	PrevScore        int       `json:"prevScore"`
+	NewRulesVersion  string    `json:"newRulesVersion"`
+	NewVerdict       string    `json:"newVerdict"`
+	NewScore         int       `json:"newScore"`
+	AddedRules       []string  `gorm:"serializer:json" json:"addedRules"`
+	RemovedRules     []string  `gorm:"serializer:json" json:"removedRules"`
+	VerdictChanged   bool      `json:"verdictChanged"`
+	CreatedAt        time.Time `json:"createdAt"`
+}
+
+// SaveSampleVerdict replaces the latest scan for a sample
+func SaveSampleVerdict(v *SampleVerdict) error {
+	result := db.Clauses(clause.OnConflict{UpdateAll: true}).Create(v)
+	if result.Error != nil {
+		return fmt.Errorf("failed to save sample verdict: %w", result.Error)
+	}
+	return nil
+}
+
+// GetSampleVerdict retrieves the latest scan for a sample
+func GetSampleVerdict(hash string) (*SampleVerdict, error) {
+	var v SampleVerdict
+	result := db.First(&v, "hash = ?", hash)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &v, nil
+}
+
+// CreateRescanRun records the start of a rescan
+func CreateRescanRun(run *RescanRun) error {
+	result := db.Create(run)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create rescan run: %w", result.Error)
+	}
+	return nil
+}
+
+// SaveRescanRun stores a rescan run's progress
+func SaveRescanRun(run *RescanRun) error {
+	result := db.Save(run)
+	if result.Error != nil {
+		return fmt.Errorf("failed to save rescan run: %w", result.Error)
+	}
+	return nil
+}
+
+// InterruptRescanRuns marks runs left running by a previous process as
+// interrupted, since nothing will finish them
+func InterruptRescanRuns() (int64, error) {
+	result := db.Model(&RescanRun{}).Where("state = ?", RescanRunning).
+		Updates(map[string]interface{}{"state": RescanInterrupted, "finished_at": time.Now()})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to interrupt rescan runs: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// GetRescanRun retrieves a rescan run
+func GetRescanRun(id string) (*RescanRun, error) {
+	var run RescanRun
+	result := db.First(&run, "id = ?", id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &run, nil
+}
+
+// ListRescanRuns returns runs newest first
+func ListRescanRuns(limit int) ([]RescanRun, error) {
+	var runs []RescanRun
+	result := db.Order("started_at DESC").Limit(limit).Find(&runs)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list rescan runs: %w", result.Error)
+	}
+	return runs, nil
+}
+
+// AddVerdictChange records one diff found by a rescan
+func AddVerdictChange(c *VerdictChange) error {
+	result := db.Create(c)
+	if result.Error != nil {
+		return fmt.Errorf("failed to record verdict change: %w", result.Error)
+	}
+	return nil
+}
+
+// ListVerdictChanges returns the diffs found by a rescan run
+func ListVerdictChanges(runID string) ([]VerdictChange, error) {
+	var changes []VerdictChange
+	result := db.Where("run_id = ?", runID).Order("id").Find(&changes)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list verdict changes: %w", result.Error)
+	}
+	return changes, nil
+}
+
+// LatestJobVerdict returns the newest job for hash that has a verdict,
+// for samples scanned before SampleVerdict existed
+func LatestJobVerdict(hash string) (*Job, error) {
+	var job Job
+	result := db.Where("hash = ? AND verdict IS NOT NULL", hash).Order("created_at DESC").First(&job)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &job, nil
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"fmt"
+
+	"gorm.io/gorm/clause"
+)
+
+// SimilarityKey links a sample to one fuzzy-hash feature. Samples sharing
+// a key are candidates for an exact ssdeep/TLSH comparison, so a search
+// only scores rows found through the key index rather than every job.
+type SimilarityKey struct {
+	Key  string `gorm:"primaryKey" json:"key"`
+	Hash string `gorm:"primaryKey;index" json:"hash"`
+}
+
+// SimilarityCandidate is a sample sharing Shared keys with the query
+type SimilarityCandidate struct {
+	Hash   string
+	Shared int
+}
+
+// IndexSimilarity stores the keys for a sample; keys it already has are kept
+func IndexSimilarity(hash string, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	rows := make([]SimilarityKey, len(keys))
+	for i, k := range keys {
+		rows[i] = SimilarityKey{Key: k, Hash: hash}
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(rows, 200)
+	if result.Error != nil {
+		return fmt.Errorf("failed to index sample %s: %w", hash, result.Error)
+	}
+	return nil
+}
+
+// SimilarityCandidates returns the samples, other than exclude, sharing the
+// most keys with the query
+func SimilarityCandidates(keys []string, exclude string, limit int) ([]SimilarityCandidate, error) {
+	var candidates []SimilarityCandidate
+	if len(keys) == 0 {
+		return candidates, nil
+	}
+	result := db.Model(&SimilarityKey{}).
+		Select("hash, COUNT(*) AS shared").
+		Where("key IN ? AND hash <> ?", keys, exclude).
+		Group("hash").
+		Order("shared DESC").
+		Limit(limit).
+		Scan(&candidates)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find similar samples: %w", result.Error)
+	}
+	return candidates, nil
+}
+
+// LatestJobs returns the newest job for each hash that has one
+func LatestJobs(hashes []string) (map[string]Job, error) {
+	latest := make(map[string]Job, len(hashes))
+	if len(hashes) == 0 {
+		return latest, nil
+	}
+	var jobs []Job
+	result := db.Where("hash IN ?", hashes).Order("created_at DESC").Find(&jobs)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get jobs: %w", result.Error)
+	}
+	for _, job := range jobs {
+		if _, ok := latest[job.Hash]; !ok {
+			latest[job.Hash] = job
+		}
+	}
+	return latest, nil
+}
+
+// UnindexedJobs returns up to limit jobs with fuzzy hashes whose sample has
+// no similarity keys yet, one per sample
+func UnindexedJobs(limit int) ([]Job, error) {
+	var jobs []Job
+	result := db.Where("ssdeep <> '' AND hash NOT IN (?)", db.Model(&SimilarityKey{}).Select("hash")).
+		Group("hash").
+		Limit(limit).
+		Find(&jobs)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list unindexed jobs: %w", result.Error)
+	}
+	return jobs, nil
+}
@@ -0,0 +1,27 @@
+package domain
+
+// Execution modes in an ExecPlan.
+const (
+	ExecScan = "scan" // inspect the file without running it
+	ExecRun  = "run"  // execute the file directly
+)
+
+// ExecPlan tells the guest agent what to do with the upload.
+type ExecPlan struct {
+	Mode   string `json:"mode"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// GuestMetadata is the document a guest reads from the Firecracker
+// metadata service (MMDS). It describes only the VM's own job; Token is
+// the one secret in it, valid for this VM's result channel alone.
+type GuestMetadata struct {
+	JobID          string   `json:"jobID,omitempty"` // empty until a pooled VM is given a job
+	FileName       string   `json:"fileName,omitempty"`
+	SHA256         string   `json:"sha256,omitempty"`
+	InputDrive     string   `json:"inputDrive"`
+	Exec           ExecPlan `json:"exec"`
+	TimeoutSeconds int      `json:"timeoutSeconds"`
+	ResultPort     uint32   `json:"resultPort"` // vsock port on the host (CID 2)
+	Token          string   `json:"token"`      // sent back in the agent's hello
+}
@@ -0,0 +1,74 @@
+package domain
+
+import "time"
+
+// NetworkReport is what the host saw on a networked guest's TAP, parsed
+// from the job's packet capture after the VM exited.
+type NetworkReport struct {
+	Capture   string        `json:"capture"` // artifact name of the pcapng
+	Packets   int           `json:"packets"`
+	Bytes     int64         `json:"bytes"`
+	Truncated bool          `json:"truncated,omitempty"` // the capture hit its size cap
+	DNS       []DNSQuery    `json:"dns,omitempty"`
+	HTTP      []HTTPRequest `json:"http,omitempty"`
+	TLS       []TLSHello    `json:"tls,omitempty"`
+	Contacts  []Contact     `json:"contacts,omitempty"`
+	Error     string        `json:"error,omitempty"` // parsing stopped early
+}
+
+type DNSQuery struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+}
+
+type HTTPRequest struct {
+	Method    string    `json:"method"`
+	Host      string    `json:"host"`
+	URL       string    `json:"url"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	Dst       string    `json:"dst"` // IP:port
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+}
+
+// TLSHello is a ClientHello. JA3 is the fingerprint string and JA3Hash its
+// MD5, as most threat feeds list it.
+type TLSHello struct {
+	SNI       string    `json:"sni,omitempty"`
+	Version   string    `json:"version"`
+	JA3       string    `json:"ja3"`
+	JA3Hash   string    `json:"ja3Hash"`
+	Dst       string    `json:"dst"` // IP:port
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+}
+
+// Contact is an address the guest opened connections or sent datagrams to.
+type Contact struct {
+	Protocol  string    `json:"protocol"` // tcp or udp
+	IP        string    `json:"ip"`
+	Port      int       `json:"port"`
+	Flows     int       `json:"flows"`
+	Packets   int       `json:"packets"`
+	Bytes     int64     `json:"bytes"` // both directions
+	FirstSeen time.Time `json:"firstSeen"`
+}
+
+// NetworkDetection is a network signature that fired on a job's traffic,
+// counted once per rule and destination.
+type NetworkDetection struct {
+	Rule      string    `json:"rule"` // the rule's msg
+	SID       int       `json:"sid"`
+	Rev       int       `json:"rev,omitempty"`
+	Severity  string    `json:"severity"`
+	Classtype string    `json:"classtype,omitempty"`
+	File      string    `json:"file"` // rules file it came from
+	Protocol  string    `json:"protocol"`
+	Src       string    `json:"src"` // IP:port of the guest side
+	Dst       string    `json:"dst"`
+	Evidence  string    `json:"evidence,omitempty"` // the buffer value matched, e.g. "dns.query: evil.example"
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+}
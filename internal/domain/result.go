@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Message types carried over the vsock result channel. The agent opens the
+// connection and says hello; the host answers with start once the job's
+// input drive is attached. Everything else flows guest to host.
+const (
+	MsgHello     = "hello"
+	MsgStart     = "start"
+	MsgProgress  = "progress"
+	MsgDetection = "detection"
+	MsgFile      = "file"
+	MsgExit      = "exit"
+)
+
+// GuestMessage is one newline-delimited JSON frame sent by the in-guest agent.
+// Data holds one of the payload types below, selected by Type.
+type GuestMessage struct {
+	Version int             `json:"version"`
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+type GuestHello struct {
+	AgentVersion string `json:"agentVersion"`
+	Token        string `json:"token,omitempty"` // GuestMetadata.Token, when the VM has one
+}
+
+type GuestStart struct {
+	JobID      string `json:"jobID"`
+	InputDrive string `json:"inputDrive"` // Firecracker drive ID to scan
+}
+
+type GuestProgress struct {
+	Stage   string `json:"stage"`
+	Percent int    `json:"percent"`
+	Message string `json:"message,omitempty"`
+}
+
+type GuestDetection struct {
+	Engine      string `json:"engine"`
+	Name        string `json:"name"`
+	Severity    string `json:"severity,omitempty"`
+	Path        string `json:"path,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type GuestFile struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Mode     string `json:"mode,omitempty"`
+	SHA256   string `json:"sha256,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+type GuestExit struct {
+	Code  int    `json:"code"`
+	Error string `json:"error,omitempty"`
+}
+
+// GuestReport is everything the host learned from one VM's agent.
+type GuestReport struct {
+	ProtocolVersion int              `json:"protocolVersion"`
+	AgentVersion    string           `json:"agentVersion,omitempty"`
+	Progress        []GuestProgress  `json:"progress"`
+	Detections      []GuestDetection `json:"detections"`
+	Files           []GuestFile      `json:"files"`
+	Exit            *GuestExit       `json:"exit,omitempty"`
+	Errors          []string         `json:"errors,omitempty"`
+	Truncated       bool             `json:"truncated,omitempty"` // entries past a per-list cap were dropped
+	StartedAt       time.Time        `json:"startedAt"`
+	FinishedAt      time.Time        `json:"finishedAt,omitempty"`
+
+	// Network is filled in on the host from the TAP capture, for jobs
+	// that ran with a network.
+	Network *NetworkReport `json:"network,omitempty"`
+}
@@ -0,0 +1,90 @@
+package domain
+
+import "time"
+
+// Triage decisions taken after static analysis
+const (
+	TriageAnalyze = "analyze" // boot a sandbox VM as usual
+	TriageSkip    = "skip"    // trivially benign; finished without a VM
+	TriageReject  = "reject"  // outside the upload policy
+)
+
+// StaticReport is what the host learned about a file without running it.
+type StaticReport struct {
+	FileType   FileType        `json:"fileType"`
+	Size       int64           `json:"size"`
+	Entropy    float64         `json:"entropy"`
+	Executable *ExecutableInfo `json:"executable,omitempty"`
+	Archive    *ArchiveInfo    `json:"archive,omitempty"`
+	Extraction *Extraction     `json:"extraction,omitempty"`
+	URLs       []string        `json:"urls,omitempty"`
+	IPs        []string        `json:"ips,omitempty"`
+	Decision   string          `json:"decision"`
+	Reason     string          `json:"reason,omitempty"`
+	Errors     []string        `json:"errors,omitempty"` // analyzers that failed
+	AnalyzedAt time.Time       `json:"analyzedAt"`
+}
+
+// FileType is detected from magic bytes, not the upload's name.
+type FileType struct {
+	Kind        string `json:"kind"` // short name, e.g. "pe", "zip", "png"
+	Description string `json:"description"`
+	MIME        string `json:"mime"`
+}
+
+// ExecutableInfo covers PE, ELF and Mach-O headers. Imports are
+// "library!symbol" where the format records the library.
+type ExecutableInfo struct {
+	Format      string     `json:"format"` // pe, elf or macho
+	Arch        string     `json:"arch"`   // ELF machine name in every format, e.g. x86_64
+	Type        string     `json:"type"`   // e.g. exe, dll, shared object
+	Bits        int        `json:"bits"`
+	EntryPoint  uint64     `json:"entryPoint,omitempty"`
+	Timestamp   *time.Time `json:"timestamp,omitempty"` // PE link time
+	Interpreter string     `json:"interpreter,omitempty"`
+	Stripped    bool       `json:"stripped,omitempty"`
+	Sections    []Section  `json:"sections"`
+	Libraries   []string   `json:"libraries,omitempty"`
+	Imports     []string   `json:"imports,omitempty"`
+	Universal   []string   `json:"universal,omitempty"` // every arch in a fat Mach-O
+	Overlay     int64      `json:"overlay,omitempty"`   // bytes after the last section
+	Anomalies   []string   `json:"anomalies,omitempty"`
+}
+
+type Section struct {
+	Name        string  `json:"name"`
+	Size        uint64  `json:"size"`
+	VirtualSize uint64  `json:"virtualSize,omitempty"`
+	Entropy     float64 `json:"entropy"`
+	Flags       string  `json:"flags,omitempty"` // r, w, x
+}
+
+type ArchiveInfo struct {
+	Format    string         `json:"format"`
+	Entries   []ArchiveEntry `json:"entries"`
+	Truncated bool           `json:"truncated,omitempty"` // more entries than listed
+	Encrypted bool           `json:"encrypted,omitempty"` // any entry is
+}
+
+type ArchiveEntry struct {
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	Compressed int64  `json:"compressed,omitempty"`
+	Dir        bool   `json:"dir,omitempty"`
+	Encrypted  bool   `json:"encrypted,omitempty"`
+}
+
+// Extraction records an archive being unpacked into child jobs.
+type Extraction struct {
+	Format   string   `json:"format"`
+	Members  int      `json:"members"`
+	Bytes    int64    `json:"bytes"`
+	Password string   `json:"password,omitempty"` // the one that opened it
+	Skipped  []string `json:"skipped,omitempty"`
+	Stopped  string   `json:"stopped,omitempty"` // limit that cut it short
+	Error    string   `json:"error,omitempty"`
+
+	// NotQueued counts members recorded as child jobs that the scheduler
+	// refused; those children are failed.
+	NotQueued int `json:"notQueued,omitempty"`
+}
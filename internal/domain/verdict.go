@@ -0,0 +1,44 @@
+package domain
+
+import "time"
+
+// Verdict labels, in increasing order of severity.
+const (
+	VerdictClean      = "clean"
+	VerdictSuspicious = "suspicious"
+	VerdictMalicious  = "malicious"
+	VerdictCritical   = "critical"
+)
+
+// Verdict is the aggregate judgement over a sample's YARA matches.
+type Verdict struct {
+	Verdict    string       `json:"verdict"`
+	Score      int          `json:"score"` // 0-100
+	Matches    int          `json:"matches"`
+	Rules      []RuleWeight `json:"rules"` // every matched rule, highest score first
+	ComputedAt time.Time    `json:"computedAt"`
+}
+
+// RuleWeight is one matched rule's parsed meta and what it contributed.
+type RuleWeight struct {
+	Rule        string   `json:"rule"`
+	Namespace   string   `json:"namespace,omitempty"`
+	Severity    string   `json:"severity"`
+	Description string   `json:"description,omitempty"`
+	Author      string   `json:"author,omitempty"`
+	References  []string `json:"references,omitempty"`
+	MitreAttack []string `json:"mitreAttack,omitempty"`
+	Score       int      `json:"score"`
+}
+
+// ArchiveVerdict rolls an archive's own verdict up with those of the files
+// unpacked from it, nested archives included.
+type ArchiveVerdict struct {
+	Verdict  string    `json:"verdict"` // the worst in the tree
+	Score    int       `json:"score"`
+	Children int       `json:"children"`
+	Pending  int       `json:"pending"`           // children not yet finished
+	Failed   int       `json:"failed,omitempty"`  // children that finished without a full analysis
+	Flagged  []string  `json:"flagged,omitempty"` // child job IDs not clean
+	Updated  time.Time `json:"updatedAt"`
+}
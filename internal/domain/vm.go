@@ -1,10 +1,63 @@
-package domain
-
-import "os/exec"
-
-type VM struct {
-	ID      string
-	Cmd     *exec.Cmd
-	APISock string
-	TapName string
-}
+package domain
+
+import (
+	"io"
+	"os/exec"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/console"
+)
+
+type VM struct {
+	ID      string
+	Cmd     *exec.Cmd
+	APISock string
+	TapName string
+	Dir     string // per-VM working directory (the chroot root when jailed)
+
+	// Console records the Firecracker process's output, the guest's
+	// serial console included, under Dir.
+	Console *console.Log
+
+	// DiskBytesWritten counts image bytes actually written while preparing
+	// Dir; shared and reflinked images contribute nothing.
+	DiskBytesWritten int64
+
+	// Overlays are the copy-on-write drives to remove on teardown.
+	Overlays []Overlay
+
+	// Done is closed after the Firecracker process exits and the host side
+	// has been cleaned up; Report and TimedOut are final from then on.
+	Done     chan struct{}
+	Report   *GuestReport
+	Deadline time.Time
+	TimedOut bool
+
+	// Guest networking; Network is empty when the VM has no network
+	// device. Responder is the fake internet behind its TAP and Capture
+	// records the TAP to CapturePath, which outlives the VM.
+	Network     string
+	GuestMAC    string
+	Responder   io.Closer
+	Capture     io.Closer
+	CapturePath string
+
+	// AgentToken is the secret in the VM's metadata document; its agent
+	// must present it before the result channel accepts anything.
+	AgentToken string
+
+	// Jailer state; zero values when Firecracker runs unjailed.
+	Jailed bool
+	UID    int
+	GID    int
+	NetNS  string
+	Mounts []string // bind mounts inside Dir to release on teardown
+}
+
+// Overlay is a device-mapper snapshot standing in for a private copy of
+// one of the VM's images.
+type Overlay struct {
+	Name    string // device-mapper name, under /dev/mapper
+	Base    string // image the snapshot reads through
+	COWLoop string // loop device over the copy-on-write file
+}
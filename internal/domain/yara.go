@@ -0,0 +1,25 @@
+package domain
+
+// YaraMatch is one YARA rule that matched a sample, with the rule's meta
+// exactly as written. Meta values are strings, int64s or bools.
+type YaraMatch struct {
+	Rule      string         `json:"rule"`
+	Namespace string         `json:"namespace"`
+	Tags      []string       `json:"tags"`
+	Meta      map[string]any `json:"meta"`
+	Strings   []YaraString   `json:"strings"`
+}
+
+// YaraString is one occurrence of a rule string in the sample.
+type YaraString struct {
+	Identifier string `json:"identifier"`
+	Offset     uint64 `json:"offset"`
+	Data       []byte `json:"data"`
+}
+
+// YaraRuleset is one rule file as it stood in a ruleset version.
+type YaraRuleset struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Source string `json:"source"`
+}
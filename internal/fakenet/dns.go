@@ -0,0 +1,169 @@
+package fakenet
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+)
+
+const (
+	dnsTypeA   = 1
+	dnsTypeMX  = 15
+	dnsTypeTXT = 16
+	dnsClassIN = 1
+	dnsTTL     = 300
+
+	dnsRcodeFormErr = 1
+	dnsRcodeNotImp  = 4
+)
+
+var errDNSMalformed = errors.New("malformed DNS message")
+
+// dnsQuestion is the first question of a query; fakenet answers no more.
+type dnsQuestion struct {
+	name  string
+	qtype uint16
+	class uint16
+	raw   []byte // the question as it appeared on the wire
+}
+
+func parseQuestion(msg []byte) (*dnsQuestion, error) {
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg[4:]) == 0 {
+		return nil, errDNSMalformed
+	}
+	var labels []string
+	off := 12
+	for {
+		if off >= len(msg) {
+			return nil, errDNSMalformed
+		}
+		n := int(msg[off])
+		off++
+		if n == 0 {
+			break
+		}
+		if n&0xc0 != 0 || off+n > len(msg) {
+			return nil, errDNSMalformed // queries never compress the question
+		}
+		labels = append(labels, string(msg[off:off+n]))
+		off += n
+	}
+	if off+4 > len(msg) {
+		return nil, errDNSMalformed
+	}
+	return &dnsQuestion{
+		name:  strings.ToLower(strings.Join(labels, ".")),
+		qtype: binary.BigEndian.Uint16(msg[off:]),
+		class: binary.BigEndian.Uint16(msg[off+2:]),
+		raw:   msg[12 : off+4],
+	}, nil
+}
+
+// answerDNS builds the reply to query: A records get the sinkhole, MX
+// points at a mail host under the same name, TXT gets an empty string and
+// everything else an empty NOERROR.
+func (r *Responder) answerDNS(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	flags := binary.BigEndian.Uint16(query[2:])
+	if flags&0x8000 != 0 {
+		return nil // a response, not a query
+	}
+	reply := make([]byte, 12, 512)
+	copy(reply, query[:2])
+	// QR, the query's opcode and RD, then AA and RA
+	binary.BigEndian.PutUint16(reply[2:], 0x8000|flags&0x7900|0x0400|0x0080)
+
+	if opcode := flags >> 11 & 0xf; opcode != 0 {
+		reply[3] |= dnsRcodeNotImp
+		return reply
+	}
+	q, err := parseQuestion(query)
+	if err != nil {
+		reply[3] |= dnsRcodeFormErr
+		return reply
+	}
+	binary.BigEndian.PutUint16(reply[4:], 1)
+	reply = append(reply, q.raw...)
+
+	var rdata []byte
+	rtype := q.qtype
+	switch q.qtype {
+	case dnsTypeA:
+		rdata = r.cfg.SinkholeIP.To4()
+	case dnsTypeMX:
+		rdata = binary.BigEndian.AppendUint16(nil, 10)
+		rdata = appendName(rdata, "mail."+q.name)
+	case dnsTypeTXT:
+		rdata = []byte{0}
+	}
+	if rdata == nil || q.class != dnsClassIN {
+		return reply
+	}
+
+	binary.BigEndian.PutUint16(reply[6:], 1)
+	reply = append(reply, 0xc0, 12) // pointer to the question's name
+	reply = binary.BigEndian.AppendUint16(reply, rtype)
+	reply = binary.BigEndian.AppendUint16(reply, dnsClassIN)
+	reply = binary.BigEndian.AppendUint32(reply, dnsTTL)
+	reply = binary.BigEndian.AppendUint16(reply, uint16(len(rdata)))
+	return append(reply, rdata...)
+}
+
+func appendName(b []byte, name string) []byte {
+	for _, label := range strings.Split(strings.Trim(name, "."), ".") {
+		if label == "" || len(label) > 63 {
+			continue
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// serveDNSPackets answers DNS over UDP. Replies leave from the address the
+// query was sent to, so a guest asking 8.8.8.8 hears back from 8.8.8.8.
+func (r *Responder) serveDNSPackets(pc *net.UDPConn) {
+	defer r.wg.Done()
+	keepDst := enableDstAddr(pc) == nil
+	buf := make([]byte, 1500)
+	oob := make([]byte, 256)
+	for {
+		n, oobn, _, addr, err := pc.ReadMsgUDP(buf, oob)
+		if err != nil {
+			return
+		}
+		reply := r.answerDNS(buf[:n])
+		if reply == nil {
+			continue
+		}
+		var src []byte
+		if keepDst {
+			src = replyFrom(oob[:oobn])
+		}
+		pc.WriteMsgUDP(reply, src, addr)
+	}
+}
+
+// serveDNSStream answers DNS over TCP, where each message carries a
+// two-byte length prefix.
+func (r *Responder) serveDNSStream(c net.Conn) {
+	for {
+		var size [2]byte
+		if _, err := io.ReadFull(c, size[:]); err != nil {
+			return
+		}
+		msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(c, msg); err != nil {
+			return
+		}
+		reply := r.answerDNS(msg)
+		if reply == nil {
+			return
+		}
+		c.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(reply))), reply...))
+	}
+}
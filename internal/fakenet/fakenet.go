@@ -0,0 +1,200 @@
+// Package fakenet is a simulated internet for sandbox guests: every DNS
+// name resolves to a sinkhole address and common services answer with
+// canned responses, so samples that phone home see something plausible
+// without any route to the real network.
+package fakenet
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/netns"
+)
+
+const (
+	connTimeout  = 60 * time.Second // per connection, idle or not
+	maxLineBytes = 4096
+)
+
+// Config selects what the responder answers with.
+type Config struct {
+	// SinkholeIP is the answer to every A query.
+	SinkholeIP net.IP
+
+	// Hostname is the name services introduce themselves with.
+	Hostname string
+
+	// Addr is the address listeners bind to; "" binds every address, which
+	// together with an AnyIP route answers connections to any IP.
+	Addr string
+}
+
+// Ports each service listens on.
+var (
+	DNSPorts   = []int{53}
+	HTTPPorts  = []int{80, 8080}
+	HTTPSPorts = []int{443, 8443}
+	SMTPPorts  = []int{25, 587}
+	IRCPorts   = []int{6667}
+)
+
+// Responder is a running fake internet. Close stops every listener and
+// open connection.
+type Responder struct {
+	cfg Config
+
+	mu        sync.Mutex
+	closed    bool
+	listeners []net.Listener
+	packets   []net.PacketConn
+	servers   []*http.Server
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+}
+
+// Start opens every listener inside the network namespace at netnsPath,
+// or in the current one when netnsPath is "". Sockets stay in the
+// namespace they were created in, so only the setup runs there.
+func Start(cfg Config, netnsPath string) (*Responder, error) {
+	if cfg.SinkholeIP == nil {
+		return nil, errors.New("fakenet: no sinkhole IP")
+	}
+	if cfg.Hostname == "" {
+		cfg.Hostname = "mail.example.com"
+	}
+	r := &Responder{cfg: cfg, conns: make(map[net.Conn]struct{})}
+
+	err := netns.Do(netnsPath, r.listen)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Responder) listen() error {
+	tcp := func(ports []int, serve func(net.Conn)) error {
+		for _, port := range ports {
+			l, err := net.Listen("tcp4", net.JoinHostPort(r.cfg.Addr, fmt.Sprint(port)))
+			if err != nil {
+				return fmt.Errorf("fakenet: %w", err)
+			}
+			r.listeners = append(r.listeners, l)
+			r.wg.Add(1)
+			go r.accept(l, serve)
+		}
+		return nil
+	}
+
+	for _, port := range DNSPorts {
+		addr, err := net.ResolveUDPAddr("udp4", net.JoinHostPort(r.cfg.Addr, fmt.Sprint(port)))
+		if err != nil {
+			return fmt.Errorf("fakenet: %w", err)
+		}
+		pc, err := net.ListenUDP("udp4", addr)
+		if err != nil {
+			return fmt.Errorf("fakenet: %w", err)
+		}
+		r.packets = append(r.packets, pc)
+		r.wg.Add(1)
+		go r.serveDNSPackets(pc)
+	}
+	tlsConfig := &tls.Config{GetCertificate: certificateFor}
+	steps := []error{
+		tcp(DNSPorts, r.serveDNSStream),
+		r.http(HTTPPorts, nil),
+		r.http(HTTPSPorts, tlsConfig),
+		tcp(SMTPPorts, r.serveSMTP),
+		tcp(IRCPorts, r.serveIRC),
+	}
+	return errors.Join(steps...)
+}
+
+func (r *Responder) http(ports []int, tlsConfig *tls.Config) error {
+	for _, port := range ports {
+		l, err := net.Listen("tcp4", net.JoinHostPort(r.cfg.Addr, fmt.Sprint(port)))
+		if err != nil {
+			return fmt.Errorf("fakenet: %w", err)
+		}
+		if tlsConfig != nil {
+			l = tls.NewListener(l, tlsConfig)
+		}
+		srv := newHTTPServer()
+		r.servers = append(r.servers, srv)
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			srv.Serve(l)
+		}()
+	}
+	return nil
+}
+
+func (r *Responder) accept(l net.Listener, serve func(net.Conn)) {
+	defer r.wg.Done()
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		if !r.track(c) {
+			c.Close()
+			return
+		}
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			defer r.untrack(c)
+			c.SetDeadline(time.Now().Add(connTimeout))
+			serve(c)
+		}()
+	}
+}
+
+func (r *Responder) track(c net.Conn) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	r.conns[c] = struct{}{}
+	return true
+}
+
+func (r *Responder) untrack(c net.Conn) {
+	c.Close()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns, c)
+}
+
+// Close stops the responder and waits for its goroutines to finish.
+func (r *Responder) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	for _, l := range r.listeners {
+		l.Close()
+	}
+	for _, pc := range r.packets {
+		pc.Close()
+	}
+	for _, srv := range r.servers {
+		srv.Close()
+	}
+	for c := range r.conns {
+		c.Close()
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	return nil
+}
@@ -0,0 +1,254 @@
+package fakenet
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBodyBytes is how much of a request body the HTTP service reads.
+const maxBodyBytes = 1 << 20
+
+const fakePage = `<html><head><title>OK</title></head><body>OK</body></html>`
+
+// fakeBinaries are served for paths that look like downloads, so droppers
+// receive a file of roughly the right type rather than an HTML page.
+var fakeBinaries = map[string]struct {
+	mime string
+	body []byte
+}{
+	".exe": {"application/octet-stream", []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff")},
+	".dll": {"application/octet-stream", []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff")},
+	".bin": {"application/octet-stream", make([]byte, 64)},
+	".elf": {"application/octet-stream", []byte("\x7fELF\x02\x01\x01\x00")},
+	".zip": {"application/zip", []byte("PK\x05\x06" + strings.Repeat("\x00", 18))},
+	".png": {"image/png", []byte("\x89PNG\r\n\x1a\n")},
+	".gif": {"image/gif", []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;")},
+	".js":  {"application/javascript", []byte("//")},
+	".txt": {"text/plain", []byte("OK")},
+}
+
+var fakeHTTP = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	io.Copy(io.Discard, io.LimitReader(req.Body, maxBodyBytes))
+	w.Header().Set("Server", "Apache")
+	if f, ok := fakeBinaries[strings.ToLower(path.Ext(req.URL.Path))]; ok {
+		w.Header().Set("Content-Type", f.mime)
+		w.Write(f.body)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	io.WriteString(w, fakePage)
+})
+
+// newHTTPServer answers every request, plain or TLS, with the canned page.
+func newHTTPServer() *http.Server {
+	return &http.Server{
+		Handler:      fakeHTTP,
+		ReadTimeout:  connTimeout,
+		WriteTimeout: connTimeout,
+		IdleTimeout:  connTimeout,
+		ErrorLog:     log.New(io.Discard, "", 0), // handshake failures are expected
+	}
+}
+
+// serveSMTP accepts any mail and throws it away.
+func (r *Responder) serveSMTP(c net.Conn) {
+	br := bufio.NewReader(io.LimitReader(c, 16<<20))
+	reply := func(format string, args ...any) { fmt.Fprintf(c, format+"\r\n", args...) }
+
+	reply("220 %s ESMTP Postfix", r.cfg.Hostname)
+	for {
+		line, err := readLine(br)
+		if err != nil {
+			return
+		}
+		verb, _, _ := strings.Cut(strings.ToUpper(line), " ")
+		switch verb {
+		case "EHLO":
+			reply("250-%s", r.cfg.Hostname)
+			reply("250-AUTH PLAIN LOGIN")
+			reply("250 8BITMIME")
+		case "HELO":
+			reply("250 %s", r.cfg.Hostname)
+		case "AUTH":
+			reply("235 2.7.0 Authentication successful")
+		case "MAIL", "RCPT", "RSET", "NOOP":
+			reply("250 2.0.0 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			for {
+				l, err := readLine(br)
+				if err != nil {
+					return
+				}
+				if l == "." {
+					break
+				}
+			}
+			reply("250 2.0.0 OK: queued")
+		case "QUIT":
+			reply("221 2.0.0 Bye")
+			return
+		case "STARTTLS":
+			reply("454 4.7.0 TLS not available")
+		default:
+			reply("502 5.5.2 Error: command not recognized")
+		}
+	}
+}
+
+// serveIRC registers any nick and joins any channel, which is as far as
+// most bots go before waiting for commands.
+func (r *Responder) serveIRC(c net.Conn) {
+	br := bufio.NewReader(io.LimitReader(c, 16<<20))
+	host := r.cfg.Hostname
+	nick := "*"
+	send := func(format string, args ...any) { fmt.Fprintf(c, format+"\r\n", args...) }
+
+	for {
+		line, err := readLine(br)
+		if err != nil {
+			return
+		}
+		verb, rest, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "NICK":
+			nick = strings.TrimPrefix(strings.TrimSpace(rest), ":")
+		case "USER":
+			send(":%s 001 %s :Welcome to the Internet Relay Network %s", host, nick, nick)
+			send(":%s 376 %s :End of /MOTD command.", host, nick)
+		case "PING":
+			send(":%s PONG %s %s", host, host, rest)
+		case "JOIN":
+			channel, _, _ := strings.Cut(strings.TrimSpace(rest), " ")
+			send(":%s!%s@%s JOIN %s", nick, nick, host, channel)
+			send(":%s 332 %s %s :", host, nick, channel)
+		case "QUIT":
+			send("ERROR :Closing link")
+			return
+		}
+	}
+}
+
+// readLine reads one CRLF or LF terminated line, refusing overlong ones.
+func readLine(br *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := br.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxLineBytes {
+			return "", bufio.ErrTooLong
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+// The HTTPS service presents a certificate for whatever name the client
+// asks for, issued by a throwaway CA made when first needed.
+var (
+	caOnce sync.Once
+	caCert *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	caErr  error
+
+	certMu    sync.Mutex
+	certCache = map[string]*tls.Certificate{}
+)
+
+const maxCachedCerts = 1000
+
+func certificateFor(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	caOnce.Do(func() { caCert, caKey, caErr = newCA() })
+	if caErr != nil {
+		return nil, caErr
+	}
+	name := strings.ToLower(hello.ServerName)
+	if name == "" {
+		name = "localhost"
+	}
+
+	certMu.Lock()
+	defer certMu.Unlock()
+	if c, ok := certCache[name]; ok {
+		return c, nil
+	}
+	c, err := issue(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(certCache) >= maxCachedCerts {
+		clear(certCache)
+	}
+	certCache[name] = c
+	return c, nil
+}
+
+func newCA() (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Root CA", Organization: []string{"Internet Security Services"}},
+		NotBefore:             time.Now().Add(-365 * 24 * time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, err
+}
+
+func issue(name string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-30 * 24 * time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else {
+		tmpl.DNSNames = []string{name}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der, caCert.Raw}, PrivateKey: key}, nil
+}
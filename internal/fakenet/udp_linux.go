@@ -0,0 +1,47 @@
+package fakenet
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// enableDstAddr has the kernel report each datagram's destination address.
+func enableDstAddr(c *net.UDPConn) error {
+	raw, err := c.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_PKTINFO, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
+
+// replyFrom turns the IP_PKTINFO a datagram arrived with into the control
+// message that sends the reply from the same address.
+func replyFrom(oob []byte) []byte {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil
+	}
+	for _, m := range msgs {
+		if m.Header.Level != syscall.IPPROTO_IP || m.Header.Type != syscall.IP_PKTINFO ||
+			len(m.Data) < syscall.SizeofInet4Pktinfo {
+			continue
+		}
+		out := make([]byte, syscall.CmsgSpace(syscall.SizeofInet4Pktinfo))
+		h := (*syscall.Cmsghdr)(unsafe.Pointer(&out[0]))
+		h.Level = syscall.IPPROTO_IP
+		h.Type = syscall.IP_PKTINFO
+		h.SetLen(syscall.CmsgLen(syscall.SizeofInet4Pktinfo))
+		info := (*syscall.Inet4Pktinfo)(unsafe.Pointer(&out[syscall.CmsgLen(0)]))
+		copy(info.Spec_dst[:], m.Data[8:12]) // the query's ipi_addr
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package fakenet
+
+import (
+	"errors"
+	"net"
+)
+
+func enableDstAddr(c *net.UDPConn) error {
+	return errors.New("fakenet: destination addresses need Linux")
+}
+
+func replyFrom(oob []byte) []byte { return nil }
@@ -0,0 +1,226 @@
+package hashing
+
+import (
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrBadSSDeep = errors.New("invalid ssdeep digest")
+	ErrBadTLSH   = errors.New("invalid tlsh digest")
+)
+
+// SSDeepParts splits an ssdeep digest into its block size and the digests
+// at that size and at twice it, with runs of more than three identical
+// characters shortened to three as libfuzzy does before comparing.
+func SSDeepParts(digest string) (blockSize uint64, part1, part2 string, err error) {
+	bs, rest, ok := strings.Cut(digest, ":")
+	if !ok {
+		return 0, "", "", ErrBadSSDeep
+	}
+	part1, part2, ok = strings.Cut(rest, ":")
+	if !ok {
+		return 0, "", "", ErrBadSSDeep
+	}
+	// Digests printed with a file name carry it after a comma
+	part2, _, _ = strings.Cut(part2, ",")
+	blockSize, err = strconv.ParseUint(bs, 10, 64)
+	if err != nil || blockSize < ssdeepMinBlock || len(part1) > spamSumLength || len(part2) > spamSumLength {
+		return 0, "", "", ErrBadSSDeep
+	}
+	return blockSize, eliminateSequences(part1), eliminateSequences(part2), nil
+}
+
+func eliminateSequences(s string) string {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if i >= 3 && s[i] == s[i-1] && s[i] == s[i-2] && s[i] == s[i-3] {
+			continue
+		}
+		out = append(out, s[i])
+	}
+	return string(out)
+}
+
+// CompareSSDeep scores two ssdeep digests from 0 (unrelated) to 100
+// (identical), matching libfuzzy's fuzzy_compare.
+func CompareSSDeep(a, b string) (int, error) {
+	bs1, a1, a2, err := SSDeepParts(a)
+	if err != nil {
+		return 0, err
+	}
+	bs2, b1, b2, err := SSDeepParts(b)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case bs1 == bs2:
+		if a1 == b1 && a2 == b2 {
+			return 100, nil
+		}
+		return max(scoreStrings(a1, b1, bs1), scoreStrings(a2, b2, bs1*2)), nil
+	case bs1*2 == bs2:
+		return scoreStrings(a2, b1, bs2), nil
+	case bs2*2 == bs1:
+		return scoreStrings(a1, b2, bs1), nil
+	}
+	return 0, nil
+}
+
+func scoreStrings(s1, s2 string, blockSize uint64) int {
+	if !hasCommonSubstring(s1, s2) {
+		return 0
+	}
+	score := uint64(editDistance(s1, s2))
+	score = score * spamSumLength / uint64(len(s1)+len(s2))
+	score = 100 * score / spamSumLength
+	if score >= 100 {
+		return 0
+	}
+	score = 100 - score
+
+	// Small block sizes can't vouch for a high score on short digests
+	if blockSize < (99+ssdeepWindow)/ssdeepWindow*ssdeepMinBlock {
+		score = min(score, blockSize/ssdeepMinBlock*uint64(min(len(s1), len(s2))))
+	}
+	return int(score)
+}
+
+// hasCommonSubstring reports whether s1 and s2 share a run of at least
+// ssdeepWindow characters; without one, matches are mostly noise.
+func hasCommonSubstring(s1, s2 string) bool {
+	if len(s1) < ssdeepWindow || len(s2) < ssdeepWindow {
+		return false
+	}
+	grams := make(map[string]struct{}, len(s1))
+	for i := 0; i+ssdeepWindow <= len(s1); i++ {
+		grams[s1[i:i+ssdeepWindow]] = struct{}{}
+	}
+	for i := 0; i+ssdeepWindow <= len(s2); i++ {
+		if _, ok := grams[s2[i:i+ssdeepWindow]]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance is Levenshtein distance with a substitution costing two,
+// as in libfuzzy.
+func editDistance(s1, s2 string) int {
+	prev := make([]int, len(s2)+1)
+	cur := make([]int, len(s2)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s1); i++ {
+		cur[0] = i
+		for j := 1; j <= len(s2); j++ {
+			sub := prev[j-1]
+			if s1[i-1] != s2[j-1] {
+				sub += 2
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, sub)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(s2)]
+}
+
+// ParseTLSH decodes a TLSH digest, with or without the "T1" prefix.
+func ParseTLSH(digest string) (*tlshDigest, error) {
+	digest = strings.TrimPrefix(strings.ToUpper(digest), "T1")
+	raw, err := hex.DecodeString(digest)
+	if err != nil || len(raw) != 3+tlshCodeSize {
+		return nil, ErrBadTLSH
+	}
+	d := &tlshDigest{
+		checksum: swapNibbles(raw[0]),
+		lvalue:   swapNibbles(raw[1]),
+		q1ratio:  raw[2] >> 4,
+		q2ratio:  raw[2] & 0x0f,
+	}
+	for i := range tlshCodeSize {
+		d.code[i] = raw[len(raw)-1-i]
+	}
+	return d, nil
+}
+
+// TLSHDistance is the TLSH distance between two digests: 0 for identical
+// files, under about 50 for close variants, and 200 or more for unrelated
+// ones.
+func TLSHDistance(a, b string) (int, error) {
+	da, err := ParseTLSH(a)
+	if err != nil {
+		return 0, err
+	}
+	db, err := ParseTLSH(b)
+	if err != nil {
+		return 0, err
+	}
+	return da.distance(db), nil
+}
+
+func modDiff(x, y, r int) int {
+	d := x - y
+	if d < 0 {
+		d = -d
+	}
+	return min(d, r-d)
+}
+
+func (d *tlshDigest) distance(o *tlshDigest) int {
+	diff := 0
+	switch l := modDiff(int(d.lvalue), int(o.lvalue), 256); {
+	case l <= 1:
+		diff += l
+	default:
+		diff += l * 12
+	}
+	for _, q := range []int{
+		modDiff(int(d.q1ratio), int(o.q1ratio), 16),
+		modDiff(int(d.q2ratio), int(o.q2ratio), 16),
+	} {
+		if q <= 1 {
+			diff += q
+		} else {
+			diff += (q - 1) * 12
+		}
+	}
+	if d.checksum != o.checksum {
+		diff++
+	}
+	for i := range tlshCodeSize {
+		x, y := d.code[i], o.code[i]
+		for range 4 {
+			switch v := int(x&3) - int(y&3); v {
+			case 3, -3:
+				diff += 6
+			case 2, -2:
+				diff += 2
+			case 1, -1:
+				diff++
+			}
+			x >>= 2
+			y >>= 2
+		}
+	}
+	return diff
+}
+
+// TLSHBands splits a digest's body into fixed-width slices. Close variants
+// usually share at least one band exactly, so bands serve as index keys for
+// finding candidates without comparing against every stored digest.
+func TLSHBands(digest string, width int) ([]string, error) {
+	d, err := ParseTLSH(digest)
+	if err != nil {
+		return nil, err
+	}
+	var bands []string
+	for i := 0; i+width <= tlshCodeSize; i += width {
+		bands = append(bands, hex.EncodeToString(d.code[i:i+width]))
+	}
+	return bands, nil
+}
@@ -0,0 +1,123 @@
+package hashing
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompareSSDeep(t *testing.T) {
+	// Scores are fuzzy_compare's, as published with github.com/glaslos/ssdeep
+	tests := []struct {
+		a, b  string
+		score int
+	}{
+		{
+			"192:MUPMinqP6+wNQ7Q40L/iB3n2rIBrP0GZKF4jsef+0FVQLSwbLbj41iH8nFVYv980:x0CllivQiFmt",
+			"192:MUPMinqP6+wNQ7Q40L/iB3n2rIBrP0GZKF4jsef+0FVQLSwbLbj41iH8nFVYv980:x0CllivQiFmt",
+			100,
+		},
+		{
+			"192:MUPMinqP6+wNQ7Q40L/iB3n2rIBrP0GZKF4jsef+0FVQLSwbLbj41iH8nFVYv980:x0CllivQiFmt",
+			"192:JkjRcePWsNVQza3ntZStn5VfsoXMhRD9+xJMinqF6+wNQ7Q40L/i737rPVt:JkjlQyIrx+kll2",
+			35,
+		},
+		{
+			"196608:pDSC8olnoL1v/uawvbQD7XlZUFYzYyMb615NktYHF7dREN/JNnQrmhnUPI+/n2Yr:5DHoJXv7XOq7Mb2TwYHXREN/3QrmktPd",
+			"196608:7DSC8olnoL1v/uawvbQD7XlZUFYzYyMb615NktYHF7dREN/JNnQrmhnUPI+/n2Y7:3DHoJXv7XOq7Mb2TwYHXREN/3QrmktPt",
+			97,
+		},
+		{
+			"24:YDVLfsT1ds/1H9Wpgq7n4XMijV6h4Z3QCw4qat:YD51H9CiMuV6uACwVat",
+			"24:YDVLfyvDj+C+opg8DV0Mdle6hPZ3QCw4qat:YDMvDj+C+kBOM+6HACwVat",
+			54,
+		},
+		{
+			// Block sizes more than a factor of two apart never match
+			"24:YDVLfsT1ds/1H9Wpgq7n4XMijV6h4Z3QCw4qat:YD51H9CiMuV6uACwVat",
+			"192:JkjRcePWsNVQza3ntZStn5VfsoXMhRD9+xJMinqF6+wNQ7Q40L/i737rPVt:JkjlQyIrx+kll2",
+			0,
+		},
+	}
+	for _, tc := range tests {
+		for _, pair := range [][2]string{{tc.a, tc.b}, {tc.b, tc.a}} {
+			got, err := CompareSSDeep(pair[0], pair[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.score {
+				t.Errorf("CompareSSDeep(%s, %s) = %d, want %d", pair[0], pair[1], got, tc.score)
+			}
+		}
+	}
+}
+
+func TestCompareSSDeepInvalid(t *testing.T) {
+	for _, d := range []string{"", "192:asdasd", "x:abc:def", "1:abc:def"} {
+		if _, err := CompareSSDeep(d, ssdeepGolden[0].digest); !errors.Is(err, ErrBadSSDeep) {
+			t.Errorf("%q: got %v, want ErrBadSSDeep", d, err)
+		}
+	}
+}
+
+func TestSSDeepPartsSequences(t *testing.T) {
+	_, p1, p2, err := SSDeepParts("3:AAAAAAbcd:xxxxy,file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p1 != "AAAbcd" || p2 != "xxxy" {
+		t.Errorf("got %q %q", p1, p2)
+	}
+}
+
+func TestTLSHDistance(t *testing.T) {
+	digest := func(name string) string {
+		for _, tc := range tlshGolden {
+			if tc.name == name {
+				return tc.digest
+			}
+		}
+		t.Fatalf("no golden input %s", name)
+		return ""
+	}
+	// Distances computed with the reference TlshImpl::totalDiff
+	tests := []struct {
+		a, b string
+		dist int
+	}{
+		{"lines400", "lines400", 0},
+		{"lines400", "lines400edit", 1},
+		{"lines6", "lines40", 167},
+		{"lines40", "lines400", 288},
+		{"lines400", "random4097", 468},
+	}
+	for _, tc := range tests {
+		got, err := TLSHDistance(digest(tc.a), digest(tc.b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.dist {
+			t.Errorf("TLSHDistance(%s, %s) = %d, want %d", tc.a, tc.b, got, tc.dist)
+		}
+	}
+
+	if _, err := TLSHDistance("T1ZZ", digest("lines6")); !errors.Is(err, ErrBadTLSH) {
+		t.Errorf("got %v, want ErrBadTLSH", err)
+	}
+}
+
+func TestTLSHBands(t *testing.T) {
+	a, _ := TLSHBands(tlshGolden[2].digest, 4)
+	b, _ := TLSHBands(tlshGolden[3].digest, 4)
+	if len(a) != tlshCodeSize/4 {
+		t.Fatalf("got %d bands", len(a))
+	}
+	shared := 0
+	for i := range a {
+		if a[i] == b[i] {
+			shared++
+		}
+	}
+	if shared == 0 {
+		t.Error("close variants share no band")
+	}
+}
@@ -0,0 +1,77 @@
+package hashing
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+)
+
+// Digests identifies one file. SSDeep and TLSH are fuzzy hashes for finding
+// similar files; TLSH is empty for inputs under 50 bytes or with too little
+// variety to hash.
+type Digests struct {
+	MD5    string `json:"md5"`
+	SHA1   string `json:"sha1"`
+	SHA256 string `json:"sha256"`
+	SHA512 string `json:"sha512"`
+	SSDeep string `json:"ssdeep"`
+	TLSH   string `json:"tlsh,omitempty"`
+}
+
+// Hasher computes every digest in a single pass. Use it as the destination
+// of an io.MultiWriter while a file is being copied.
+type Hasher struct {
+	md5, sha1, sha256, sha512 hash.Hash
+	ssdeep                    *ssdeepState
+	tlsh                      *tlshState
+	w                         io.Writer
+}
+
+func New() *Hasher {
+	h := &Hasher{
+		md5:    md5.New(),
+		sha1:   sha1.New(),
+		sha256: sha256.New(),
+		sha512: sha512.New(),
+		ssdeep: newSSDeep(),
+		tlsh:   &tlshState{},
+	}
+	h.w = io.MultiWriter(h.md5, h.sha1, h.sha256, h.sha512, h.ssdeep, h.tlsh)
+	return h
+}
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	return h.w.Write(p)
+}
+
+// Sum returns the digests of everything written so far.
+func (h *Hasher) Sum() Digests {
+	return Digests{
+		MD5:    hex.EncodeToString(h.md5.Sum(nil)),
+		SHA1:   hex.EncodeToString(h.sha1.Sum(nil)),
+		SHA256: hex.EncodeToString(h.sha256.Sum(nil)),
+		SHA512: hex.EncodeToString(h.sha512.Sum(nil)),
+		SSDeep: h.ssdeep.Sum(),
+		TLSH:   h.tlsh.Sum(),
+	}
+}
+
+// File hashes the file at path.
+func File(path string) (Digests, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Digests{}, err
+	}
+	defer f.Close()
+
+	h := New()
+	if _, err := io.Copy(h, f); err != nil {
+		return Digests{}, err
+	}
+	return h.Sum(), nil
+}
@@ -0,0 +1,196 @@
+package hashing
+
+import "strconv"
+
+// ssdeep context-triggered piecewise hashing, computed incrementally the way
+// libfuzzy's fuzzy_update does: a digest is kept for every candidate block
+// size at once, so the input never has to be re-read once its length is known.
+const (
+	ssdeepWindow    = 7
+	ssdeepMinBlock  = 3
+	ssdeepPrime     = 0x01000193
+	ssdeepInit      = 0x27
+	ssdeepNumBlocks = 31
+	spamSumLength   = 64
+	ssdeepB64       = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+func ssdeepBlockSize(i int) uint32 { return ssdeepMinBlock << i }
+
+type rollingHash struct {
+	window     [ssdeepWindow]byte
+	h1, h2, h3 uint32
+	n          uint32
+}
+
+func (r *rollingHash) roll(c byte) {
+	r.h2 -= r.h1
+	r.h2 += ssdeepWindow * uint32(c)
+	r.h1 += uint32(c)
+	r.h1 -= uint32(r.window[r.n%ssdeepWindow])
+	r.window[r.n%ssdeepWindow] = c
+	r.n++
+	r.h3 <<= 5
+	r.h3 ^= uint32(c)
+}
+
+func (r *rollingHash) sum() uint32 { return r.h1 + r.h2 + r.h3 }
+
+func sumHash(c byte, h uint32) uint32 { return h*ssdeepPrime ^ uint32(c) }
+
+type blockHash struct {
+	h, halfh   uint32
+	digest     [spamSumLength]byte
+	halfDigest byte
+	dlen       int
+}
+
+type ssdeepState struct {
+	bh        [ssdeepNumBlocks]blockHash
+	bhStart   int
+	bhEnd     int
+	total     uint64
+	roll      rollingHash
+	lasth     uint32
+	needLastH bool
+}
+
+func newSSDeep() *ssdeepState {
+	s := &ssdeepState{bhEnd: 1}
+	s.bh[0].h = ssdeepInit
+	s.bh[0].halfh = ssdeepInit
+	return s
+}
+
+func (s *ssdeepState) Write(p []byte) (int, error) {
+	s.total += uint64(len(p))
+	for _, c := range p {
+		s.step(c)
+	}
+	return len(p), nil
+}
+
+func (s *ssdeepState) forkBlockHash() {
+	prev := &s.bh[s.bhEnd-1]
+	if s.bhEnd < ssdeepNumBlocks {
+		next := &s.bh[s.bhEnd]
+		next.h = prev.h
+		next.halfh = prev.halfh
+		next.digest[0] = 0
+		next.halfDigest = 0
+		next.dlen = 0
+		s.bhEnd++
+	} else if !s.needLastH {
+		s.needLastH = true
+		s.lasth = prev.h
+	}
+}
+
+// reduceBlockHash drops the smallest block size once the input is too long
+// for it ever to be chosen.
+func (s *ssdeepState) reduceBlockHash() {
+	if s.bhEnd-s.bhStart < 2 {
+		return
+	}
+	if uint64(ssdeepBlockSize(s.bhStart))*spamSumLength >= s.total {
+		return
+	}
+	if s.bh[s.bhStart+1].dlen < spamSumLength/2 {
+		return
+	}
+	s.bhStart++
+}
+
+func (s *ssdeepState) step(c byte) {
+	s.roll.roll(c)
+	h := s.roll.sum()
+	for i := s.bhStart; i < s.bhEnd; i++ {
+		s.bh[i].h = sumHash(c, s.bh[i].h)
+		s.bh[i].halfh = sumHash(c, s.bh[i].halfh)
+	}
+	if s.needLastH {
+		s.lasth = sumHash(c, s.lasth)
+	}
+
+	if h == 0xffffffff {
+		return
+	}
+	// A trigger point for a block size is one for every smaller size too
+	if h%ssdeepBlockSize(s.bhStart) != ssdeepBlockSize(s.bhStart)-1 {
+		return
+	}
+	for i := s.bhStart; i < s.bhEnd; i++ {
+		if h%ssdeepBlockSize(i) != ssdeepBlockSize(i)-1 {
+			break
+		}
+		b := &s.bh[i]
+		if b.dlen == 0 {
+			s.forkBlockHash()
+		}
+		b.digest[b.dlen] = ssdeepB64[b.h%64]
+		b.halfDigest = ssdeepB64[b.halfh%64]
+		if b.dlen < spamSumLength-1 {
+			// Only reset while there is room, so the tail of a long input
+			// folds into the last character
+			b.dlen++
+			b.digest[b.dlen] = 0
+			b.h = ssdeepInit
+			if b.dlen < spamSumLength/2 {
+				b.halfh = ssdeepInit
+				b.halfDigest = 0
+			}
+		} else {
+			s.reduceBlockHash()
+		}
+	}
+}
+
+// Sum returns the digest as blocksize:hash:hash2.
+func (s *ssdeepState) Sum() string {
+	bi := s.bhStart
+	h := s.roll.sum()
+
+	for uint64(ssdeepBlockSize(bi))*spamSumLength < s.total {
+		bi++
+		if bi >= ssdeepNumBlocks {
+			return ""
+		}
+	}
+	for bi >= s.bhEnd {
+		bi--
+	}
+	for bi > s.bhStart && s.bh[bi].dlen < spamSumLength/2 {
+		bi--
+	}
+
+	out := make([]byte, 0, 2*spamSumLength+16)
+	out = strconv.AppendUint(out, uint64(ssdeepBlockSize(bi)), 10)
+	out = append(out, ':')
+
+	b := &s.bh[bi]
+	out = append(out, b.digest[:b.dlen]...)
+	if h != 0 {
+		out = append(out, ssdeepB64[b.h%64])
+	} else if b.digest[b.dlen] != 0 {
+		out = append(out, b.digest[b.dlen])
+	}
+	out = append(out, ':')
+
+	if bi < s.bhEnd-1 {
+		b := &s.bh[bi+1]
+		n := min(b.dlen, spamSumLength/2-1)
+		out = append(out, b.digest[:n]...)
+		if h != 0 {
+			out = append(out, ssdeepB64[b.halfh%64])
+		} else if b.halfDigest != 0 {
+			out = append(out, b.halfDigest)
+		}
+	} else if h != 0 {
+		if bi == 0 {
+			out = append(out, ssdeepB64[b.h%64])
+		} else {
+			out = append(out, ssdeepB64[s.lasth%64])
+		}
+	}
+	return string(out)
+}
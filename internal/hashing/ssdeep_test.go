@@ -0,0 +1,50 @@
+package hashing
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Digests from libfuzzy of consecutive reads from math/rand seeded with
+// 1, the vectors github.com/glaslos/ssdeep checks itself against.
+var ssdeepGolden = []struct {
+	size   int
+	digest string
+}{
+	{4097, "96:yNDH/iNQaSXRLmOSxu1aQP4iWgC8JbkiA5Ix:yNLaNQhSxEgVYkiA5Ix"},
+	{45056, "768:mlHmRZnCRFRwSuK/UiwY37TMbsDEsb1Jqi6dcXoWpKXIUxpQDOAvWpPK:mqhCJwjmJD31DzbDwd+oGo9AvOi"},
+	{86016, "1536:Jdr3F6yZG0agLg/b6G6REjI+WUhWDKRSpzKjSUT4plmjvX6ex7RwdsHIGV:PrVbZG0BuuGzc+WcdRilmbPx7RwGV"},
+	{126976, "3072:pwP2ZmVLsvDAyshOZIzFkGxIE++3ysSsZCj3JwAjpn:ps2/DAyKIaRyE++RSsUj3JwaJ"},
+	{167936, "3072:20RnMAMjfifg0w9B9pd4RcuCOpjSFkhfZn8bA7KT3Dwp8iKXDgBU7bocn2INL9WJ:zRfvw9B9pd47+qfZ0A+T3DWFK04kcXNe"},
+	{208896, "6144:tG4fQHdGW3TvR07E9kJ5slz0RLEB0+3wHt18F7xgMf:WOGkigLC/AH07qW"},
+}
+
+func TestSSDeepGolden(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, tc := range ssdeepGolden {
+		blob := make([]byte, tc.size)
+		r.Read(blob)
+
+		s := newSSDeep()
+		s.Write(blob)
+		if got := s.Sum(); got != tc.digest {
+			t.Errorf("size %d: got %s, want %s", tc.size, got, tc.digest)
+		}
+	}
+}
+
+func TestSSDeepChunked(t *testing.T) {
+	blob := make([]byte, ssdeepGolden[0].size)
+	rand.New(rand.NewSource(1)).Read(blob)
+
+	// Digests must not depend on how the input is split across writes
+	s := newSSDeep()
+	for len(blob) > 0 {
+		n := min(len(blob), 333)
+		s.Write(blob[:n])
+		blob = blob[n:]
+	}
+	if got := s.Sum(); got != ssdeepGolden[0].digest {
+		t.Errorf("got %s, want %s", got, ssdeepGolden[0].digest)
+	}
+}
@@ -0,0 +1,151 @@
+package hashing
+
+import (
+	"encoding/hex"
+	"math"
+	"slices"
+	"strings"
+)
+
+// TLSH (Trend Micro locality sensitive hash), standard 128-bucket variant
+// with a one-byte checksum, printed with the "T1" version prefix.
+const (
+	tlshWindow     = 5
+	tlshBuckets    = 128
+	tlshCodeSize   = tlshBuckets / 4
+	tlshMinDataLen = 50
+)
+
+// tlshPearson is the Pearson permutation used by the reference implementation.
+var tlshPearson = [256]byte{
+	1, 87, 49, 12, 176, 178, 102, 166, 121, 193, 6, 84, 249, 230, 44, 163,
+	14, 197, 213, 181, 161, 85, 218, 80, 64, 239, 24, 226, 236, 142, 38, 200,
+	110, 177, 104, 103, 141, 253, 255, 50, 77, 101, 81, 18, 45, 96, 31, 222,
+	25, 107, 190, 70, 86, 237, 240, 34, 72, 242, 20, 214, 244, 227, 149, 235,
+	97, 234, 57, 22, 60, 250, 82, 175, 208, 5, 127, 199, 111, 62, 135, 248,
+	174, 169, 211, 58, 66, 154, 106, 195, 245, 171, 17, 187, 182, 179, 0, 243,
+	132, 56, 148, 75, 128, 133, 158, 100, 130, 126, 91, 13, 153, 246, 216, 219,
+	119, 68, 223, 78, 83, 88, 201, 99, 122, 11, 92, 32, 136, 114, 52, 10,
+	138, 30, 48, 183, 156, 35, 61, 26, 143, 74, 251, 94, 129, 162, 63, 152,
+	170, 7, 115, 167, 241, 206, 3, 150, 55, 59, 151, 220, 90, 53, 23, 131,
+	125, 173, 15, 238, 79, 95, 89, 16, 105, 137, 225, 224, 217, 160, 37, 123,
+	118, 73, 2, 157, 46, 116, 9, 145, 134, 228, 207, 212, 202, 215, 69, 229,
+	27, 188, 67, 124, 168, 252, 42, 4, 29, 108, 21, 247, 19, 205, 39, 203,
+	233, 40, 186, 147, 198, 192, 155, 33, 164, 191, 98, 204, 165, 180, 117, 76,
+	140, 36, 210, 172, 41, 54, 159, 8, 185, 232, 113, 196, 231, 47, 146, 120,
+	51, 65, 28, 144, 254, 221, 93, 189, 194, 139, 112, 43, 71, 109, 184, 209,
+}
+
+func tlshMapping(salt, i, j, k byte) byte {
+	h := tlshPearson[salt]
+	h = tlshPearson[h^i]
+	h = tlshPearson[h^j]
+	return tlshPearson[h^k]
+}
+
+type tlshState struct {
+	window   [tlshWindow]byte
+	buckets  [256]uint32
+	checksum byte
+	n        uint64
+}
+
+func (t *tlshState) Write(p []byte) (int, error) {
+	w := &t.window
+	for _, c := range p {
+		j := int(t.n % tlshWindow)
+		w[j] = c
+		t.n++
+		if t.n < tlshWindow {
+			continue
+		}
+		j1 := (j + 4) % tlshWindow
+		j2 := (j + 3) % tlshWindow
+		j3 := (j + 2) % tlshWindow
+		j4 := (j + 1) % tlshWindow
+
+		t.checksum = tlshMapping(0, w[j], w[j1], t.checksum)
+		t.buckets[tlshMapping(2, w[j], w[j1], w[j2])]++
+		t.buckets[tlshMapping(3, w[j], w[j1], w[j3])]++
+		t.buckets[tlshMapping(5, w[j], w[j2], w[j3])]++
+		t.buckets[tlshMapping(7, w[j], w[j2], w[j4])]++
+		t.buckets[tlshMapping(11, w[j], w[j1], w[j4])]++
+		t.buckets[tlshMapping(13, w[j], w[j3], w[j4])]++
+	}
+	return len(p), nil
+}
+
+// Sum returns the hex digest, or "" when the input is too short or too
+// uniform to give a meaningful one.
+func (t *tlshState) Sum() string {
+	if t.n < tlshMinDataLen {
+		return ""
+	}
+	sorted := slices.Clone(t.buckets[:tlshBuckets])
+	slices.Sort(sorted)
+	q1, q2, q3 := sorted[tlshBuckets/4-1], sorted[tlshBuckets/2-1], sorted[tlshBuckets-tlshBuckets/4-1]
+
+	nonzero := 0
+	for _, b := range t.buckets[:tlshBuckets] {
+		if b > 0 {
+			nonzero++
+		}
+	}
+	if nonzero <= tlshBuckets/2 || q3 == 0 {
+		return ""
+	}
+
+	var d tlshDigest
+	d.checksum = t.checksum
+	d.lvalue = tlshLength(t.n)
+	d.q1ratio = byte(uint32(float32(q1*100)/float32(q3)) % 16)
+	d.q2ratio = byte(uint32(float32(q2*100)/float32(q3)) % 16)
+	for i := range tlshCodeSize {
+		var h byte
+		for j := range 4 {
+			switch k := t.buckets[4*i+j]; {
+			case q3 < k:
+				h += 3 << (j * 2)
+			case q2 < k:
+				h += 2 << (j * 2)
+			case q1 < k:
+				h += 1 << (j * 2)
+			}
+		}
+		d.code[i] = h
+	}
+	return d.String()
+}
+
+// tlshLength buckets the input length on a log scale.
+func tlshLength(n uint64) byte {
+	l := float64(n)
+	var i int
+	switch {
+	case n <= 656:
+		i = int(math.Floor(math.Log(l) / 0.4054651))
+	case n <= 3199:
+		i = int(math.Floor(math.Log(l)/0.26236426 - 8.72777))
+	default:
+		i = int(math.Floor(math.Log(l)/0.095310180 - 62.5472))
+	}
+	return byte(i & 0xff)
+}
+
+type tlshDigest struct {
+	checksum         byte
+	lvalue           byte
+	q1ratio, q2ratio byte
+	code             [tlshCodeSize]byte
+}
+
+func swapNibbles(b byte) byte { return b<<4 | b>>4 }
+
+func (d *tlshDigest) String() string {
+	raw := make([]byte, 0, 3+tlshCodeSize)
+	raw = append(raw, swapNibbles(d.checksum), swapNibbles(d.lvalue), d.q1ratio<<4|d.q2ratio)
+	for i := tlshCodeSize - 1; i >= 0; i-- {
+		raw = append(raw, d.code[i])
+	}
+	return "T1" + strings.ToUpper(hex.EncodeToString(raw))
+}
@@ -0,0 +1,81 @@
+package hashing
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// tlshLines is n numbered lines of text, with line edit reworded.
+func tlshLines(n, edit int) []byte {
+	var b strings.Builder
+	for i := range n {
+		if i == edit {
+			fmt.Fprintf(&b, "line %d: a lazy dog was jumped by the quick fox\n", i)
+			continue
+		}
+		fmt.Fprintf(&b, "line %d: the quick brown fox jumps over the lazy dog\n", i)
+	}
+	return []byte(b.String())
+}
+
+func tlshRandom(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(b)
+	return b
+}
+
+// Digests from a line-by-line transcription of the reference TlshImpl
+// (128 buckets, 1-byte checksum). The text inputs cover each of the three
+// length-encoding ranges.
+var tlshGolden = []struct {
+	name   string
+	data   []byte
+	digest string
+}{
+	{"lines6", tlshLines(6, -1), "T181E0024E615853F4B9DF18C5638D98F2D2DCC627A1721525B8316412691D531ACAC8D5"},
+	{"lines40", tlshLines(40, -1), "T11B41628E625957F4F5CF2889638EE4F2D3ECC523A2722525B831B0026958531ECFD4E6"},
+	{"lines400", tlshLines(400, -1), "T18FA2729E622953F4F5CF1885638EE8F2D7ECC533A2726426F930B0136919521ECFC4A6"},
+	{"lines400edit", tlshLines(400, 200), "T196A2729E622953F4F5CF1885638EE8F2D7ECC533A2726426F930B0136919521ECFC4A6"},
+	{"random4097", tlshRandom(4097), "T1A0816D783F69F14ED9942A67B7A95618D085C50381BA758223D9C93FCF0DEB183087A5"},
+	{"short", []byte("too short to hash"), ""},
+	{"uniform", make([]byte, 1000), ""},
+}
+
+func TestTLSHGolden(t *testing.T) {
+	for _, tc := range tlshGolden {
+		s := &tlshState{}
+		s.Write(tc.data)
+		if got := s.Sum(); got != tc.digest {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.digest)
+		}
+	}
+}
+
+// The header bytes follow the reference layout: checksum and length with
+// their nibbles swapped, then Q1 ratio in the high nibble and Q2 in the
+// low one, then the body with the last bucket group first.
+func TestTLSHLayout(t *testing.T) {
+	d := tlshDigest{checksum: 0x12, lvalue: 0x34, q1ratio: 0x5, q2ratio: 0xA}
+	d.code[0] = 0xAB
+	d.code[tlshCodeSize-1] = 0xCD
+
+	s := d.String()
+	want := "T1" + "21" + "43" + "5A" + "CD" + strings.Repeat("00", tlshCodeSize-2) + "AB"
+	if s != want {
+		t.Fatalf("got %s, want %s", s, want)
+	}
+
+	got, err := ParseTLSH(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != d {
+		t.Errorf("parsed %+v, want %+v", *got, d)
+	}
+	// The prefix is optional when parsing
+	if got, err := ParseTLSH(strings.ToLower(s[2:])); err != nil || *got != d {
+		t.Errorf("without prefix: %+v, %v", got, err)
+	}
+}
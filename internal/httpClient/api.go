@@ -0,0 +1,152 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// Typed wrappers for every endpoint in the v1.7.0 API spec.
+
+func DescribeInstance(c *http.Client) (*InstanceInfo, error) {
+	var info InstanceInfo
+	if err := Get(c, "/", &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func GetVersion(c *http.Client) (*FirecrackerVersion, error) {
+	var v FirecrackerVersion
+	if err := Get(c, "/version", &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func CreateAction(c *http.Client, actionType string) error {
+	return PutJSON(c, "/actions", InstanceActionInfo{ActionType: actionType})
+}
+
+func GetMachineConfig(c *http.Client) (*MachineConfiguration, error) {
+	var cfg MachineConfiguration
+	if err := Get(c, "/machine-config", &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func PutMachineConfig(c *http.Client, cfg MachineConfiguration) error {
+	return PutJSON(c, "/machine-config", cfg)
+}
+
+func PatchMachineConfig(c *http.Client, cfg MachineConfiguration) error {
+	return PatchJSON(c, "/machine-config", cfg)
+}
+
+func PutBootSource(c *http.Client, src BootSource) error {
+	return PutJSON(c, "/boot-source", src)
+}
+
+func PutDrive(c *http.Client, d Drive) error {
+	return PutJSON(c, "/drives/"+url.PathEscape(d.DriveID), d)
+}
+
+func PatchDrive(c *http.Client, d PartialDrive) error {
+	return PatchJSON(c, "/drives/"+url.PathEscape(d.DriveID), d)
+}
+
+func PutNetworkInterface(c *http.Client, iface NetworkInterface) error {
+	return PutJSON(c, "/network-interfaces/"+url.PathEscape(iface.IfaceID), iface)
+}
+
+func PatchNetworkInterface(c *http.Client, iface PartialNetworkInterface) error {
+	return PatchJSON(c, "/network-interfaces/"+url.PathEscape(iface.IfaceID), iface)
+}
+
+func PutVsock(c *http.Client, v Vsock) error {
+	return PutJSON(c, "/vsock", v)
+}
+
+func GetBalloon(c *http.Client) (*Balloon, error) {
+	var b Balloon
+	if err := Get(c, "/balloon", &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func PutBalloon(c *http.Client, b Balloon) error {
+	return PutJSON(c, "/balloon", b)
+}
+
+func PatchBalloon(c *http.Client, b BalloonUpdate) error {
+	return PatchJSON(c, "/balloon", b)
+}
+
+func GetBalloonStats(c *http.Client) (*BalloonStats, error) {
+	var s BalloonStats
+	if err := Get(c, "/balloon/statistics", &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func PatchBalloonStats(c *http.Client, u BalloonStatsUpdate) error {
+	return PatchJSON(c, "/balloon/statistics", u)
+}
+
+func PutLogger(c *http.Client, l Logger) error {
+	return PutJSON(c, "/logger", l)
+}
+
+func PutMetrics(c *http.Client, m Metrics) error {
+	return PutJSON(c, "/metrics", m)
+}
+
+func PutMmdsConfig(c *http.Client, cfg MmdsConfig) error {
+	return PutJSON(c, "/mmds/config", cfg)
+}
+
+// PutMmds replaces the whole MMDS data store with contents.
+func PutMmds(c *http.Client, contents any) error {
+	return PutJSON(c, "/mmds", contents)
+}
+
+// PatchMmds merges contents into the MMDS data store.
+func PatchMmds(c *http.Client, contents any) error {
+	return PatchJSON(c, "/mmds", contents)
+}
+
+// GetMmds decodes the MMDS data store into out.
+func GetMmds(c *http.Client, out any) error {
+	return Get(c, "/mmds", out)
+}
+
+// PutCPUConfig applies a custom CPU template (see the *-v1.7.0.json files).
+func PutCPUConfig(c *http.Client, cfg any) error {
+	return PutJSON(c, "/cpu-config", cfg)
+}
+
+func PutEntropy(c *http.Client, e EntropyDevice) error {
+	return PutJSON(c, "/entropy", e)
+}
+
+func CreateSnapshot(c *http.Client, p SnapshotCreateParams) error {
+	return PutJSON(c, "/snapshot/create", p)
+}
+
+func LoadSnapshot(c *http.Client, p SnapshotLoadParams) error {
+	return PutJSON(c, "/snapshot/load", p)
+}
+
+func PatchVM(c *http.Client, state string) error {
+	return PatchJSON(c, "/vm", VM{State: state})
+}
+
+func GetVMConfig(c *http.Client) (*FullVMConfiguration, error) {
+	var cfg FullVMConfiguration
+	if err := Get(c, "/vm/config", &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
@@ -1,47 +1,118 @@
-package client
-
-import (
-	"bytes"
-	"context"
-	"fmt"
-	"net"
-	"net/http"
-	"time"
-)
-
-func NewClient(sock string) *http.Client {
-	transport := &http.Transport{
-		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
-			d := &net.Dialer{}
-			return d.DialContext(ctx, "unix", sock)
-		},
-	}
-	return &http.Client{
-		Transport: transport,
-		Timeout:   10 * time.Second,
-	}
-}
-
-func Put(client *http.Client, path string, body []byte) error {
-	req, err := http.NewRequest(
-		http.MethodPut,
-		"http://localhost"+path,
-		bytes.NewReader(body),
-	)
-	if err != nil {
-		return err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("firecracker PUT %s failed: %s", path, resp.Status)
-	}
-	return nil
-}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// APIError is returned when Firecracker answers with a non-2xx status.
+// FaultMessage carries the "fault_message" field of the Error body.
+type APIError struct {
+	Method       string
+	Path         string
+	StatusCode   int
+	FaultMessage string
+}
+
+func (e *APIError) Error() string {
+	if e.FaultMessage == "" {
+		return fmt.Sprintf("firecracker %s %s failed: %d %s",
+			e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("firecracker %s %s failed: %d %s",
+		e.Method, e.Path, e.StatusCode, e.FaultMessage)
+}
+
+func NewClient(sock string) *http.Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			d := &net.Dialer{}
+			return d.DialContext(ctx, "unix", sock)
+		},
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   10 * time.Second,
+	}
+}
+
+// Put sends a raw JSON body to path.
+func Put(client *http.Client, path string, body []byte) error {
+	return do(client, http.MethodPut, path, body, nil)
+}
+
+// Patch sends a raw JSON body to path.
+func Patch(client *http.Client, path string, body []byte) error {
+	return do(client, http.MethodPatch, path, body, nil)
+}
+
+// Get decodes the JSON response of path into out.
+func Get(client *http.Client, path string, out any) error {
+	return do(client, http.MethodGet, path, nil, out)
+}
+
+// PutJSON marshals in and sends it to path.
+func PutJSON(client *http.Client, path string, in any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encode %s body: %w", path, err)
+	}
+	return do(client, http.MethodPut, path, body, nil)
+}
+
+// PatchJSON marshals in and sends it to path.
+func PatchJSON(client *http.Client, path string, in any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encode %s body: %w", path, err)
+	}
+	return do(client, http.MethodPatch, path, body, nil)
+}
+
+func do(client *http.Client, method, path string, body []byte, out any) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, "http://localhost"+path, reader)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &APIError{Method: method, Path: path, StatusCode: resp.StatusCode}
+		var fault Error
+		if data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); err == nil {
+			if json.Unmarshal(data, &fault) == nil {
+				apiErr.FaultMessage = fault.FaultMessage
+			}
+		}
+		return apiErr
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s %s response: %w", method, path, err)
+	}
+	return nil
+}
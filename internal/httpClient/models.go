@@ -0,0 +1,220 @@
+package client
+
+// Types in this file mirror the definitions section of
+// release-v1.7.0-x86_64/firecracker_spec-v1.7.0.yaml. Field names and
+// required/optional markers follow the spec; optional fields use omitempty.
+
+// Error is the body Firecracker returns with every non-2xx response.
+type Error struct {
+	FaultMessage string `json:"fault_message,omitempty"`
+}
+
+// Action types accepted by PUT /actions.
+const (
+	ActionFlushMetrics   = "FlushMetrics"
+	ActionInstanceStart  = "InstanceStart"
+	ActionSendCtrlAltDel = "SendCtrlAltDel"
+)
+
+// InstanceActionInfo is the body of PUT /actions.
+type InstanceActionInfo struct {
+	ActionType string `json:"action_type"`
+}
+
+// InstanceInfo is returned by GET /.
+type InstanceInfo struct {
+	AppName    string `json:"app_name"`
+	ID         string `json:"id"`
+	State      string `json:"state"` // "Not started", "Running" or "Paused"
+	VMMVersion string `json:"vmm_version"`
+}
+
+// FirecrackerVersion is returned by GET /version.
+type FirecrackerVersion struct {
+	FirecrackerVersion string `json:"firecracker_version"`
+}
+
+// MachineConfiguration is the body of /machine-config.
+type MachineConfiguration struct {
+	VcpuCount       int    `json:"vcpu_count"`
+	MemSizeMib      int    `json:"mem_size_mib"`
+	Smt             bool   `json:"smt,omitempty"`
+	TrackDirtyPages bool   `json:"track_dirty_pages,omitempty"`
+	CPUTemplate     string `json:"cpu_template,omitempty"`
+	HugePages       string `json:"huge_pages,omitempty"`
+}
+
+// BootSource is the body of PUT /boot-source.
+type BootSource struct {
+	KernelImagePath string `json:"kernel_image_path"`
+	BootArgs        string `json:"boot_args,omitempty"`
+	InitrdPath      string `json:"initrd_path,omitempty"`
+}
+
+// TokenBucket configures one dimension of a RateLimiter.
+type TokenBucket struct {
+	Size         int64 `json:"size"`
+	RefillTime   int64 `json:"refill_time"`
+	OneTimeBurst int64 `json:"one_time_burst,omitempty"`
+}
+
+// RateLimiter limits a device by bandwidth and/or operations.
+type RateLimiter struct {
+	Bandwidth *TokenBucket `json:"bandwidth,omitempty"`
+	Ops       *TokenBucket `json:"ops,omitempty"`
+}
+
+// Drive is the body of PUT /drives/{drive_id}.
+type Drive struct {
+	DriveID      string       `json:"drive_id"`
+	PathOnHost   string       `json:"path_on_host,omitempty"`
+	IsRootDevice bool         `json:"is_root_device"`
+	IsReadOnly   bool         `json:"is_read_only"`
+	PartUUID     string       `json:"partuuid,omitempty"`
+	CacheType    string       `json:"cache_type,omitempty"`
+	IoEngine     string       `json:"io_engine,omitempty"`
+	RateLimiter  *RateLimiter `json:"rate_limiter,omitempty"`
+	Socket       string       `json:"socket,omitempty"`
+}
+
+// PartialDrive is the body of PATCH /drives/{drive_id}.
+type PartialDrive struct {
+	DriveID     string       `json:"drive_id"`
+	PathOnHost  string       `json:"path_on_host,omitempty"`
+	RateLimiter *RateLimiter `json:"rate_limiter,omitempty"`
+}
+
+// NetworkInterface is the body of PUT /network-interfaces/{iface_id}.
+type NetworkInterface struct {
+	IfaceID       string       `json:"iface_id"`
+	HostDevName   string       `json:"host_dev_name"`
+	GuestMAC      string       `json:"guest_mac,omitempty"`
+	RxRateLimiter *RateLimiter `json:"rx_rate_limiter,omitempty"`
+	TxRateLimiter *RateLimiter `json:"tx_rate_limiter,omitempty"`
+}
+
+// PartialNetworkInterface is the body of PATCH /network-interfaces/{iface_id}.
+type PartialNetworkInterface struct {
+	IfaceID       string       `json:"iface_id"`
+	RxRateLimiter *RateLimiter `json:"rx_rate_limiter,omitempty"`
+	TxRateLimiter *RateLimiter `json:"tx_rate_limiter,omitempty"`
+}
+
+// Vsock is the body of PUT /vsock.
+type Vsock struct {
+	GuestCID uint32 `json:"guest_cid"`
+	UDSPath  string `json:"uds_path"`
+}
+
+// Balloon is the body of PUT /balloon and the response of GET /balloon.
+type Balloon struct {
+	AmountMib             int  `json:"amount_mib"`
+	DeflateOnOom          bool `json:"deflate_on_oom"`
+	StatsPollingIntervalS int  `json:"stats_polling_interval_s,omitempty"`
+}
+
+// BalloonUpdate is the body of PATCH /balloon.
+type BalloonUpdate struct {
+	AmountMib int `json:"amount_mib"`
+}
+
+// BalloonStatsUpdate is the body of PATCH /balloon/statistics.
+type BalloonStatsUpdate struct {
+	StatsPollingIntervalS int `json:"stats_polling_interval_s"`
+}
+
+// BalloonStats is returned by GET /balloon/statistics.
+type BalloonStats struct {
+	TargetPages        int   `json:"target_pages"`
+	ActualPages        int   `json:"actual_pages"`
+	TargetMib          int   `json:"target_mib"`
+	ActualMib          int   `json:"actual_mib"`
+	SwapIn             int64 `json:"swap_in,omitempty"`
+	SwapOut            int64 `json:"swap_out,omitempty"`
+	MajorFaults        int64 `json:"major_faults,omitempty"`
+	MinorFaults        int64 `json:"minor_faults,omitempty"`
+	FreeMemory         int64 `json:"free_memory,omitempty"`
+	TotalMemory        int64 `json:"total_memory,omitempty"`
+	AvailableMemory    int64 `json:"available_memory,omitempty"`
+	DiskCaches         int64 `json:"disk_caches,omitempty"`
+	HugetlbAllocations int64 `json:"hugetlb_allocations,omitempty"`
+	HugetlbFailures    int64 `json:"hugetlb_failures,omitempty"`
+}
+
+// Logger is the body of PUT /logger.
+type Logger struct {
+	Level         string `json:"level,omitempty"`
+	LogPath       string `json:"log_path,omitempty"`
+	ShowLevel     bool   `json:"show_level,omitempty"`
+	ShowLogOrigin bool   `json:"show_log_origin,omitempty"`
+	Module        string `json:"module,omitempty"`
+}
+
+// Metrics is the body of PUT /metrics.
+type Metrics struct {
+	MetricsPath string `json:"metrics_path"`
+}
+
+// MmdsConfig is the body of PUT /mmds/config.
+type MmdsConfig struct {
+	Version           string   `json:"version,omitempty"` // "V1" or "V2"
+	NetworkInterfaces []string `json:"network_interfaces"`
+	IPv4Address       string   `json:"ipv4_address,omitempty"`
+}
+
+// EntropyDevice is the body of PUT /entropy.
+type EntropyDevice struct {
+	RateLimiter *RateLimiter `json:"rate_limiter,omitempty"`
+}
+
+// Snapshot types accepted by SnapshotCreateParams.
+const (
+	SnapshotFull = "Full"
+	SnapshotDiff = "Diff"
+)
+
+// SnapshotCreateParams is the body of PUT /snapshot/create.
+type SnapshotCreateParams struct {
+	MemFilePath  string `json:"mem_file_path"`
+	SnapshotPath string `json:"snapshot_path"`
+	SnapshotType string `json:"snapshot_type,omitempty"`
+}
+
+// MemoryBackend selects where guest memory is restored from.
+type MemoryBackend struct {
+	BackendType string `json:"backend_type"` // "File" or "Uffd"
+	BackendPath string `json:"backend_path"`
+}
+
+// SnapshotLoadParams is the body of PUT /snapshot/load.
+type SnapshotLoadParams struct {
+	SnapshotPath        string         `json:"snapshot_path"`
+	MemBackend          *MemoryBackend `json:"mem_backend,omitempty"`
+	MemFilePath         string         `json:"mem_file_path,omitempty"`
+	EnableDiffSnapshots bool           `json:"enable_diff_snapshots,omitempty"`
+	ResumeVM            bool           `json:"resume_vm,omitempty"`
+}
+
+// VM states accepted by PATCH /vm.
+const (
+	VMStatePaused  = "Paused"
+	VMStateResumed = "Resumed"
+)
+
+// VM is the body of PATCH /vm.
+type VM struct {
+	State string `json:"state"`
+}
+
+// FullVMConfiguration is returned by GET /vm/config.
+type FullVMConfiguration struct {
+	Balloon           *Balloon              `json:"balloon,omitempty"`
+	Drives            []Drive               `json:"drives,omitempty"`
+	BootSource        *BootSource           `json:"boot-source,omitempty"`
+	Logger            *Logger               `json:"logger,omitempty"`
+	MachineConfig     *MachineConfiguration `json:"machine-config,omitempty"`
+	Metrics           *Metrics              `json:"metrics,omitempty"`
+	MmdsConfig        *MmdsConfig           `json:"mmds-config,omitempty"`
+	NetworkInterfaces []NetworkInterface    `json:"network-interfaces,omitempty"`
+	Vsock             *Vsock                `json:"vsock,omitempty"`
+}
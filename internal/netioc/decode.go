@@ -0,0 +1,145 @@
+package netioc
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"time"
+)
+
+// IP protocol numbers the parser follows.
+const (
+	protoTCP = 6
+	protoUDP = 17
+)
+
+// TCP flags the parser looks at.
+const (
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpRST = 0x04
+	tcpACK = 0x10
+)
+
+// segment is a TCP or UDP packet with its link and IP layers stripped.
+type segment struct {
+	time    time.Time
+	proto   uint8
+	src     netip.AddrPort
+	dst     netip.AddrPort
+	flags   uint8
+	seq     uint32
+	payload []byte
+	length  int // frame length on the wire
+}
+
+// decodeEthernet strips Ethernet, VLAN tags and IP from frame. It reports
+// false for anything that is not TCP or UDP over IPv4 or IPv6, and for IP
+// fragments after the first.
+func decodeEthernet(frame []byte) (segment, bool) {
+	if len(frame) < 14 {
+		return segment{}, false
+	}
+	etherType := binary.BigEndian.Uint16(frame[12:])
+	rest := frame[14:]
+	for etherType == 0x8100 || etherType == 0x88a8 {
+		if len(rest) < 4 {
+			return segment{}, false
+		}
+		etherType = binary.BigEndian.Uint16(rest[2:])
+		rest = rest[4:]
+	}
+	switch etherType {
+	case 0x0800:
+		return decodeIPv4(rest)
+	case 0x86dd:
+		return decodeIPv6(rest)
+	}
+	return segment{}, false
+}
+
+func decodeIPv4(b []byte) (segment, bool) {
+	if len(b) < 20 || b[0]>>4 != 4 {
+		return segment{}, false
+	}
+	ihl := int(b[0]&0x0f) * 4
+	total := int(binary.BigEndian.Uint16(b[2:]))
+	if ihl < 20 || total < ihl || len(b) < ihl {
+		return segment{}, false
+	}
+	if binary.BigEndian.Uint16(b[6:])&0x1fff != 0 {
+		return segment{}, false // a later fragment has no transport header
+	}
+	if total < len(b) {
+		b = b[:total] // drop Ethernet padding
+	}
+	src := netip.AddrFrom4([4]byte(b[12:16]))
+	dst := netip.AddrFrom4([4]byte(b[16:20]))
+	return decodeTransport(b[9], src, dst, b[ihl:])
+}
+
+func decodeIPv6(b []byte) (segment, bool) {
+	if len(b) < 40 || b[0]>>4 != 6 {
+		return segment{}, false
+	}
+	if n := 40 + int(binary.BigEndian.Uint16(b[4:])); n < len(b) {
+		b = b[:n]
+	}
+	src := netip.AddrFrom16([16]byte(b[8:24]))
+	dst := netip.AddrFrom16([16]byte(b[24:40]))
+	next, rest := b[6], b[40:]
+	for {
+		switch next {
+		case 0, 43, 60: // hop-by-hop, routing, destination options
+			if len(rest) < 8 {
+				return segment{}, false
+			}
+			n := (int(rest[1]) + 1) * 8
+			if len(rest) < n {
+				return segment{}, false
+			}
+			next, rest = rest[0], rest[n:]
+		case 44: // fragment
+			if len(rest) < 8 || binary.BigEndian.Uint16(rest[2:])&0xfff8 != 0 {
+				return segment{}, false
+			}
+			next, rest = rest[0], rest[8:]
+		default:
+			return decodeTransport(next, src, dst, rest)
+		}
+	}
+}
+
+func decodeTransport(proto uint8, src, dst netip.Addr, b []byte) (segment, bool) {
+	switch proto {
+	case protoTCP:
+		if len(b) < 20 {
+			return segment{}, false
+		}
+		off := int(b[12]>>4) * 4
+		if off < 20 || off > len(b) {
+			return segment{}, false
+		}
+		return segment{
+			proto:   protoTCP,
+			src:     netip.AddrPortFrom(src, binary.BigEndian.Uint16(b[0:])),
+			dst:     netip.AddrPortFrom(dst, binary.BigEndian.Uint16(b[2:])),
+			seq:     binary.BigEndian.Uint32(b[4:]),
+			flags:   b[13],
+			payload: b[off:],
+		}, true
+	case protoUDP:
+		if len(b) < 8 {
+			return segment{}, false
+		}
+		if n := int(binary.BigEndian.Uint16(b[4:])); n >= 8 && n < len(b) {
+			b = b[:n]
+		}
+		return segment{
+			proto:   protoUDP,
+			src:     netip.AddrPortFrom(src, binary.BigEndian.Uint16(b[0:])),
+			dst:     netip.AddrPortFrom(dst, binary.BigEndian.Uint16(b[2:])),
+			payload: b[8:],
+		}, true
+	}
+	return segment{}, false
+}
@@ -0,0 +1,98 @@
+package netioc
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+var dnsTypes = map[uint16]string{
+	1: "A", 2: "NS", 5: "CNAME", 6: "SOA", 12: "PTR", 15: "MX", 16: "TXT",
+	28: "AAAA", 33: "SRV", 35: "NAPTR", 43: "DS", 48: "DNSKEY", 64: "SVCB",
+	65: "HTTPS", 99: "SPF", 255: "ANY",
+}
+
+// Question is one name a DNS query asked about.
+type Question struct {
+	Name string
+	Type string // A, AAAA, TXT, ...
+}
+
+// dnsQuestions returns the questions of msg when it is a query.
+func dnsQuestions(msg []byte) []Question {
+	if len(msg) < 12 || msg[2]&0x80 != 0 {
+		return nil // too short, or a response
+	}
+	n := int(binary.BigEndian.Uint16(msg[4:]))
+	var qs []Question
+	off := 12
+	for range min(n, 16) {
+		name, next, ok := dnsName(msg, off)
+		if !ok || next+4 > len(msg) {
+			break
+		}
+		qtype := binary.BigEndian.Uint16(msg[next:])
+		qs = append(qs, Question{Name: name, Type: dnsTypeName(qtype)})
+		off = next + 4
+	}
+	return qs
+}
+
+// dnsName reads the possibly compressed name at off and returns it with
+// the offset just past it.
+func dnsName(msg []byte, off int) (string, int, bool) {
+	var labels []string
+	end := -1
+	for hops := 0; hops < 32; {
+		if off >= len(msg) {
+			return "", 0, false
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.ToLower(strings.Join(labels, ".")), end, true
+		case n&0xc0 == 0xc0:
+			if off+2 > len(msg) {
+				return "", 0, false
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			hops++
+		case n&0xc0 != 0:
+			return "", 0, false
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, false
+			}
+			labels = append(labels, string(msg[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+	return "", 0, false
+}
+
+func dnsTypeName(t uint16) string {
+	if name, ok := dnsTypes[t]; ok {
+		return name
+	}
+	return "TYPE" + strconv.Itoa(int(t))
+}
+
+// dnsStream splits DNS over TCP into its length-prefixed messages.
+func dnsStream(b []byte) [][]byte {
+	var msgs [][]byte
+	for len(b) >= 2 {
+		n := int(binary.BigEndian.Uint16(b))
+		if n == 0 || 2+n > len(b) {
+			break
+		}
+		msgs = append(msgs, b[2:2+n])
+		b = b[2+n:]
+	}
+	return msgs
+}
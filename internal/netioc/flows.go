@@ -0,0 +1,196 @@
+package netioc
+
+import (
+	"net/netip"
+	"time"
+)
+
+const (
+	maxFlows       = 10000
+	maxStreamBytes = 64 << 10 // per direction; enough for requests and hellos
+	maxPending     = 64       // out-of-order segments held per direction
+	maxDatagrams   = 64       // kept per UDP flow
+)
+
+// Flow is one TCP connection or UDP conversation, oriented from the side
+// that started it, with what the parser found inside.
+type Flow struct {
+	Protocol string // "tcp" or "udp"
+	Client   netip.AddrPort
+	Server   netip.AddrPort
+	First    time.Time
+	Packets  int
+	Bytes    int64 // frame bytes, both directions
+
+	// ToServer and ToClient are the start of each TCP stream, in order.
+	ToServer []byte
+	ToClient []byte
+
+	// Datagrams are the first UDP payloads, both directions.
+	Datagrams []Datagram
+
+	HTTP []Request    // requests read from ToServer
+	TLS  *ClientHello // the hello opening ToServer
+	DNS  []Question   // queries carried over TCP
+
+	proto uint8
+	up    stream // client to server
+	down  stream // server to client
+}
+
+// Datagram is one UDP payload and, for DNS queries, what it asked.
+type Datagram struct {
+	Time     time.Time
+	ToServer bool
+	Payload  []byte
+	DNS      []Question
+}
+
+type flowKey struct {
+	proto    uint8
+	src, dst netip.AddrPort
+}
+
+type flowTable struct {
+	flows []*Flow
+	index map[flowKey]*Flow
+}
+
+// lookup returns seg's flow, starting one if there is room.
+func (t *flowTable) lookup(seg segment) (*Flow, bool) {
+	if f, ok := t.index[flowKey{seg.proto, seg.src, seg.dst}]; ok {
+		return f, true
+	}
+	if f, ok := t.index[flowKey{seg.proto, seg.dst, seg.src}]; ok {
+		return f, true
+	}
+	if len(t.flows) >= maxFlows {
+		return nil, false
+	}
+	if t.index == nil {
+		t.index = make(map[flowKey]*Flow)
+	}
+	f := &Flow{Protocol: "udp", proto: seg.proto, Client: seg.src, Server: seg.dst, First: seg.time}
+	if seg.proto == protoTCP {
+		f.Protocol = "tcp"
+	}
+	if fromServer(seg) {
+		f.Client, f.Server = seg.dst, seg.src
+	}
+	t.flows = append(t.flows, f)
+	t.index[flowKey{seg.proto, f.Client, f.Server}] = f
+	return f, true
+}
+
+// fromServer guesses whether the first packet seen of a flow came from its
+// server: a SYN-ACK did, and so does traffic from a well-known port to an
+// ephemeral one.
+func fromServer(seg segment) bool {
+	if seg.proto == protoTCP && seg.flags&tcpSYN != 0 {
+		return seg.flags&tcpACK != 0
+	}
+	return seg.src.Port() < 1024 && seg.dst.Port() >= 1024
+}
+
+// add accounts seg to f and keeps its payload: reassembled for TCP, as is
+// for UDP.
+func (f *Flow) add(seg segment) {
+	f.Packets++
+	f.Bytes += int64(seg.length)
+	toServer := seg.dst == f.Server
+	if f.proto == protoUDP {
+		if len(f.Datagrams) < maxDatagrams && len(seg.payload) > 0 {
+			d := Datagram{Time: seg.time, ToServer: toServer, Payload: append([]byte(nil), seg.payload...)}
+			if toServer && f.Server.Port() == 53 {
+				d.DNS = dnsQuestions(d.Payload)
+			}
+			f.Datagrams = append(f.Datagrams, d)
+		}
+		return
+	}
+	if toServer {
+		f.up.add(seg)
+	} else {
+		f.down.add(seg)
+	}
+}
+
+// finish parses the application layer out of a TCP flow's streams.
+func (f *Flow) finish() {
+	if f.proto != protoTCP {
+		return
+	}
+	f.ToServer, f.ToClient = f.up.data, f.down.data
+	switch b := f.ToServer; {
+	case isTLS(b):
+		if hello, ok := parseClientHello(b); ok {
+			f.TLS = hello
+		}
+	case isHTTP(b):
+		for _, req := range httpRequests(b) {
+			f.HTTP = append(f.HTTP, newRequest(req, f.Server.String()))
+		}
+	case f.Server.Port() == 53:
+		for _, msg := range dnsStream(b) {
+			f.DNS = append(f.DNS, dnsQuestions(msg)...)
+		}
+	}
+}
+
+// stream rebuilds one direction of a TCP connection from its segments,
+// keeping the first maxStreamBytes.
+type stream struct {
+	started bool
+	next    uint32 // sequence number of the byte after data
+	data    []byte
+	pending []segment
+}
+
+func (s *stream) add(seg segment) {
+	if seg.flags&tcpSYN != 0 {
+		s.started = true
+		s.next = seg.seq + 1
+		return
+	}
+	if len(seg.payload) == 0 || len(s.data) >= maxStreamBytes {
+		return
+	}
+	if !s.started {
+		// Joined mid-connection; take the first data seen as the start
+		s.started = true
+		s.next = seg.seq
+	}
+	if int32(seg.seq-s.next) > 0 {
+		if len(s.pending) < maxPending {
+			seg.payload = append([]byte(nil), seg.payload...)
+			s.pending = append(s.pending, seg)
+		}
+		return
+	}
+	s.append(seg)
+	for progress := true; progress; {
+		progress = false
+		for i := 0; i < len(s.pending); i++ {
+			if int32(s.pending[i].seq-s.next) <= 0 {
+				s.append(s.pending[i])
+				s.pending = append(s.pending[:i], s.pending[i+1:]...)
+				progress = true
+				i--
+			}
+		}
+	}
+}
+
+// append adds the part of seg past what is already assembled.
+func (s *stream) append(seg segment) {
+	skip := int(s.next - seg.seq)
+	if skip >= len(seg.payload) {
+		return // a retransmission
+	}
+	b := seg.payload[skip:]
+	if room := maxStreamBytes - len(s.data); len(b) > room {
+		b = b[:room]
+	}
+	s.data = append(s.data, b...)
+	s.next += uint32(len(seg.payload) - skip)
+}
@@ -0,0 +1,79 @@
+package netioc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var httpMethods = []string{"GET ", "POST ", "HEAD ", "PUT ", "DELETE ", "OPTIONS ", "PATCH ", "CONNECT ", "TRACE "}
+
+// isHTTP reports whether a client stream starts like an HTTP/1 request.
+func isHTTP(b []byte) bool {
+	for _, m := range httpMethods {
+		if bytes.HasPrefix(b, []byte(m)) {
+			return true
+		}
+	}
+	return false
+}
+
+// httpRequests parses the requests a client sent on one connection,
+// stopping at the first it cannot read in full.
+func httpRequests(b []byte) []*http.Request {
+	br := bufio.NewReader(bytes.NewReader(b))
+	var reqs []*http.Request
+	for len(reqs) < 100 {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			break
+		}
+		reqs = append(reqs, req)
+		if _, err := io.Copy(io.Discard, req.Body); err != nil {
+			break
+		}
+	}
+	return reqs
+}
+
+// Request is one HTTP request a client sent.
+type Request struct {
+	Method    string
+	Host      string // the Host header, or the server address without one
+	URI       string // as written on the request line
+	URL       string // absolute
+	UserAgent string
+}
+
+func newRequest(req *http.Request, dst string) Request {
+	host := requestHost(req, dst)
+	return Request{
+		Method:    req.Method,
+		Host:      host,
+		URI:       req.RequestURI,
+		URL:       requestURL(req, host),
+		UserAgent: req.UserAgent(),
+	}
+}
+
+// requestURL is the absolute URL a request asked for.
+func requestURL(req *http.Request, host string) string {
+	if req.URL.IsAbs() {
+		return req.URL.String()
+	}
+	if req.Method == http.MethodConnect {
+		return req.RequestURI
+	}
+	return "http://" + host + req.URL.RequestURI()
+}
+
+// requestHost prefers the Host header and falls back to the address the
+// request went to.
+func requestHost(req *http.Request, dst string) string {
+	if h := strings.ToLower(req.Host); h != "" {
+		return h
+	}
+	return dst
+}
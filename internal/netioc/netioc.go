@@ -0,0 +1,156 @@
+// Package netioc turns a guest's packet capture into network indicators:
+// DNS queries, HTTP requests, TLS ClientHellos with their JA3 fingerprints
+// and the addresses the guest contacted.
+package netioc
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+	"github.com/sudankdk/firecracker/internal/pcap"
+)
+
+// Trace is a parsed capture: the indicators for the job report and the
+// flows they were read from, for callers that look deeper.
+type Trace struct {
+	Report *domain.NetworkReport
+	Flows  []*Flow
+}
+
+// Parse reads the pcapng file at path. A damaged or cut-short file still
+// yields what was read before the damage, with Report.Error set.
+func Parse(path string) (*Trace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := pcap.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &domain.NetworkReport{}
+	var flows flowTable
+	for {
+		p, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			rep.Error = err.Error()
+			break
+		}
+		rep.Packets++
+		rep.Bytes += int64(p.Length)
+		if p.LinkType != pcap.LinkTypeEthernet {
+			continue
+		}
+		seg, ok := decodeEthernet(p.Data)
+		if !ok {
+			continue
+		}
+		seg.time, seg.length = p.Time, p.Length
+		if f, ok := flows.lookup(seg); ok {
+			f.add(seg)
+		}
+	}
+	rep.Truncated = r.Dropped() > 0
+
+	for _, f := range flows.flows {
+		f.finish()
+	}
+	summarize(rep, flows.flows)
+	return &Trace{Report: rep, Flows: flows.flows}, nil
+}
+
+// summarize fills rep's indicator lists from flows, repeats counted once
+// and each list in order of first sight. Entries are appended as they are
+// met and sorted stably, so ties on FirstSeen keep capture order.
+func summarize(rep *domain.NetworkReport, flows []*Flow) {
+	dns := make(map[Question]int)
+	http := make(map[string]int)
+	tls := make(map[string]int)
+	contacts := make(map[string]int)
+
+	addDNS := func(q Question, at time.Time) {
+		if i, ok := dns[q]; ok {
+			rep.DNS[i].Count++
+			return
+		}
+		dns[q] = len(rep.DNS)
+		rep.DNS = append(rep.DNS, domain.DNSQuery{Name: q.Name, Type: q.Type, Count: 1, FirstSeen: at})
+	}
+
+	for _, f := range flows {
+		dst := f.Server.String()
+		key := f.Protocol + "/" + dst
+		i, ok := contacts[key]
+		if !ok {
+			i = len(rep.Contacts)
+			contacts[key] = i
+			rep.Contacts = append(rep.Contacts, domain.Contact{
+				Protocol:  f.Protocol,
+				IP:        f.Server.Addr().String(),
+				Port:      int(f.Server.Port()),
+				FirstSeen: f.First,
+			})
+		}
+		c := &rep.Contacts[i]
+		c.Flows++
+		c.Packets += f.Packets
+		c.Bytes += f.Bytes
+
+		for _, d := range f.Datagrams {
+			for _, q := range d.DNS {
+				addDNS(q, d.Time)
+			}
+		}
+		for _, q := range f.DNS {
+			addDNS(q, f.First)
+		}
+		for _, req := range f.HTTP {
+			key := req.Method + " " + req.URL + "\x00" + req.UserAgent + "\x00" + dst
+			if i, ok := http[key]; ok {
+				rep.HTTP[i].Count++
+				continue
+			}
+			http[key] = len(rep.HTTP)
+			rep.HTTP = append(rep.HTTP, domain.HTTPRequest{
+				Method:    req.Method,
+				Host:      req.Host,
+				URL:       req.URL,
+				UserAgent: req.UserAgent,
+				Dst:       dst,
+				Count:     1,
+				FirstSeen: f.First,
+			})
+		}
+		if h := f.TLS; h != nil {
+			key := h.SNI + "\x00" + h.JA3 + "\x00" + dst
+			if i, ok := tls[key]; ok {
+				rep.TLS[i].Count++
+			} else {
+				tls[key] = len(rep.TLS)
+				rep.TLS = append(rep.TLS, domain.TLSHello{
+					SNI:       h.SNI,
+					Version:   tlsVersionName(h.Version),
+					JA3:       h.JA3,
+					JA3Hash:   JA3Hash(h.JA3),
+					Dst:       dst,
+					Count:     1,
+					FirstSeen: f.First,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(rep.DNS, func(i, j int) bool { return rep.DNS[i].FirstSeen.Before(rep.DNS[j].FirstSeen) })
+	sort.SliceStable(rep.HTTP, func(i, j int) bool { return rep.HTTP[i].FirstSeen.Before(rep.HTTP[j].FirstSeen) })
+	sort.SliceStable(rep.TLS, func(i, j int) bool { return rep.TLS[i].FirstSeen.Before(rep.TLS[j].FirstSeen) })
+	sort.SliceStable(rep.Contacts, func(i, j int) bool { return rep.Contacts[i].FirstSeen.Before(rep.Contacts[j].FirstSeen) })
+}
@@ -0,0 +1,293 @@
+package netioc
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/pcap"
+)
+
+var (
+	guestIP = netip.MustParseAddr("10.0.0.2")
+	dnsIP   = netip.MustParseAddr("10.0.0.1")
+	webIP   = netip.MustParseAddr("93.184.216.34")
+	c2IP    = netip.MustParseAddr("198.51.100.7")
+)
+
+// ipv4Frame wraps an IPv4 packet carrying transport in an Ethernet frame.
+func ipv4Frame(proto uint8, src, dst netip.Addr, transport []byte) []byte {
+	f := make([]byte, 14, 14+20+len(transport))
+	binary.BigEndian.PutUint16(f[12:], 0x0800)
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(transport)))
+	ip[8] = 64
+	ip[9] = proto
+	copy(ip[12:], src.AsSlice())
+	copy(ip[16:], dst.AsSlice())
+	return append(append(f, ip...), transport...)
+}
+
+func udpFrame(src, dst netip.AddrPort, payload []byte) []byte {
+	h := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(h[0:], src.Port())
+	binary.BigEndian.PutUint16(h[2:], dst.Port())
+	binary.BigEndian.PutUint16(h[4:], uint16(8+len(payload)))
+	return ipv4Frame(protoUDP, src.Addr(), dst.Addr(), append(h, payload...))
+}
+
+func tcpFrame(src, dst netip.AddrPort, seq uint32, flags uint8, payload []byte) []byte {
+	h := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(h[0:], src.Port())
+	binary.BigEndian.PutUint16(h[2:], dst.Port())
+	binary.BigEndian.PutUint32(h[4:], seq)
+	h[12] = 5 << 4
+	h[13] = flags
+	binary.BigEndian.PutUint16(h[14:], 65535)
+	return ipv4Frame(protoTCP, src.Addr(), dst.Addr(), append(h, payload...))
+}
+
+// dnsMessage is a one-question message for name; answer makes it a
+// response carrying that address.
+func dnsMessage(id uint16, name string, qtype uint16, answer netip.Addr) []byte {
+	m := binary.BigEndian.AppendUint16(nil, id)
+	if answer.IsValid() {
+		m = append(m, 0x81, 0x80, 0, 1, 0, 1, 0, 0, 0, 0)
+	} else {
+		m = append(m, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0)
+	}
+	for _, label := range splitLabels(name) {
+		m = append(m, byte(len(label)))
+		m = append(m, label...)
+	}
+	m = append(m, 0)
+	m = binary.BigEndian.AppendUint16(m, qtype)
+	m = binary.BigEndian.AppendUint16(m, 1)
+	if answer.IsValid() {
+		m = append(m, 0xc0, 12) // pointer to the question's name
+		m = binary.BigEndian.AppendUint16(m, qtype)
+		m = binary.BigEndian.AppendUint16(m, 1)
+		m = binary.BigEndian.AppendUint32(m, 300)
+		m = binary.BigEndian.AppendUint16(m, 4)
+		m = append(m, answer.AsSlice()...)
+	}
+	return m
+}
+
+func splitLabels(name string) []string {
+	var labels []string
+	start := 0
+	for i := range len(name) {
+		if name[i] == '.' {
+			labels = append(labels, name[start:i])
+			start = i + 1
+		}
+	}
+	return append(labels, name[start:])
+}
+
+// ja3Hello is a TLS 1.0 ClientHello whose JA3 is the example in the JA3
+// README, with GREASE values added that the fingerprint must ignore.
+func ja3Hello(sni string) []byte {
+	ext := func(b []byte, typ uint16, data []byte) []byte {
+		b = binary.BigEndian.AppendUint16(b, typ)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+		return append(b, data...)
+	}
+	u16s := func(vs ...uint16) []byte {
+		var b []byte
+		for _, v := range vs {
+			b = binary.BigEndian.AppendUint16(b, v)
+		}
+		return b
+	}
+
+	body := u16s(0x0301)
+	body = append(body, make([]byte, 32)...) // random
+	body = append(body, 0)                   // session ID
+	ciphers := u16s(0x0a0a, 47, 53, 5, 10, 49161, 49162, 49171, 49172, 50, 56, 19, 4)
+	body = append(binary.BigEndian.AppendUint16(body, uint16(len(ciphers))), ciphers...)
+	body = append(body, 1, 0) // null compression
+
+	name := append([]byte{0}, binary.BigEndian.AppendUint16(nil, uint16(len(sni)))...)
+	name = append(name, sni...)
+	groups := u16s(0x2a2a, 23, 24, 25)
+
+	var exts []byte
+	exts = ext(exts, 0x1a1a, nil)
+	exts = ext(exts, extServerName, append(u16s(uint16(len(name))), name...))
+	exts = ext(exts, extSupportedGroups, append(u16s(uint16(len(groups))), groups...))
+	exts = ext(exts, extPointFormats, []byte{1, 0})
+	body = append(binary.BigEndian.AppendUint16(body, uint16(len(exts))), exts...)
+
+	hs := []byte{1, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}
+	hs = append(hs, body...)
+	rec := []byte{0x16, 3, 1}
+	rec = binary.BigEndian.AppendUint16(rec, uint16(len(hs)))
+	return append(rec, hs...)
+}
+
+func writeCapture(t *testing.T, base time.Time, frames []struct {
+	at    time.Duration
+	frame []byte
+}) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "capture.pcapng")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := pcap.NewWriter(f, pcap.LinkTypeEthernet, pcap.SnapLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fr := range frames {
+		w.WritePacket(pcap.Packet{Time: base.Add(fr.at), Data: fr.frame, Length: len(fr.frame)})
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseIndicators(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	resolver := netip.AddrPortFrom(dnsIP, 53)
+	web := netip.AddrPortFrom(webIP, 80)
+	c2 := netip.AddrPortFrom(c2IP, 443)
+	q1 := netip.AddrPortFrom(guestIP, 40000)
+	q2 := netip.AddrPortFrom(guestIP, 40001)
+	httpClient := netip.AddrPortFrom(guestIP, 40100)
+	tlsClient := netip.AddrPortFrom(guestIP, 40200)
+
+	request := []byte("GET /payload.exe HTTP/1.1\r\nHost: Evil.Test\r\nUser-Agent: curl/8.0\r\n\r\n")
+	hello := ja3Hello("C2.Example.NET")
+
+	path := writeCapture(t, base, []struct {
+		at    time.Duration
+		frame []byte
+	}{
+		{0, udpFrame(q1, resolver, dnsMessage(1, "Example.COM", 1, netip.Addr{}))},
+		{time.Millisecond, udpFrame(resolver, q1, dnsMessage(1, "example.com", 1, webIP))},
+		{2 * time.Millisecond, udpFrame(q2, resolver, dnsMessage(2, "example.com", 1, netip.Addr{}))},
+		{2 * time.Millisecond, udpFrame(q2, resolver, dnsMessage(3, "example.com", 28, netip.Addr{}))},
+
+		{10 * time.Millisecond, tcpFrame(httpClient, web, 1000, tcpSYN, nil)},
+		{11 * time.Millisecond, tcpFrame(web, httpClient, 5000, tcpSYN|tcpACK, nil)},
+		// The request arrives in two segments, the second one first
+		{12 * time.Millisecond, tcpFrame(httpClient, web, 1001+20, tcpACK, request[20:])},
+		{13 * time.Millisecond, tcpFrame(httpClient, web, 1001, tcpACK, request[:20])},
+
+		{20 * time.Millisecond, tcpFrame(tlsClient, c2, 7000, tcpSYN, nil)},
+		{21 * time.Millisecond, tcpFrame(tlsClient, c2, 7001, tcpACK, hello)},
+	})
+
+	trace, err := Parse(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := trace.Report
+	if rep.Error != "" || rep.Packets != 10 {
+		t.Fatalf("packets=%d error=%q", rep.Packets, rep.Error)
+	}
+
+	// The response is not a query, and the repeat is counted once
+	if len(rep.DNS) != 2 {
+		t.Fatalf("DNS = %+v", rep.DNS)
+	}
+	if d := rep.DNS[0]; d.Name != "example.com" || d.Type != "A" || d.Count != 2 || !d.FirstSeen.Equal(base) {
+		t.Errorf("DNS[0] = %+v", d)
+	}
+	if d := rep.DNS[1]; d.Name != "example.com" || d.Type != "AAAA" || d.Count != 1 {
+		t.Errorf("DNS[1] = %+v", d)
+	}
+
+	if len(rep.HTTP) != 1 {
+		t.Fatalf("HTTP = %+v", rep.HTTP)
+	}
+	if h := rep.HTTP[0]; h.Method != "GET" || h.Host != "evil.test" || h.URL != "http://evil.test/payload.exe" ||
+		h.UserAgent != "curl/8.0" || h.Dst != "93.184.216.34:80" {
+		t.Errorf("HTTP[0] = %+v", h)
+	}
+
+	if len(rep.TLS) != 1 {
+		t.Fatalf("TLS = %+v", rep.TLS)
+	}
+	tls := rep.TLS[0]
+	if tls.JA3 != "769,47-53-5-10-49161-49162-49171-49172-50-56-19-4,0-10-11,23-24-25,0" {
+		t.Errorf("JA3 = %s", tls.JA3)
+	}
+	if tls.JA3Hash != "ada70206e40642a3e4461f35503241d5" {
+		t.Errorf("JA3 hash = %s", tls.JA3Hash)
+	}
+	if tls.SNI != "c2.example.net" || tls.Version != "TLS 1.0" || tls.Dst != "198.51.100.7:443" {
+		t.Errorf("TLS[0] = %+v", tls)
+	}
+
+	want := []struct {
+		proto string
+		dst   string
+		flows int
+	}{
+		{"udp", "10.0.0.1", 2},
+		{"tcp", "93.184.216.34", 1},
+		{"tcp", "198.51.100.7", 1},
+	}
+	if len(rep.Contacts) != len(want) {
+		t.Fatalf("contacts = %+v", rep.Contacts)
+	}
+	for i, w := range want {
+		if c := rep.Contacts[i]; c.Protocol != w.proto || c.IP != w.dst || c.Flows != w.flows {
+			t.Errorf("contact %d = %+v, want %+v", i, c, w)
+		}
+	}
+}
+
+func TestSummarizeTiesKeepCaptureOrder(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var frames []struct {
+		at    time.Duration
+		frame []byte
+	}
+	var names []string
+	for i := range 20 {
+		name := string(rune('a'+i)) + ".example"
+		names = append(names, name)
+		src := netip.AddrPortFrom(guestIP, uint16(41000+i))
+		dst := netip.AddrPortFrom(netip.AddrFrom4([4]byte{10, 0, 1, byte(i + 1)}), 53)
+		frames = append(frames, struct {
+			at    time.Duration
+			frame []byte
+		}{0, udpFrame(src, dst, dnsMessage(uint16(i), name, 1, netip.Addr{}))})
+	}
+	path := writeCapture(t, base, frames)
+
+	for range 5 {
+		trace, err := Parse(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, d := range trace.Report.DNS {
+			if d.Name != names[i] {
+				t.Fatalf("DNS[%d] = %s, want %s", i, d.Name, names[i])
+			}
+		}
+		for i, c := range trace.Report.Contacts {
+			if want := netip.AddrFrom4([4]byte{10, 0, 1, byte(i + 1)}).String(); c.IP != want {
+				t.Fatalf("contact %d = %s, want %s", i, c.IP, want)
+			}
+		}
+	}
+}
+
+func TestJA3HashKnown(t *testing.T) {
+	// The second example in the JA3 README: a hello with no extensions
+	if got := JA3Hash("769,4-5-10-9-100-98-3-6-19-18-99,,,"); got != "de350869b8c85de67a350c8d186f11e6" {
+		t.Errorf("got %s", got)
+	}
+}
@@ -0,0 +1,184 @@
+package netioc
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ClientHello is what the parser keeps of a TLS ClientHello.
+type ClientHello struct {
+	SNI     string
+	Version uint16 // the highest offered; TLS 1.3 only says so in an extension
+	JA3     string
+}
+
+// Extensions read for SNI and JA3.
+const (
+	extServerName        = 0
+	extSupportedGroups   = 10
+	extPointFormats      = 11
+	extSupportedVersions = 43
+)
+
+var tlsVersions = map[uint16]string{
+	0x0300: "SSL 3.0", 0x0301: "TLS 1.0", 0x0302: "TLS 1.1", 0x0303: "TLS 1.2", 0x0304: "TLS 1.3",
+}
+
+// isTLS reports whether a client stream starts with a handshake record.
+func isTLS(b []byte) bool {
+	return len(b) >= 6 && b[0] == 0x16 && b[1] == 3 && b[5] == 1
+}
+
+// parseClientHello reads the ClientHello at the start of a client stream,
+// which may span several records.
+func parseClientHello(b []byte) (*ClientHello, bool) {
+	var hs []byte
+	for len(b) >= 5 && b[0] == 0x16 {
+		n := int(binary.BigEndian.Uint16(b[3:]))
+		if 5+n > len(b) {
+			hs = append(hs, b[5:]...)
+			break
+		}
+		hs = append(hs, b[5:5+n]...)
+		b = b[5+n:]
+		if len(hs) >= 4 && len(hs) >= 4+int(uint32(hs[1])<<16|uint32(hs[2])<<8|uint32(hs[3])) {
+			break
+		}
+	}
+	if len(hs) < 4 || hs[0] != 1 {
+		return nil, false
+	}
+	body := hs[4:]
+	if n := int(uint32(hs[1])<<16 | uint32(hs[2])<<8 | uint32(hs[3])); n < len(body) {
+		body = body[:n]
+	}
+
+	r := reader{b: body}
+	version := r.u16()
+	r.skip(32) // random
+	r.skip(int(r.u8()))
+	ciphers := r.bytes(int(r.u16()))
+	r.skip(int(r.u8())) // compression methods
+	if r.bad {
+		return nil, false
+	}
+	hello := &ClientHello{Version: version}
+
+	var exts, groups, formats []string
+	extData := r.bytes(int(r.u16()))
+	er := reader{b: extData}
+	for !er.bad && len(er.b) >= 4 {
+		typ := er.u16()
+		data := er.bytes(int(er.u16()))
+		if er.bad {
+			break
+		}
+		if !grease(typ) {
+			exts = append(exts, strconv.Itoa(int(typ)))
+		}
+		switch typ {
+		case extServerName:
+			hello.SNI = serverName(data)
+		case extSupportedGroups:
+			gr := reader{b: data}
+			list := reader{b: gr.bytes(int(gr.u16()))}
+			for len(list.b) >= 2 {
+				if g := list.u16(); !grease(g) {
+					groups = append(groups, strconv.Itoa(int(g)))
+				}
+			}
+		case extSupportedVersions:
+			vr := reader{b: data}
+			list := reader{b: vr.bytes(int(vr.u8()))}
+			for len(list.b) >= 2 {
+				if v := list.u16(); !grease(v) && v > hello.Version && v <= 0x0304 {
+					hello.Version = v
+				}
+			}
+		case extPointFormats:
+			pr := reader{b: data}
+			for _, f := range pr.bytes(int(pr.u8())) {
+				formats = append(formats, strconv.Itoa(int(f)))
+			}
+		}
+	}
+
+	var suites []string
+	for i := 0; i+1 < len(ciphers); i += 2 {
+		if c := binary.BigEndian.Uint16(ciphers[i:]); !grease(c) {
+			suites = append(suites, strconv.Itoa(int(c)))
+		}
+	}
+	hello.JA3 = fmt.Sprintf("%d,%s,%s,%s,%s", version,
+		strings.Join(suites, "-"), strings.Join(exts, "-"),
+		strings.Join(groups, "-"), strings.Join(formats, "-"))
+	return hello, true
+}
+
+// serverName returns the first host_name in a server_name extension.
+func serverName(data []byte) string {
+	r := reader{b: data}
+	list := reader{b: r.bytes(int(r.u16()))}
+	for !list.bad && len(list.b) >= 3 {
+		typ := list.u8()
+		name := list.bytes(int(list.u16()))
+		if typ == 0 && !list.bad {
+			return strings.ToLower(string(name))
+		}
+	}
+	return ""
+}
+
+// grease reports RFC 8701 values, which JA3 leaves out.
+func grease(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// JA3Hash is the MD5 of a JA3 string, the form threat feeds list.
+func JA3Hash(ja3 string) string {
+	sum := md5.Sum([]byte(ja3))
+	return hex.EncodeToString(sum[:])
+}
+
+func tlsVersionName(v uint16) string {
+	if name, ok := tlsVersions[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", v)
+}
+
+// reader consumes big-endian fields, turning bad once it runs short.
+type reader struct {
+	b   []byte
+	bad bool
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.bad || n > len(r.b) {
+		r.bad = true
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) skip(n int) { r.bytes(n) }
+
+func (r *reader) u8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) u16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
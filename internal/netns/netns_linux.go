@@ -0,0 +1,46 @@
+// Package netns runs setup code inside a Linux network namespace. Sockets
+// keep the namespace they were created in, so only their creation needs to
+// happen there.
+package netns
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// Do runs fn on a thread switched into the network namespace at path, or
+// in the current one when path is "". If the thread cannot be switched back
+// it is left locked, so the runtime retires it rather than reuse it in the
+// wrong namespace.
+func Do(path string, fn func() error) error {
+	if path == "" {
+		return fn()
+	}
+	target, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("netns: %w", err)
+	}
+	defer target.Close()
+
+	runtime.LockOSThread()
+	self, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("netns: %w", err)
+	}
+	defer self.Close()
+
+	if err := unix.Setns(int(target.Fd()), unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("netns: enter %s: %w", path, err)
+	}
+	fnErr := fn()
+	if err := unix.Setns(int(self.Fd()), unix.CLONE_NEWNET); err != nil {
+		return fmt.Errorf("netns: leave %s: %w", path, err)
+	}
+	runtime.UnlockOSThread()
+	return fnErr
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package netns
+
+import "errors"
+
+func Do(path string, fn func() error) error {
+	if path == "" {
+		return fn()
+	}
+	return errors.New("netns: network namespaces need Linux")
+}
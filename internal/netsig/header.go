@@ -0,0 +1,156 @@
+package netsig
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Variables a rule header may use. The guest is the only host on its
+// network, so every address variable is any.
+var addrVars = map[string]string{
+	"$HOME_NET": "any", "$EXTERNAL_NET": "any", "$DNS_SERVERS": "any",
+	"$HTTP_SERVERS": "any", "$SMTP_SERVERS": "any", "$SQL_SERVERS": "any",
+}
+
+var portVars = map[string]string{
+	"$HTTP_PORTS": "[80,8080]", "$SSL_PORTS": "[443,8443]", "$SHELLCODE_PORTS": "!80",
+	"$ORACLE_PORTS": "1521", "$SSH_PORTS": "22", "$DNS_PORTS": "53", "$FILE_DATA_PORTS": "[80,8080,110,143]",
+}
+
+// set is a header field: any, a single address or port range, or a list
+// of members, any of which may be negated. A list matches what its
+// positive members match (everything, when there are none) minus what its
+// negated members match.
+type set[T any] struct {
+	negate  bool
+	any     bool
+	leaf    func(T) bool
+	members []set[T]
+}
+
+func (s set[T]) match(v T) bool {
+	var m bool
+	switch {
+	case s.any:
+		m = true
+	case s.leaf != nil:
+		m = s.leaf(v)
+	default:
+		hasPositive, inPositive, excluded := false, false, false
+		for _, member := range s.members {
+			if member.negate {
+				// A negated member fails exactly on what it excludes
+				excluded = excluded || !member.match(v)
+				continue
+			}
+			hasPositive = true
+			inPositive = inPositive || member.match(v)
+		}
+		m = (inPositive || !hasPositive) && !excluded
+	}
+	return m != s.negate
+}
+
+type (
+	addrSet = set[netip.Addr]
+	portSet = set[uint16]
+)
+
+func parseSet[T any](s string, vars map[string]string, leaf func(string) (func(T) bool, error)) (set[T], error) {
+	s = strings.TrimSpace(s)
+	if v, ok := vars[s]; ok {
+		s = v
+	}
+	if strings.HasPrefix(s, "!") {
+		inner, err := parseSet(s[1:], vars, leaf)
+		inner.negate = !inner.negate
+		return inner, err
+	}
+	switch {
+	case s == "any":
+		return set[T]{any: true}, nil
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return set[T]{}, fmt.Errorf("unterminated list %q", s)
+		}
+		var list set[T]
+		for _, part := range splitList(s[1 : len(s)-1]) {
+			member, err := parseSet(part, vars, leaf)
+			if err != nil {
+				return list, err
+			}
+			list.members = append(list.members, member)
+		}
+		return list, nil
+	}
+	fn, err := leaf(s)
+	return set[T]{leaf: fn}, err
+}
+
+func parseAddrs(s string) (addrSet, error) {
+	return parseSet(s, addrVars, func(s string) (func(netip.Addr) bool, error) {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			a, aerr := netip.ParseAddr(s)
+			if aerr != nil {
+				return nil, fmt.Errorf("address %q", s)
+			}
+			p = netip.PrefixFrom(a, a.BitLen())
+		}
+		p = p.Masked()
+		return func(a netip.Addr) bool { return p.Contains(a.Unmap()) }, nil
+	})
+}
+
+func parsePorts(s string) (portSet, error) {
+	return parseSet(s, portVars, func(s string) (func(uint16) bool, error) {
+		lo, hi, isRange := strings.Cut(s, ":")
+		first, err := portNumber(lo, 0)
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if isRange {
+			if last, err = portNumber(hi, 65535); err != nil {
+				return nil, err
+			}
+		}
+		if last < first {
+			return nil, fmt.Errorf("port range %q", s)
+		}
+		return func(p uint16) bool { return p >= first && p <= last }, nil
+	})
+}
+
+func portNumber(s string, empty uint16) (uint16, error) {
+	if s == "" {
+		return empty, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("port %q", s)
+	}
+	return uint16(n), nil
+}
+
+// splitList splits the inside of "[a,b,[c,d]]" into its top-level members.
+func splitList(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
@@ -0,0 +1,321 @@
+package netsig
+
+import (
+	"bytes"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/netioc"
+)
+
+// matcher is a content or pcre option, in rule order.
+type matcher interface {
+	bufferName() string
+}
+
+// content is one content option and its modifiers.
+type content struct {
+	buffer   string
+	pattern  []byte
+	lower    []byte // pattern, lowercased for nocase
+	negate   bool
+	nocase   bool
+	offset   int
+	depth    int // 0 means to the end
+	relative bool
+	distance int
+	within   int // 0 means to the end
+	endswith bool
+}
+
+func (c *content) bufferName() string { return c.buffer }
+
+func (c *content) modify(key, value string) error {
+	num := func() (int, error) {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, &optionError{key, value}
+		}
+		return n, nil
+	}
+	var err error
+	switch key {
+	case "nocase":
+		c.nocase = true
+		c.lower = bytes.ToLower(c.pattern)
+	case "offset":
+		c.offset, err = num()
+	case "depth":
+		c.depth, err = num()
+	case "distance":
+		c.relative = true
+		c.distance, err = num()
+	case "within":
+		c.relative = true
+		c.within, err = num()
+	case "startswith":
+		c.offset, c.depth = 0, len(c.pattern)
+	case "endswith":
+		c.endswith = true
+	}
+	if err == nil && (c.offset < 0 || c.depth < 0 || c.within < 0) {
+		err = &optionError{key, value}
+	}
+	return err
+}
+
+type optionError struct{ key, value string }
+
+func (e *optionError) Error() string { return e.key + ": bad value " + strconv.Quote(e.value) }
+
+// window is where c may match in a buffer of n bytes when the previous
+// match in the same buffer ended at prev.
+func (c *content) window(n, prev int) (lo, hi int) {
+	lo, hi = c.offset, n
+	if c.depth > 0 {
+		hi = c.offset + c.depth
+	}
+	if c.relative {
+		lo = prev + c.distance
+		hi = n
+		if c.within > 0 {
+			hi = lo + c.within
+		}
+	}
+	return max(lo, 0), min(hi, n)
+}
+
+// pcre is one pcre option.
+type pcre struct {
+	buffer string
+	re     *regexp.Regexp
+	negate bool
+}
+
+func (p *pcre) bufferName() string { return p.buffer }
+
+// unit is what one rule evaluation sees: a direction of a flow and the
+// buffers read from it.
+type unit struct {
+	flow     *netioc.Flow
+	toServer bool
+	time     time.Time
+	buffers  map[string][]byte
+	lower    map[string][]byte
+}
+
+func (u *unit) buffer(name string, nocase bool) ([]byte, bool) {
+	b, ok := u.buffers[name]
+	if !ok || !nocase {
+		return b, ok
+	}
+	if l, ok := u.lower[name]; ok {
+		return l, true
+	}
+	if u.lower == nil {
+		u.lower = make(map[string][]byte)
+	}
+	l := bytes.ToLower(b)
+	u.lower[name] = l
+	return l, true
+}
+
+// units splits a flow into what rules are evaluated against: one unit per
+// HTTP request, DNS question or UDP datagram, and one per TCP direction.
+func units(f *netioc.Flow) []*unit {
+	var out []*unit
+	add := func(toServer bool, at time.Time, bufs map[string][]byte) {
+		out = append(out, &unit{flow: f, toServer: toServer, time: at, buffers: bufs})
+	}
+	if f.Protocol == "udp" {
+		for _, d := range f.Datagrams {
+			if len(d.DNS) == 0 {
+				add(d.ToServer, d.Time, map[string][]byte{bufPayload: d.Payload})
+			}
+			for _, q := range d.DNS {
+				add(d.ToServer, d.Time, map[string][]byte{bufPayload: d.Payload, bufDNSQuery: []byte(q.Name)})
+			}
+		}
+		if len(f.Datagrams) == 0 {
+			add(true, f.First, map[string][]byte{bufPayload: nil})
+		}
+		return out
+	}
+
+	base := func() map[string][]byte {
+		bufs := map[string][]byte{bufPayload: f.ToServer}
+		if f.TLS != nil {
+			bufs[bufJA3Hash] = []byte(netioc.JA3Hash(f.TLS.JA3))
+			if f.TLS.SNI != "" {
+				bufs[bufTLSSNI] = []byte(f.TLS.SNI)
+			}
+		}
+		return bufs
+	}
+	switch {
+	case len(f.HTTP) > 0:
+		for _, req := range f.HTTP {
+			bufs := base()
+			bufs[bufHTTPURI] = []byte(req.URI)
+			bufs[bufHTTPHost] = []byte(req.Host)
+			bufs[bufHTTPMeth] = []byte(req.Method)
+			bufs[bufHTTPUA] = []byte(req.UserAgent)
+			add(true, f.First, bufs)
+		}
+	case len(f.DNS) > 0:
+		for _, q := range f.DNS {
+			bufs := base()
+			bufs[bufDNSQuery] = []byte(q.Name)
+			add(true, f.First, bufs)
+		}
+	default:
+		add(true, f.First, base())
+	}
+	if len(f.ToClient) > 0 {
+		add(false, f.First, map[string][]byte{bufPayload: f.ToClient})
+	}
+	return out
+}
+
+// applies checks r's protocol, flow direction and header against u.
+func (r *Rule) applies(u *unit) bool {
+	f := u.flow
+	_, hasDNS := u.buffers[bufDNSQuery]
+	_, hasHTTP := u.buffers[bufHTTPURI]
+	_, hasTLS := u.buffers[bufJA3Hash]
+	switch r.proto {
+	case "tcp", "udp":
+		if f.Protocol != r.proto {
+			return false
+		}
+	case "dns":
+		if !hasDNS && f.Server.Port() != 53 {
+			return false
+		}
+	case "http":
+		if !hasHTTP {
+			return false
+		}
+	case "tls":
+		if !hasTLS {
+			return false
+		}
+	}
+	switch r.flow {
+	case flowToServer:
+		if !u.toServer {
+			return false
+		}
+	case flowToClient:
+		if u.toServer {
+			return false
+		}
+	}
+	src, dst := f.Client, f.Server
+	if !u.toServer {
+		src, dst = dst, src
+	}
+	return r.header(src, dst) || (r.both && r.header(dst, src))
+}
+
+func (r *Rule) header(src, dst netip.AddrPort) bool {
+	return r.src.match(src.Addr()) && r.sport.match(src.Port()) &&
+		r.dst.match(dst.Addr()) && r.dport.match(dst.Port())
+}
+
+// matchOptions reports whether r's content and pcre options all hold in
+// u, trying later placements of a content when a relative one after it
+// fails.
+func (r *Rule) matchOptions(u *unit) bool {
+	tries := 0
+	return r.matchFrom(u, 0, map[string]int{}, &tries)
+}
+
+func (r *Rule) matchFrom(u *unit, i int, ends map[string]int, tries *int) bool {
+	if i == len(r.matches) {
+		return true
+	}
+	*tries++
+	if *tries > maxTries {
+		return false
+	}
+	switch m := r.matches[i].(type) {
+	case *pcre:
+		buf, ok := u.buffer(m.buffer, false)
+		if !ok {
+			return false
+		}
+		loc := m.re.FindIndex(buf)
+		if m.negate {
+			return loc == nil && r.matchFrom(u, i+1, ends, tries)
+		}
+		if loc == nil {
+			return false
+		}
+		return r.matchFrom(u, i+1, withEnd(ends, m.buffer, loc[1]), tries)
+
+	case *content:
+		buf, ok := u.buffer(m.buffer, m.nocase)
+		if !ok {
+			return false
+		}
+		pattern := m.pattern
+		if m.nocase {
+			pattern = m.lower
+		}
+		lo, hi := m.window(len(buf), ends[m.buffer])
+		found := false
+		for start := lo; start+len(pattern) <= hi; {
+			at := bytes.Index(buf[start:hi], pattern)
+			if at < 0 {
+				break
+			}
+			at += start
+			end := at + len(pattern)
+			start = at + 1
+			if m.endswith && end != len(buf) {
+				continue
+			}
+			found = true
+			if m.negate {
+				break
+			}
+			if r.matchFrom(u, i+1, withEnd(ends, m.buffer, end), tries) {
+				return true
+			}
+			if *tries > maxTries {
+				return false
+			}
+		}
+		if m.negate {
+			return !found && r.matchFrom(u, i+1, ends, tries)
+		}
+		return false
+	}
+	return false
+}
+
+func withEnd(ends map[string]int, buffer string, end int) map[string]int {
+	next := make(map[string]int, len(ends)+1)
+	for k, v := range ends {
+		next[k] = v
+	}
+	next[buffer] = end
+	return next
+}
+
+// evidence is the sticky buffer value r matched in u, for the report.
+func (r *Rule) evidence(u *unit) string {
+	for _, m := range r.matches {
+		if name := m.bufferName(); name != bufPayload {
+			v := u.buffers[name]
+			if len(v) > 200 {
+				v = v[:200]
+			}
+			return name + ": " + string(v)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,196 @@
+package netsig
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/netioc"
+)
+
+var t0 = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func mustAddr(s string) netip.Addr { return netip.MustParseAddr(s) }
+
+func tcpFlow(server string, toServer, toClient string) *netioc.Flow {
+	return &netioc.Flow{
+		Protocol: "tcp",
+		Client:   netip.MustParseAddrPort("10.0.0.2:40000"),
+		Server:   netip.MustParseAddrPort(server),
+		First:    t0,
+		ToServer: []byte(toServer),
+		ToClient: []byte(toClient),
+	}
+}
+
+func httpFlow(server, method, host, uri, ua string) *netioc.Flow {
+	f := tcpFlow(server, method+" "+uri+" HTTP/1.1\r\nHost: "+host+"\r\n\r\n", "")
+	f.HTTP = []netioc.Request{{Method: method, Host: host, URI: uri, URL: "http://" + host + uri, UserAgent: ua}}
+	return f
+}
+
+func dnsFlow(names ...string) *netioc.Flow {
+	f := &netioc.Flow{
+		Protocol: "udp",
+		Client:   netip.MustParseAddrPort("10.0.0.2:40001"),
+		Server:   netip.MustParseAddrPort("10.0.0.1:53"),
+		First:    t0,
+	}
+	for _, n := range names {
+		f.Datagrams = append(f.Datagrams, netioc.Datagram{
+			Time:     t0,
+			ToServer: true,
+			Payload:  []byte("query"),
+			DNS:      []netioc.Question{{Name: n, Type: "A"}},
+		})
+	}
+	return f
+}
+
+func tlsFlow(server, sni, ja3 string) *netioc.Flow {
+	f := tcpFlow(server, "\x16\x03\x01", "")
+	f.TLS = &netioc.ClientHello{SNI: sni, Version: 0x0303, JA3: ja3}
+	return f
+}
+
+func ruleset(t *testing.T, src string) *Ruleset {
+	t.Helper()
+	rules, err := ParseRules("test.rules", strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Ruleset{Rules: rules}
+}
+
+func matchSIDs(rs *Ruleset, flows ...*netioc.Flow) []int {
+	var out []int
+	for _, d := range rs.Match(flows) {
+		out = append(out, d.SID)
+	}
+	return out
+}
+
+func sameInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestContentModifiers(t *testing.T) {
+	tests := []struct {
+		name    string
+		options string
+		payload string
+		want    bool
+	}{
+		{"plain", `content:"evil";`, "xx evil xx", true},
+		{"case", `content:"EVIL";`, "xx evil xx", false},
+		{"nocase", `content:"EVIL"; nocase;`, "xx evil xx", true},
+		{"hex", `content:"|de ad|BE|ef|";`, "\xde\xadBE\xef", true},
+		{"offset", `content:"evil"; offset:4;`, "evil evil", true},
+		{"offset past", `content:"evil"; offset:6;`, "evil evil", false},
+		{"depth", `content:"evil"; depth:4;`, "evil", true},
+		{"depth short", `content:"evil"; depth:3;`, "evil", false},
+		{"startswith", `content:"GET"; startswith;`, "GET /", true},
+		{"startswith later", `content:"GET"; startswith;`, " GET /", false},
+		{"endswith", `content:"exe"; endswith;`, "a.exe", true},
+		{"endswith not last", `content:"exe"; endswith;`, "a.exe.txt", false},
+		{"distance", `content:"a"; content:"b"; distance:2;`, "a..b", true},
+		{"distance short", `content:"a"; content:"b"; distance:3;`, "a..b", false},
+		{"within", `content:"a"; content:"b"; within:3;`, "a..b", true},
+		{"within short", `content:"a"; content:"b"; within:2;`, "a..b", false},
+		// The first "a" fails the relative match; a later one must be tried
+		{"backtrack", `content:"a"; content:"b"; within:1;`, "a.ab", true},
+		{"negated", `content:"ok"; content:!"bad";`, "ok", true},
+		{"negated present", `content:"ok"; content:!"bad";`, "ok bad", false},
+		{"pcre", `pcre:"/ev[il]{2}/";`, "xx evil", true},
+		{"pcre negated", `pcre:!"/evil/";`, "xx evil", false},
+	}
+	for _, tc := range tests {
+		rs := ruleset(t, `alert tcp any any -> any any (`+tc.options+` sid:1;)`)
+		got := len(rs.Match([]*netioc.Flow{tcpFlow("1.2.3.4:80", tc.payload, "")})) > 0
+		if got != tc.want {
+			t.Errorf("%s: matched=%v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestHeaderAndFlow(t *testing.T) {
+	rs := ruleset(t, `
+alert tcp any any -> any [!80,1:1024] (msg:"low ports but 80"; sid:1;)
+alert tcp any any -> 1.2.3.0/24 any (msg:"subnet"; sid:2;)
+alert tcp any any -> any any (msg:"reply"; flow:to_client; content:"MZ"; sid:3;)
+alert tcp any 80 <> any any (msg:"either way"; content:"MZ"; sid:4;)
+alert udp any any -> any any (msg:"udp only"; sid:5;)
+`)
+	tests := []struct {
+		flow *netioc.Flow
+		want []int
+	}{
+		{tcpFlow("9.9.9.9:443", "hello", ""), []int{1}},
+		{tcpFlow("9.9.9.9:80", "hello", ""), nil},
+		{tcpFlow("1.2.3.4:8080", "hello", ""), []int{2}},
+		// The reply runs from server port 80, which only <> lets sid 4 see
+		{tcpFlow("9.9.9.9:80", "GET /", "MZ..."), []int{3, 4}},
+		{tcpFlow("9.9.9.9:8080", "MZ", ""), nil},
+		{dnsFlow("example.com"), []int{5}},
+	}
+	for i, tc := range tests {
+		if got := matchSIDs(rs, tc.flow); !sameInts(got, tc.want) {
+			t.Errorf("flow %d to %s: got sids %v, want %v", i, tc.flow.Server, got, tc.want)
+		}
+	}
+}
+
+func TestStickyBuffers(t *testing.T) {
+	rs := ruleset(t, `
+alert http any any -> any any (http.method; content:"POST"; http.uri; content:"/gate.php"; endswith; sid:1;)
+alert http any any -> any any (content:"evil.test"; http_host; sid:2;)
+alert http any any -> any any (http.user_agent; content:"bot"; nocase; sid:3;)
+alert tls any any -> any any (tls.sni; content:"c2.example"; sid:4;)
+alert tls any any -> any any (ja3.hash; content:"ada70206e40642a3e4461f35503241d5"; sid:5;)
+alert dns any any -> any any (dns.query; content:"bad.example"; endswith; sid:6;)
+`)
+	ja3 := "769,47-53-5-10-49161-49162-49171-49172-50-56-19-4,0-10-11,23-24-25,0"
+	tests := []struct {
+		flow *netioc.Flow
+		want []int
+	}{
+		{httpFlow("1.2.3.4:80", "POST", "evil.test", "/gate.php", "MyBot/1.0"), []int{1, 2, 3}},
+		{httpFlow("1.2.3.4:80", "GET", "good.test", "/gate.php?x", "Mozilla"), nil},
+		{tlsFlow("1.2.3.4:443", "c2.example", ja3), []int{4, 5}},
+		{tlsFlow("1.2.3.4:443", "", "771,4865,,,"), nil},
+		{dnsFlow("www.bad.example", "good.example"), []int{6}},
+		// Buffers only exist for their protocol
+		{tcpFlow("1.2.3.4:80", "POST /gate.php HTTP/1.1", ""), nil},
+	}
+	for i, tc := range tests {
+		if got := matchSIDs(rs, tc.flow); !sameInts(got, tc.want) {
+			t.Errorf("flow %d: got sids %v, want %v", i, got, tc.want)
+		}
+	}
+}
+
+func TestMatchCountsRepeats(t *testing.T) {
+	rs := ruleset(t, `alert dns any any -> any any (msg:"lookup"; dns.query; content:"bad"; sid:7; rev:2;)`)
+	later := dnsFlow("bad.example")
+	later.Client = netip.MustParseAddrPort("10.0.0.2:40002")
+	later.First = t0.Add(time.Second)
+
+	hits := rs.Match([]*netioc.Flow{dnsFlow("bad.example", "also.bad.example"), later})
+	if len(hits) != 1 {
+		t.Fatalf("got %d hits, want one per rule and destination", len(hits))
+	}
+	h := hits[0]
+	if h.SID != 7 || h.Rev != 2 || h.Rule != "lookup" || h.Count != 3 || h.Dst != "10.0.0.1:53" ||
+		h.Evidence != "dns.query: bad.example" || !h.FirstSeen.Equal(t0) {
+		t.Errorf("hit = %+v", h)
+	}
+}
@@ -0,0 +1,452 @@
+// Package netsig is a small Suricata-style signature engine that runs
+// offline over the flows of a job's packet capture. It understands rule
+// headers (protocol, addresses, ports, direction), flow direction,
+// content matches with their position modifiers, pcre, and the sticky
+// buffers dns.query, http.uri, http.host, http.method, http.user_agent,
+// tls.sni and ja3.hash.
+package netsig
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sudankdk/firecracker/internal/verdict"
+)
+
+// Inspection buffers. Payload is the default; the rest are sticky buffers
+// selected by keyword.
+const (
+	bufPayload   = "payload"
+	bufDNSQuery  = "dns.query"
+	bufHTTPURI   = "http.uri"
+	bufHTTPHost  = "http.host"
+	bufHTTPMeth  = "http.method"
+	bufHTTPUA    = "http.user_agent"
+	bufTLSSNI    = "tls.sni"
+	bufJA3Hash   = "ja3.hash"
+	maxTries     = 4096 // content placements tried per rule and unit
+	maxRuleBytes = 64 << 10
+)
+
+// stickyBuffers maps keywords, current and legacy, to the buffer they
+// select for the options after them.
+var stickyBuffers = map[string]string{
+	"pkt_data":        bufPayload,
+	"dns.query":       bufDNSQuery,
+	"dns_query":       bufDNSQuery,
+	"http.uri":        bufHTTPURI,
+	"http.host":       bufHTTPHost,
+	"http.method":     bufHTTPMeth,
+	"http.user_agent": bufHTTPUA,
+	"tls.sni":         bufTLSSNI,
+	"ja3.hash":        bufJA3Hash,
+}
+
+// contentModifiers are the legacy keywords that move the content before
+// them into a buffer.
+var contentModifiers = map[string]string{
+	"http_uri":        bufHTTPURI,
+	"http_host":       bufHTTPHost,
+	"http_method":     bufHTTPMeth,
+	"http_user_agent": bufHTTPUA,
+	"tls_sni":         bufTLSSNI,
+}
+
+// ignoredKeywords change nothing about what an offline match means.
+var ignoredKeywords = map[string]bool{
+	"reference": true, "fast_pattern": true, "threshold": true, "target": true,
+	"gid": true, "detection_filter": true,
+}
+
+// Rule is one parsed signature.
+type Rule struct {
+	SID       int
+	Rev       int
+	Msg       string
+	Classtype string
+	Severity  string // info, low, medium, high or critical
+	File      string
+	Line      int
+
+	proto    string // tcp, udp, ip, dns, http or tls
+	src, dst addrSet
+	sport    portSet
+	dport    portSet
+	both     bool // <> rather than ->
+	flow     int  // flowAny, flowToServer or flowToClient
+	matches  []matcher
+	priority int
+}
+
+const (
+	flowAny = iota
+	flowToServer
+	flowToClient
+)
+
+var validProtos = map[string]bool{"tcp": true, "udp": true, "ip": true, "dns": true, "http": true, "tls": true}
+
+// ParseRules reads rules from r, one per line with backslash continuation.
+// Rules that do not parse are skipped and reported in the joined error,
+// each prefixed with file:line.
+func ParseRules(file string, r io.Reader) ([]*Rule, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), maxRuleBytes)
+	var rules []*Rule
+	var errs []error
+	var pending strings.Builder
+	start := 0
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if pending.Len() == 0 {
+			start = n
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+		}
+		if strings.HasSuffix(line, "\\") {
+			pending.WriteString(strings.TrimSuffix(line, "\\"))
+			continue
+		}
+		pending.WriteString(line)
+		text := pending.String()
+		pending.Reset()
+
+		rule, err := parseRule(text)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %w", file, start, err))
+			continue
+		}
+		rule.File, rule.Line = file, start
+		rules = append(rules, rule)
+	}
+	if err := sc.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", file, err))
+	}
+	return rules, errors.Join(errs...)
+}
+
+func parseRule(text string) (*Rule, error) {
+	open := strings.IndexByte(text, '(')
+	if open < 0 || !strings.HasSuffix(text, ")") {
+		return nil, errors.New("missing option list")
+	}
+	head := strings.Fields(text[:open])
+	if len(head) != 7 {
+		return nil, fmt.Errorf("header has %d fields, want 7", len(head))
+	}
+	if head[0] != "alert" {
+		return nil, fmt.Errorf("action %q: only alert rules are evaluated", head[0])
+	}
+	r := &Rule{proto: strings.ToLower(head[1])}
+	if !validProtos[r.proto] {
+		return nil, fmt.Errorf("unsupported protocol %q", head[1])
+	}
+	var err error
+	if r.src, err = parseAddrs(head[2]); err != nil {
+		return nil, err
+	}
+	if r.sport, err = parsePorts(head[3]); err != nil {
+		return nil, err
+	}
+	switch head[4] {
+	case "->":
+	case "<>":
+		r.both = true
+	default:
+		return nil, fmt.Errorf("direction %q", head[4])
+	}
+	if r.dst, err = parseAddrs(head[5]); err != nil {
+		return nil, err
+	}
+	if r.dport, err = parsePorts(head[6]); err != nil {
+		return nil, err
+	}
+
+	opts, err := splitOptions(text[open+1 : len(text)-1])
+	if err != nil {
+		return nil, err
+	}
+	if err := r.parseOptions(opts); err != nil {
+		return nil, err
+	}
+	if r.SID == 0 {
+		return nil, errors.New("rule has no sid")
+	}
+	if r.Msg == "" {
+		r.Msg = "sid:" + strconv.Itoa(r.SID)
+	}
+	return r, nil
+}
+
+type option struct {
+	key, value string
+}
+
+// splitOptions splits "k:v; k; k:v;" honouring quotes and backslash
+// escapes inside values.
+func splitOptions(s string) ([]option, error) {
+	var opts []option
+	var cur strings.Builder
+	quoted, escaped := false, false
+	flush := func() {
+		text := strings.TrimSpace(cur.String())
+		cur.Reset()
+		if text == "" {
+			return
+		}
+		key, value, _ := strings.Cut(text, ":")
+		opts = append(opts, option{strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)})
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ';' && !quoted:
+			flush()
+			continue
+		}
+		cur.WriteByte(c)
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+	flush()
+	return opts, nil
+}
+
+func (r *Rule) parseOptions(opts []option) error {
+	buffer := bufPayload
+	var last *content // the content that position modifiers apply to
+	for _, o := range opts {
+		if b, ok := stickyBuffers[o.key]; ok {
+			buffer, last = b, nil
+			continue
+		}
+		if b, ok := contentModifiers[o.key]; ok {
+			if last == nil {
+				return fmt.Errorf("%s without a content before it", o.key)
+			}
+			last.buffer = b
+			continue
+		}
+		switch o.key {
+		case "msg":
+			r.Msg = unquote(o.value)
+		case "sid", "rev", "priority":
+			n, err := strconv.Atoi(o.value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("%s: %q is not a number", o.key, o.value)
+			}
+			switch o.key {
+			case "sid":
+				r.SID = n
+			case "rev":
+				r.Rev = n
+			default:
+				r.priority = n
+			}
+		case "classtype":
+			r.Classtype = o.value
+		case "metadata":
+			r.metadata(o.value)
+		case "flow":
+			for _, f := range strings.Split(o.value, ",") {
+				switch strings.TrimSpace(f) {
+				case "to_server", "from_client":
+					r.flow = flowToServer
+				case "to_client", "from_server":
+					r.flow = flowToClient
+				case "established", "not_established", "stateless", "only_stream", "no_stream":
+				default:
+					return fmt.Errorf("flow: unsupported %q", f)
+				}
+			}
+		case "content":
+			c, err := parseContent(o.value)
+			if err != nil {
+				return err
+			}
+			c.buffer = buffer
+			r.matches = append(r.matches, c)
+			last = c
+		case "nocase", "depth", "offset", "distance", "within", "startswith", "endswith":
+			if last == nil {
+				return fmt.Errorf("%s without a content before it", o.key)
+			}
+			if err := last.modify(o.key, o.value); err != nil {
+				return err
+			}
+		case "pcre":
+			p, err := parsePCRE(o.value)
+			if err != nil {
+				return err
+			}
+			p.buffer = buffer
+			r.matches = append(r.matches, p)
+			last = nil
+		default:
+			if !ignoredKeywords[o.key] {
+				return fmt.Errorf("unsupported keyword %q", o.key)
+			}
+		}
+	}
+	if r.Severity == "" {
+		r.Severity = prioritySeverity(r.priority)
+	}
+	return nil
+}
+
+// metadata takes the severity from "signature_severity Major" or
+// "severity high" entries.
+func (r *Rule) metadata(value string) {
+	for _, entry := range strings.Split(value, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(entry), " ")
+		val = strings.ToLower(strings.TrimSpace(val))
+		switch strings.ToLower(key) {
+		case "signature_severity":
+			switch val {
+			case "critical":
+				r.Severity = verdict.SeverityCritical
+			case "major":
+				r.Severity = verdict.SeverityHigh
+			case "minor":
+				r.Severity = verdict.SeverityLow
+			case "informational":
+				r.Severity = verdict.SeverityInfo
+			}
+		case "severity":
+			switch val {
+			case verdict.SeverityInfo, verdict.SeverityLow, verdict.SeverityMedium, verdict.SeverityHigh, verdict.SeverityCritical:
+				r.Severity = val
+			}
+		}
+	}
+}
+
+// prioritySeverity maps Suricata's priority, 1 being the most urgent,
+// onto a severity; no priority means verdict.DefaultSeverity.
+func prioritySeverity(p int) string {
+	switch p {
+	case 0:
+		return verdict.DefaultSeverity
+	case 1:
+		return verdict.SeverityHigh
+	case 2:
+		return verdict.SeverityMedium
+	case 3:
+		return verdict.SeverityLow
+	}
+	return verdict.SeverityInfo
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// parsePCRE reads "/pattern/flags". Go's RE2 syntax covers what rules
+// usually use; backreferences and lookaround do not compile.
+func parsePCRE(value string) (*pcre, error) {
+	// Negation is written outside the quotes, pcre:!"/x/"
+	negate := strings.HasPrefix(value, "!")
+	s := strings.TrimSpace(strings.TrimPrefix(value, "!"))
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	// Only the rule syntax's own escapes; the rest belong to the regexp
+	s = strings.NewReplacer(`\"`, `"`, `\;`, `;`).Replace(s)
+	end := strings.LastIndexByte(s, '/')
+	if !strings.HasPrefix(s, "/") || end <= 0 {
+		return nil, fmt.Errorf("pcre %q is not /pattern/flags", value)
+	}
+	pattern, flags := s[1:end], s[end+1:]
+	var prefix string
+	for _, f := range flags {
+		switch f {
+		case 'i', 's', 'm':
+			prefix += string(f)
+		case 'R', 'U', 'H', 'P', 'B', 'O':
+		default:
+			return nil, fmt.Errorf("pcre flag %q", f)
+		}
+	}
+	if prefix != "" {
+		pattern = "(?" + prefix + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("pcre: %w", err)
+	}
+	return &pcre{re: re, negate: negate}, nil
+}
+
+// parseContent reads a quoted content string with |hex| sections and an
+// optional leading ! for negation.
+func parseContent(value string) (*content, error) {
+	c := &content{}
+	if strings.HasPrefix(value, "!") {
+		c.negate = true
+		value = strings.TrimSpace(value[1:])
+	}
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return nil, fmt.Errorf("content %s is not quoted", value)
+	}
+	s := value[1 : len(value)-1]
+	var out bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+			}
+			out.WriteByte(s[i])
+		case '|':
+			end := strings.IndexByte(s[i+1:], '|')
+			if end < 0 {
+				return nil, fmt.Errorf("content %s: unterminated hex", value)
+			}
+			for _, h := range strings.Fields(s[i+1 : i+1+end]) {
+				for len(h) > 0 {
+					if len(h) < 2 {
+						return nil, fmt.Errorf("content %s: odd hex digits", value)
+					}
+					b, err := strconv.ParseUint(h[:2], 16, 8)
+					if err != nil {
+						return nil, fmt.Errorf("content %s: bad hex %q", value, h[:2])
+					}
+					out.WriteByte(byte(b))
+					h = h[2:]
+				}
+			}
+			i += end + 1
+		default:
+			out.WriteByte(s[i])
+		}
+	}
+	if out.Len() == 0 {
+		return nil, errors.New("empty content")
+	}
+	c.pattern = out.Bytes()
+	return c, nil
+}
@@ -0,0 +1,114 @@
+package netsig
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	src := `# comment
+
+alert tcp $HOME_NET any -> $EXTERNAL_NET [80,8080] (msg:"say \"hi\"; now"; \
+    flow:established,to_server; content:"|48 49|x"; nocase; offset:2; depth:8; \
+    classtype:trojan-activity; metadata:signature_severity Major, created_at 2024; sid:10; rev:3;)
+alert dns any any -> any any (msg:"pcre"; dns.query; pcre:"/^a\.b\;c\"d$/i"; priority:3; sid:11;)
+alert udp 10.0.0.0/8 !53 <> any any (sid:12;)
+`
+	rules, err := ParseRules("t.rules", strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("got %d rules", len(rules))
+	}
+
+	r := rules[0]
+	if r.SID != 10 || r.Rev != 3 || r.Msg != `say "hi"; now` || r.Classtype != "trojan-activity" ||
+		r.Severity != "high" || r.File != "t.rules" || r.Line != 3 {
+		t.Errorf("rule 0 = %+v", r)
+	}
+	if r.flow != flowToServer || r.proto != "tcp" || len(r.matches) != 1 {
+		t.Fatalf("rule 0 flow=%d proto=%s matches=%d", r.flow, r.proto, len(r.matches))
+	}
+	c := r.matches[0].(*content)
+	if !bytes.Equal(c.pattern, []byte("HIx")) || !c.nocase || c.offset != 2 || c.depth != 8 || c.buffer != bufPayload {
+		t.Errorf("content = %+v", c)
+	}
+	if !r.dport.match(8080) || r.dport.match(443) {
+		t.Error("port list [80,8080] matched wrongly")
+	}
+
+	r = rules[1]
+	if r.Severity != "low" || r.Msg != "pcre" {
+		t.Errorf("rule 1 = %+v", r)
+	}
+	p := r.matches[0].(*pcre)
+	if p.buffer != bufDNSQuery || !p.re.MatchString(`A.B;C"D`) || p.re.MatchString("axb;c\"d") {
+		t.Errorf("pcre %s in %s", p.re, p.buffer)
+	}
+
+	r = rules[2]
+	if r.Msg != "sid:12" || r.Severity != "low" || !r.both {
+		t.Errorf("rule 2 = %+v", r)
+	}
+	if !r.src.match(mustAddr("10.1.2.3")) || r.src.match(mustAddr("192.168.0.1")) {
+		t.Error("10.0.0.0/8 matched wrongly")
+	}
+	if r.sport.match(53) || !r.sport.match(54) {
+		t.Error("!53 matched wrongly")
+	}
+}
+
+func TestParseRulesRejects(t *testing.T) {
+	bad := []struct {
+		rule string
+		want string
+	}{
+		{`alert tcp any any -> any any sid:1;`, "missing option list"},
+		{`alert tcp any any -> any (sid:1;)`, "header has 6 fields"},
+		{`drop tcp any any -> any any (sid:1;)`, "only alert rules"},
+		{`alert smb any any -> any any (sid:1;)`, "unsupported protocol"},
+		{`alert tcp any any <- any any (sid:1;)`, "direction"},
+		{`alert tcp 10.0.0.300 any -> any any (sid:1;)`, "address"},
+		{`alert tcp any 90:80 -> any any (sid:1;)`, "port range"},
+		{`alert tcp any [80,81 -> any any (sid:1;)`, "unterminated list"},
+		{`alert tcp any any -> any any (msg:"x; sid:1;)`, "unterminated quote"},
+		{`alert tcp any any -> any any (msg:"x";)`, "no sid"},
+		{`alert tcp any any -> any any (sid:x;)`, "not a number"},
+		{`alert tcp any any -> any any (byte_test:4,>,1,0; sid:1;)`, "unsupported keyword"},
+		{`alert tcp any any -> any any (nocase; sid:1;)`, "without a content"},
+		{`alert tcp any any -> any any (content:"a"; depth:-1; sid:1;)`, "bad value"},
+		{`alert tcp any any -> any any (content:"|4|"; sid:1;)`, "odd hex"},
+		{`alert tcp any any -> any any (content:"|41"; sid:1;)`, "unterminated hex"},
+		{`alert tcp any any -> any any (content:"||"; sid:1;)`, "empty content"},
+		{`alert tcp any any -> any any (content:abc; sid:1;)`, "not quoted"},
+		{`alert tcp any any -> any any (pcre:"/a/x"; sid:1;)`, "pcre flag"},
+		{`alert tcp any any -> any any (pcre:"/(?=a)/"; sid:1;)`, "pcre"},
+		{`alert tcp any any -> any any (flow:sideways; sid:1;)`, "flow"},
+	}
+	var src strings.Builder
+	src.WriteString("alert tcp any any -> any any (sid:1;)\n")
+	for _, b := range bad {
+		src.WriteString(b.rule + "\n")
+	}
+
+	rules, err := ParseRules("bad.rules", strings.NewReader(src.String()))
+	if len(rules) != 1 || rules[0].SID != 1 {
+		t.Fatalf("kept %d rules, want only the valid one", len(rules))
+	}
+	if err == nil {
+		t.Fatal("no error for bad rules")
+	}
+	msgs := strings.Split(err.Error(), "\n")
+	if len(msgs) != len(bad) {
+		t.Fatalf("got %d errors, want %d:\n%v", len(msgs), len(bad), err)
+	}
+	for i, b := range bad {
+		prefix := fmt.Sprintf("bad.rules:%d: ", i+2)
+		if !strings.HasPrefix(msgs[i], prefix) || !strings.Contains(msgs[i], b.want) {
+			t.Errorf("%s\n  got  %q\n  want %s... %s", b.rule, msgs[i], prefix, b.want)
+		}
+	}
+}
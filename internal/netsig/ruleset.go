@@ -0,0 +1,119 @@
+package netsig
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+	"github.com/sudankdk/firecracker/internal/netioc"
+)
+
+// Ruleset is the rules loaded from one directory. It is read-only once
+// loaded, so it is safe for concurrent use.
+type Ruleset struct {
+	Rules    []*Rule
+	Files    []string
+	Version  string // content hash of Files
+	LoadedAt time.Time
+}
+
+// Load parses every *.rules file in dir. Rules that do not parse are
+// left out and reported in the returned error alongside the ruleset; only
+// an unreadable directory or file yields no ruleset.
+func Load(dir string) (*Ruleset, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.rules"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	rs := &Ruleset{LoadedAt: time.Now()}
+	h := sha256.New()
+	var errs []error
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(path)
+		fmt.Fprintf(h, "%s\x00%d\x00", name, len(src))
+		h.Write(src)
+
+		rules, err := ParseRules(name, bytes.NewReader(src))
+		if err != nil {
+			errs = append(errs, err)
+		}
+		rs.Rules = append(rs.Rules, rules...)
+		rs.Files = append(rs.Files, name)
+	}
+	rs.Version = hex.EncodeToString(h.Sum(nil))[:16]
+
+	seen := make(map[int]string)
+	for _, r := range rs.Rules {
+		if prev, ok := seen[r.SID]; ok {
+			errs = append(errs, fmt.Errorf("%s:%d: sid %d already used at %s", r.File, r.Line, r.SID, prev))
+		}
+		seen[r.SID] = r.File + ":" + strconv.Itoa(r.Line)
+	}
+	return rs, errors.Join(errs...)
+}
+
+// Match runs every rule over flows and returns the hits, one per rule and
+// destination, in order of first sight.
+func (rs *Ruleset) Match(flows []*netioc.Flow) []domain.NetworkDetection {
+	if rs == nil || len(rs.Rules) == 0 {
+		return nil
+	}
+	type key struct {
+		sid int
+		dst string
+	}
+	hits := make(map[key]*domain.NetworkDetection)
+	var order []key
+	for _, f := range flows {
+		for _, u := range units(f) {
+			for _, r := range rs.Rules {
+				if !r.applies(u) || !r.matchOptions(u) {
+					continue
+				}
+				k := key{r.SID, f.Server.String()}
+				if d, ok := hits[k]; ok {
+					d.Count++
+					continue
+				}
+				hits[k] = &domain.NetworkDetection{
+					Rule:      r.Msg,
+					SID:       r.SID,
+					Rev:       r.Rev,
+					Severity:  r.Severity,
+					Classtype: r.Classtype,
+					File:      r.File,
+					Protocol:  f.Protocol,
+					Src:       f.Client.String(),
+					Dst:       f.Server.String(),
+					Evidence:  r.evidence(u),
+					Count:     1,
+					FirstSeen: u.time,
+				}
+				order = append(order, k)
+			}
+		}
+	}
+	out := make([]domain.NetworkDetection, 0, len(order))
+	for _, k := range order {
+		out = append(out, *hits[k])
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].FirstSeen.Before(out[j].FirstSeen) })
+	return out
+}
@@ -0,0 +1,93 @@
+package netsig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sudankdk/firecracker/internal/netioc"
+)
+
+// The shipped rules must all parse, and each should fire on the traffic
+// it was written for and stay quiet on ordinary traffic.
+func TestDefaultRules(t *testing.T) {
+	rs, err := Load("../../network_rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Files) != 1 || rs.Files[0] != "default.rules" || len(rs.Version) != 16 {
+		t.Errorf("files=%v version=%q", rs.Files, rs.Version)
+	}
+
+	irc := tcpFlow("203.0.113.5:6667", "NICK bot123\r\nUSER bot 0 * :bot\r\n", "")
+	smtp := tcpFlow("203.0.113.6:587", "EHLO guest\r\nmail from:<a@b>\r\n", "")
+	download := httpFlow("203.0.113.7:80", "GET", "203.0.113.7", "/a/setup.exe?id=1", "curl/8.4.0")
+	download.ToClient = []byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nMZ")
+
+	tests := []struct {
+		name string
+		flow *netioc.Flow
+		want []int
+	}{
+		{"dynamic dns", dnsFlow("x.duckdns.org"), []int{1000001}},
+		{"paste site", dnsFlow("pastebin.com"), []int{1000002}},
+		{"exe download", download, []int{1000010, 1000011, 1000012, 1000020}},
+		{"tunnel", tlsFlow("203.0.113.8:443", "abc.ngrok-free.app", "771,4865,,,"), []int{1000030}},
+		{"irc", irc, []int{1000040}},
+		{"smtp", smtp, []int{1000041}},
+		{"benign dns", dnsFlow("example.com", "notpastebin.com.example"), nil},
+		{"benign http", httpFlow("203.0.113.9:80", "GET", "example.com", "/index.html", "Mozilla/5.0"), nil},
+		{"benign tls", tlsFlow("203.0.113.9:443", "example.com", "771,4865,,,"), nil},
+		{"irc off port", tcpFlow("203.0.113.5:80", "NICK bot\r\n", ""), nil},
+	}
+	covered := make(map[int]bool)
+	for _, tc := range tests {
+		got := matchSIDs(rs, tc.flow)
+		if !sameInts(got, tc.want) {
+			t.Errorf("%s: got sids %v, want %v", tc.name, got, tc.want)
+		}
+		for _, sid := range got {
+			covered[sid] = true
+		}
+	}
+	for _, r := range rs.Rules {
+		if !covered[r.SID] {
+			t.Errorf("sid %d (%s) has no test", r.SID, r.Msg)
+		}
+	}
+}
+
+func TestLoadReportsBadRules(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.rules", "alert tcp any any -> any any (sid:1;)\nalert tcp any any -> any any (nope:1; sid:2;)\n")
+	write("b.rules", "alert udp any any -> any any (sid:1;)\n")
+	write("ignored.txt", "not rules")
+
+	rs, err := Load(dir)
+	if rs == nil {
+		t.Fatalf("no ruleset: %v", err)
+	}
+	if len(rs.Rules) != 2 || len(rs.Files) != 2 {
+		t.Errorf("rules=%d files=%v", len(rs.Rules), rs.Files)
+	}
+	if err == nil || !strings.Contains(err.Error(), "a.rules:2:") || !strings.Contains(err.Error(), "sid 1 already used at a.rules:1") {
+		t.Errorf("err = %v", err)
+	}
+
+	// The version follows the content
+	before := rs.Version
+	write("b.rules", "alert udp any any -> any any (sid:3;)\n")
+	if rs, _ := Load(dir); rs.Version == before {
+		t.Error("version unchanged after editing a rules file")
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing")); err == nil {
+		t.Error("missing directory loaded")
+	}
+}
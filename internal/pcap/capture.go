@@ -0,0 +1,122 @@
+package pcap
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// SnapLen is the longest frame kept; a TAP never carries more.
+const SnapLen = 65535
+
+// statsBlockSize is kept free under the size cap for Close's statistics.
+const statsBlockSize = 12 + 12 + 2*12 + 4
+
+// Stats describes a finished capture.
+type Stats struct {
+	Packets   int   `json:"packets"`
+	Bytes     int64 `json:"bytes"`             // frame bytes on the wire
+	Dropped   int   `json:"dropped,omitempty"` // frames seen after the size cap
+	Truncated bool  `json:"truncated,omitempty"`
+}
+
+// Capture writes every frame seen on one interface to a pcapng file until
+// it is closed or the file reaches its size cap.
+type Capture struct {
+	src      io.ReadCloser // packet socket, one frame per read
+	out      *os.File
+	w        *Writer
+	maxBytes int64
+
+	mu    sync.Mutex
+	size  int64
+	stats Stats
+	err   error
+	done  chan struct{}
+}
+
+// Start captures iface in the network namespace at netnsPath into a new
+// file at path. maxBytes caps the file; 0 leaves it unbounded.
+func Start(netnsPath, iface, path string, maxBytes int64) (*Capture, error) {
+	src, err := openInterface(netnsPath, iface)
+	if err != nil {
+		return nil, fmt.Errorf("pcap: %s: %w", iface, err)
+	}
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("pcap: %w", err)
+	}
+	w, err := NewWriter(out, LinkTypeEthernet, SnapLen)
+	if err != nil {
+		src.Close()
+		out.Close()
+		return nil, fmt.Errorf("pcap: %w", err)
+	}
+	c := &Capture{src: src, out: out, w: w, maxBytes: maxBytes, done: make(chan struct{})}
+	c.size, _ = out.Seek(0, io.SeekCurrent)
+	go c.run()
+	return c, nil
+}
+
+func (c *Capture) run() {
+	defer close(c.done)
+	buf := make([]byte, SnapLen)
+	for {
+		n, err := c.src.Read(buf)
+		if err != nil {
+			return
+		}
+		c.mu.Lock()
+		c.record(Packet{Time: time.Now(), Data: buf[:n], Length: n})
+		c.mu.Unlock()
+	}
+}
+
+func (c *Capture) record(p Packet) {
+	if c.err != nil {
+		return
+	}
+	if c.maxBytes > 0 && c.size+BlockSize(len(p.Data))+statsBlockSize > c.maxBytes {
+		c.stats.Dropped++
+		c.stats.Truncated = true
+		return
+	}
+	if c.err = c.w.WritePacket(p); c.err != nil {
+		return
+	}
+	c.size += BlockSize(len(p.Data))
+	c.stats.Packets++
+	c.stats.Bytes += int64(p.Length)
+}
+
+// Close stops the capture and finishes the file with a statistics block
+// recording how many frames the size cap dropped.
+func (c *Capture) Close() error {
+	c.src.Close()
+	<-c.done
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.err
+	if err == nil {
+		seen := uint64(c.stats.Packets + c.stats.Dropped)
+		err = c.w.WriteStats(time.Now(), seen, uint64(c.stats.Dropped))
+	}
+	if ferr := c.w.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := c.out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Stats returns the counts so far.
+func (c *Capture) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
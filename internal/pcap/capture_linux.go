@@ -0,0 +1,41 @@
+package pcap
+
+import (
+	"io"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/sudankdk/firecracker/internal/netns"
+)
+
+// openInterface opens a packet socket bound to iface that sees frames in
+// both directions. It is non-blocking, so closing it ends a pending read.
+func openInterface(netnsPath, iface string) (io.ReadCloser, error) {
+	var f *os.File
+	err := netns.Do(netnsPath, func() error {
+		ifi, err := net.InterfaceByName(iface)
+		if err != nil {
+			return err
+		}
+		proto := htons(syscall.ETH_P_ALL)
+		fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, int(proto))
+		if err != nil {
+			return err
+		}
+		if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: proto, Ifindex: ifi.Index}); err != nil {
+			syscall.Close(fd)
+			return err
+		}
+		f = os.NewFile(uintptr(fd), "packet:"+iface)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package pcap
+
+import (
+	"errors"
+	"io"
+)
+
+func openInterface(netnsPath, iface string) (io.ReadCloser, error) {
+	return nil, errors.New("packet capture needs Linux")
+}
@@ -0,0 +1,286 @@
+// Package pcap records guest traffic as pcapng and reads it back.
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// LinkTypeEthernet is the only link type a TAP produces.
+const LinkTypeEthernet = 1
+
+// Block types this package writes or understands.
+const (
+	blockSHB = 0x0A0D0D0A
+	blockIDB = 0x00000001
+	blockSPB = 0x00000003
+	blockISB = 0x00000005
+	blockEPB = 0x00000006
+
+	isbIfRecv = 4
+	isbIfDrop = 5
+
+	byteOrderMagic = 0x1A2B3C4D
+	maxBlockBytes  = 16 << 20
+)
+
+// Packet is one captured frame.
+type Packet struct {
+	Time     time.Time
+	LinkType uint16
+	Data     []byte
+	Length   int // on the wire; more than len(Data) when truncated
+}
+
+// Writer writes a single-interface pcapng section.
+type Writer struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+// NewWriter writes the section and interface headers for a capture of
+// linkType frames cut to snapLen bytes.
+func NewWriter(w io.Writer, linkType uint16, snapLen int) (*Writer, error) {
+	pw := &Writer{w: bufio.NewWriter(w)}
+
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb[0:], byteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[4:], 1) // major version
+	binary.LittleEndian.PutUint16(shb[6:], 0) // minor version
+	binary.LittleEndian.PutUint64(shb[8:], ^uint64(0))
+	if err := pw.block(blockSHB, shb, nil); err != nil {
+		return nil, err
+	}
+
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb[0:], linkType)
+	binary.LittleEndian.PutUint32(idb[4:], uint32(snapLen))
+	if err := pw.block(blockIDB, idb, nil); err != nil {
+		return nil, err
+	}
+	return pw, pw.w.Flush()
+}
+
+// WritePacket appends an enhanced packet block for p, timestamped in
+// microseconds, the pcapng default resolution.
+func (pw *Writer) WritePacket(p Packet) error {
+	hdr := make([]byte, 20)
+	us := uint64(p.Time.UnixMicro())
+	binary.LittleEndian.PutUint32(hdr[0:], 0) // interface ID
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(us>>32))
+	binary.LittleEndian.PutUint32(hdr[8:], uint32(us))
+	binary.LittleEndian.PutUint32(hdr[12:], uint32(len(p.Data)))
+	length := max(p.Length, len(p.Data))
+	binary.LittleEndian.PutUint32(hdr[16:], uint32(length))
+	return pw.block(blockEPB, hdr, p.Data)
+}
+
+// WriteStats appends an interface statistics block counting the frames
+// seen and those dropped, which readers report through Dropped.
+func (pw *Writer) WriteStats(at time.Time, received, dropped uint64) error {
+	body := make([]byte, 12, 44)
+	us := uint64(at.UnixMicro())
+	binary.LittleEndian.PutUint32(body[4:], uint32(us>>32))
+	binary.LittleEndian.PutUint32(body[8:], uint32(us))
+	for _, opt := range []struct {
+		code  uint16
+		value uint64
+	}{{isbIfRecv, received}, {isbIfDrop, dropped}} {
+		body = binary.LittleEndian.AppendUint16(body, opt.code)
+		body = binary.LittleEndian.AppendUint16(body, 8)
+		body = binary.LittleEndian.AppendUint64(body, opt.value)
+	}
+	body = append(body, 0, 0, 0, 0) // opt_endofopt
+	return pw.block(blockISB, body, nil)
+}
+
+// Flush writes out any buffered blocks.
+func (pw *Writer) Flush() error {
+	return pw.w.Flush()
+}
+
+// BlockSize is how many bytes WritePacket adds for a frame of n bytes.
+func BlockSize(n int) int64 {
+	return int64(12 + 20 + pad4(n))
+}
+
+func (pw *Writer) block(typ uint32, fixed, data []byte) error {
+	total := 12 + len(fixed) + pad4(len(data))
+	buf := pw.buf[:0]
+	buf = binary.LittleEndian.AppendUint32(buf, typ)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(total))
+	buf = append(buf, fixed...)
+	buf = append(buf, data...)
+	buf = append(buf, make([]byte, pad4(len(data))-len(data))...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(total))
+	pw.buf = buf
+	_, err := pw.w.Write(buf)
+	return err
+}
+
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// ErrFormat reports a file that is not pcapng or is damaged.
+var ErrFormat = errors.New("pcap: not a valid pcapng file")
+
+// Reader reads the packets of a pcapng file, across sections and
+// interfaces, in file order. Blocks it does not know are skipped.
+type Reader struct {
+	r       *bufio.Reader
+	order   binary.ByteOrder
+	ifs     []iface
+	dropped uint64
+}
+
+type iface struct {
+	linkType uint16
+	tsUnit   time.Duration // per timestamp tick
+}
+
+// NewReader checks that r starts with a section header.
+func NewReader(r io.Reader) (*Reader, error) {
+	pr := &Reader{r: bufio.NewReaderSize(r, 64<<10)}
+	head, err := pr.r.Peek(12)
+	if err != nil || binary.LittleEndian.Uint32(head) != blockSHB {
+		return nil, ErrFormat
+	}
+	return pr, nil
+}
+
+// Next returns the next packet, or io.EOF after the last one. Packet data
+// is only valid until the following call.
+func (pr *Reader) Next() (Packet, error) {
+	for {
+		typ, body, err := pr.readBlock()
+		if err != nil {
+			return Packet{}, err
+		}
+		switch typ {
+		case blockSHB:
+			pr.ifs = pr.ifs[:0]
+		case blockIDB:
+			if len(body) < 8 {
+				return Packet{}, ErrFormat
+			}
+			pr.ifs = append(pr.ifs, iface{
+				linkType: pr.order.Uint16(body),
+				tsUnit:   pr.tsResolution(body[8:]),
+			})
+		case blockISB:
+			if len(body) >= 12 {
+				pr.dropped += pr.option(body[12:], isbIfDrop)
+			}
+		case blockEPB:
+			if len(body) < 20 {
+				return Packet{}, ErrFormat
+			}
+			id := int(pr.order.Uint32(body))
+			captured := int(pr.order.Uint32(body[12:]))
+			if id >= len(pr.ifs) || 20+captured > len(body) {
+				return Packet{}, ErrFormat
+			}
+			ticks := uint64(pr.order.Uint32(body[4:]))<<32 | uint64(pr.order.Uint32(body[8:]))
+			return Packet{
+				Time:     time.Unix(0, 0).Add(time.Duration(ticks) * pr.ifs[id].tsUnit),
+				LinkType: pr.ifs[id].linkType,
+				Data:     body[20 : 20+captured],
+				Length:   int(pr.order.Uint32(body[16:])),
+			}, nil
+		case blockSPB:
+			if len(body) < 4 || len(pr.ifs) == 0 {
+				return Packet{}, ErrFormat
+			}
+			length := int(pr.order.Uint32(body))
+			data := body[4:]
+			if length < len(data) {
+				data = data[:length]
+			}
+			return Packet{LinkType: pr.ifs[0].linkType, Data: data, Length: length}, nil
+		}
+	}
+}
+
+// Dropped is the number of frames the capturing side reported losing in
+// the statistics blocks read so far.
+func (pr *Reader) Dropped() uint64 {
+	return pr.dropped
+}
+
+// readBlock returns a block's type and the bytes between its length fields.
+func (pr *Reader) readBlock() (uint32, []byte, error) {
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(pr.r, head); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = ErrFormat
+		}
+		return 0, nil, err
+	}
+	if binary.LittleEndian.Uint32(head) == blockSHB {
+		// The byte order is only known once the section's magic is read
+		magic, err := pr.r.Peek(4)
+		if err != nil {
+			return 0, nil, ErrFormat
+		}
+		switch {
+		case binary.LittleEndian.Uint32(magic) == byteOrderMagic:
+			pr.order = binary.LittleEndian
+		case binary.BigEndian.Uint32(magic) == byteOrderMagic:
+			pr.order = binary.BigEndian
+		default:
+			return 0, nil, ErrFormat
+		}
+	}
+	if pr.order == nil {
+		return 0, nil, ErrFormat
+	}
+	typ, total := pr.order.Uint32(head), int(pr.order.Uint32(head[4:]))
+	if total < 12 || total%4 != 0 || total > maxBlockBytes {
+		return 0, nil, fmt.Errorf("%w: block of %d bytes", ErrFormat, total)
+	}
+	rest := make([]byte, total-8)
+	if _, err := io.ReadFull(pr.r, rest); err != nil {
+		return 0, nil, ErrFormat
+	}
+	return typ, rest[:len(rest)-4], nil
+}
+
+// tsResolution reads if_tsresol from an interface's options; without it
+// timestamps count microseconds.
+func (pr *Reader) tsResolution(opts []byte) time.Duration {
+	if v, ok := pr.findOption(opts, 9); ok && len(v) >= 1 && v[0]&0x80 == 0 && v[0] <= 9 {
+		unit := time.Second
+		for range v[0] {
+			unit /= 10
+		}
+		return unit
+	}
+	return time.Microsecond
+}
+
+// option reads a 64-bit counter option, 0 when it is absent.
+func (pr *Reader) option(opts []byte, code uint16) uint64 {
+	if v, ok := pr.findOption(opts, code); ok && len(v) == 8 {
+		return pr.order.Uint64(v)
+	}
+	return 0
+}
+
+func (pr *Reader) findOption(opts []byte, code uint16) ([]byte, bool) {
+	for len(opts) >= 4 {
+		c, n := pr.order.Uint16(opts), int(pr.order.Uint16(opts[2:]))
+		if c == 0 || 4+n > len(opts) {
+			break
+		}
+		if c == code {
+			return opts[4 : 4+n], true
+		}
+		opts = opts[min(4+pad4(n), len(opts)):]
+	}
+	return nil, false
+}
@@ -0,0 +1,113 @@
+package pcap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	packets := []Packet{
+		{Time: base, Data: []byte("frame one"), Length: 9},
+		{Time: base.Add(1500 * time.Microsecond), Data: bytes.Repeat([]byte{0xab}, 60), Length: 60},
+		// Cut short by the snap length; Length keeps the size on the wire
+		{Time: base.Add(2 * time.Second), Data: []byte{1, 2, 3}, Length: 1514},
+		{Time: base.Add(3 * time.Second), Data: []byte{}, Length: 0},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, LinkTypeEthernet, SnapLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range packets {
+		before := buf.Len()
+		if err := w.WritePacket(p); err != nil {
+			t.Fatal(err)
+		}
+		w.Flush()
+		if got := int64(buf.Len() - before); got != BlockSize(len(p.Data)) {
+			t.Errorf("packet of %d bytes took %d bytes, BlockSize says %d", len(p.Data), got, BlockSize(len(p.Data)))
+		}
+	}
+	if err := w.WriteStats(base.Add(4*time.Second), 6, 2); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range packets {
+		got, err := r.Next()
+		if err != nil {
+			t.Fatalf("packet %d: %v", i, err)
+		}
+		if !got.Time.Equal(want.Time) || got.LinkType != LinkTypeEthernet ||
+			!bytes.Equal(got.Data, want.Data) || got.Length != want.Length {
+			t.Errorf("packet %d: got %+v, want %+v", i, got, want)
+		}
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("after last packet: %v", err)
+	}
+	if r.Dropped() != 2 {
+		t.Errorf("Dropped() = %d, want 2", r.Dropped())
+	}
+}
+
+func TestReaderRejectsDamage(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, LinkTypeEthernet, SnapLen)
+	w.WritePacket(Packet{Time: time.Now(), Data: make([]byte, 100), Length: 100})
+	w.Flush()
+	file := buf.Bytes()
+
+	if _, err := NewReader(bytes.NewReader([]byte("\xd4\xc3\xb2\xa1 classic pcap"))); !errors.Is(err, ErrFormat) {
+		t.Errorf("classic pcap: got %v, want ErrFormat", err)
+	}
+
+	// A file cut inside the last block still yields the blocks before it
+	r, err := NewReader(bytes.NewReader(file[:len(file)-10]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(); !errors.Is(err, ErrFormat) {
+		t.Errorf("cut block: got %v, want ErrFormat", err)
+	}
+}
+
+func TestCaptureSizeCap(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, LinkTypeEthernet, SnapLen)
+	c := &Capture{w: w, size: int64(buf.Len())}
+	c.maxBytes = c.size + 2*BlockSize(100) + statsBlockSize
+
+	for range 5 {
+		c.record(Packet{Time: time.Now(), Data: make([]byte, 100), Length: 100})
+	}
+	if c.stats.Packets != 2 || c.stats.Dropped != 3 || !c.stats.Truncated {
+		t.Fatalf("stats %+v, want 2 kept and 3 dropped", c.stats)
+	}
+	w.WriteStats(time.Now(), 5, 3)
+	w.Flush()
+	if int64(buf.Len()) > c.maxBytes {
+		t.Errorf("file is %d bytes, over the %d byte cap", buf.Len(), c.maxBytes)
+	}
+
+	r, _ := NewReader(&buf)
+	n := 0
+	for {
+		if _, err := r.Next(); err != nil {
+			break
+		}
+		n++
+	}
+	if n != 2 || r.Dropped() != 3 {
+		t.Errorf("read %d packets with %d dropped, want 2 and 3", n, r.Dropped())
+	}
+}
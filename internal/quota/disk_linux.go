@@ -0,0 +1,13 @@
+package quota
+
+import "syscall"
+
+// diskSpace reports the bytes available to unprivileged users and the size
+// of the filesystem holding dir.
+func diskSpace(dir string) (free, total int64, ok bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, 0, false
+	}
+	return int64(st.Bavail) * int64(st.Bsize), int64(st.Blocks) * int64(st.Bsize), true
+}
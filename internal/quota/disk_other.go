@@ -0,0 +1,8 @@
+//go:build !linux
+
+package quota
+
+// diskSpace is unknown here, so the free space checks are skipped.
+func diskSpace(dir string) (free, total int64, ok bool) {
+	return 0, 0, false
+}
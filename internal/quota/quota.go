@@ -0,0 +1,185 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/database"
+)
+
+var (
+	// ErrTooLarge is returned for uploads over the per-request limit, or
+	// over what is left of the client's daily quota.
+	ErrTooLarge = errors.New("upload too large")
+
+	// ErrQuotaExhausted is returned once a client has used its whole
+	// daily quota.
+	ErrQuotaExhausted = errors.New("daily upload quota exhausted")
+
+	// ErrLowDisk is returned while the upload directory's filesystem is
+	// below its free space threshold.
+	ErrLowDisk = errors.New("insufficient free disk space")
+)
+
+// Framing is the multipart overhead a request body may carry on top of the
+// file itself.
+const Framing = 64 << 10
+
+// Config bounds what uploads may write to disk. Zero fields disable the
+// matching check.
+type Config struct {
+	MaxUploadBytes int64   // largest single upload
+	DailyBytes     int64   // per client, reset at midnight UTC
+	MinFreeBytes   int64   // free space the upload directory must keep
+	MinFreePercent float64 // the same, as a share of the filesystem
+
+	// ClientHeader names a header carrying the client address, such as
+	// X-Forwarded-For, for deployments behind a proxy. Without it the
+	// connection's remote address identifies the client.
+	ClientHeader string
+}
+
+// DefaultConfig allows 512 MiB uploads and 10 GiB a day per client, and
+// stops accepting uploads with under 2 GiB or 5% of the disk free.
+func DefaultConfig() Config {
+	return Config{
+		MaxUploadBytes: 512 << 20,
+		DailyBytes:     10 << 30,
+		MinFreeBytes:   2 << 30,
+		MinFreePercent: 5,
+	}
+}
+
+// Limiter admits uploads into dir. Bytes that uploads still streaming may
+// yet write are held against the client's quota and the free space, so
+// concurrent uploads cannot overshoot either.
+type Limiter struct {
+	cfg Config
+	dir string
+
+	mu       sync.Mutex
+	pending  map[string]int64 // client -> bytes admitted, not yet charged
+	inflight int64
+}
+
+func New(cfg Config, dir string) *Limiter {
+	return &Limiter{cfg: cfg, dir: dir, pending: make(map[string]int64)}
+}
+
+// Ticket is one admitted upload. Limit is the most it may write; Done must
+// be called with what it actually wrote.
+type Ticket struct {
+	Client string
+	Limit  int64 // -1 when unbounded
+	Reason string
+
+	l        *Limiter
+	reserved int64
+}
+
+// Client identifies who sent r for quota purposes.
+func (l *Limiter) Client(r *http.Request) string {
+	if l.cfg.ClientHeader != "" {
+		if v := r.Header.Get(l.cfg.ClientHeader); v != "" {
+			first, _, _ := strings.Cut(v, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Admit checks the request against every limit before its body is read.
+// declared is the request's Content-Length, or -1. The returned Ticket's
+// Limit is the tightest bound on the file that applies; Reason says which.
+func (l *Limiter) Admit(client string, declared int64) (*Ticket, error) {
+	t := &Ticket{Client: client, Limit: -1, l: l}
+	tighten := func(n int64, reason string) {
+		if t.Limit < 0 || n < t.Limit {
+			t.Limit, t.Reason = n, reason
+		}
+	}
+	if l.cfg.MaxUploadBytes > 0 {
+		tighten(l.cfg.MaxUploadBytes, fmt.Sprintf("uploads are limited to %d bytes", l.cfg.MaxUploadBytes))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cfg.DailyBytes > 0 {
+		used, err := database.UploadUsageBytes(client, Today())
+		if err != nil {
+			return nil, err
+		}
+		left := l.cfg.DailyBytes - used - l.pending[client]
+		if left <= 0 {
+			return nil, ErrQuotaExhausted
+		}
+		tighten(left, fmt.Sprintf("%d bytes left of the daily quota", left))
+	}
+
+	if free, total, ok := diskSpace(l.dir); ok {
+		keep := l.cfg.MinFreeBytes
+		if pct := int64(l.cfg.MinFreePercent / 100 * float64(total)); pct > keep {
+			keep = pct
+		}
+		room := free - keep - l.inflight
+		if keep > 0 && room <= 0 {
+			return nil, ErrLowDisk
+		}
+		if keep > 0 {
+			tighten(room, "not enough free disk space")
+		}
+	}
+
+	if t.Limit >= 0 && declared > t.Limit+Framing {
+		return nil, fmt.Errorf("%w: %s", ErrTooLarge, t.Reason)
+	}
+	if t.Limit >= 0 {
+		// A declared length is all the body can hold, so reserve only that
+		t.reserved = t.Limit
+		if declared >= 0 {
+			t.reserved = declared
+		}
+		l.pending[client] += t.reserved
+		l.inflight += t.reserved
+	}
+	return t, nil
+}
+
+// Done releases the ticket's reservation and charges written bytes to the
+// client's quota.
+func (t *Ticket) Done(written int64) error {
+	l := t.l
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending[t.Client] -= t.reserved
+	if l.pending[t.Client] <= 0 {
+		delete(l.pending, t.Client)
+	}
+	l.inflight -= t.reserved
+	t.reserved = 0
+	if written <= 0 || l.cfg.DailyBytes <= 0 {
+		return nil
+	}
+	return database.AddUploadUsage(t.Client, Today(), written)
+}
+
+// Today is the quota day, in UTC.
+func Today() string {
+	return time.Now().UTC().Format(time.DateOnly)
+}
+
+// UntilReset is how long until the daily quotas start over.
+func UntilReset() time.Duration {
+	now := time.Now().UTC()
+	return now.Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+}
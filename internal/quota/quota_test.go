@@ -0,0 +1,103 @@
+package quota
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/sudankdk/firecracker/internal/database"
+)
+
+func openDB(t *testing.T) {
+	t.Helper()
+	if err := database.InitDatabase(filepath.Join(t.TempDir(), "quota.db")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func usage(t *testing.T, client string) int64 {
+	t.Helper()
+	n, err := database.UploadUsageBytes(client, Today())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestDailyQuota(t *testing.T) {
+	openDB(t)
+	l := New(Config{MaxUploadBytes: 1000, DailyBytes: 2500}, t.TempDir())
+
+	// Streaming uploads of unknown length reserve their whole limit
+	a, err := l.Admit("10.0.0.1", -1)
+	if err != nil || a.Limit != 1000 {
+		t.Fatalf("first upload: limit %v, err %v", a, err)
+	}
+	b, _ := l.Admit("10.0.0.1", -1)
+	c, err := l.Admit("10.0.0.1", -1)
+	if err != nil || c.Limit != 500 || c.Reason != "500 bytes left of the daily quota" {
+		t.Fatalf("third upload: %+v, err %v", c, err)
+	}
+	if _, err := l.Admit("10.0.0.1", -1); !errors.Is(err, ErrQuotaExhausted) {
+		t.Fatalf("fourth upload: got %v, want ErrQuotaExhausted", err)
+	}
+	if other, err := l.Admit("10.0.0.2", -1); err != nil || other.Limit != 1000 {
+		t.Fatalf("another client: %+v, err %v", other, err)
+	}
+
+	// Only written bytes are charged; the rest of each reservation returns
+	a.Done(300)
+	b.Done(0)
+	c.Done(500)
+	if got := usage(t, "10.0.0.1"); got != 800 {
+		t.Errorf("charged %d bytes, want 800", got)
+	}
+	d, err := l.Admit("10.0.0.1", -1)
+	if err != nil || d.Limit != 1000 {
+		t.Fatalf("after Done: %+v, err %v", d, err)
+	}
+
+	// A declared length reserves only that much, plus room for framing
+	e, err := l.Admit("10.0.0.1", 200)
+	if err != nil || e.Limit != 700 || e.reserved != 200 {
+		t.Fatalf("declared upload: %+v, err %v", e, err)
+	}
+	if _, err := l.Admit("10.0.0.1", 500+Framing+1); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("declared length over the limit: got %v, want ErrTooLarge", err)
+	}
+	d.Done(0)
+	e.Done(0)
+	if len(l.pending) != 1 || l.inflight != 1000 {
+		t.Errorf("pending %v, inflight %d; want only the other client's reservation", l.pending, l.inflight)
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	l := New(Config{}, t.TempDir())
+	tk, err := l.Admit("10.0.0.1", 1<<40)
+	if err != nil || tk.Limit != -1 {
+		t.Fatalf("got %+v, %v", tk, err)
+	}
+	// Without a daily quota nothing is recorded, so no database is needed
+	if err := tk.Done(1 << 40); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	r := &http.Request{RemoteAddr: "192.0.2.7:51234", Header: http.Header{}}
+	r.Header.Set("X-Forwarded-For", "198.51.100.1, 10.0.0.1")
+
+	if got := New(Config{}, "").Client(r); got != "192.0.2.7" {
+		t.Errorf("without ClientHeader: %s", got)
+	}
+	l := New(Config{ClientHeader: "X-Forwarded-For"}, "")
+	if got := l.Client(r); got != "198.51.100.1" {
+		t.Errorf("with ClientHeader: %s", got)
+	}
+	r.Header.Del("X-Forwarded-For")
+	if got := l.Client(r); got != "192.0.2.7" {
+		t.Errorf("header missing: %s", got)
+	}
+}
@@ -0,0 +1,272 @@
+package rescan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sudankdk/firecracker/internal/database"
+	"github.com/sudankdk/firecracker/internal/domain"
+	"github.com/sudankdk/firecracker/internal/samples"
+	"github.com/sudankdk/firecracker/internal/scanner"
+	"github.com/sudankdk/firecracker/internal/verdict"
+	"gorm.io/gorm"
+)
+
+var ErrRunning = errors.New("a rescan is already running")
+
+// Rescanner runs the current YARA rules over every stored sample and
+// records, per sample, how the result differs from the one before it.
+// Rescans are report-only: they update SampleVerdict and the run's
+// VerdictChanges, while each Job keeps the verdict of its own analysis.
+type Rescanner struct {
+	Store    *samples.Store
+	Scanner  scanner.Scanner
+	Verdicts verdict.Config
+	Workers  int    // concurrent scans; defaults to 2
+	TmpDir   string // where samples are decrypted for scanning
+
+	mu      sync.Mutex
+	running *database.RescanRun
+}
+
+// Start begins a rescan in the background and returns its run record.
+// Samples already scanned with the rules loaded when their turn comes are
+// skipped unless force is set.
+func (r *Rescanner) Start(force bool) (*database.RescanRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running != nil {
+		run := *r.running
+		return &run, ErrRunning
+	}
+
+	hashes, err := r.Store.Hashes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored samples: %w", err)
+	}
+	run := &database.RescanRun{
+		ID:           uuid.New().String(),
+		RulesVersion: r.Scanner.Info().Version,
+		State:        database.RescanRunning,
+		Force:        force,
+		Total:        len(hashes),
+		StartedAt:    time.Now(),
+	}
+	if err := database.CreateRescanRun(run); err != nil {
+		return nil, err
+	}
+	r.running = run
+	go r.run(run, hashes)
+
+	copied := *run
+	return &copied, nil
+}
+
+// outcome of rescanning one sample
+const (
+	scanned = iota
+	skipped
+	changed
+	failed
+)
+
+func (r *Rescanner) run(run *database.RescanRun, hashes []string) {
+	log.Printf("rescan started: run=%s rules=%s samples=%d force=%t", run.ID, run.RulesVersion, run.Total, run.Force)
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for range max(1, r.Workers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for hash := range work {
+				res, err := r.rescanOne(run, hash)
+				if err != nil {
+					log.Printf("rescan failed: run=%s hash=%s err=%v", run.ID, hash, err)
+				}
+				r.progress(run, res)
+			}
+		}()
+	}
+	for _, hash := range hashes {
+		work <- hash
+	}
+	close(work)
+	wg.Wait()
+
+	r.mu.Lock()
+	now := time.Now()
+	run.State = database.RescanCompleted
+	run.FinishedAt = &now
+	if err := database.SaveRescanRun(run); err != nil {
+		log.Printf("rescan not saved: run=%s err=%v", run.ID, err)
+	}
+	r.running = nil
+	r.mu.Unlock()
+
+	log.Printf("rescan finished: run=%s scanned=%d skipped=%d changed=%d failed=%d",
+		run.ID, run.Scanned, run.Skipped, run.Changed, run.Failed)
+}
+
+// Recover marks runs a previous process left running as interrupted. Call
+// it once at startup, before Start.
+func Recover() {
+	n, err := database.InterruptRescanRuns()
+	if err != nil {
+		log.Printf("rescan runs not recovered: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("rescan runs interrupted by restart: %d", n)
+	}
+}
+
+func (r *Rescanner) progress(run *database.RescanRun, outcome int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch outcome {
+	case skipped:
+		run.Skipped++
+	case failed:
+		run.Failed++
+	case changed:
+		run.Changed++
+		run.Scanned++
+	default:
+		run.Scanned++
+	}
+	if err := database.SaveRescanRun(run); err != nil {
+		log.Printf("rescan progress not saved: run=%s err=%v", run.ID, err)
+	}
+}
+
+func (r *Rescanner) rescanOne(run *database.RescanRun, hash string) (int, error) {
+	prev, err := prior(hash)
+	if err != nil {
+		return failed, err
+	}
+	// Rules may reload mid-run, so compare against what is loaded now
+	if !run.Force && prev != nil && prev.RulesVersion == r.Scanner.Info().Version {
+		return skipped, nil
+	}
+
+	path, err := r.Store.Extract(hash, r.TmpDir)
+	if err != nil {
+		return failed, err
+	}
+	defer os.Remove(path)
+
+	res, err := r.Scanner.ScanFile(context.Background(), path)
+	if err != nil {
+		return failed, err
+	}
+	v := r.Verdicts.Evaluate(res.Matches)
+	if err := RecordScan(hash, res, v); err != nil {
+		return failed, err
+	}
+	if prev == nil {
+		return scanned, nil
+	}
+
+	now := MatchedRules(res.Matches)
+	added, removed := diff(prev.Rules, now)
+	prevLabel, prevScore := domain.VerdictClean, 0
+	if prev.Verdict != nil {
+		prevLabel, prevScore = prev.Verdict.Verdict, prev.Verdict.Score
+	}
+	if len(added) == 0 && len(removed) == 0 && prevLabel == v.Verdict {
+		return scanned, nil
+	}
+
+	change := &database.VerdictChange{
+		RunID:            run.ID,
+		Hash:             hash,
+		PrevRulesVersion: prev.RulesVersion,
+		PrevVerdict:      prevLabel,
+		PrevScore:        prevScore,
+		NewRulesVersion:  res.RulesVersion,
+		NewVerdict:       v.Verdict,
+		NewScore:         v.Score,
+		AddedRules:       added,
+		RemovedRules:     removed,
+		VerdictChanged:   prevLabel != v.Verdict,
+	}
+	if err := database.AddVerdictChange(change); err != nil {
+		return failed, err
+	}
+	log.Printf("rescan verdict diff: run=%s hash=%s %s -> %s added=%v removed=%v",
+		run.ID, hash, prevLabel, v.Verdict, added, removed)
+	if change.VerdictChanged {
+		return changed, nil
+	}
+	return scanned, nil
+}
+
+// RecordScan makes res the latest result for the sample with this hash.
+func RecordScan(hash string, res *scanner.Result, v *domain.Verdict) error {
+	return database.SaveSampleVerdict(&database.SampleVerdict{
+		Hash:         hash,
+		RulesVersion: res.RulesVersion,
+		Verdict:      v,
+		Rules:        MatchedRules(res.Matches),
+		ScannedAt:    time.Now(),
+	})
+}
+
+// MatchedRules names each match as namespace:rule, sorted.
+func MatchedRules(matches []domain.YaraMatch) []string {
+	rules := make([]string, 0, len(matches))
+	for _, m := range matches {
+		rules = append(rules, m.Namespace+":"+m.Rule)
+	}
+	slices.Sort(rules)
+	return slices.Compact(rules)
+}
+
+// prior is the result a rescan is compared against: the sample's latest
+// scan, or for samples from before SampleVerdict, its newest job.
+func prior(hash string) (*database.SampleVerdict, error) {
+	sv, err := database.GetSampleVerdict(hash)
+	if err == nil {
+		return sv, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	job, err := database.LatestJobVerdict(hash)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &database.SampleVerdict{
+		Hash:         hash,
+		RulesVersion: job.RulesVersion,
+		Verdict:      job.Verdict,
+		Rules:        MatchedRules(job.YaraMatches),
+	}, nil
+}
+
+func diff(before, after []string) (added, removed []string) {
+	added, removed = []string{}, []string{}
+	for _, r := range after {
+		if !slices.Contains(before, r) {
+			added = append(added, r)
+		}
+	}
+	for _, r := range before {
+		if !slices.Contains(after, r) {
+			removed = append(removed, r)
+		}
+	}
+	return added, removed
+}
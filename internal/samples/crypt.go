@@ -0,0 +1,166 @@
+package samples
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Samples are sealed with AES-256-GCM in fixed-size chunks so large files
+// stream in constant memory. Each chunk's nonce is a random per-file prefix
+// plus the chunk counter, and the counter and a final-chunk flag are bound
+// in as additional data, so chunks cannot be reordered, dropped or the file
+// truncated without Open failing.
+//
+//	magic(8) | prefix(8) | chunk 0 | chunk 1 | ... | final chunk (may be empty)
+const (
+	keySize     = 32
+	chunkSize   = 64 << 10
+	prefixSize  = 8
+	fileMagic   = "FCSMPL01"
+	maxChunkIdx = 1<<32 - 1
+)
+
+var errCorrupt = errors.New("sample ciphertext corrupt")
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, idx uint32) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[prefixSize:], idx)
+	return nonce
+}
+
+func chunkAD(idx uint32, final bool) []byte {
+	ad := make([]byte, 5)
+	binary.BigEndian.PutUint32(ad, idx)
+	if final {
+		ad[4] = 1
+	}
+	return ad
+}
+
+func encrypt(dst io.Writer, src io.Reader, key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(dst, fileMagic); err != nil {
+		return err
+	}
+	if _, err := dst.Write(prefix); err != nil {
+		return err
+	}
+
+	br := bufio.NewReaderSize(src, chunkSize)
+	buf := make([]byte, chunkSize)
+	sealed := make([]byte, 0, chunkSize+aead.Overhead())
+	for idx := uint32(0); ; idx++ {
+		n, err := io.ReadFull(br, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		// A short read ends the file; so does a full chunk with nothing after it
+		final := n < chunkSize
+		if !final {
+			if _, perr := br.Peek(1); perr == io.EOF {
+				final = true
+			}
+		}
+		if idx == maxChunkIdx && !final {
+			return errors.New("sample too large")
+		}
+		sealed = aead.Seal(sealed[:0], chunkNonce(prefix, idx), buf[:n], chunkAD(idx, final))
+		if _, err := dst.Write(sealed); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// decryptReader streams plaintext out of an encrypted sample.
+type decryptReader struct {
+	src    *bufio.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	idx    uint32
+	buf    []byte // ciphertext scratch
+	plain  []byte // decrypted bytes not yet returned
+	done   bool
+}
+
+func newDecryptReader(src io.Reader, key []byte) (*decryptReader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, len(fileMagic)+prefixSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return nil, fmt.Errorf("%w: short header", errCorrupt)
+	}
+	if string(header[:len(fileMagic)]) != fileMagic {
+		return nil, fmt.Errorf("%w: bad magic", errCorrupt)
+	}
+	return &decryptReader{
+		src:    bufio.NewReaderSize(src, chunkSize+aead.Overhead()),
+		aead:   aead,
+		prefix: header[len(fileMagic):],
+		buf:    make([]byte, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *decryptReader) next() error {
+	n, err := io.ReadFull(r.src, r.buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return fmt.Errorf("%w: truncated", errCorrupt)
+		}
+		return err
+	}
+	final := n < len(r.buf)
+	if !final {
+		if _, perr := r.src.Peek(1); perr == io.EOF {
+			final = true
+		}
+	}
+	plain, err := r.aead.Open(r.buf[:0:0], chunkNonce(r.prefix, r.idx), r.buf[:n], chunkAD(r.idx, final))
+	if err != nil {
+		return fmt.Errorf("%w: chunk %d", errCorrupt, r.idx)
+	}
+	r.plain = plain
+	r.done = final
+	r.idx++
+	return nil
+}
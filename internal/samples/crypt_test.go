@@ -0,0 +1,99 @@
+package samples
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"slices"
+	"testing"
+	"testing/iotest"
+)
+
+var testKey = bytes.Repeat([]byte{0x42}, keySize)
+
+func seal(t *testing.T, plain []byte) []byte {
+	t.Helper()
+	var sealed bytes.Buffer
+	// One byte at a time, so chunks are filled by repeated short reads
+	if err := encrypt(&sealed, iotest.OneByteReader(bytes.NewReader(plain)), testKey); err != nil {
+		t.Fatal(err)
+	}
+	return sealed.Bytes()
+}
+
+func unseal(sealed, key []byte) ([]byte, error) {
+	r, err := newDecryptReader(bytes.NewReader(sealed), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestChunkedRoundTrip(t *testing.T) {
+	const overhead = 16 // GCM tag
+	header := len(fileMagic) + prefixSize
+	rng := rand.New(rand.NewSource(1))
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 2 * chunkSize, 2*chunkSize + 17} {
+		plain := make([]byte, size)
+		rng.Read(plain)
+		sealed := seal(t, plain)
+
+		// A file that ends on a chunk boundary has no empty final chunk,
+		// but an empty file is one empty chunk
+		chunks := (size + chunkSize - 1) / chunkSize
+		if size == 0 {
+			chunks = 1
+		}
+		if want := header + size + chunks*overhead; len(sealed) != want {
+			t.Errorf("size %d: sealed to %d bytes, want %d", size, len(sealed), want)
+		}
+
+		got, err := unseal(sealed, testKey)
+		if err != nil {
+			t.Errorf("size %d: %v", size, err)
+			continue
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("size %d: round trip changed the data", size)
+		}
+	}
+}
+
+func TestChunkedTampering(t *testing.T) {
+	plain := make([]byte, 2*chunkSize+17)
+	rand.New(rand.NewSource(2)).Read(plain)
+	sealed := seal(t, plain)
+
+	header := len(fileMagic) + prefixSize
+	chunk := chunkSize + 16
+	c0 := sealed[header : header+chunk]
+	c1 := sealed[header+chunk : header+2*chunk]
+	rest := sealed[header+2*chunk:]
+
+	flipped := bytes.Clone(sealed)
+	flipped[header+chunk+100] ^= 1
+	badMagic := bytes.Clone(sealed)
+	badMagic[0] = 'X'
+
+	tests := []struct {
+		name   string
+		sealed []byte
+		key    []byte
+	}{
+		{"flipped bit", flipped, testKey},
+		{"swapped chunks", slices.Concat(sealed[:header], c1, c0, rest), testKey},
+		{"dropped final chunk", sealed[:header+2*chunk], testKey},
+		{"dropped middle chunk", slices.Concat(sealed[:header], c0, rest), testKey},
+		{"cut mid-chunk", sealed[:header+chunk+10], testKey},
+		{"header only", sealed[:header], testKey},
+		{"bad magic", badMagic, testKey},
+		{"wrong key", sealed, bytes.Repeat([]byte{0x43}, keySize)},
+	}
+	for _, tc := range tests {
+		if _, err := unseal(tc.sealed, tc.key); !errors.Is(err, errCorrupt) {
+			t.Errorf("%s: got %v, want errCorrupt", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package samples
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrNotFound = errors.New("sample not stored")
+	ErrBadHash  = errors.New("invalid sha256")
+
+	sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// Config enables the sample store. Without it uploads are deleted once
+// their job finishes and can never be rescanned.
+type Config struct {
+	Enabled bool
+	Dir     string
+	KeyFile string // 32 raw or 64 hex bytes; created on first use
+}
+
+// Store keeps one encrypted copy of every sample, addressed by its SHA-256.
+// Files live at Dir/<first two hex digits>/<sha256>.enc.
+type Store struct {
+	dir string
+	key []byte
+}
+
+// Open prepares the store directory and loads, or generates, its key.
+func Open(cfg Config) (*Store, error) {
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create sample store: %w", err)
+	}
+	key, err := loadOrCreateKey(cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{dir: cfg.Dir, key: key}, nil
+}
+
+// Has reports whether the sample with this hash is stored.
+func (s *Store) Has(hash string) bool {
+	path, err := s.path(hash)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// Put encrypts srcPath into the store under hash. The content is hashed as
+// it is copied and rejected if it does not match. Storing a sample twice
+// is a no-op.
+func (s *Store) Put(hash, srcPath string) error {
+	dst, err := s.path(hash)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	err = encrypt(tmp, io.TeeReader(src, h), s.key)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store sample %s: %w", hash, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != hash {
+		return fmt.Errorf("sample content hashes to %s, not %s", got, hash)
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// Open returns the decrypted sample. Reads fail if the ciphertext has been
+// tampered with or truncated.
+func (s *Store) Open(hash string) (io.ReadCloser, error) {
+	path, err := s.path(hash)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	r, err := newDecryptReader(f, s.key)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, f}, nil
+}
+
+// Extract decrypts the sample to a new file in dir, for tools that need a
+// path. The caller removes it.
+func (s *Store) Extract(hash, dir string) (string, error) {
+	r, err := s.Open(hash)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	out, err := os.CreateTemp(dir, "sample-"+hash[:12]+"-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", fmt.Errorf("failed to decrypt sample %s: %w", hash, err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+// Delete removes a stored sample.
+func (s *Store) Delete(hash string) error {
+	path, err := s.path(hash)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Hashes lists every stored sample.
+func (s *Store) Hashes() ([]string, error) {
+	var hashes []string
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if hash, ok := strings.CutSuffix(d.Name(), ".enc"); ok && sha256Hex.MatchString(hash) {
+			hashes = append(hashes, hash)
+		}
+		return nil
+	})
+	return hashes, err
+}
+
+func (s *Store) path(hash string) (string, error) {
+	hash = strings.ToLower(hash)
+	if !sha256Hex.MatchString(hash) {
+		return "", ErrBadHash
+	}
+	return filepath.Join(s.dir, hash[:2], hash+".enc"), nil
+}
+
+func loadOrCreateKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		key := make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write sample key: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sample key: %w", err)
+	}
+
+	if len(data) == keySize {
+		return data, nil
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("sample key %s must be %d raw or hex-encoded bytes", path, keySize)
+	}
+	return key, nil
+}
@@ -0,0 +1,107 @@
+package samples
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "sample.key")
+	s, err := Open(Config{Enabled: true, Dir: filepath.Join(dir, "store"), KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := bytes.Repeat([]byte("MZ sample "), 10000)
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	src := filepath.Join(dir, "upload")
+	if err := os.WriteFile(src, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Put(strings.Repeat("0", 64), src); err == nil {
+		t.Error("Put accepted content under the wrong hash")
+	}
+	if err := s.Put(hash, src); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Has(hash) || !s.Has(strings.ToUpper(hash)) {
+		t.Error("Has() = false after Put")
+	}
+	stored, _ := os.ReadFile(filepath.Join(dir, "store", hash[:2], hash+".enc"))
+	if bytes.Contains(stored, []byte("MZ sample")) {
+		t.Error("sample stored in the clear")
+	}
+
+	r, err := s.Open(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("Open returned %d bytes, err %v", len(got), err)
+	}
+
+	// A reopened store reads the same key back from its file
+	s2, err := Open(Config{Enabled: true, Dir: filepath.Join(dir, "store"), KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := s2.Extract(hash, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, content) {
+		t.Error("Extract wrote different content")
+	}
+
+	if hashes, err := s.Hashes(); err != nil || !slices.Equal(hashes, []string{hash}) {
+		t.Errorf("Hashes() = %v, %v", hashes, err)
+	}
+	if err := s.Delete(hash); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Open(hash); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open after Delete: %v", err)
+	}
+	if _, err := s.Open("../../etc/passwd"); !errors.Is(err, ErrBadHash) {
+		t.Errorf("Open with a path for a hash: %v", err)
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	dir := t.TempDir()
+	raw := bytes.Repeat([]byte{7}, keySize)
+	tests := []struct {
+		name string
+		data string
+		ok   bool
+	}{
+		{"raw", string(raw), true},
+		{"hex", hex.EncodeToString(raw) + "\n", true},
+		{"short", "abcd", false},
+		{"bad hex", strings.Repeat("zz", keySize), false},
+	}
+	for _, tc := range tests {
+		path := filepath.Join(dir, tc.name)
+		os.WriteFile(path, []byte(tc.data), 0600)
+		key, err := loadOrCreateKey(path)
+		if tc.ok && (err != nil || !bytes.Equal(key, raw)) {
+			t.Errorf("%s: key %x, err %v", tc.name, key, err)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("%s: accepted", tc.name)
+		}
+	}
+}
@@ -1,121 +1,164 @@
-package sandboxing
-
-import (
-	"errors"
-	"fmt"
-	"os"
-	"os/exec"
-
-	"github.com/google/uuid"
-	"github.com/sudankdk/firecracker/internal/domain"
-	client "github.com/sudankdk/firecracker/internal/httpClient"
-)
-
-// CreateVMMetadata generates unique IDs, socket path, and TAP name
-func CreateVMMetadata() (*domain.VM, error) {
-	vmID := uuid.New().String()
-	apiSock := fmt.Sprintf("/tmp/firecracker/%s.api.sock", vmID)
-	tap := fmt.Sprintf("tap-%s", vmID[:8])
-
-	return &domain.VM{
-		ID:      vmID,
-		APISock: apiSock,
-		TapName: tap,
-	}, nil
-}
-
-// CreateTAP creates a host TAP interface
-func CreateTAP(tapName string) error {
-	if err := exec.Command("ip", "tuntap", "add", tapName, "mode", "tap").Run(); err != nil {
-		return err
-	}
-	if err := exec.Command("ip", "link", "set", tapName, "up").Run(); err != nil {
-		return err
-	}
-	return nil
-}
-
-// RunFirecracker launches Firecracker process asynchronously
-func RunFirecracker(vm *domain.VM) error {
-	cmd := exec.Command(
-		"./firecracker",
-		"--api-sock", vm.APISock,
-		"--enable-pci",
-	)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Start(); err != nil {
-		return err
-	}
-
-	vm.Cmd = cmd
-
-	// Cleanup TAP & socket when process exits
-	go func() {
-		cmd.Wait()
-		exec.Command("ip", "link", "del", vm.TapName).Run()
-		os.Remove(vm.APISock)
-	}()
-
-	return nil
-}
-
-func configureVM(vm *domain.VM, kernel, rootfs, inputDrive string) error {
-	httpClient := client.NewClient(vm.APISock)
-
-	// Random MAC for eth0
-	// r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	// mac := fmt.Sprintf("AA:FC:%02X:%02X:%02X:%02X", r.Intn(256), r.Intn(256), r.Intn(256), r.Intn(256))
-
-	// // Network interface
-	// if err := client.Put(httpClient, "/network-interfaces/eth0", []byte(fmt.Sprintf(`{
-	// 	"iface_id": "eth0",
-	// 	"host_dev_name": "%s",
-	// 	"guest_mac": "%s"
-	// }`, vm.TapName, mac))); err != nil {
-	// 	return errors.New("failed to attach network interface")
-	// }
-
-	// Machine config
-	if err := client.Put(httpClient, "/machine-config", []byte(`{
-		"vcpu_count": 1,
-		"mem_size_mib": 512
-	}`)); err != nil {
-		return errors.New("failed to configure machine")
-	}
-
-	// Boot source
-	if err := client.Put(httpClient, "/boot-source", []byte(fmt.Sprintf(`{
-		"kernel_image_path": "%s",
-		"boot_args": "console=ttyS0 reboot=k panic=1 pci=off ip=off"
-	}`, kernel))); err != nil {
-		return errors.New("failed to configure boot source")
-	}
-
-	// Rootfs (read-only for isolation)
-	if err := client.Put(httpClient, "/drives/rootfs", []byte(fmt.Sprintf(`{
-		"drive_id": "rootfs",
-		"path_on_host": "%s",
-		"is_root_device": true,
-		"is_read_only": true
-	}`, rootfs))); err != nil {
-		return errors.New("failed to configure rootfs")
-	}
-
-	// Input drive (uploaded file)
-	if err := client.Put(httpClient, "/drives/input_drive", []byte(fmt.Sprintf(`{
-		"drive_id": "input_drive",
-		"path_on_host": "%s",
-		"is_root_device": false,
-		"is_read_only": true
-	}`, inputDrive))); err != nil {
-		return errors.New("failed to configure input drive")
-	}
-
-	// Start instance
-	if err := client.Put(httpClient, "/actions", []byte(`{"action_type":"InstanceStart"}`)); err != nil {
-		return errors.New("failed to start instance")
-	}
-	return nil
-}
+package sandboxing
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/google/uuid"
+	"github.com/sudankdk/firecracker/internal/domain"
+	client "github.com/sudankdk/firecracker/internal/httpClient"
+)
+
+// CreateVMMetadata generates unique IDs, socket path, and TAP name
+func CreateVMMetadata() (*domain.VM, error) {
+	vmID := uuid.New().String()
+	apiSock := fmt.Sprintf("/tmp/firecracker/%s.api.sock", vmID)
+	tap := fmt.Sprintf("tap-%s", vmID[:8])
+
+	return &domain.VM{
+		ID:      vmID,
+		APISock: apiSock,
+		TapName: tap,
+	}, nil
+}
+
+// CreateTAP creates a host TAP interface
+func CreateTAP(tapName string) error {
+	if err := exec.Command("ip", "tuntap", "add", tapName, "mode", "tap").Run(); err != nil {
+		return err
+	}
+	if err := exec.Command("ip", "link", "set", tapName, "up").Run(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RunFirecracker launches Firecracker process asynchronously
+func RunFirecracker(vm *domain.VM) error {
+	cmd := exec.Command(
+		"./firecracker",
+		"--api-sock", vm.APISock,
+		"--enable-pci",
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	vm.Cmd = cmd
+
+	// Cleanup TAP & socket when process exits
+	go func() {
+		cmd.Wait()
+		exec.Command("ip", "link", "del", vm.TapName).Run()
+		os.Remove(vm.APISock)
+	}()
+
+	return nil
+}
+
+// bootSpec holds what configureVM hands to Firecracker. Paths are already
+// translated to the chroot view when the VM is jailed.
+type bootSpec struct {
+	VcpuCount      int
+	MemSizeMib     int
+	RootfsWritable bool
+	Kernel         string
+	Rootfs         string
+	InputDrive     string
+	VsockUDS       string
+	Network        *guestNetwork         // nil leaves the guest without a NIC
+	Metadata       *domain.GuestMetadata // MMDS v2 document; needs Network
+
+	// Set instead of Kernel when restoring from a golden snapshot.
+	SnapshotState string
+	SnapshotMem   string
+}
+
+func configureVM(vm *domain.VM, spec bootSpec) error {
+	httpClient := client.NewClient(vm.APISock)
+
+	// Network interface, only for jobs that asked for one
+	bootArgs := "console=ttyS0 reboot=k panic=1 pci=off ip=off"
+	if spec.Network != nil {
+		if err := client.PutNetworkInterface(httpClient, client.NetworkInterface{
+			IfaceID:     "eth0",
+			HostDevName: spec.Network.TapName,
+			GuestMAC:    spec.Network.GuestMAC,
+		}); err != nil {
+			return fmt.Errorf("failed to attach network interface: %w", err)
+		}
+		bootArgs = "console=ttyS0 reboot=k panic=1 pci=off " + spec.Network.BootIP
+	}
+
+	// Job metadata, stored before the guest can ask for it
+	if spec.Metadata != nil {
+		if spec.Network == nil {
+			return errors.New("guest metadata needs a network interface")
+		}
+		if err := client.PutMmdsConfig(httpClient, client.MmdsConfig{
+			Version:           "V2",
+			NetworkInterfaces: []string{"eth0"},
+			IPv4Address:       mmdsIPv4,
+		}); err != nil {
+			return fmt.Errorf("failed to configure metadata service: %w", err)
+		}
+		if err := putMetadata(vm, spec.Metadata); err != nil {
+			return err
+		}
+	}
+
+	// Machine config
+	if err := client.PutMachineConfig(httpClient, client.MachineConfiguration{
+		VcpuCount:  spec.VcpuCount,
+		MemSizeMib: spec.MemSizeMib,
+	}); err != nil {
+		return fmt.Errorf("failed to configure machine: %w", err)
+	}
+
+	// Boot source
+	if err := client.PutBootSource(httpClient, client.BootSource{
+		KernelImagePath: spec.Kernel,
+		BootArgs:        bootArgs,
+	}); err != nil {
+		return fmt.Errorf("failed to configure boot source: %w", err)
+	}
+
+	// Rootfs (read-only for isolation unless the VM has a private clone)
+	if err := client.PutDrive(httpClient, client.Drive{
+		DriveID:      "rootfs",
+		PathOnHost:   spec.Rootfs,
+		IsRootDevice: true,
+		IsReadOnly:   !spec.RootfsWritable,
+	}); err != nil {
+		return fmt.Errorf("failed to configure rootfs: %w", err)
+	}
+
+	// Input drive (uploaded file)
+	if err := client.PutDrive(httpClient, client.Drive{
+		DriveID:      "input_drive",
+		PathOnHost:   spec.InputDrive,
+		IsRootDevice: false,
+		IsReadOnly:   true,
+	}); err != nil {
+		return fmt.Errorf("failed to configure input drive: %w", err)
+	}
+
+	// Result channel back to the host
+	if err := client.PutVsock(httpClient, client.Vsock{
+		GuestCID: GuestCID,
+		UDSPath:  spec.VsockUDS,
+	}); err != nil {
+		return fmt.Errorf("failed to configure vsock: %w", err)
+	}
+
+	// Start instance
+	if err := client.CreateAction(httpClient, client.ActionInstanceStart); err != nil {
+		return fmt.Errorf("failed to start instance: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package sandboxing
+
+import "syscall"
+
+// allocatedBytes reports the disk space path actually occupies, which for
+// a sparse image is less than its size.
+func allocatedBytes(path string) (int64, bool) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, false
+	}
+	return st.Blocks * 512, true
+}
@@ -0,0 +1,112 @@
+package sandboxing
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+// Artifact names under a job's artifact directory.
+const (
+	ArtifactCapture = "network.pcapng"
+	ArtifactConsole = "console.log"
+
+	consoleLogFile = "console.log" // in the VM directory, rotated beside it
+)
+
+// ErrNoArtifact is returned for artifacts that do not exist.
+var ErrNoArtifact = errors.New("no such artifact")
+
+// Artifact is a file a job's VM left behind, kept after teardown.
+type Artifact struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// ArtifactDir is where jobID's artifacts are kept, or "" when
+// BaseArtifactDir is unset and nothing is kept.
+func (mgr *VMManager) ArtifactDir(jobID string) string {
+	if mgr.BaseArtifactDir == "" || jobID == "" {
+		return ""
+	}
+	return filepath.Join(mgr.BaseArtifactDir, jobID)
+}
+
+// artifactPath creates jobID's artifact directory and returns the path for
+// name inside it.
+func (mgr *VMManager) artifactPath(jobID, name string) (string, error) {
+	dir := mgr.ArtifactDir(jobID)
+	if dir == "" {
+		return "", errors.New("artifacts are not kept")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// Artifacts lists jobID's artifacts by name.
+func (mgr *VMManager) Artifacts(jobID string) ([]Artifact, error) {
+	dir := mgr.ArtifactDir(jobID)
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []Artifact
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		list = append(list, Artifact{Name: e.Name(), Size: info.Size(), Modified: info.ModTime()})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// OpenArtifact opens one of jobID's artifacts for reading.
+func (mgr *VMManager) OpenArtifact(jobID, name string) (*os.File, error) {
+	dir := mgr.ArtifactDir(jobID)
+	if dir == "" || name == "" || name != filepath.Base(name) || name[0] == '.' {
+		return nil, ErrNoArtifact
+	}
+	f, err := os.Open(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoArtifact
+	}
+	return f, err
+}
+
+// keepConsole copies vm's console log into jobID's artifacts before
+// teardown removes the VM directory with it.
+func (mgr *VMManager) keepConsole(vm *domain.VM, jobID string) {
+	if vm.Console == nil || mgr.ArtifactDir(jobID) == "" {
+		return
+	}
+	path, err := mgr.artifactPath(jobID, ArtifactConsole)
+	if err == nil {
+		var f *os.File
+		if f, err = os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600); err == nil {
+			err = vm.Console.CopyTo(f)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("console log not kept: vm=%s job=%s err=%v", vm.ID, jobID, err)
+	}
+}
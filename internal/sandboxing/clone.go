@@ -0,0 +1,218 @@
+package sandboxing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+// Clone strategies, in the order cloneImage tries them.
+const (
+	CloneReflink    = "reflink"     // FICLONE: shares extents, copy-on-write
+	CloneOverlay    = "overlay"     // dm-snapshot over the shared image; writable images only
+	CloneHardlink   = "hardlink"    // shares the inode; read-only images only
+	CloneSparseCopy = "sparse-copy" // full private copy that skips holes and zero blocks
+	CloneCopy       = "copy"        // full byte copy
+
+	// CloneBindMount is used instead of a copy to expose a read-only image
+	// inside a jail on another filesystem.
+	CloneBindMount = "bind"
+)
+
+const (
+	seekData = 3 // SEEK_DATA
+	seekHole = 4 // SEEK_HOLE
+
+	sparseBlock = 64 << 10
+)
+
+// CloneMetrics aggregates how VM images were materialised.
+type CloneMetrics struct {
+	Files        map[string]uint64 `json:"files"` // per strategy
+	BytesWritten int64             `json:"bytesWritten"`
+	BytesShared  int64             `json:"bytesShared"` // logical bytes not written
+	VMs          uint64            `json:"vms"`
+}
+
+type cloneStats struct {
+	mu sync.Mutex
+	m  CloneMetrics
+}
+
+func (c *cloneStats) record(strategy string, written, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m.Files == nil {
+		c.m.Files = make(map[string]uint64)
+	}
+	c.m.Files[strategy]++
+	c.m.BytesWritten += written
+	c.m.BytesShared += size - written
+}
+
+func (c *cloneStats) recordVM() {
+	c.mu.Lock()
+	c.m.VMs++
+	c.mu.Unlock()
+}
+
+func (c *cloneStats) snapshot() CloneMetrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := c.m
+	m.Files = make(map[string]uint64, len(c.m.Files))
+	for k, v := range c.m.Files {
+		m.Files[k] = v
+	}
+	return m
+}
+
+// CloneMetrics reports totals across every VM this manager has prepared.
+func (mgr *VMManager) CloneMetrics() CloneMetrics {
+	return mgr.clones.snapshot()
+}
+
+// cloneImage materialises src at dst as cheaply as the host allows. A
+// writable image gets a copy-on-write overlay when reflinks are not
+// available; a read-only one may be hard-linked, since no VM ever writes
+// through it. vm owns the overlay and may be nil for images that are not
+// released through releaseVM. It returns the strategy used and the bytes
+// actually written.
+func (mgr *VMManager) cloneImage(vm *domain.VM, src, dst string, readOnly bool) (string, int64, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := reflink(src, dst); err == nil {
+		mgr.clones.record(CloneReflink, 0, info.Size())
+		return CloneReflink, 0, nil
+	}
+	os.Remove(dst)
+
+	switch {
+	case readOnly:
+		if err := os.Link(src, dst); err == nil {
+			mgr.clones.record(CloneHardlink, 0, info.Size())
+			return CloneHardlink, 0, nil
+		}
+	case vm != nil:
+		if written, err := mgr.overlayImage(vm, src, dst); err == nil {
+			mgr.clones.record(CloneOverlay, written, info.Size())
+			return CloneOverlay, written, nil
+		}
+		os.Remove(dst)
+	}
+
+	if written, err := sparseCopy(src, dst); err == nil {
+		mgr.clones.record(CloneSparseCopy, written, info.Size())
+		return CloneSparseCopy, written, nil
+	}
+	os.Remove(dst)
+
+	if err := copyFile(src, dst); err != nil {
+		return "", 0, err
+	}
+	mgr.clones.record(CloneCopy, info.Size(), info.Size())
+	return CloneCopy, info.Size(), nil
+}
+
+// shareImage places the image src at dst inside vm's directory and adds
+// the bytes it had to write to vm.DiskBytesWritten. Read-only images in a
+// jail are linked or bind-mounted, never copied.
+func (mgr *VMManager) shareImage(vm *domain.VM, src, dst string, readOnly bool) error {
+	if vm.Jailed && readOnly {
+		strategy, err := linkIntoJail(vm, src, dst)
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(src); err == nil {
+			mgr.clones.record(strategy, 0, info.Size())
+		}
+		return nil
+	}
+
+	_, written, err := mgr.cloneImage(vm, src, dst, readOnly)
+	if err != nil {
+		return err
+	}
+	vm.DiskBytesWritten += written
+	return nil
+}
+
+// sparseCopy copies src to dst, skipping holes (via SEEK_DATA/SEEK_HOLE
+// where supported) and all-zero blocks so dst stays sparse. Every other
+// byte is written, so it is the fallback when nothing can be shared.
+func sparseCopy(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	size := info.Size()
+	if err := out.Truncate(size); err != nil {
+		return 0, err
+	}
+
+	var written int64
+	buf := make([]byte, sparseBlock)
+	zero := make([]byte, sparseBlock)
+
+	useSeek := true
+	for off := int64(0); off < size; {
+		start, end := off, size
+		if useSeek {
+			s, err := in.Seek(off, seekData)
+			switch {
+			case errors.Is(err, syscall.ENXIO):
+				// Only holes remain
+				return written, out.Sync()
+			case err != nil:
+				// Filesystem without SEEK_DATA: scan everything
+				useSeek = false
+			default:
+				start = s
+				if e, err := in.Seek(s, seekHole); err == nil {
+					end = e
+				}
+			}
+		}
+
+		for pos := start; pos < end; {
+			n, err := in.ReadAt(buf[:min(int64(len(buf)), end-pos)], pos)
+			if n > 0 && !bytes.Equal(buf[:n], zero[:n]) {
+				if _, werr := out.WriteAt(buf[:n], pos); werr != nil {
+					return written, werr
+				}
+				written += int64(n)
+			}
+			pos += int64(n)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return written, fmt.Errorf("read %s: %w", src, err)
+			}
+		}
+		off = end
+	}
+	return written, out.Sync()
+}
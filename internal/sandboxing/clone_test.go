@@ -0,0 +1,129 @@
+package sandboxing
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+func TestSparseCopy(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "rootfs.ext4")
+
+	// data | hole | written zeros | data | hole to the end
+	data := bytes.Repeat([]byte("ext4"), sparseBlock/4)
+	layout := []struct {
+		off  int64
+		data []byte
+	}{
+		{0, data},
+		{2 * sparseBlock, make([]byte, 4*sparseBlock)},
+		{8 * sparseBlock, data},
+	}
+	const size = 16 * sparseBlock
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range layout {
+		if _, err := f.WriteAt(l.data, l.off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Truncate(size)
+	f.Close()
+
+	dst := filepath.Join(dir, "clone.ext4")
+	written, err := sparseCopy(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(2 * len(data)); written != want {
+		t.Errorf("wrote %d bytes, want %d: only the non-zero blocks", written, want)
+	}
+
+	want, _ := os.ReadFile(src)
+	got, _ := os.ReadFile(dst)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("clone differs from the source (%d bytes, want %d)", len(got), len(want))
+	}
+	if alloc, ok := allocatedBytes(dst); ok && alloc > written+sparseBlock {
+		t.Errorf("clone occupies %d bytes on disk, want about %d", alloc, written)
+	}
+}
+
+func TestCloneImageReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "vmlinux")
+	os.WriteFile(src, []byte("kernel"), 0644)
+
+	mgr := &VMManager{}
+	strategy, written, err := mgr.cloneImage(nil, src, filepath.Join(dir, "kernel"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 0 || (strategy != CloneReflink && strategy != CloneHardlink) {
+		t.Errorf("read-only image: %s, %d bytes written; want it shared", strategy, written)
+	}
+	if m := mgr.CloneMetrics(); m.BytesShared != 6 || m.BytesWritten != 0 {
+		t.Errorf("metrics %+v", m)
+	}
+}
+
+// TestOverlayImage needs root and losetup. Without the dm-snapshot target
+// it checks that a failed overlay leaves no loop devices behind.
+func TestOverlayImage(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("needs root")
+	}
+	if _, err := exec.LookPath("losetup"); err != nil {
+		t.Skip("needs losetup")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "rootfs.ext4")
+	if err := os.WriteFile(src, bytes.Repeat([]byte("base"), 1<<18), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "vm", "rootfs.ext4")
+	os.Mkdir(filepath.Dir(dst), 0700)
+
+	attached := func() string {
+		out, _ := exec.Command("losetup", "--associated", src).Output()
+		cow, _ := exec.Command("losetup", "--associated", dst+".cow").Output()
+		return strings.TrimSpace(string(out) + string(cow))
+	}
+
+	mgr := &VMManager{}
+	vm := &domain.VM{ID: "overlay-test"}
+	written, err := mgr.overlayImage(vm, src, dst)
+	if err != nil {
+		if left := attached(); left != "" {
+			t.Errorf("failed overlay left loop devices attached: %s", left)
+		}
+		if _, serr := os.Stat(dst + ".cow"); !os.IsNotExist(serr) {
+			t.Error("failed overlay left its copy-on-write file")
+		}
+		t.Skipf("no device-mapper snapshot here: %v", err)
+	}
+
+	if info, err := os.Stat(dst); err != nil || info.Mode()&os.ModeDevice == 0 {
+		t.Errorf("dst is not a device node: %v, %v", info, err)
+	}
+	if written >= 1<<20 {
+		t.Errorf("overlay wrote %d bytes up front", written)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil || !bytes.HasPrefix(got, []byte("basebase")) {
+		t.Errorf("reading through the overlay: %q..., %v", got[:min(len(got), 8)], err)
+	}
+
+	mgr.releaseOverlays(vm)
+	if left := attached(); left != "" {
+		t.Errorf("loop devices still attached after release: %s", left)
+	}
+}
@@ -0,0 +1,184 @@
+package sandboxing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Input drive formats for VMManager.InputFormat.
+const (
+	InputExt4 = "ext4" // mkfs.ext4 -d, no mount needed (default)
+	InputFAT  = "vfat" // mkfs.vfat + mtools, for guests without ext4
+	InputRaw  = "raw"  // the upload's bytes as-is, no filesystem
+
+	inputManifestName = "manifest.json"
+	inputVolumeLabel  = "input"
+)
+
+// InputManifest describes the sample on an input drive. It is written to
+// manifest.json at the root of the image, next to the sample itself.
+type InputManifest struct {
+	JobID     string    `json:"jobID"`
+	FileName  string    `json:"fileName"` // name of the sample inside the image
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	MIME      string    `json:"mime"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// BuildInputImage writes a filesystem image at dst holding samplePath under
+// m.FileName plus manifest.json. Size and MIME are filled in from the sample.
+// Neither format needs root or a loop mount.
+func BuildInputImage(dst, samplePath, format string, m InputManifest) (*InputManifest, error) {
+	info, err := os.Stat(samplePath)
+	if err != nil {
+		return nil, err
+	}
+	m.Size = info.Size()
+	m.FileName = sanitizeInputName(m.FileName)
+	if m.MIME == "" {
+		if m.MIME, err = sniffMIME(samplePath); err != nil {
+			return nil, err
+		}
+	}
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now().UTC()
+	}
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	os.Remove(dst)
+	sizeKiB := inputImageSize(m.Size + int64(len(manifest)))
+	switch format {
+	case "", InputExt4:
+		err = buildExt4Image(dst, samplePath, m.FileName, manifest, sizeKiB)
+	case InputFAT:
+		err = buildFATImage(dst, samplePath, m.FileName, manifest, sizeKiB)
+	default:
+		err = fmt.Errorf("unknown input image format %q", format)
+	}
+	if err != nil {
+		os.Remove(dst)
+		return nil, err
+	}
+	return &m, nil
+}
+
+// buildExt4Image stages the files in a scratch directory and lets mke2fs
+// populate the image from it.
+func buildExt4Image(dst, samplePath, name string, manifest []byte, sizeKiB int64) error {
+	staging, err := os.MkdirTemp(filepath.Dir(dst), ".input-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := os.Link(samplePath, filepath.Join(staging, name)); err != nil {
+		if err := copyFile(samplePath, filepath.Join(staging, name)); err != nil {
+			return fmt.Errorf("failed to stage sample: %w", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(staging, inputManifestName), manifest, 0644); err != nil {
+		return err
+	}
+
+	out, err := exec.Command("mkfs.ext4", "-q", "-F",
+		"-L", inputVolumeLabel,
+		"-m", "0",
+		"-O", "^has_journal",
+		"-E", "root_owner=0:0",
+		"-d", staging,
+		dst, fmt.Sprintf("%dk", sizeKiB),
+	).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("mkfs.ext4 failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// buildFATImage formats a fresh image and copies the files in with mtools.
+func buildFATImage(dst, samplePath, name string, manifest []byte, sizeKiB int64) error {
+	if out, err := exec.Command("mkfs.vfat", "-C", "-n", strings.ToUpper(inputVolumeLabel),
+		dst, fmt.Sprint(sizeKiB)).CombinedOutput(); err != nil {
+		return fmt.Errorf("mkfs.vfat failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	manifestPath := dst + "." + inputManifestName
+	if err := os.WriteFile(manifestPath, manifest, 0644); err != nil {
+		return err
+	}
+	defer os.Remove(manifestPath)
+
+	copies := [][2]string{
+		{samplePath, name},
+		{manifestPath, inputManifestName},
+	}
+	for _, c := range copies {
+		out, err := exec.Command("mcopy", "-i", dst, "-o", c[0], "::/"+c[1]).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("mcopy %s failed: %w: %s", c[1], err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// inputImageSize returns an image size in KiB with room for filesystem
+// metadata, rounded up to a whole MiB.
+func inputImageSize(payload int64) int64 {
+	const mib = 1 << 20
+	size := payload + payload/8 + 4*mib
+	size = (size + mib - 1) / mib * mib
+	return max(size, 8*mib) >> 10
+}
+
+// sanitizeInputName keeps the uploaded filename where it is safe on both
+// ext4 and FAT, and falls back to "sample" otherwise.
+func sanitizeInputName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20, r == 0x7f:
+			return -1
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	if len(name) > 200 {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		name = strings.ToValidUTF8(name[:200-len(ext)], "") + ext
+	}
+	if name == "" || strings.EqualFold(name, inputManifestName) {
+		return "sample"
+	}
+	return name
+}
+
+func sniffMIME(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
@@ -0,0 +1,64 @@
+package sandboxing
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeInputName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"sample.exe", "sample.exe"},
+		{`C:\Users\victim\invoice.pdf.exe`, "invoice.pdf.exe"},
+		{"../../etc/passwd", "passwd"},
+		{`..\..\boot.ini`, "boot.ini"},
+		{"a//b\\\\c.exe", "c.exe"},
+		{"dropper/", "dropper"},
+		{"..", "sample"},
+		{"dir/..", "sample"},
+		{"a\x00b\x1f\x7fc.exe", "abc.exe"},
+		{"\n\t", "sample"},
+		{`what?<now>:"x"|y*.exe`, "what__now___x__y_.exe"},
+		{" .hidden. ", "hidden"},
+		{"", "sample"},
+		// The sample must not collide with the manifest next to it
+		{"manifest.json", "sample"},
+		{"MANIFEST.JSON", "sample"},
+		{"x/manifest.json", "sample"},
+		{"Привет.doc", "Привет.doc"},
+		{strings.Repeat("a", 300) + ".exe", strings.Repeat("a", 196) + ".exe"},
+		// Cut mid-rune, the partial character is dropped
+		{"a" + strings.Repeat("é", 150) + ".exe", "a" + strings.Repeat("é", 97) + ".exe"},
+		// An extension too long to be one is cut like the rest
+		{strings.Repeat("a", 300) + "." + strings.Repeat("x", 20), strings.Repeat("a", 200)},
+	}
+	for _, tc := range tests {
+		if got := sanitizeInputName(tc.in); got != tc.want {
+			t.Errorf("sanitizeInputName(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestInputImageSize(t *testing.T) {
+	const mib = 1 << 20
+	tests := []struct {
+		payload int64
+		wantKiB int64
+	}{
+		{0, 8 << 10},             // floor of 8 MiB
+		{mib, 8 << 10},           // 5.125 MiB rounds to 6, below the floor
+		{8 * mib, 13 << 10},      // 8 + 1 + 4
+		{100 * mib, 117 << 10},   // 116.5 MiB rounds up
+		{1024 * mib, 1156 << 10}, // 1024 + 128 + 4
+	}
+	for _, tc := range tests {
+		got := inputImageSize(tc.payload)
+		if got != tc.wantKiB {
+			t.Errorf("inputImageSize(%d) = %d KiB, want %d", tc.payload, got, tc.wantKiB)
+		}
+		if got<<10 < tc.payload || got%(1<<10) != 0 {
+			t.Errorf("inputImageSize(%d) = %d KiB: smaller than the payload or not whole MiB", tc.payload, got)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package sandboxing
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+const jailAPISock = "/run/firecracker.socket"
+
+// JailerConfig enables the jailed launch mode. The jailer is not
+// available on WSL, so it is off unless Enabled is set.
+type JailerConfig struct {
+	Enabled bool
+
+	// Each VM gets its own uid/gid, cycling through
+	// [UIDBase, UIDBase+IDRange) and [GIDBase, GIDBase+IDRange).
+	UIDBase int
+	GIDBase int
+	IDRange int
+
+	// Cgroups are passed as --cgroup <file>=<value>, e.g.
+	// "memory.max=600M" or "cpu.max=100000 100000".
+	Cgroups []string
+
+	// NetNS runs each VM inside a dedicated network namespace.
+	NetNS bool
+}
+
+// jailRoot returns the chroot the jailer builds for vmID:
+// <BaseChrootDir>/<exec-name>/<id>/root.
+func (mgr *VMManager) jailRoot(vmID string) string {
+	return filepath.Join(mgr.BaseChrootDir, filepath.Base(mgr.firecrackerPath()), vmID, "root")
+}
+
+// nextJailIDs hands out the next uid/gid pair from the configured range.
+func (mgr *VMManager) nextJailIDs() (int, int) {
+	idRange := mgr.Jailer.IDRange
+	if idRange <= 0 {
+		idRange = 1
+	}
+	n := int(mgr.jailSeq.Add(1)-1) % idRange
+	return mgr.Jailer.UIDBase + n, mgr.Jailer.GIDBase + n
+}
+
+// prepareJail creates the chroot skeleton and optional network namespace.
+func (mgr *VMManager) prepareJail(vm *domain.VM) error {
+	vm.Jailed = true
+	vm.UID, vm.GID = mgr.nextJailIDs()
+
+	if err := os.Chown(vm.Dir, vm.UID, vm.GID); err != nil {
+		return fmt.Errorf("failed to chown jail root: %w", err)
+	}
+
+	runDir := filepath.Join(vm.Dir, filepath.Dir(jailAPISock))
+	if err := os.MkdirAll(runDir, 0750); err != nil {
+		return fmt.Errorf("failed to create jail run dir: %w", err)
+	}
+	if err := os.Chown(runDir, vm.UID, vm.GID); err != nil {
+		return fmt.Errorf("failed to chown jail run dir: %w", err)
+	}
+	vm.APISock = filepath.Join(vm.Dir, jailAPISock)
+
+	if mgr.Jailer.NetNS {
+		name := "fc-" + vm.ID[:8]
+		if err := exec.Command("ip", "netns", "add", name).Run(); err != nil {
+			return fmt.Errorf("failed to create netns %s: %w", name, err)
+		}
+		vm.NetNS = name
+	}
+	return nil
+}
+
+// linkIntoJail exposes a shared read-only image inside the jail. It tries a
+// hard link first and falls back to a read-only bind mount when src lives on
+// another filesystem. It returns the clone strategy used.
+func linkIntoJail(vm *domain.VM, src, dst string) (string, error) {
+	if err := os.Link(src, dst); err == nil {
+		return CloneHardlink, nil
+	}
+
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY, 0444)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+
+	if err := exec.Command("mount", "--bind", src, dst).Run(); err != nil {
+		return "", fmt.Errorf("failed to bind mount %s: %w", src, err)
+	}
+	vm.Mounts = append(vm.Mounts, dst)
+	if err := exec.Command("mount", "-o", "remount,bind,ro", dst).Run(); err != nil {
+		return "", fmt.Errorf("failed to remount %s read-only: %w", dst, err)
+	}
+	return CloneBindMount, nil
+}
+
+// vmPath translates a host path under vm.Dir into the path handed to
+// Firecracker. Firecracker always runs with vm.Dir as its working directory
+// (the jailer chroots and chdirs there), so the relative path resolves the
+// same way jailed or not, and also survives a snapshot restore into a
+// different VM directory.
+func vmPath(vm *domain.VM, hostPath string) string {
+	rel, err := filepath.Rel(vm.Dir, hostPath)
+	if err != nil {
+		return hostPath
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (mgr *VMManager) jailerCommand(vm *domain.VM) *exec.Cmd {
+	args := []string{
+		"--id", vm.ID,
+		"--exec-file", mgr.firecrackerPath(),
+		"--uid", strconv.Itoa(vm.UID),
+		"--gid", strconv.Itoa(vm.GID),
+		"--chroot-base-dir", mgr.BaseChrootDir,
+		"--cgroup-version", "2",
+	}
+	for _, c := range mgr.Jailer.Cgroups {
+		args = append(args, "--cgroup", c)
+	}
+	if vm.NetNS != "" {
+		args = append(args, "--netns", filepath.Join("/var/run/netns", vm.NetNS))
+	}
+	args = append(args, "--", "--api-sock", jailAPISock)
+
+	return exec.Command(mgr.JailerPath, args...)
+}
+
+// teardownJail releases everything prepareJail and the jailer created.
+func (mgr *VMManager) teardownJail(vm *domain.VM) error {
+	var errs []error
+	for i := len(vm.Mounts) - 1; i >= 0; i-- {
+		if err := exec.Command("umount", vm.Mounts[i]).Run(); err != nil {
+			errs = append(errs, fmt.Errorf("umount %s: %w", vm.Mounts[i], err))
+		}
+	}
+	if vm.NetNS != "" {
+		if err := exec.Command("ip", "netns", "del", vm.NetNS).Run(); err != nil {
+			errs = append(errs, fmt.Errorf("delete netns %s: %w", vm.NetNS, err))
+		}
+	}
+
+	cgroupDir := filepath.Join("/sys/fs/cgroup", filepath.Base(mgr.firecrackerPath()), vm.ID)
+	if err := os.Remove(cgroupDir); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, fmt.Errorf("remove cgroup %s: %w", cgroupDir, err))
+	}
+
+	if err := os.RemoveAll(filepath.Dir(vm.Dir)); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		log.Printf("jail teardown incomplete: vm=%s err=%v", vm.ID, err)
+		return err
+	}
+	return nil
+}
@@ -1,126 +1,548 @@
-package sandboxing
-
-import (
-	"fmt"
-	"io"
-	"os"
-	"os/exec"
-	"path/filepath"
-	"time"
-
-	"github.com/sudankdk/firecracker/internal/domain"
-)
-
-type VMManager struct {
-	BaseChrootDir   string // e.g., "/srv/vms"
-	BaseUploadDir   string // e.g., "/srv/uploads"
-	KernelPath      string
-	RootfsPath      string
-	JailerPath      string
-	FirecrackerPath string
-}
-
-func (mgr *VMManager) SpawnVM(uploadFilePath string) (*domain.VM, error) {
-	vm, err := CreateVMMetadata()
-	if err != nil {
-		return nil, err
-	}
-	vmDir := filepath.Join(mgr.BaseChrootDir, vm.ID)
-	if err := os.MkdirAll(vmDir, 0700); err != nil {
-		return nil, fmt.Errorf("failed to create VM directory: %w", err)
-	}
-
-	inputDrive := filepath.Join(vmDir, "input_drive.img")
-	if err := copyFile(uploadFilePath, inputDrive); err != nil {
-		return nil, fmt.Errorf("failed to copy upload: %w", err)
-	}
-
-	kernelPath := filepath.Join(vmDir, "kernel")
-	if err := copyFile(mgr.KernelPath, kernelPath); err != nil {
-		return nil, fmt.Errorf("failed to copy kernel: %w", err)
-	}
-
-	rootfsPath := filepath.Join(vmDir, "rootfs.ext4")
-	if err := copyFile(mgr.RootfsPath, rootfsPath); err != nil {
-		return nil, fmt.Errorf("failed to copy rootfs: %w", err)
-	}
-
-	// TAP and networking disabled for manual isolation in WSL
-	// if err := CreateTAP(vm.TapName); err != nil {
-	// 	return nil, fmt.Errorf("failed to create TAP: %w", err)
-	// }
-
-	vm.APISock = filepath.Join(vmDir, "firecracker.socket")
-
-	cmd, err := mgr.SetUpFirecracker(vm)
-	if err != nil {
-		return nil, fmt.Errorf("failed to set up Firecracker: %w", err)
-	}
-	vm.Cmd = cmd
-	if err := waitForSocket(vm.APISock, 5*time.Second); err != nil {
-		return nil, err
-	}
-
-	if err := configureVM(vm, kernelPath, rootfsPath, inputDrive); err != nil {
-		return nil, fmt.Errorf("failed to configure VM: %w", err)
-	}
-
-	// Cleanup after VM exits
-	go func() {
-		cmd.Wait()
-		os.RemoveAll(vmDir)
-	}()
-
-	return vm, nil
-
-}
-
-// copyFile safely copies a file
-func copyFile(src, dst string) error {
-	in, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer in.Close()
-
-	out, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	if _, err := io.Copy(out, in); err != nil {
-		return err
-	}
-	return out.Sync()
-}
-
-func waitForSocket(socketPath string, timeout time.Duration) error {
-	start := time.Now()
-	for {
-		if _, err := os.Stat(socketPath); err == nil {
-			return nil
-		}
-		if time.Since(start) > timeout {
-			return fmt.Errorf("socket did not appear within %v", timeout)
-		}
-		time.Sleep(100 * time.Millisecond)
-	}
-}
-
-func (mgr *VMManager) SetUpFirecracker(vm *domain.VM) (*exec.Cmd, error) {
-	// Jailer is not supported in WSL, so running Firecracker directly with manual isolation
-	firecrackerPath := mgr.FirecrackerPath
-	if firecrackerPath == "" {
-		firecrackerPath = "./firecracker"
-	}
-
-	cmd := exec.Command(firecrackerPath, "--api-sock", vm.APISock)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start Firecracker: %w", err)
-	}
-	return cmd, nil
-}
+package sandboxing
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/console"
+	"github.com/sudankdk/firecracker/internal/domain"
+	client "github.com/sudankdk/firecracker/internal/httpClient"
+)
+
+type VMManager struct {
+	BaseChrootDir   string // e.g., "/srv/vms"
+	BaseUploadDir   string // e.g., "/srv/uploads"
+	BaseArtifactDir string // e.g., "/srv/artifacts"; per-job files kept after teardown
+	KernelPath      string
+	RootfsPath      string
+	JailerPath      string
+	FirecrackerPath string
+
+	// Guest size; zero means 1 vCPU and 512 MiB.
+	VcpuCount  int
+	MemSizeMib int
+
+	// Wall-clock limits per VM. DefaultTimeout applies when a job asks for
+	// none, MaxTimeout caps what a job may ask for, and ShutdownGrace is how
+	// long a guest gets after SendCtrlAltDel before it is killed.
+	DefaultTimeout time.Duration
+	MaxTimeout     time.Duration
+	ShutdownGrace  time.Duration
+
+	// Jailer switches SpawnVM to the jailed launch mode.
+	Jailer JailerConfig
+
+	// InputFormat selects how uploads are presented to the guest: InputExt4
+	// (the default), InputFAT or InputRaw.
+	InputFormat string
+
+	// WritableRootfs gives each guest a private copy-on-write clone of the
+	// rootfs instead of sharing the original read-only.
+	WritableRootfs bool
+
+	// Snapshots enables warm starts from a golden snapshot; see
+	// PrepareGoldenSnapshot.
+	Snapshots SnapshotConfig
+
+	// Pool keeps booted VMs ready for instant dispatch; see StartPool.
+	Pool PoolConfig
+
+	// Network lets jobs ask for a simulated internet; see setupNetwork.
+	Network NetworkConfig
+
+	// Metadata hands each guest its job through MMDS.
+	Metadata MetadataConfig
+
+	// Console caps each VM's console log; see ConsoleConfig.
+	Console ConsoleConfig
+
+	pool       *vmPool
+	clones     cloneStats
+	loops      sharedLoops
+	jailSeq    atomic.Uint32
+	snapshotMu sync.Mutex
+	golden     atomic.Pointer[GoldenSnapshot]
+}
+
+// ConsoleConfig sizes the console log kept in each VM's directory. Zero
+// values take console.DefaultMaxBytes and console.DefaultKeep; a negative
+// Keep keeps no rotated files.
+type ConsoleConfig struct {
+	MaxBytes int64 // per file
+	Keep     int   // rotated files besides the current one
+}
+
+// SpawnOptions carries per-job settings for SpawnVM.
+type SpawnOptions struct {
+	JobID string
+
+	// FileName and SHA256 describe the upload in the input drive's manifest.
+	FileName string
+	SHA256   string
+
+	// Timeout is the requested wall-clock limit; see ResolveTimeout.
+	Timeout time.Duration
+
+	// Network is NetworkNone or NetworkSimulated. Networked VMs always
+	// cold boot, since pooled VMs and snapshots have no network device.
+	Network string
+
+	// Exec is the execution plan passed to the guest in its metadata.
+	Exec domain.ExecPlan
+}
+
+// instance is a started Firecracker process and its host-side plumbing,
+// before it is handed to a job.
+type instance struct {
+	vm       *domain.VM
+	results  *ResultListener
+	exited   chan struct{} // closed when the Firecracker process exits
+	bootedAt time.Time
+}
+
+// SpawnVM runs uploadFilePath in a sandbox VM. An idle VM from the pool is
+// used when one is available; otherwise a new one is started.
+func (mgr *VMManager) SpawnVM(uploadFilePath string, opts SpawnOptions) (*domain.VM, error) {
+	if opts.networked() && !mgr.Network.Enabled {
+		return nil, fmt.Errorf("network mode %q is not enabled", opts.Network)
+	}
+	// Pooled VMs were booted without a network device
+	if !opts.networked() {
+		if inst := mgr.takePooled(); inst != nil {
+			err := mgr.attachInput(inst, uploadFilePath, opts)
+			if err == nil {
+				return mgr.supervise(inst, opts), nil
+			}
+			log.Printf("pooled vm unusable, starting a fresh one: vm=%s err=%v", inst.vm.ID, err)
+			mgr.discard(inst)
+		}
+	}
+
+	inst, err := mgr.startVM(uploadFilePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := inst.results.Start(domain.GuestStart{JobID: opts.JobID, InputDrive: "input_drive"}); err != nil {
+		mgr.discard(inst)
+		return nil, err
+	}
+	return mgr.supervise(inst, opts), nil
+}
+
+// startVM boots a VM with uploadFilePath as its input drive, or with an
+// empty placeholder drive when uploadFilePath is "".
+func (mgr *VMManager) startVM(uploadFilePath string, opts SpawnOptions) (*instance, error) {
+	vm, err := CreateVMMetadata()
+	if err != nil {
+		return nil, err
+	}
+	vmDir := filepath.Join(mgr.BaseChrootDir, vm.ID)
+	if mgr.Jailer.Enabled {
+		vmDir = mgr.jailRoot(vm.ID)
+	}
+	vm.Dir = vmDir
+	if err := os.MkdirAll(vmDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create VM directory: %w", err)
+	}
+
+	vm.APISock = filepath.Join(vmDir, "firecracker.socket")
+	if mgr.Jailer.Enabled {
+		if err := mgr.prepareJail(vm); err != nil {
+			mgr.teardownJail(vm)
+			return nil, err
+		}
+	}
+
+	inputDrive := filepath.Join(vmDir, "input_drive.img")
+	if uploadFilePath == "" {
+		err = createPlaceholderDrive(inputDrive)
+	} else {
+		err = mgr.stageInput(vm, uploadFilePath, inputDrive, opts)
+	}
+	if err != nil {
+		mgr.releaseVM(vm)
+		return nil, fmt.Errorf("failed to prepare input drive: %w", err)
+	}
+	if vm.Jailed {
+		if err := os.Chown(inputDrive, vm.UID, vm.GID); err != nil {
+			mgr.releaseVM(vm)
+			return nil, fmt.Errorf("failed to chown input drive: %w", err)
+		}
+	}
+
+	golden := mgr.currentGolden()
+	if opts.networked() || mgr.Metadata.Enabled {
+		golden = nil
+	}
+	spec := bootSpec{
+		VcpuCount:      mgr.VMVcpus(),
+		MemSizeMib:     mgr.VMMemMib(),
+		RootfsWritable: mgr.WritableRootfs,
+	}
+
+	kernelPath := filepath.Join(vmDir, "kernel")
+	rootfsPath := filepath.Join(vmDir, "rootfs.ext4")
+	if golden == nil {
+		if err := mgr.shareImage(vm, mgr.KernelPath, kernelPath, true); err != nil {
+			mgr.releaseVM(vm)
+			return nil, fmt.Errorf("failed to stage kernel: %w", err)
+		}
+	}
+	if mgr.WritableRootfs {
+		strategy, n, err := mgr.cloneImage(vm, mgr.RootfsPath, rootfsPath, false)
+		if err == nil && vm.Jailed {
+			err = os.Chown(rootfsPath, vm.UID, vm.GID)
+		}
+		if err != nil {
+			mgr.releaseVM(vm)
+			return nil, fmt.Errorf("failed to clone rootfs: %w", err)
+		}
+		vm.DiskBytesWritten += n
+		log.Printf("rootfs cloned: vm=%s strategy=%s bytes=%d", vm.ID, strategy, n)
+	} else if err := mgr.shareImage(vm, mgr.RootfsPath, rootfsPath, true); err != nil {
+		mgr.releaseVM(vm)
+		return nil, fmt.Errorf("failed to stage rootfs: %w", err)
+	}
+	mgr.clones.recordVM()
+	log.Printf("vm images staged: vm=%s bytesWritten=%d", vm.ID, vm.DiskBytesWritten)
+
+	if golden == nil {
+		spec.Kernel = vmPath(vm, kernelPath)
+	} else {
+		spec.SnapshotState, err = stageSnapshotFile(vm, golden.StatePath(), filepath.Join(vmDir, snapshotStateFile))
+		if err != nil {
+			mgr.releaseVM(vm)
+			return nil, fmt.Errorf("failed to stage snapshot: %w", err)
+		}
+		spec.SnapshotMem, err = stageSnapshotFile(vm, golden.MemPath(), filepath.Join(vmDir, snapshotMemFile))
+		if err != nil {
+			mgr.releaseVM(vm)
+			return nil, fmt.Errorf("failed to stage snapshot memory: %w", err)
+		}
+	}
+
+	if opts.networked() {
+		if spec.Network, err = mgr.setupNetwork(vm, opts.JobID); err != nil {
+			mgr.releaseVM(vm)
+			return nil, fmt.Errorf("failed to set up guest network: %w", err)
+		}
+	}
+	if mgr.Metadata.Enabled {
+		if spec.Network == nil {
+			if spec.Network, err = mgr.setupMetadataNIC(vm); err != nil {
+				mgr.releaseVM(vm)
+				return nil, fmt.Errorf("failed to set up metadata interface: %w", err)
+			}
+		}
+		vm.AgentToken = newAgentToken()
+		spec.Metadata = mgr.guestMetadata(vm, opts)
+	}
+
+	vsockPath := filepath.Join(vmDir, "vsock.sock")
+	results, err := ListenResults(vm.ID, vsockPath)
+	if err != nil {
+		mgr.releaseVM(vm)
+		return nil, err
+	}
+	if vm.AgentToken != "" {
+		results.RequireToken(vm.AgentToken)
+	}
+	if vm.Jailed {
+		if err := os.Chown(fmt.Sprintf("%s_%d", vsockPath, ResultPort), vm.UID, vm.GID); err != nil {
+			results.Close()
+			mgr.releaseVM(vm)
+			return nil, fmt.Errorf("failed to chown result socket: %w", err)
+		}
+	}
+
+	cmd, err := mgr.SetUpFirecracker(vm)
+	if err != nil {
+		results.Close()
+		mgr.releaseVM(vm)
+		return nil, fmt.Errorf("failed to set up Firecracker: %w", err)
+	}
+	vm.Cmd = cmd
+	if err := waitForSocket(vm.APISock, 5*time.Second); err != nil {
+		results.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+		mgr.releaseVM(vm)
+		return nil, err
+	}
+
+	spec.Rootfs = vmPath(vm, rootfsPath)
+	spec.InputDrive = vmPath(vm, inputDrive)
+	spec.VsockUDS = vmPath(vm, vsockPath)
+	if golden != nil {
+		err = restoreVM(vm, spec)
+	} else {
+		err = configureVM(vm, spec)
+	}
+	if err != nil {
+		results.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+		mgr.releaseVM(vm)
+		return nil, fmt.Errorf("failed to configure VM: %w", err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	return &instance{
+		vm:       vm,
+		results:  results,
+		exited:   exited,
+		bootedAt: time.Now(),
+	}, nil
+}
+
+// supervise hands inst to a job: it arms the deadline and releases the
+// host side once the process exits.
+func (mgr *VMManager) supervise(inst *instance, opts SpawnOptions) *domain.VM {
+	vm := inst.vm
+	vm.Done = make(chan struct{})
+	vm.Deadline = time.Now().Add(mgr.ResolveTimeout(opts.Timeout))
+	watched := make(chan struct{})
+
+	go func() {
+		mgr.watchdog(vm, inst.results, inst.exited)
+		close(watched)
+	}()
+
+	// Cleanup after VM exits
+	go func() {
+		<-inst.exited
+		<-watched
+		inst.results.Close()
+		report := inst.results.Report()
+		if report.FinishedAt.IsZero() {
+			report.FinishedAt = time.Now()
+		}
+		vm.Report = &report
+		mgr.keepConsole(vm, opts.JobID)
+		mgr.releaseVM(vm)
+		close(vm.Done)
+	}()
+
+	return vm
+}
+
+// discard kills an instance that never made it to a job.
+func (mgr *VMManager) discard(inst *instance) {
+	mgr.DestroyVM(inst.vm)
+	<-inst.exited
+	inst.results.Close()
+	mgr.releaseVM(inst.vm)
+}
+
+// ResolveTimeout applies the server default and cap to a requested timeout.
+func (mgr *VMManager) ResolveTimeout(requested time.Duration) time.Duration {
+	timeout := requested
+	if timeout <= 0 {
+		timeout = mgr.DefaultTimeout
+	}
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	if mgr.MaxTimeout > 0 && timeout > mgr.MaxTimeout {
+		timeout = mgr.MaxTimeout
+	}
+	return timeout
+}
+
+// watchdog ends the VM once the guest agent reports its exit status or the
+// deadline passes, whichever comes first. It returns when the process exits.
+func (mgr *VMManager) watchdog(vm *domain.VM, results *ResultListener, exited <-chan struct{}) {
+	timer := time.NewTimer(time.Until(vm.Deadline))
+	defer timer.Stop()
+
+	select {
+	case <-exited:
+		return
+	case <-results.Exited():
+		log.Printf("guest reported exit, shutting down: vm=%s", vm.ID)
+	case <-timer.C:
+		vm.TimedOut = true
+		log.Printf("vm deadline reached, shutting down: vm=%s", vm.ID)
+	}
+	mgr.shutdown(vm, exited)
+}
+
+// shutdown asks the guest to halt and kills it if it has not exited
+// within ShutdownGrace.
+func (mgr *VMManager) shutdown(vm *domain.VM, exited <-chan struct{}) {
+	grace := mgr.ShutdownGrace
+	if grace <= 0 {
+		grace = 10 * time.Second
+	}
+
+	if err := client.CreateAction(client.NewClient(vm.APISock), client.ActionSendCtrlAltDel); err != nil {
+		log.Printf("SendCtrlAltDel failed: vm=%s err=%v", vm.ID, err)
+	}
+
+	select {
+	case <-exited:
+	case <-time.After(grace):
+		log.Printf("vm ignored shutdown for %v, killing: vm=%s", grace, vm.ID)
+		mgr.DestroyVM(vm)
+		<-exited
+	}
+}
+
+// VMVcpus is the vCPU count every guest is booted with.
+func (mgr *VMManager) VMVcpus() int {
+	if mgr.VcpuCount <= 0 {
+		return 1
+	}
+	return mgr.VcpuCount
+}
+
+// VMMemMib is the memory size every guest is booted with.
+func (mgr *VMManager) VMMemMib() int {
+	if mgr.MemSizeMib <= 0 {
+		return 512
+	}
+	return mgr.MemSizeMib
+}
+
+// DestroyVM kills the Firecracker process behind vm. Host-side cleanup runs
+// in SpawnVM's exit watcher, so callers wait on vm.Done for it to finish.
+func (mgr *VMManager) DestroyVM(vm *domain.VM) error {
+	if vm.Cmd == nil || vm.Cmd.Process == nil {
+		return fmt.Errorf("vm %s has no running process", vm.ID)
+	}
+	if err := vm.Cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("failed to kill vm %s: %w", vm.ID, err)
+	}
+	return nil
+}
+
+// releaseVM removes everything SpawnVM created on the host for vm.
+func (mgr *VMManager) releaseVM(vm *domain.VM) {
+	if vm.Console != nil {
+		vm.Console.Close()
+	}
+	teardownNetwork(vm)
+	mgr.releaseOverlays(vm)
+	if vm.Jailed {
+		mgr.teardownJail(vm)
+		return
+	}
+	os.RemoveAll(vm.Dir)
+}
+
+func (mgr *VMManager) firecrackerPath() string {
+	if mgr.FirecrackerPath == "" {
+		return "./firecracker"
+	}
+	return mgr.FirecrackerPath
+}
+
+// stageInput writes the input drive for uploadFilePath at dst in the
+// configured InputFormat.
+func (mgr *VMManager) stageInput(vm *domain.VM, uploadFilePath, dst string, opts SpawnOptions) error {
+	if mgr.InputFormat == InputRaw {
+		return mgr.shareImage(vm, uploadFilePath, dst, false)
+	}
+
+	m, err := BuildInputImage(dst, uploadFilePath, mgr.InputFormat, InputManifest{
+		JobID:    opts.JobID,
+		FileName: opts.FileName,
+		SHA256:   opts.SHA256,
+	})
+	if err != nil {
+		return err
+	}
+	if n, ok := allocatedBytes(dst); ok {
+		vm.DiskBytesWritten += n
+	}
+	log.Printf("input image built: vm=%s name=%q mime=%s bytes=%d", vm.ID, m.FileName, m.MIME, m.Size)
+	return nil
+}
+
+// createPlaceholderDrive writes the empty input drive idle and template VMs
+// boot with; jobs swap in their own image later.
+func createPlaceholderDrive(path string) error {
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		return err
+	}
+	return os.Truncate(path, placeholderDriveSize)
+}
+
+// copyFile safely copies a file
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+func waitForSocket(socketPath string, timeout time.Duration) error {
+	start := time.Now()
+	for {
+		if _, err := os.Stat(socketPath); err == nil {
+			return nil
+		}
+		if time.Since(start) > timeout {
+			return fmt.Errorf("socket did not appear within %v", timeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (mgr *VMManager) SetUpFirecracker(vm *domain.VM) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+	if vm.Jailed {
+		cmd = mgr.jailerCommand(vm)
+	} else {
+		// Jailer is not supported in WSL, so running Firecracker directly with manual isolation
+		cmd = exec.Command(mgr.firecrackerPath(), "--api-sock", vm.APISock)
+		if vm.NetNS != "" {
+			// Only a process inside the namespace can open its TAP
+			cmd = exec.Command("ip", "netns", "exec", vm.NetNS, mgr.firecrackerPath(), "--api-sock", vm.APISock)
+		}
+		cmd.Dir = vm.Dir
+	}
+
+	keep := mgr.Console.Keep
+	if keep == 0 {
+		keep = console.DefaultKeep
+	}
+	out, err := console.Open(filepath.Join(vm.Dir, consoleLogFile), mgr.Console.MaxBytes, keep)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open console log: %w", err)
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	if err := cmd.Start(); err != nil {
+		out.Close()
+		return nil, fmt.Errorf("failed to start Firecracker: %w", err)
+	}
+	vm.Console = out
+	return cmd, nil
+}
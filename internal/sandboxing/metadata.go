@@ -0,0 +1,84 @@
+package sandboxing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+	client "github.com/sudankdk/firecracker/internal/httpClient"
+)
+
+// MetadataConfig enables the Firecracker metadata service (MMDS v2), from
+// which each guest reads a domain.GuestMetadata document describing its
+// job. MMDS is reached through a network interface, so every VM gets one:
+// networked VMs use their own, and airgapped VMs get a TAP that leads
+// nowhere, in a namespace of its own. Like NetworkConfig this needs root.
+// VMs cold boot while it is enabled, since golden snapshots have no NIC.
+type MetadataConfig struct {
+	Enabled bool
+}
+
+const (
+	mmdsIPv4 = "169.254.169.254"
+
+	// Airgapped guests get a link-local address, which puts MMDS on-link
+	// and nothing else within reach.
+	metadataGuestIP   = "169.254.0.2"
+	metadataNetmask   = "255.255.0.0"
+	metadataTokenSize = 32
+)
+
+// newAgentToken is a fresh secret for one VM's result channel.
+func newAgentToken() string {
+	b := make([]byte, metadataTokenSize)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// setupMetadataNIC gives an airgapped vm the interface MMDS needs: an
+// unaddressed TAP alone in its network namespace, so whatever the guest
+// sends other than to MMDS goes nowhere.
+func (mgr *VMManager) setupMetadataNIC(vm *domain.VM) (*guestNetwork, error) {
+	if err := addTap(vm); err != nil {
+		return nil, err
+	}
+	vm.GuestMAC = randomMAC()
+	log.Printf("metadata interface ready: vm=%s netns=%s", vm.ID, vm.NetNS)
+	return &guestNetwork{
+		TapName:  guestTap,
+		GuestMAC: vm.GuestMAC,
+		BootIP:   fmt.Sprintf("ip=%s::::%s::eth0:off", metadataGuestIP, metadataNetmask),
+	}, nil
+}
+
+// guestMetadata is vm's MMDS document for opts; a pooled VM, booted
+// before it has a job, gets one with only the token and result port.
+func (mgr *VMManager) guestMetadata(vm *domain.VM, opts SpawnOptions) *domain.GuestMetadata {
+	doc := &domain.GuestMetadata{
+		InputDrive: "input_drive",
+		ResultPort: ResultPort,
+		Token:      vm.AgentToken,
+	}
+	if opts.JobID == "" {
+		return doc
+	}
+	doc.JobID = opts.JobID
+	doc.FileName = opts.FileName
+	doc.SHA256 = opts.SHA256
+	doc.Exec = opts.Exec
+	if doc.Exec.Mode == "" {
+		doc.Exec.Mode = domain.ExecScan
+	}
+	doc.TimeoutSeconds = int(mgr.ResolveTimeout(opts.Timeout).Seconds())
+	return doc
+}
+
+// putMetadata replaces vm's MMDS data store with doc.
+func putMetadata(vm *domain.VM, doc *domain.GuestMetadata) error {
+	if err := client.PutMmds(client.NewClient(vm.APISock), doc); err != nil {
+		return fmt.Errorf("failed to store guest metadata: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package sandboxing
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+	"github.com/sudankdk/firecracker/internal/fakenet"
+	"github.com/sudankdk/firecracker/internal/pcap"
+)
+
+// Network modes a job may ask for.
+const (
+	NetworkNone      = "none"      // no network device at all
+	NetworkSimulated = "simulated" // a TAP to the fake internet, nothing beyond
+)
+
+// Every networked guest sits alone in its own namespace, so all of them
+// can use the same addresses.
+const (
+	guestTap       = "tap0"
+	guestIP        = "10.0.2.2"
+	gatewayIP      = "10.0.2.1"
+	guestNetmask   = "255.255.255.252"
+	guestPrefixLen = 30
+	guestSubnet    = "10.0.2.0/30"
+)
+
+// DefaultCaptureBytes caps a job's packet capture when NetworkConfig sets
+// no cap of its own.
+const DefaultCaptureBytes = 256 << 20
+
+// NetworkConfig enables NetworkSimulated. Setting it up needs root for
+// network namespaces, TAP devices and packet capture.
+type NetworkConfig struct {
+	Enabled bool
+
+	// SinkholeIP is the answer to every DNS query; the gateway by default.
+	SinkholeIP string
+
+	// CaptureMaxBytes caps each job's pcapng artifact; frames past it are
+	// dropped and the network report marked truncated.
+	CaptureMaxBytes int64
+}
+
+// ValidNetwork reports whether mode names a network mode; "" means none.
+func ValidNetwork(mode string) bool {
+	switch mode {
+	case "", NetworkNone, NetworkSimulated:
+		return true
+	}
+	return false
+}
+
+// networked reports whether opts asks for a network device.
+func (opts SpawnOptions) networked() bool {
+	return opts.Network == NetworkSimulated
+}
+
+// guestNetwork is what configureVM needs to give the guest its interface.
+type guestNetwork struct {
+	TapName  string
+	GuestMAC string
+	BootIP   string // the kernel's ip= argument for eth0
+}
+
+// bootIPArg is the kernel's static ip= configuration for eth0, with the
+// gateway as its resolver.
+func bootIPArg() string {
+	return fmt.Sprintf("ip=%s::%s:%s::eth0:off:%s", guestIP, gatewayIP, guestNetmask, gatewayIP)
+}
+
+// setupNetwork gives vm a TAP inside a network namespace of its own, with
+// the fake internet listening behind it. The namespace has no other
+// interfaces, so nothing the guest sends can leave the host. Every frame
+// on the TAP is captured into jobID's artifacts.
+func (mgr *VMManager) setupNetwork(vm *domain.VM, jobID string) (*guestNetwork, error) {
+	if !mgr.Network.Enabled {
+		return nil, errors.New("guest networking is not enabled")
+	}
+	if err := addTap(vm); err != nil {
+		return nil, err
+	}
+	err := ipIn(vm,
+		[]string{"link", "set", "lo", "up"},
+		[]string{"addr", "add", fmt.Sprintf("%s/%d", gatewayIP, guestPrefixLen), "dev", guestTap},
+		// Every address is local, so the responder answers for the whole
+		// internet; the guest's subnet gets a more specific route in the
+		// same table so replies still reach it through the TAP. A throw
+		// route would not do: with no extra rules the kernel merges the
+		// local and main tables and a throw there is unreachable.
+		[]string{"route", "add", "local", "0.0.0.0/0", "dev", "lo", "table", "local"},
+		[]string{"route", "add", guestSubnet, "dev", guestTap, "table", "local"},
+	)
+	if err != nil {
+		return nil, err
+	}
+	netnsPath := filepath.Join("/var/run/netns", vm.NetNS)
+
+	if err := mgr.startCapture(vm, jobID, netnsPath); err != nil {
+		return nil, err
+	}
+
+	sinkhole := net.ParseIP(mgr.Network.SinkholeIP)
+	if sinkhole == nil {
+		sinkhole = net.ParseIP(gatewayIP)
+	}
+	responder, err := fakenet.Start(fakenet.Config{SinkholeIP: sinkhole}, netnsPath)
+	if err != nil {
+		return nil, err
+	}
+	vm.Responder = responder
+	vm.GuestMAC = randomMAC()
+	vm.Network = NetworkSimulated
+	log.Printf("guest network ready: vm=%s netns=%s guest=%s sinkhole=%s", vm.ID, vm.NetNS, guestIP, sinkhole)
+
+	return &guestNetwork{TapName: guestTap, GuestMAC: vm.GuestMAC, BootIP: bootIPArg()}, nil
+}
+
+// addTap creates the guest's TAP, up but unaddressed, in a network
+// namespace of vm's own, creating the namespace unless the jailer did.
+func addTap(vm *domain.VM) error {
+	if vm.NetNS == "" {
+		name := "fcnet-" + vm.ID[:8]
+		if err := exec.Command("ip", "netns", "add", name).Run(); err != nil {
+			return fmt.Errorf("failed to create netns %s: %w", name, err)
+		}
+		vm.NetNS = name
+	}
+	tap := []string{"tuntap", "add", "dev", guestTap, "mode", "tap"}
+	if vm.Jailed {
+		tap = append(tap, "user", strconv.Itoa(vm.UID), "group", strconv.Itoa(vm.GID))
+	}
+	if err := ipIn(vm, tap, []string{"link", "set", guestTap, "up"}); err != nil {
+		return err
+	}
+	vm.TapName = guestTap
+	return nil
+}
+
+// ipIn runs each ip command inside vm's network namespace, stopping at
+// the first failure.
+func ipIn(vm *domain.VM, steps ...[]string) error {
+	for _, args := range steps {
+		out, err := exec.Command("ip", append([]string{"-n", vm.NetNS}, args...)...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("ip %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// startCapture records the guest's TAP, before the guest can send
+// anything, into jobID's capture artifact.
+func (mgr *VMManager) startCapture(vm *domain.VM, jobID, netnsPath string) error {
+	path, err := mgr.artifactPath(jobID, ArtifactCapture)
+	if err != nil {
+		return fmt.Errorf("no place for the packet capture: %w", err)
+	}
+	limit := mgr.Network.CaptureMaxBytes
+	if limit <= 0 {
+		limit = DefaultCaptureBytes
+	}
+	c, err := pcap.Start(netnsPath, guestTap, path, limit)
+	if err != nil {
+		return err
+	}
+	vm.Capture = c
+	vm.CapturePath = path
+	return nil
+}
+
+// teardownNetwork stops the responder and the capture and, for unjailed
+// VMs, deletes the namespace; the jailer's own teardown deletes it
+// otherwise. The capture file is left for the job to parse.
+func teardownNetwork(vm *domain.VM) {
+	if vm.Responder != nil {
+		vm.Responder.Close()
+		vm.Responder = nil
+	}
+	if vm.Capture != nil {
+		if err := vm.Capture.Close(); err != nil {
+			log.Printf("network capture not finished: vm=%s err=%v", vm.ID, err)
+		}
+		vm.Capture = nil
+	}
+	if vm.NetNS != "" && !vm.Jailed {
+		if err := exec.Command("ip", "netns", "del", vm.NetNS).Run(); err != nil {
+			log.Printf("netns not deleted: vm=%s netns=%s err=%v", vm.ID, vm.NetNS, err)
+		}
+		vm.NetNS = ""
+	}
+}
+
+// randomMAC is a locally administered unicast address.
+func randomMAC() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("AA:FC:%02X:%02X:%02X:%02X", b[0], b[1], b[2], b[3])
+}
@@ -0,0 +1,171 @@
+package sandboxing
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+// overlayChunkSectors is the dm-snapshot chunk size: 4 KiB, so a guest
+// write copies no more than a filesystem block.
+const overlayChunkSectors = 8
+
+// overlayImage exposes src at dst as a device-mapper snapshot. Reads come
+// from src through a read-only loop device shared by every VM, and writes
+// land in a sparse copy-on-write file beside dst, so the VM writes only
+// the blocks it changes. It needs root, losetup and the dm-snapshot target.
+// It returns the bytes written to set the overlay up.
+func (mgr *VMManager) overlayImage(vm *domain.VM, src, dst string) (int64, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() == 0 || info.Size()%512 != 0 {
+		return 0, fmt.Errorf("%s is not a whole number of sectors", src)
+	}
+
+	var ov domain.Overlay
+	base, err := mgr.loops.acquire(src)
+	if err != nil {
+		return 0, err
+	}
+	ov.Base = src
+
+	cow := dst + ".cow"
+	err = createSparseFile(cow, info.Size())
+	if err == nil {
+		ov.COWLoop, err = losetup("--find", "--show", cow)
+	}
+	if err == nil {
+		name := "fc-" + vm.ID + "-" + filepath.Base(dst)
+		table := fmt.Sprintf("0 %d snapshot %s %s N %d",
+			info.Size()/512, base, ov.COWLoop, overlayChunkSectors)
+		if out, cerr := exec.Command("dmsetup", "create", name, "--table", table).CombinedOutput(); cerr != nil {
+			err = fmt.Errorf("dmsetup create %s: %w: %s", name, cerr, strings.TrimSpace(string(out)))
+		} else {
+			ov.Name = name
+		}
+	}
+	if err == nil {
+		// A node of its own inside vm.Dir, so the jailed Firecracker can
+		// reach it without /dev/mapper
+		err = copyDeviceNode(filepath.Join("/dev/mapper", ov.Name), dst)
+	}
+	if err != nil {
+		mgr.releaseOverlay(ov)
+		os.Remove(cow)
+		return 0, err
+	}
+	vm.Overlays = append(vm.Overlays, ov)
+
+	written, _ := allocatedBytes(cow)
+	return written, nil
+}
+
+// releaseOverlays removes vm's snapshots once Firecracker has exited.
+func (mgr *VMManager) releaseOverlays(vm *domain.VM) {
+	for _, ov := range vm.Overlays {
+		mgr.releaseOverlay(ov)
+	}
+	vm.Overlays = nil
+}
+
+// releaseOverlay undoes as much of overlayImage as ov records.
+func (mgr *VMManager) releaseOverlay(ov domain.Overlay) {
+	var errs []error
+	if ov.Name != "" {
+		if out, err := exec.Command("dmsetup", "remove", "--retry", ov.Name).CombinedOutput(); err != nil {
+			errs = append(errs, fmt.Errorf("dmsetup remove %s: %w: %s", ov.Name, err, strings.TrimSpace(string(out))))
+		}
+	}
+	if ov.COWLoop != "" {
+		if _, err := losetup("--detach", ov.COWLoop); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if ov.Base != "" {
+		if err := mgr.loops.release(ov.Base); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		log.Printf("overlay teardown incomplete: name=%s err=%v", ov.Name, err)
+	}
+}
+
+// sharedLoops attaches each base image to a single read-only loop device
+// and detaches it when the last overlay over it is released. A base image
+// replaced on disk is picked up once the VMs on the old one have gone.
+type sharedLoops struct {
+	mu    sync.Mutex
+	loops map[string]*sharedLoop // base image path -> its loop device
+}
+
+type sharedLoop struct {
+	dev  string
+	refs int
+}
+
+func (s *sharedLoops) acquire(path string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.loops[path]; ok {
+		l.refs++
+		return l.dev, nil
+	}
+	dev, err := losetup("--find", "--show", "--read-only", path)
+	if err != nil {
+		return "", err
+	}
+	if s.loops == nil {
+		s.loops = make(map[string]*sharedLoop)
+	}
+	s.loops[path] = &sharedLoop{dev: dev, refs: 1}
+	return dev, nil
+}
+
+func (s *sharedLoops) release(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.loops[path]
+	if !ok {
+		return nil
+	}
+	if l.refs--; l.refs > 0 {
+		return nil
+	}
+	delete(s.loops, path)
+	_, err := losetup("--detach", l.dev)
+	return err
+}
+
+// losetup runs losetup and returns its trimmed output, the device name
+// for --show.
+func losetup(args ...string) (string, error) {
+	out, err := exec.Command("losetup", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("losetup %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// createSparseFile makes an empty file of size bytes that occupies no
+// disk until written.
+func createSparseFile(path string, size int64) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
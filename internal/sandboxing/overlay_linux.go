@@ -0,0 +1,13 @@
+package sandboxing
+
+import "golang.org/x/sys/unix"
+
+// copyDeviceNode creates dst as a block device node for the same device
+// as dev.
+func copyDeviceNode(dev, dst string) error {
+	var st unix.Stat_t
+	if err := unix.Stat(dev, &st); err != nil {
+		return err
+	}
+	return unix.Mknod(dst, unix.S_IFBLK|0600, int(st.Rdev))
+}
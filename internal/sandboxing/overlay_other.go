@@ -0,0 +1,9 @@
+//go:build !linux
+
+package sandboxing
+
+import "errors"
+
+func copyDeviceNode(dev, dst string) error {
+	return errors.New("device-mapper overlays not supported on this platform")
+}
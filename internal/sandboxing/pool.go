@@ -0,0 +1,284 @@
+package sandboxing
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+	client "github.com/sudankdk/firecracker/internal/httpClient"
+)
+
+// PoolConfig keeps booted VMs waiting for jobs. Pool VMs boot with an empty
+// placeholder input drive outside the scheduler, so take their share out
+// of its limits with SchedulerConfig.ReservePool.
+type PoolConfig struct {
+	Size        int           // idle VMs to keep ready; 0 disables the pool
+	RefillEvery time.Duration // at most one replacement boot per interval
+	MaxIdle     time.Duration // idle VMs older than this are recycled
+}
+
+// ReservePool returns c with the pool's VMs taken out of its limits, so
+// pooled and scheduled VMs together stay within c. vcpus and memMiB are the
+// size of one VM. A job that takes a pooled VM holds a scheduler slot while
+// the pool boots a replacement, so the total never exceeds c. It fails when
+// the pool would leave no room for a job.
+func (c SchedulerConfig) ReservePool(pool PoolConfig, vcpus, memMiB int) (SchedulerConfig, error) {
+	if pool.Size <= 0 {
+		return c, nil
+	}
+	reserve := func(limit *int, per int, what string) error {
+		if *limit <= 0 {
+			return nil
+		}
+		if *limit -= pool.Size * per; *limit < per {
+			return fmt.Errorf("a pool of %d VMs leaves no %s for jobs", pool.Size, what)
+		}
+		return nil
+	}
+	if err := reserve(&c.MaxVMs, 1, "VM slots"); err != nil {
+		return c, err
+	}
+	if err := reserve(&c.MaxVCPUs, vcpus, "vCPUs"); err != nil {
+		return c, err
+	}
+	if err := reserve(&c.MaxMemMiB, memMiB, "memory"); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+type PoolStats struct {
+	Size              int     `json:"size"`
+	Idle              int     `json:"idle"`
+	Booting           int     `json:"booting"`
+	Hits              uint64  `json:"hits"`
+	Misses            uint64  `json:"misses"`
+	Recycled          uint64  `json:"recycled"`
+	BootFailures      uint64  `json:"bootFailures"`
+	OldestIdleSeconds float64 `json:"oldestIdleSeconds"`
+}
+
+type vmPool struct {
+	mu      sync.Mutex
+	idle    []*instance
+	booting int
+	stats   PoolStats
+	stop    chan struct{}
+	boot    func() (*instance, error) // starts a VM and waits for its agent
+}
+
+// StartPool begins filling the idle pool in the background. It is a no-op
+// when Pool.Size is zero.
+func (mgr *VMManager) StartPool() {
+	if mgr.Pool.Size <= 0 {
+		return
+	}
+	mgr.startPool(mgr.bootIdle)
+}
+
+func (mgr *VMManager) startPool(boot func() (*instance, error)) {
+	mgr.pool = &vmPool{stop: make(chan struct{}), boot: boot}
+	go mgr.refillLoop()
+}
+
+// StopPool stops refilling and destroys every idle VM. VMs still booting
+// are destroyed once they come up.
+func (mgr *VMManager) StopPool() {
+	p := mgr.pool
+	if p == nil {
+		return
+	}
+	close(p.stop)
+
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+	for _, inst := range idle {
+		mgr.discard(inst)
+	}
+}
+
+// PoolStats reports the pool's current occupancy and counters.
+func (mgr *VMManager) PoolStats() PoolStats {
+	p := mgr.pool
+	if p == nil {
+		return PoolStats{}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.Size = mgr.Pool.Size
+	stats.Idle = len(p.idle)
+	stats.Booting = p.booting
+	for _, inst := range p.idle {
+		if age := time.Since(inst.bootedAt).Seconds(); age > stats.OldestIdleSeconds {
+			stats.OldestIdleSeconds = age
+		}
+	}
+	return stats
+}
+
+// takePooled pops the oldest live idle VM, or returns nil if none is ready.
+func (mgr *VMManager) takePooled() *instance {
+	p := mgr.pool
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.idle) > 0 {
+		inst := p.idle[0]
+		p.idle = p.idle[1:]
+		select {
+		case <-inst.exited:
+			p.stats.Recycled++
+			go mgr.discard(inst)
+			continue
+		default:
+		}
+		p.stats.Hits++
+		return inst
+	}
+	p.stats.Misses++
+	return nil
+}
+
+func (mgr *VMManager) refillLoop() {
+	every := mgr.Pool.RefillEvery
+	if every <= 0 {
+		every = time.Second
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		mgr.reapPool()
+
+		p := mgr.pool
+		p.mu.Lock()
+		need := len(p.idle)+p.booting < mgr.Pool.Size
+		if need {
+			p.booting++
+		}
+		p.mu.Unlock()
+		if need {
+			go mgr.bootPooled()
+		}
+
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// bootIdle starts a VM on a placeholder input drive and waits for its
+// agent to say hello.
+func (mgr *VMManager) bootIdle() (*instance, error) {
+	inst, err := mgr.startVM("", SpawnOptions{})
+	if err != nil {
+		return nil, err
+	}
+	readyTimeout := mgr.Snapshots.ReadyTimeout
+	if readyTimeout <= 0 {
+		readyTimeout = time.Minute
+	}
+	select {
+	case <-inst.results.Ready():
+		return inst, nil
+	case <-inst.exited:
+		err = fmt.Errorf("pooled vm %s exited during boot", inst.vm.ID)
+	case <-time.After(readyTimeout):
+		err = fmt.Errorf("pooled vm %s not ready after %v", inst.vm.ID, readyTimeout)
+	}
+	mgr.discard(inst)
+	return nil, err
+}
+
+func (mgr *VMManager) bootPooled() {
+	p := mgr.pool
+	inst, err := p.boot()
+
+	p.mu.Lock()
+	p.booting--
+	if err != nil {
+		p.stats.BootFailures++
+		p.mu.Unlock()
+		log.Printf("pool boot failed: %v", err)
+		return
+	}
+	select {
+	case <-p.stop:
+		// StopPool has already drained the pool; nothing would reap this VM
+		p.mu.Unlock()
+		mgr.discard(inst)
+		return
+	default:
+	}
+	p.idle = append(p.idle, inst)
+	p.mu.Unlock()
+}
+
+// reapPool recycles idle VMs that died or outlived MaxIdle.
+func (mgr *VMManager) reapPool() {
+	p := mgr.pool
+	p.mu.Lock()
+	var keep, drop []*instance
+	for _, inst := range p.idle {
+		dead := false
+		select {
+		case <-inst.exited:
+			dead = true
+		default:
+		}
+		if dead || (mgr.Pool.MaxIdle > 0 && time.Since(inst.bootedAt) > mgr.Pool.MaxIdle) {
+			drop = append(drop, inst)
+			continue
+		}
+		keep = append(keep, inst)
+	}
+	p.idle = keep
+	p.stats.Recycled += uint64(len(drop))
+	p.mu.Unlock()
+
+	for _, inst := range drop {
+		go mgr.discard(inst)
+	}
+}
+
+// attachInput swaps the job's upload in for a pooled VM's placeholder
+// drive and tells the waiting agent to start.
+func (mgr *VMManager) attachInput(inst *instance, uploadFilePath string, opts SpawnOptions) error {
+	vm := inst.vm
+	jobDrive := filepath.Join(vm.Dir, "job_input.img")
+	if err := mgr.stageInput(vm, uploadFilePath, jobDrive, opts); err != nil {
+		return fmt.Errorf("failed to prepare input drive: %w", err)
+	}
+	if vm.Jailed {
+		if err := os.Chown(jobDrive, vm.UID, vm.GID); err != nil {
+			return fmt.Errorf("failed to chown input drive: %w", err)
+		}
+	}
+
+	if err := client.PatchDrive(client.NewClient(vm.APISock), client.PartialDrive{
+		DriveID:    "input_drive",
+		PathOnHost: vmPath(vm, jobDrive),
+	}); err != nil {
+		return fmt.Errorf("failed to swap input drive: %w", err)
+	}
+	if vm.AgentToken != "" {
+		if err := putMetadata(vm, mgr.guestMetadata(vm, opts)); err != nil {
+			return err
+		}
+	}
+
+	return inst.results.Start(domain.GuestStart{JobID: opts.JobID, InputDrive: "input_drive"})
+}
@@ -0,0 +1,198 @@
+package sandboxing
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+// fakeBooter stands in for Firecracker with a sleeping process, so the
+// pool's discard path kills and reaps something real.
+type fakeBooter struct {
+	dir   string
+	boots atomic.Int32
+	fail  atomic.Bool
+}
+
+func newFakeBooter(t *testing.T) *fakeBooter {
+	return &fakeBooter{dir: t.TempDir()}
+}
+
+// boot may still run after its test has finished, so it reports failure
+// through its return values only.
+func (b *fakeBooter) boot() (*instance, error) {
+	n := b.boots.Add(1)
+	if b.fail.Load() {
+		return nil, errors.New("boot failed")
+	}
+	dir, err := os.MkdirTemp(b.dir, "vm-")
+	if err != nil {
+		return nil, err
+	}
+	results, err := ListenResults("pooled", filepath.Join(dir, "v.sock"))
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		results.Close()
+		return nil, err
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	return &instance{
+		vm:       &domain.VM{ID: fmt.Sprintf("pooled-%d", n), Cmd: cmd, Dir: dir},
+		results:  results,
+		exited:   exited,
+		bootedAt: time.Now(),
+	}, nil
+}
+
+// waitFor polls cond until it holds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func exitedWithin(inst *instance, d time.Duration) bool {
+	select {
+	case <-inst.exited:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+func TestPoolRefillAndTake(t *testing.T) {
+	b := newFakeBooter(t)
+	mgr := &VMManager{Pool: PoolConfig{Size: 2, RefillEvery: 5 * time.Millisecond}}
+	mgr.startPool(b.boot)
+	defer mgr.StopPool()
+
+	waitFor(t, "a full pool", func() bool { return mgr.PoolStats().Idle == 2 })
+	time.Sleep(30 * time.Millisecond)
+	if n := b.boots.Load(); n != 2 {
+		t.Errorf("booted %d VMs for a pool of 2", n)
+	}
+
+	first := mgr.takePooled()
+	second := mgr.takePooled()
+	if first == nil || second == nil || first == second {
+		t.Fatal("pool did not hand out two idle VMs")
+	}
+	waitFor(t, "the pool to refill", func() bool { return mgr.PoolStats().Idle == 2 })
+
+	st := mgr.PoolStats()
+	if st.Hits < 2 || st.Size != 2 || st.Booting != 0 {
+		t.Errorf("stats %+v", st)
+	}
+	// Handed-out VMs belong to their jobs now
+	if exitedWithin(first, 20*time.Millisecond) {
+		t.Error("pool killed a VM it had handed out")
+	}
+	mgr.discard(first)
+	mgr.discard(second)
+}
+
+func TestPoolRecycles(t *testing.T) {
+	b := newFakeBooter(t)
+	mgr := &VMManager{Pool: PoolConfig{Size: 1, RefillEvery: 5 * time.Millisecond, MaxIdle: 50 * time.Millisecond}}
+	mgr.startPool(b.boot)
+	defer mgr.StopPool()
+
+	waitFor(t, "an idle VM", func() bool { return mgr.PoolStats().Idle == 1 })
+	mgr.pool.mu.Lock()
+	old := mgr.pool.idle[0]
+	mgr.pool.mu.Unlock()
+
+	// Past MaxIdle it is destroyed and replaced
+	if !exitedWithin(old, 5*time.Second) {
+		t.Fatal("stale idle VM not recycled")
+	}
+	waitFor(t, "a replacement", func() bool {
+		st := mgr.PoolStats()
+		return st.Recycled >= 1 && st.Idle == 1
+	})
+
+	// A VM that died while idle is skipped, not handed out
+	mgr.pool.mu.Lock()
+	dead := mgr.pool.idle[0]
+	mgr.pool.mu.Unlock()
+	dead.vm.Cmd.Process.Kill()
+	<-dead.exited
+	if inst := mgr.takePooled(); inst == dead {
+		t.Error("took a dead VM from the pool")
+	} else if inst != nil {
+		mgr.discard(inst)
+	}
+}
+
+func TestPoolBootFailure(t *testing.T) {
+	b := newFakeBooter(t)
+	b.fail.Store(true)
+	mgr := &VMManager{Pool: PoolConfig{Size: 1, RefillEvery: 5 * time.Millisecond}}
+	if mgr.takePooled() != nil {
+		t.Fatal("took a VM with no pool")
+	}
+	mgr.startPool(b.boot)
+
+	waitFor(t, "boot failures", func() bool { return mgr.PoolStats().BootFailures >= 2 })
+	if st := mgr.PoolStats(); st.Idle != 0 {
+		t.Errorf("stats %+v", st)
+	}
+	if mgr.takePooled() != nil || mgr.PoolStats().Misses != 1 {
+		t.Error("empty pool: want a miss")
+	}
+
+	b.fail.Store(false)
+	waitFor(t, "recovery", func() bool { return mgr.PoolStats().Idle == 1 })
+	mgr.pool.mu.Lock()
+	idle := mgr.pool.idle[0]
+	mgr.pool.mu.Unlock()
+
+	mgr.StopPool()
+	if !exitedWithin(idle, 5*time.Second) || mgr.PoolStats().Idle != 0 {
+		t.Error("StopPool left an idle VM running")
+	}
+}
+
+func TestReservePool(t *testing.T) {
+	host := SchedulerConfig{MaxVMs: 8, MaxVCPUs: 8, MaxMemMiB: 4096, MaxQueue: 100}
+
+	got, err := host.ReservePool(PoolConfig{Size: 2}, 1, 512)
+	want := SchedulerConfig{MaxVMs: 6, MaxVCPUs: 6, MaxMemMiB: 3072, MaxQueue: 100}
+	if err != nil || got != want {
+		t.Errorf("got %+v, %v; want %+v", got, err, want)
+	}
+	if got, err := host.ReservePool(PoolConfig{}, 1, 512); err != nil || got != host {
+		t.Errorf("no pool: got %+v, %v", got, err)
+	}
+	// Unbounded limits stay unbounded
+	if got, err := (SchedulerConfig{MaxVMs: 4}).ReservePool(PoolConfig{Size: 1}, 2, 1024); err != nil || got.MaxVMs != 3 || got.MaxVCPUs != 0 {
+		t.Errorf("partial limits: got %+v, %v", got, err)
+	}
+	for _, size := range []int{8, 9} {
+		if _, err := host.ReservePool(PoolConfig{Size: size}, 1, 512); err == nil {
+			t.Errorf("pool of %d on a host of 8: accepted", size)
+		}
+	}
+	if _, err := host.ReservePool(PoolConfig{Size: 4}, 1, 1024); err == nil {
+		t.Error("pool using all the memory: accepted")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package sandboxing
+
+import "errors"
+
+func reflink(src, dst string) error {
+	return errors.New("reflink not supported on this platform")
+}
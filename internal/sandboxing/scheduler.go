@@ -0,0 +1,220 @@
+package sandboxing
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned by Submit when MaxQueue tasks are already waiting.
+	ErrQueueFull = errors.New("scheduler queue is full")
+	// ErrTaskTooLarge is returned for tasks that could never fit the host limits.
+	ErrTaskTooLarge = errors.New("task exceeds scheduler capacity")
+)
+
+// SchedulerConfig caps what the host runs at once. Zero limits are unbounded.
+type SchedulerConfig struct {
+	MaxVMs    int
+	MaxVCPUs  int
+	MaxMemMiB int
+	MaxQueue  int
+
+	// RetryAfter is the hint handed to clients rejected with ErrQueueFull.
+	RetryAfter time.Duration
+}
+
+// Task is a unit of work waiting for VM capacity. Run is called in its own
+// goroutine once admitted; the task's resources are released when it returns.
+type Task struct {
+	ID       string
+	Priority int // higher runs first; equal priorities run FIFO
+	VCPUs    int
+	MemMiB   int
+	Run      func()
+
+	seq      uint64
+	enqueued time.Time
+	index    int
+}
+
+// SchedulerStats is a point-in-time view of the queue and running set.
+type SchedulerStats struct {
+	Queued      int             `json:"queued"`
+	Running     int             `json:"running"`
+	VCPUsInUse  int             `json:"vcpusInUse"`
+	MemMiBInUse int             `json:"memMiBInUse"`
+	OldestWait  float64         `json:"oldestWaitSeconds"`
+	Limits      SchedulerConfig `json:"limits"`
+}
+
+type Scheduler struct {
+	cfg SchedulerConfig
+
+	mu      sync.Mutex
+	queue   taskQueue
+	byID    map[string]*Task
+	running int
+	vcpus   int
+	mem     int
+	seq     uint64
+}
+
+func NewScheduler(cfg SchedulerConfig) *Scheduler {
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = 30 * time.Second
+	}
+	return &Scheduler{
+		cfg:  cfg,
+		byID: make(map[string]*Task),
+	}
+}
+
+// Submit queues t and starts it as soon as capacity allows.
+func (s *Scheduler) Submit(t *Task) error {
+	if (s.cfg.MaxVCPUs > 0 && t.VCPUs > s.cfg.MaxVCPUs) ||
+		(s.cfg.MaxMemMiB > 0 && t.MemMiB > s.cfg.MaxMemMiB) {
+		return fmt.Errorf("%w: %d vCPU / %d MiB", ErrTaskTooLarge, t.VCPUs, t.MemMiB)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cfg.MaxQueue > 0 && s.queue.Len() >= s.cfg.MaxQueue {
+		return ErrQueueFull
+	}
+	s.seq++
+	t.seq = s.seq
+	t.enqueued = time.Now()
+	heap.Push(&s.queue, t)
+	s.byID[t.ID] = t
+
+	s.dispatchLocked()
+	return nil
+}
+
+// Cancel drops a task that is still waiting. It reports false when the task
+// is unknown or already running.
+func (s *Scheduler) Cancel(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.byID[id]
+	if !ok {
+		return false
+	}
+	heap.Remove(&s.queue, t.index)
+	delete(s.byID, id)
+	return true
+}
+
+// Full reports whether Submit would currently reject a task.
+func (s *Scheduler) Full() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg.MaxQueue > 0 && s.queue.Len() >= s.cfg.MaxQueue
+}
+
+// RetryAfter is how long rejected clients are told to wait.
+func (s *Scheduler) RetryAfter() time.Duration {
+	return s.cfg.RetryAfter
+}
+
+func (s *Scheduler) Stats() SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := SchedulerStats{
+		Queued:      s.queue.Len(),
+		Running:     s.running,
+		VCPUsInUse:  s.vcpus,
+		MemMiBInUse: s.mem,
+		Limits:      s.cfg,
+	}
+	for _, t := range s.queue {
+		if wait := time.Since(t.enqueued).Seconds(); wait > stats.OldestWait {
+			stats.OldestWait = wait
+		}
+	}
+	return stats
+}
+
+// dispatchLocked starts queued tasks in priority order until the head of the
+// queue no longer fits. The head is never skipped, so a large task cannot be
+// starved by a stream of small ones.
+func (s *Scheduler) dispatchLocked() {
+	for s.queue.Len() > 0 {
+		t := s.queue[0]
+		if !s.fitsLocked(t) {
+			return
+		}
+		heap.Pop(&s.queue)
+		delete(s.byID, t.ID)
+
+		s.running++
+		s.vcpus += t.VCPUs
+		s.mem += t.MemMiB
+		go s.run(t)
+	}
+}
+
+func (s *Scheduler) fitsLocked(t *Task) bool {
+	if s.cfg.MaxVMs > 0 && s.running+1 > s.cfg.MaxVMs {
+		return false
+	}
+	if s.cfg.MaxVCPUs > 0 && s.vcpus+t.VCPUs > s.cfg.MaxVCPUs {
+		return false
+	}
+	if s.cfg.MaxMemMiB > 0 && s.mem+t.MemMiB > s.cfg.MaxMemMiB {
+		return false
+	}
+	return true
+}
+
+func (s *Scheduler) run(t *Task) {
+	defer func() {
+		s.mu.Lock()
+		s.running--
+		s.vcpus -= t.VCPUs
+		s.mem -= t.MemMiB
+		s.dispatchLocked()
+		s.mu.Unlock()
+	}()
+	t.Run()
+}
+
+// taskQueue is a container/heap ordered by priority, then submission order.
+type taskQueue []*Task
+
+func (q taskQueue) Len() int { return len(q) }
+
+func (q taskQueue) Less(i, j int) bool {
+	if q[i].Priority != q[j].Priority {
+		return q[i].Priority > q[j].Priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q taskQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *taskQueue) Push(x any) {
+	t := x.(*Task)
+	t.index = len(*q)
+	*q = append(*q, t)
+}
+
+func (q *taskQueue) Pop() any {
+	old := *q
+	n := len(old)
+	t := old[n-1]
+	old[n-1] = nil
+	t.index = -1
+	*q = old[:n-1]
+	return t
+}
@@ -0,0 +1,208 @@
+package sandboxing
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// probe hands out tasks that report when they start and run until
+// finished.
+type probe struct {
+	t       *testing.T
+	started chan string
+	release map[string]chan struct{}
+}
+
+func newProbe(t *testing.T) *probe {
+	return &probe{t: t, started: make(chan string, 16), release: make(map[string]chan struct{})}
+}
+
+func (p *probe) task(id string, priority, vcpus, mem int) *Task {
+	done := make(chan struct{})
+	p.release[id] = done
+	return &Task{ID: id, Priority: priority, VCPUs: vcpus, MemMiB: mem, Run: func() {
+		p.started <- id
+		<-done
+	}}
+}
+
+func (p *probe) submit(s *Scheduler, tasks ...*Task) {
+	p.t.Helper()
+	for _, task := range tasks {
+		if err := s.Submit(task); err != nil {
+			p.t.Fatalf("submit %s: %v", task.ID, err)
+		}
+	}
+}
+
+func (p *probe) finish(id string) { close(p.release[id]) }
+
+// next waits for the next task to start.
+func (p *probe) next() string {
+	p.t.Helper()
+	select {
+	case id := <-p.started:
+		return id
+	case <-time.After(5 * time.Second):
+		p.t.Fatal("no task started")
+		return ""
+	}
+}
+
+// idle checks that nothing else starts.
+func (p *probe) idle() {
+	p.t.Helper()
+	select {
+	case id := <-p.started:
+		p.t.Fatalf("%s started, want it still queued", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSchedulerOrder(t *testing.T) {
+	p := newProbe(t)
+	s := NewScheduler(SchedulerConfig{MaxVMs: 1})
+	p.submit(s, p.task("blocker", 0, 1, 512))
+	p.next()
+
+	p.submit(s,
+		p.task("a", 0, 1, 512),
+		p.task("b", 5, 1, 512),
+		p.task("c", 0, 1, 512),
+		p.task("d", 5, 1, 512),
+		p.task("e", 1, 1, 512),
+	)
+	p.idle()
+	p.finish("blocker")
+
+	var order []string
+	for range 5 {
+		id := p.next()
+		order = append(order, id)
+		p.finish(id)
+	}
+	// Highest priority first, then in submission order
+	if want := []string{"b", "d", "e", "a", "c"}; !slices.Equal(order, want) {
+		t.Errorf("ran %v, want %v", order, want)
+	}
+}
+
+func TestSchedulerCaps(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  SchedulerConfig
+	}{
+		{"vms", SchedulerConfig{MaxVMs: 2}},
+		{"vcpus", SchedulerConfig{MaxVCPUs: 4}},
+		{"memory", SchedulerConfig{MaxMemMiB: 1024}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newProbe(t)
+			s := NewScheduler(tc.cfg)
+			p.submit(s, p.task("a", 0, 2, 512), p.task("b", 0, 2, 512), p.task("c", 0, 2, 512))
+			p.next()
+			p.next()
+			p.idle()
+
+			st := s.Stats()
+			if st.Running != 2 || st.Queued != 1 || st.VCPUsInUse != 4 || st.MemMiBInUse != 1024 {
+				t.Errorf("stats %+v", st)
+			}
+			p.finish("a")
+			if id := p.next(); id != "c" {
+				t.Errorf("%s started after a finished, want c", id)
+			}
+			p.finish("b")
+			p.finish("c")
+		})
+	}
+
+	s := NewScheduler(SchedulerConfig{MaxVCPUs: 4, MaxMemMiB: 1024})
+	for _, task := range []*Task{{ID: "cpu", VCPUs: 5}, {ID: "mem", MemMiB: 2048}} {
+		if err := s.Submit(task); !errors.Is(err, ErrTaskTooLarge) {
+			t.Errorf("%s: got %v, want ErrTaskTooLarge", task.ID, err)
+		}
+	}
+}
+
+func TestSchedulerHeadOfLine(t *testing.T) {
+	p := newProbe(t)
+	s := NewScheduler(SchedulerConfig{MaxVCPUs: 4})
+	p.submit(s, p.task("small", 0, 2, 0))
+	p.next()
+
+	// big waits for the whole host; tiny would fit now but queues behind it
+	p.submit(s, p.task("big", 0, 4, 0), p.task("tiny", 0, 1, 0))
+	p.idle()
+
+	p.finish("small")
+	if id := p.next(); id != "big" {
+		t.Fatalf("%s started first, want big", id)
+	}
+	p.idle()
+	p.finish("big")
+	if id := p.next(); id != "tiny" {
+		t.Fatalf("%s started, want tiny", id)
+	}
+	p.finish("tiny")
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	p := newProbe(t)
+	s := NewScheduler(SchedulerConfig{MaxVMs: 1})
+	p.submit(s, p.task("running", 0, 1, 0), p.task("queued", 0, 1, 0), p.task("after", 0, 1, 0))
+	p.next()
+
+	if s.Cancel("running") {
+		t.Error("cancelled a running task")
+	}
+	if !s.Cancel("queued") {
+		t.Error("queued task not cancelled")
+	}
+	if s.Cancel("queued") || s.Cancel("unknown") {
+		t.Error("cancelled a task that is not queued")
+	}
+	if st := s.Stats(); st.Queued != 1 || st.Running != 1 {
+		t.Errorf("stats after cancel: %+v", st)
+	}
+
+	p.finish("running")
+	if id := p.next(); id != "after" {
+		t.Errorf("%s started, want after", id)
+	}
+	p.finish("after")
+	p.idle()
+}
+
+func TestSchedulerFull(t *testing.T) {
+	p := newProbe(t)
+	s := NewScheduler(SchedulerConfig{MaxVMs: 1, MaxQueue: 2, RetryAfter: 5 * time.Second})
+	p.submit(s, p.task("a", 0, 1, 0))
+	p.next()
+
+	// The running task does not count against the queue
+	p.submit(s, p.task("b", 0, 1, 0))
+	if s.Full() {
+		t.Error("full with one queued task")
+	}
+	p.submit(s, p.task("c", 0, 1, 0))
+	if !s.Full() {
+		t.Error("not full with MaxQueue tasks waiting")
+	}
+	if err := s.Submit(p.task("d", 9, 1, 0)); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("submit to a full queue: got %v, want ErrQueueFull", err)
+	}
+	if s.RetryAfter() != 5*time.Second {
+		t.Errorf("RetryAfter() = %v", s.RetryAfter())
+	}
+
+	s.Cancel("c")
+	if s.Full() {
+		t.Error("still full after a cancel")
+	}
+	p.finish("a")
+	p.finish(p.next())
+}
@@ -0,0 +1,352 @@
+package sandboxing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+	client "github.com/sudankdk/firecracker/internal/httpClient"
+)
+
+const (
+	snapshotStateFile    = "snapshot.state"
+	snapshotMemFile      = "snapshot.mem"
+	snapshotManifestFile = "manifest.json"
+
+	// The template's input drive only has to exist; each job swaps in its own.
+	placeholderDriveSize = 1 << 20
+)
+
+// SnapshotConfig enables warm starts from a golden snapshot. Each snapshot
+// lives in Dir/<version>, where the version is derived from the kernel,
+// rootfs and Firecracker binary hashes plus the machine size.
+type SnapshotConfig struct {
+	Enabled bool
+	Dir     string
+
+	// ReadyTimeout bounds how long the template guest has to send its
+	// hello over vsock before the snapshot is taken.
+	ReadyTimeout time.Duration
+}
+
+// GoldenSnapshot describes a paused, fully booted template VM on disk.
+type GoldenSnapshot struct {
+	Version           string    `json:"version"`
+	KernelSHA256      string    `json:"kernelSha256"`
+	RootfsSHA256      string    `json:"rootfsSha256"`
+	FirecrackerSHA256 string    `json:"firecrackerSha256"`
+	VcpuCount         int       `json:"vcpuCount"`
+	MemSizeMib        int       `json:"memSizeMib"`
+	WritableRootfs    bool      `json:"writableRootfs"`
+	CreatedAt         time.Time `json:"createdAt"`
+
+	dir    string
+	images []imageStamp
+}
+
+// imageStamp is the cheap identity of a source image, checked before every
+// restore so an image swapped underneath a running server is noticed.
+type imageStamp struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (g *GoldenSnapshot) StatePath() string { return filepath.Join(g.dir, snapshotStateFile) }
+func (g *GoldenSnapshot) MemPath() string   { return filepath.Join(g.dir, snapshotMemFile) }
+
+// PrepareGoldenSnapshot makes sure a snapshot matching the current images
+// exists, booting a template VM to create one if needed. Snapshots for older
+// image versions are removed.
+func (mgr *VMManager) PrepareGoldenSnapshot() (*GoldenSnapshot, error) {
+	mgr.snapshotMu.Lock()
+	defer mgr.snapshotMu.Unlock()
+
+	want, err := mgr.snapshotIdentity()
+	if err != nil {
+		return nil, err
+	}
+	want.dir = filepath.Join(mgr.Snapshots.Dir, want.Version)
+
+	if existing, err := readSnapshotManifest(want.dir); err == nil && existing.Version == want.Version {
+		existing.dir = want.dir
+		existing.images = want.images
+		mgr.golden.Store(existing)
+		log.Printf("golden snapshot reused: version=%s", existing.Version)
+		mgr.pruneSnapshots(want.Version)
+		return existing, nil
+	}
+
+	log.Printf("building golden snapshot: version=%s", want.Version)
+	os.RemoveAll(want.dir)
+	if err := os.MkdirAll(want.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot dir: %w", err)
+	}
+	if err := mgr.snapshotTemplate(want); err != nil {
+		os.RemoveAll(want.dir)
+		return nil, err
+	}
+
+	want.CreatedAt = time.Now()
+	data, err := json.MarshalIndent(want, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(want.dir, snapshotManifestFile), data, 0644); err != nil {
+		os.RemoveAll(want.dir)
+		return nil, fmt.Errorf("failed to write snapshot manifest: %w", err)
+	}
+
+	mgr.golden.Store(want)
+	mgr.pruneSnapshots(want.Version)
+	log.Printf("golden snapshot ready: version=%s", want.Version)
+	return want, nil
+}
+
+// currentGolden returns the snapshot SpawnVM may restore from, or nil for a
+// cold boot. A snapshot whose source images changed on disk is dropped and
+// rebuilt in the background.
+func (mgr *VMManager) currentGolden() *GoldenSnapshot {
+	if !mgr.Snapshots.Enabled {
+		return nil
+	}
+	g := mgr.golden.Load()
+	if g == nil {
+		return nil
+	}
+	for _, img := range g.images {
+		info, err := os.Stat(img.path)
+		if err != nil || info.Size() != img.size || !info.ModTime().Equal(img.modTime) {
+			if mgr.golden.CompareAndSwap(g, nil) {
+				log.Printf("golden snapshot stale (%s changed), rebuilding", img.path)
+				go func() {
+					if _, err := mgr.PrepareGoldenSnapshot(); err != nil {
+						log.Printf("golden snapshot rebuild failed: %v", err)
+					}
+				}()
+			}
+			return nil
+		}
+	}
+	return g
+}
+
+func (mgr *VMManager) snapshotIdentity() (*GoldenSnapshot, error) {
+	g := &GoldenSnapshot{
+		VcpuCount:      mgr.VMVcpus(),
+		MemSizeMib:     mgr.VMMemMib(),
+		WritableRootfs: mgr.WritableRootfs,
+	}
+	for _, src := range []struct {
+		path string
+		sum  *string
+	}{
+		{mgr.KernelPath, &g.KernelSHA256},
+		{mgr.RootfsPath, &g.RootfsSHA256},
+		{mgr.firecrackerPath(), &g.FirecrackerSHA256},
+	} {
+		sum, stamp, err := hashImage(src.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", src.path, err)
+		}
+		*src.sum = sum
+		g.images = append(g.images, stamp)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%d\n%d\n%t\n",
+		g.KernelSHA256, g.RootfsSHA256, g.FirecrackerSHA256, g.VcpuCount, g.MemSizeMib, g.WritableRootfs)
+	g.Version = hex.EncodeToString(h.Sum(nil))[:16]
+	return g, nil
+}
+
+func hashImage(path string) (string, imageStamp, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", imageStamp{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", imageStamp{}, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", imageStamp{}, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), imageStamp{path, info.Size(), info.ModTime()}, nil
+}
+
+func readSnapshotManifest(dir string) (*GoldenSnapshot, error) {
+	data, err := os.ReadFile(filepath.Join(dir, snapshotManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var g GoldenSnapshot
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, err
+	}
+	for _, f := range []string{snapshotStateFile, snapshotMemFile} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			return nil, err
+		}
+	}
+	return &g, nil
+}
+
+func (mgr *VMManager) pruneSnapshots(keep string) {
+	entries, err := os.ReadDir(mgr.Snapshots.Dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() && e.Name() != keep {
+			log.Printf("removing stale golden snapshot: version=%s", e.Name())
+			os.RemoveAll(filepath.Join(mgr.Snapshots.Dir, e.Name()))
+		}
+	}
+}
+
+// snapshotTemplate cold-boots an unjailed template VM laid out exactly like
+// a job VM, waits for its agent, pauses it and writes the snapshot into g.dir.
+func (mgr *VMManager) snapshotTemplate(g *GoldenSnapshot) error {
+	vm, err := CreateVMMetadata()
+	if err != nil {
+		return err
+	}
+	vm.Dir = filepath.Join(g.dir, "template")
+	vm.APISock = filepath.Join(vm.Dir, "firecracker.socket")
+	if err := os.MkdirAll(vm.Dir, 0700); err != nil {
+		return err
+	}
+	defer os.RemoveAll(vm.Dir)
+
+	kernelPath := filepath.Join(vm.Dir, "kernel")
+	rootfsPath := filepath.Join(vm.Dir, "rootfs.ext4")
+	inputDrive := filepath.Join(vm.Dir, "input_drive.img")
+	vsockPath := filepath.Join(vm.Dir, "vsock.sock")
+
+	if _, _, err := mgr.cloneImage(nil, mgr.KernelPath, kernelPath, true); err != nil {
+		return fmt.Errorf("failed to stage kernel: %w", err)
+	}
+	if _, _, err := mgr.cloneImage(nil, mgr.RootfsPath, rootfsPath, !mgr.WritableRootfs); err != nil {
+		return fmt.Errorf("failed to stage rootfs: %w", err)
+	}
+	if err := createPlaceholderDrive(inputDrive); err != nil {
+		return err
+	}
+
+	results, err := ListenResults(vm.ID, vsockPath)
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	cmd, err := mgr.SetUpFirecracker(vm)
+	if err != nil {
+		return fmt.Errorf("failed to start template: %w", err)
+	}
+	vm.Cmd = cmd
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		vm.Console.Close()
+	}()
+
+	if err := waitForSocket(vm.APISock, 5*time.Second); err != nil {
+		return err
+	}
+	spec := bootSpec{
+		VcpuCount:      g.VcpuCount,
+		MemSizeMib:     g.MemSizeMib,
+		RootfsWritable: g.WritableRootfs,
+		Kernel:         vmPath(vm, kernelPath),
+		Rootfs:         vmPath(vm, rootfsPath),
+		InputDrive:     vmPath(vm, inputDrive),
+		VsockUDS:       vmPath(vm, vsockPath),
+	}
+	if err := configureVM(vm, spec); err != nil {
+		return fmt.Errorf("failed to boot template: %w", err)
+	}
+
+	readyTimeout := mgr.Snapshots.ReadyTimeout
+	if readyTimeout <= 0 {
+		readyTimeout = time.Minute
+	}
+	select {
+	case <-results.Ready():
+	case <-time.After(readyTimeout):
+		return fmt.Errorf("template guest not ready after %v", readyTimeout)
+	}
+
+	httpClient := client.NewClient(vm.APISock)
+	if err := client.PatchVM(httpClient, client.VMStatePaused); err != nil {
+		return fmt.Errorf("failed to pause template: %w", err)
+	}
+	if err := client.CreateSnapshot(httpClient, client.SnapshotCreateParams{
+		SnapshotPath: g.StatePath(),
+		MemFilePath:  g.MemPath(),
+		SnapshotType: client.SnapshotFull,
+	}); err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	return nil
+}
+
+// stageSnapshotFile makes a golden snapshot file reachable from the VM's
+// directory so a later rebuild cannot pull it out from under the restore.
+// It returns the path to hand to Firecracker.
+func stageSnapshotFile(vm *domain.VM, src, dst string) (string, error) {
+	if vm.Jailed {
+		if _, err := linkIntoJail(vm, src, dst); err != nil {
+			return "", err
+		}
+		return vmPath(vm, dst), nil
+	}
+	if err := os.Link(src, dst); err != nil {
+		// Different filesystem: an unjailed Firecracker can read it in place.
+		return src, nil
+	}
+	return vmPath(vm, dst), nil
+}
+
+// restoreVM loads the golden snapshot into a freshly started Firecracker
+// process, points the input drive at the job's image and resumes the guest.
+// The guest agent sees a vsock transport reset on resume and reconnects.
+func restoreVM(vm *domain.VM, spec bootSpec) error {
+	if spec.SnapshotState == "" || spec.SnapshotMem == "" {
+		return errors.New("restore requested without snapshot files")
+	}
+	httpClient := client.NewClient(vm.APISock)
+
+	if err := client.LoadSnapshot(httpClient, client.SnapshotLoadParams{
+		SnapshotPath: spec.SnapshotState,
+		MemBackend: &client.MemoryBackend{
+			BackendType: "File",
+			BackendPath: spec.SnapshotMem,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to load snapshot: %w", err)
+	}
+
+	if err := client.PatchDrive(httpClient, client.PartialDrive{
+		DriveID:    "input_drive",
+		PathOnHost: spec.InputDrive,
+	}); err != nil {
+		return fmt.Errorf("failed to attach input drive: %w", err)
+	}
+
+	if err := client.PatchVM(httpClient, client.VMStateResumed); err != nil {
+		return fmt.Errorf("failed to resume VM: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package sandboxing
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+const (
+	// GuestCID is the vsock context ID every sandbox guest gets.
+	GuestCID = 3
+	// ResultPort is the vsock port the guest agent connects to on the host (CID 2).
+	ResultPort = 52000
+	// ResultProtocolVersion is the highest agent protocol version the host understands.
+	ResultProtocolVersion = 1
+
+	maxResultFrame = 1 << 20
+
+	// The guest controls what it sends, so each list in the report is
+	// capped and a connection is dropped after too many bad frames.
+	maxReportEntries = 1000
+	maxReportErrors  = 100
+	maxBadFrames     = 10
+)
+
+// ResultListener accepts guest-initiated vsock connections. Firecracker
+// forwards a guest connection to port P onto the Unix socket <uds_path>_<P>,
+// so the listener binds that path before the VM starts.
+type ResultListener struct {
+	vmID  string
+	ln    net.Listener
+	token string // required in every hello when set
+
+	mu        sync.Mutex
+	report    domain.GuestReport
+	conn      net.Conn // connection of the latest hello
+	start     *domain.GuestStart
+	writeMu   sync.Mutex
+	ready     chan struct{}
+	exited    chan struct{}
+	readyOnce sync.Once
+	exitOnce  sync.Once
+}
+
+// ListenResults binds the host side of the result channel for the vsock
+// device whose uds_path is udsPath.
+func ListenResults(vmID, udsPath string) (*ResultListener, error) {
+	sockPath := fmt.Sprintf("%s_%d", udsPath, ResultPort)
+	os.Remove(sockPath)
+
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", sockPath, err)
+	}
+
+	rl := &ResultListener{
+		vmID: vmID,
+		ln:   ln,
+		report: domain.GuestReport{
+			Progress:   []domain.GuestProgress{},
+			Detections: []domain.GuestDetection{},
+			Files:      []domain.GuestFile{},
+			StartedAt:  time.Now(),
+		},
+		ready:  make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	go rl.acceptLoop()
+	return rl, nil
+}
+
+// RequireToken makes the listener drop connections whose hello does not
+// carry token, along with anything they send before it. Call it before
+// the VM starts.
+func (rl *ResultListener) RequireToken(token string) {
+	rl.token = token
+}
+
+// Start tells the agent to begin. It is sent right away if the agent has
+// already said hello, and again on every later hello, since the agent
+// reconnects after a snapshot restore.
+func (rl *ResultListener) Start(cmd domain.GuestStart) error {
+	rl.mu.Lock()
+	rl.start = &cmd
+	conn := rl.conn
+	rl.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return rl.sendStart(conn, cmd)
+}
+
+func (rl *ResultListener) sendStart(conn net.Conn, cmd domain.GuestStart) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	frame, err := json.Marshal(domain.GuestMessage{
+		Version: ResultProtocolVersion,
+		Type:    domain.MsgStart,
+		Data:    data,
+	})
+	if err != nil {
+		return err
+	}
+
+	rl.writeMu.Lock()
+	defer rl.writeMu.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(append(frame, '\n')); err != nil {
+		return fmt.Errorf("failed to signal guest agent: %w", err)
+	}
+	return nil
+}
+
+// Ready is closed once the guest agent has said hello.
+func (rl *ResultListener) Ready() <-chan struct{} {
+	return rl.ready
+}
+
+// Exited is closed once the guest agent reports its exit status.
+func (rl *ResultListener) Exited() <-chan struct{} {
+	return rl.exited
+}
+
+// Report returns a copy of everything received so far.
+func (rl *ResultListener) Report() domain.GuestReport {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	r := rl.report
+	r.Progress = append([]domain.GuestProgress(nil), r.Progress...)
+	r.Detections = append([]domain.GuestDetection(nil), r.Detections...)
+	r.Files = append([]domain.GuestFile(nil), r.Files...)
+	r.Errors = append([]string(nil), r.Errors...)
+	return r
+}
+
+// Close stops accepting connections and removes the socket.
+func (rl *ResultListener) Close() error {
+	return rl.ln.Close()
+}
+
+func (rl *ResultListener) acceptLoop() {
+	for {
+		conn, err := rl.ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("result channel accept failed: vm=%s err=%v", rl.vmID, err)
+			}
+			return
+		}
+		go rl.handleConn(conn)
+	}
+}
+
+func (rl *ResultListener) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxResultFrame)
+	authed := rl.token == ""
+	bad := 0
+	badFrame := func(msg string) bool {
+		rl.recordError(msg)
+		if bad++; bad >= maxBadFrames {
+			rl.recordError(fmt.Sprintf("%d bad frames, connection dropped", bad))
+			return false
+		}
+		return true
+	}
+	for scanner.Scan() {
+		var msg domain.GuestMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			if !badFrame(fmt.Sprintf("malformed frame: %v", err)) {
+				return
+			}
+			continue
+		}
+		if msg.Version < 1 || msg.Version > ResultProtocolVersion {
+			rl.recordError(fmt.Sprintf("unsupported protocol version %d", msg.Version))
+			return
+		}
+		if !authed {
+			if err := rl.authenticate(msg); err != nil {
+				rl.recordError(err.Error())
+				return
+			}
+			authed = true
+		}
+		if err := rl.apply(msg); err != nil {
+			if !badFrame(err.Error()) {
+				return
+			}
+			continue
+		}
+		if msg.Type == domain.MsgHello {
+			rl.mu.Lock()
+			rl.conn = conn
+			start := rl.start
+			rl.mu.Unlock()
+			if start != nil {
+				if err := rl.sendStart(conn, *start); err != nil {
+					rl.recordError(err.Error())
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		rl.recordError(fmt.Sprintf("read failed: %v", err))
+	}
+}
+
+// authenticate checks that msg, the first frame on a connection, is a
+// hello carrying the VM's token.
+func (rl *ResultListener) authenticate(msg domain.GuestMessage) error {
+	if msg.Type != domain.MsgHello {
+		return fmt.Errorf("%s frame before hello, connection dropped", msg.Type)
+	}
+	var hello domain.GuestHello
+	if err := json.Unmarshal(msg.Data, &hello); err != nil {
+		return fmt.Errorf("bad hello payload: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(hello.Token), []byte(rl.token)) != 1 {
+		return errors.New("hello without the VM's token, connection dropped")
+	}
+	return nil
+}
+
+func (rl *ResultListener) apply(msg domain.GuestMessage) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.report.ProtocolVersion = msg.Version
+	switch msg.Type {
+	case domain.MsgHello:
+		var hello domain.GuestHello
+		if err := json.Unmarshal(msg.Data, &hello); err != nil {
+			return fmt.Errorf("bad hello payload: %w", err)
+		}
+		rl.report.AgentVersion = hello.AgentVersion
+		rl.readyOnce.Do(func() { close(rl.ready) })
+	case domain.MsgProgress:
+		var p domain.GuestProgress
+		if err := json.Unmarshal(msg.Data, &p); err != nil {
+			return fmt.Errorf("bad progress payload: %w", err)
+		}
+		rl.report.Progress = capAppend(&rl.report, rl.report.Progress, p, maxReportEntries)
+	case domain.MsgDetection:
+		var d domain.GuestDetection
+		if err := json.Unmarshal(msg.Data, &d); err != nil {
+			return fmt.Errorf("bad detection payload: %w", err)
+		}
+		rl.report.Detections = capAppend(&rl.report, rl.report.Detections, d, maxReportEntries)
+	case domain.MsgFile:
+		var f domain.GuestFile
+		if err := json.Unmarshal(msg.Data, &f); err != nil {
+			return fmt.Errorf("bad file payload: %w", err)
+		}
+		rl.report.Files = capAppend(&rl.report, rl.report.Files, f, maxReportEntries)
+	case domain.MsgExit:
+		var e domain.GuestExit
+		if err := json.Unmarshal(msg.Data, &e); err != nil {
+			return fmt.Errorf("bad exit payload: %w", err)
+		}
+		rl.report.Exit = &e
+		rl.report.FinishedAt = time.Now()
+		rl.exitOnce.Do(func() { close(rl.exited) })
+	default:
+		return fmt.Errorf("unknown message type %q", msg.Type)
+	}
+	return nil
+}
+
+func (rl *ResultListener) recordError(msg string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if len(rl.report.Errors) < maxReportErrors {
+		log.Printf("result channel: vm=%s %s", rl.vmID, msg)
+	}
+	rl.report.Errors = capAppend(&rl.report, rl.report.Errors, msg, maxReportErrors)
+}
+
+// capAppend appends v to list unless it already holds max entries, in
+// which case v is dropped and the report marked truncated.
+func capAppend[T any](report *domain.GuestReport, list []T, v T, max int) []T {
+	if len(list) >= max {
+		report.Truncated = true
+		return list
+	}
+	return append(list, v)
+}
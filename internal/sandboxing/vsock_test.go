@@ -0,0 +1,94 @@
+package sandboxing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+func listen(t *testing.T) (*ResultListener, string) {
+	t.Helper()
+	uds := filepath.Join(t.TempDir(), "v.sock")
+	rl, err := ListenResults("vm", uds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rl.Close() })
+	return rl, fmt.Sprintf("%s_%d", uds, ResultPort)
+}
+
+func frame(t *testing.T, typ string, data any) string {
+	t.Helper()
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, _ := json.Marshal(domain.GuestMessage{Version: 1, Type: typ, Data: raw})
+	return string(msg) + "\n"
+}
+
+// send writes frames on a new connection and waits for the host to close
+// it, or for the caller to, when wait is false.
+func send(t *testing.T, sock string, frames string, wait bool) {
+	t.Helper()
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, frames); err != nil {
+		t.Fatal(err)
+	}
+	if wait {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.Copy(io.Discard, conn); err != nil {
+			t.Fatalf("connection not dropped: %v", err)
+		}
+	}
+}
+
+func TestResultReportCapped(t *testing.T) {
+	rl, sock := listen(t)
+
+	frames := frame(t, domain.MsgHello, domain.GuestHello{AgentVersion: "1"})
+	for i := range maxReportEntries + 5 {
+		frames += frame(t, domain.MsgProgress, domain.GuestProgress{Stage: "run", Percent: i})
+	}
+	frames += frame(t, domain.MsgExit, domain.GuestExit{})
+	send(t, sock, frames, false)
+
+	select {
+	case <-rl.Exited():
+	case <-time.After(5 * time.Second):
+		t.Fatal("exit never arrived")
+	}
+	r := rl.Report()
+	if len(r.Progress) != maxReportEntries || !r.Truncated {
+		t.Errorf("kept %d progress entries, truncated %v; want %d, true", len(r.Progress), r.Truncated, maxReportEntries)
+	}
+}
+
+func TestResultBadFramesDropConnection(t *testing.T) {
+	rl, sock := listen(t)
+
+	garbage := strings.Repeat("not json\n", maxBadFrames*3)
+	send(t, sock, garbage, true)
+	if r := rl.Report(); len(r.Errors) != maxBadFrames+1 || r.Truncated {
+		t.Fatalf("one connection: %d errors, truncated %v; want %d, false", len(r.Errors), r.Truncated, maxBadFrames+1)
+	}
+
+	// A guest that keeps reconnecting still cannot grow the error list
+	for range maxReportErrors / maxBadFrames {
+		send(t, sock, garbage, true)
+	}
+	if r := rl.Report(); len(r.Errors) != maxReportErrors || !r.Truncated {
+		t.Errorf("reconnecting: %d errors, truncated %v; want %d, true", len(r.Errors), r.Truncated, maxReportErrors)
+	}
+}
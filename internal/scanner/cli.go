@@ -0,0 +1,370 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+// cliScanner shells out to the yara binary for hosts without libyara. When
+// yarac is installed the rules are compiled once per reload and scans load
+// the compiled file; otherwise every scan passes the sources.
+type cliScanner struct {
+	cfg   Config
+	yara  string
+	yarac string
+
+	mu       sync.RWMutex
+	ruleArgs []string // "-C <compiled>", one "<ns>:<file>" per source, or empty for no rules
+	compiled string
+	info     RulesetInfo
+}
+
+// NewCLI returns a Scanner backed by the yara command-line tool.
+func NewCLI(cfg Config) (Scanner, error) {
+	yaraPath, err := exec.LookPath("yara")
+	if err != nil {
+		return nil, fmt.Errorf("yara not found: %w", err)
+	}
+	s := &cliScanner{cfg: cfg, yara: yaraPath}
+	s.yarac, _ = exec.LookPath("yarac")
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *cliScanner) Reload() error {
+	files, err := ruleFiles(s.cfg.RulesDir)
+	if err != nil {
+		return err
+	}
+	sources := make([]string, 0, len(files))
+	for _, f := range files {
+		sources = append(sources, namespace(f)+":"+f)
+	}
+	version := Version(files)
+
+	args := []string{}
+	var compiled string
+	switch {
+	case len(files) == 0:
+		// Nothing to compile; scans report no matches
+	case s.yarac != "":
+		cacheDir := s.cfg.CacheDir
+		if cacheDir == "" {
+			cacheDir = os.TempDir()
+		}
+		if err := os.MkdirAll(cacheDir, 0755); err != nil {
+			return err
+		}
+		compiled = filepath.Join(cacheDir, fmt.Sprintf("rules-%s-%d.yarc", version, time.Now().UnixNano()))
+		cmd := exec.Command(s.yarac, append(append([]string{"-w"}, sources...), compiled)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			os.Remove(compiled)
+			return fmt.Errorf("yarac failed: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+		args = []string{"-C", compiled}
+	default:
+		// Compile once against an empty target so broken rules are
+		// rejected here rather than on every scan.
+		cmd := exec.Command(s.yara, append(append([]string{"-w"}, sources...), os.DevNull)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("yara compile failed: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+		args = sources
+	}
+
+	s.mu.Lock()
+	previous := s.compiled
+	s.ruleArgs = args
+	s.compiled = compiled
+	s.info = RulesetInfo{
+		Engine:   EngineCLI,
+		Files:    files,
+		Version:  version,
+		LoadedAt: time.Now(),
+	}
+	s.mu.Unlock()
+
+	// Scans that started before the swap keep their open file handle
+	if previous != "" {
+		os.Remove(previous)
+	}
+	return nil
+}
+
+func (s *cliScanner) Check(namespace string, source []byte) error {
+	tmp, err := os.CreateTemp("", "check-*.yar")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(source)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	out, err := exec.Command(s.yara, "-w", namespace+":"+tmp.Name(), os.DevNull).CombinedOutput()
+	if err != nil {
+		msg := strings.ReplaceAll(strings.TrimSpace(string(out)), tmp.Name(), namespace)
+		return fmt.Errorf("yara compile failed: %s", msg)
+	}
+	return nil
+}
+
+func (s *cliScanner) ScanFile(ctx context.Context, path string) (*Result, error) {
+	s.mu.RLock()
+	ruleArgs := s.ruleArgs
+	version := s.info.Version
+	s.mu.RUnlock()
+	if ruleArgs == nil {
+		return nil, errors.New("scanner closed")
+	}
+	if len(ruleArgs) == 0 {
+		return &Result{Matches: []domain.YaraMatch{}, RulesVersion: version}, nil
+	}
+
+	timeout := s.cfg.timeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout+5*time.Second)
+	defer cancel()
+
+	args := []string{"-s", "-m", "-g", "-e", "-w",
+		"-a", strconv.Itoa(max(1, int(timeout.Seconds())))}
+	args = append(args, ruleArgs...)
+	args = append(args, path)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.yara, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("yara scan of %s failed: %w: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	matches, err := parseCLIOutput(stdout.String(), path)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Matches: matches, RulesVersion: version}, nil
+}
+
+func (s *cliScanner) Info() RulesetInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.info
+}
+
+func (s *cliScanner) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ruleArgs = nil
+	if s.compiled != "" {
+		os.Remove(s.compiled)
+		s.compiled = ""
+	}
+	return nil
+}
+
+// parseCLIOutput reads `yara -s -m -g -e` output for a single target:
+//
+//	ns:Rule [tag1,tag2] [author="x",score=80] /path/to/target
+//	0x0:$mz: MZ
+func parseCLIOutput(out, target string) ([]domain.YaraMatch, error) {
+	matches := []domain.YaraMatch{}
+	sc := bufio.NewScanner(strings.NewReader(out))
+	sc.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "0x") {
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("string match before any rule: %q", line)
+			}
+			str, err := parseStringLine(line)
+			if err != nil {
+				return nil, err
+			}
+			last := &matches[len(matches)-1]
+			last.Strings = append(last.Strings, str)
+			continue
+		}
+		m, err := parseRuleLine(strings.TrimSuffix(line, " "+target))
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, sc.Err()
+}
+
+func parseRuleLine(line string) (domain.YaraMatch, error) {
+	m := domain.YaraMatch{
+		Tags:    []string{},
+		Meta:    map[string]any{},
+		Strings: []domain.YaraString{},
+	}
+
+	id, rest, ok := strings.Cut(line, " [")
+	if !ok {
+		return m, fmt.Errorf("unexpected yara output: %q", line)
+	}
+	if ns, rule, ok := strings.Cut(id, ":"); ok {
+		m.Namespace, m.Rule = ns, rule
+	} else {
+		m.Rule = id
+	}
+
+	tags, rest, ok := strings.Cut(rest, "] [")
+	if !ok {
+		return m, fmt.Errorf("unexpected yara output: %q", line)
+	}
+	for _, t := range strings.Split(tags, ",") {
+		if t != "" {
+			m.Tags = append(m.Tags, t)
+		}
+	}
+
+	meta, err := parseMeta(strings.TrimSuffix(rest, "]"))
+	if err != nil {
+		return m, fmt.Errorf("%w in %q", err, line)
+	}
+	m.Meta = meta
+	return m, nil
+}
+
+// parseMeta reads the comma-separated identifier=value list yara prints for
+// -m. Strings are quoted and escaped; integers and booleans are bare.
+func parseMeta(s string) (map[string]any, error) {
+	meta := map[string]any{}
+	for s != "" {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed meta %q", s)
+		}
+
+		var raw string
+		if strings.HasPrefix(rest, `"`) {
+			end := closingQuote(rest)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated meta string for %s", key)
+			}
+			meta[key] = string(unescape(rest[1:end]))
+			rest = rest[end+1:]
+		} else {
+			raw, rest, _ = strings.Cut(rest, ",")
+			rest = "," + rest
+			switch raw {
+			case "true", "false":
+				meta[key] = raw == "true"
+			default:
+				n, err := strconv.ParseInt(raw, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("malformed meta value %s=%s", key, raw)
+				}
+				meta[key] = n
+			}
+		}
+		s = strings.TrimPrefix(rest, ",")
+	}
+	return meta, nil
+}
+
+var nextMeta = regexp.MustCompile(`^,[A-Za-z_][A-Za-z0-9_]*=`)
+
+// closingQuote finds the quote ending the string that starts at s[0]. yara
+// does not escape quotes inside meta strings, so the closing one is the
+// first that is followed by the next identifier= or the end of the list.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			if i == len(s)-1 || nextMeta.MatchString(s[i+1:]) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+var hexBytes = regexp.MustCompile(`^[0-9A-F]{2}( [0-9A-F]{2})* ?$`)
+
+func parseStringLine(line string) (domain.YaraString, error) {
+	var str domain.YaraString
+	offset, rest, ok := strings.Cut(line, ":")
+	if !ok {
+		return str, fmt.Errorf("unexpected yara string output: %q", line)
+	}
+	off, err := strconv.ParseUint(strings.TrimPrefix(offset, "0x"), 16, 64)
+	if err != nil {
+		return str, fmt.Errorf("bad match offset in %q", line)
+	}
+	str.Offset = off
+
+	id, data, _ := strings.Cut(rest, ": ")
+	str.Identifier = id
+
+	// Hex strings are printed as "4D 5A ", text strings escaped
+	if hexBytes.MatchString(data) {
+		if b, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(data), " ", "")); err == nil {
+			str.Data = b
+			return str, nil
+		}
+	}
+	str.Data = unescape(data)
+	return str, nil
+}
+
+// unescape reverses yara's escaping of non-printable bytes.
+func unescape(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			out = append(out, s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'x':
+			if i+2 < len(s) {
+				if b, err := hex.DecodeString(s[i+1 : i+3]); err == nil {
+					out = append(out, b[0])
+					i += 2
+					continue
+				}
+			}
+			out = append(out, '\\', 'x')
+		default:
+			out = append(out, s[i])
+		}
+	}
+	return out
+}
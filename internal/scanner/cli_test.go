@@ -0,0 +1,97 @@
+package scanner
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+func TestParseCLIOutput(t *testing.T) {
+	target := "/tmp/uploads/job 1.bin"
+	out := `default_rules:Suspicious_EXE_Header [exe,pe] [author="analyst",description="MZ, then "PE" header",score=80,weight=-5,enabled=true] /tmp/uploads/job 1.bin
+0x0:$mz: MZ
+0x4e:$dos: This program cannot be run in DOS mode.\x0d\x0d\x0a
+0x80:$hex: 50 45 00 00
+0x200:$ctl: tab\there\nline\\end
+extra:NoMeta [] [] /tmp/uploads/job 1.bin
+`
+	got, err := parseCLIOutput(out, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []domain.YaraMatch{
+		{
+			Rule:      "Suspicious_EXE_Header",
+			Namespace: "default_rules",
+			Tags:      []string{"exe", "pe"},
+			Meta: map[string]any{
+				"author":      "analyst",
+				"description": `MZ, then "PE" header`,
+				"score":       int64(80),
+				"weight":      int64(-5),
+				"enabled":     true,
+			},
+			Strings: []domain.YaraString{
+				{Identifier: "$mz", Offset: 0, Data: []byte("MZ")},
+				{Identifier: "$dos", Offset: 0x4e, Data: []byte("This program cannot be run in DOS mode.\r\r\n")},
+				{Identifier: "$hex", Offset: 0x80, Data: []byte{0x50, 0x45, 0, 0}},
+				{Identifier: "$ctl", Offset: 0x200, Data: []byte("tab\there\nline\\end")},
+			},
+		},
+		{
+			Rule:      "NoMeta",
+			Namespace: "extra",
+			Tags:      []string{},
+			Meta:      map[string]any{},
+			Strings:   []domain.YaraString{},
+		},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d matches, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("match %d:\n got  %+v\n want %+v", i, got[i], want[i])
+		}
+	}
+
+	if got, err := parseCLIOutput("", target); err != nil || got == nil || len(got) != 0 {
+		t.Errorf("no output: got %v, %v; want an empty, non-nil list", got, err)
+	}
+}
+
+func TestParseCLIOutputRejects(t *testing.T) {
+	bad := map[string]string{
+		"string before rule": "0x0:$mz: MZ\n",
+		"no tag list":        "ns:Rule /tmp/x\n",
+		"no meta list":       "ns:Rule [a] /tmp/x\n",
+		"meta without value": "ns:Rule [] [author] /tmp/x\n",
+		"unterminated meta":  `ns:Rule [] [author="x] /tmp/x` + "\n",
+		"bad meta number":    "ns:Rule [] [score=8o] /tmp/x\n",
+		"bad offset":         "ns:Rule [] [] /tmp/x\n0xZZ:$a: x\n",
+	}
+	for name, out := range bad {
+		if _, err := parseCLIOutput(out, "/tmp/x"); err == nil {
+			t.Errorf("%s: accepted %q", name, out)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := map[string][]byte{
+		`plain`:       []byte("plain"),
+		`a\x00b\xffc`: {'a', 0, 'b', 0xff, 'c'},
+		`\r\n\t`:      []byte("\r\n\t"),
+		`\"quoted\"`:  []byte(`"quoted"`),
+		`bad \xZZ`:    []byte(`bad \xZZ`),
+		`cut \x4`:     []byte(`cut \x4`),
+		`trailing \`:  []byte(`trailing \`),
+	}
+	for in, want := range tests {
+		if got := unescape(in); !bytes.Equal(got, want) {
+			t.Errorf("unescape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+//go:build yara
+
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hillu/go-yara/v4"
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+// nativeScanner runs rules in-process through libyara. Scans share one
+// compiled ruleset under a read lock; Reload takes the write lock only to
+// swap it.
+type nativeScanner struct {
+	cfg Config
+
+	mu    sync.RWMutex
+	rules *yara.Rules
+	info  RulesetInfo
+}
+
+func newNative(cfg Config) (Scanner, error) {
+	s := &nativeScanner{cfg: cfg}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *nativeScanner) Reload() error {
+	files, err := ruleFiles(s.cfg.RulesDir)
+	if err != nil {
+		return err
+	}
+
+	compiler, err := yara.NewCompiler()
+	if err != nil {
+		return err
+	}
+	defer compiler.Destroy()
+
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = compiler.AddFile(f, namespace(path))
+		f.Close()
+		if err != nil {
+			return compileError(compiler, err)
+		}
+	}
+	rules, err := compiler.GetRules()
+	if err != nil {
+		return compileError(compiler, err)
+	}
+
+	s.mu.Lock()
+	old := s.rules
+	s.rules = rules
+	s.info = RulesetInfo{
+		Engine:   EngineLibyara,
+		Files:    files,
+		Version:  Version(files),
+		LoadedAt: time.Now(),
+	}
+	s.mu.Unlock()
+
+	if old != nil {
+		old.Destroy()
+	}
+	return nil
+}
+
+func (s *nativeScanner) Check(namespace string, source []byte) error {
+	compiler, err := yara.NewCompiler()
+	if err != nil {
+		return err
+	}
+	defer compiler.Destroy()
+
+	if err := compiler.AddString(string(source), namespace); err != nil {
+		return compileError(compiler, err)
+	}
+	return nil
+}
+
+func (s *nativeScanner) ScanFile(ctx context.Context, path string) (*Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	timeout := s.cfg.timeout()
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.rules == nil {
+		return nil, errors.New("scanner closed")
+	}
+
+	cb := &matchCollector{ctx: ctx}
+	if err := s.rules.ScanFileDescriptor(f.Fd(), 0, timeout, cb); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("yara scan of %s failed: %w", path, err)
+	}
+
+	result := &Result{
+		Matches:      make([]domain.YaraMatch, 0, len(cb.matches)),
+		RulesVersion: s.info.Version,
+	}
+	for _, m := range cb.matches {
+		result.Matches = append(result.Matches, convertMatch(m))
+	}
+	return result, nil
+}
+
+func (s *nativeScanner) Info() RulesetInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.info
+}
+
+func (s *nativeScanner) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rules != nil {
+		s.rules.Destroy()
+		s.rules = nil
+	}
+	return nil
+}
+
+// matchCollector gathers matches and aborts the scan once ctx is done.
+type matchCollector struct {
+	ctx     context.Context
+	matches yara.MatchRules
+}
+
+func (c *matchCollector) RuleMatching(sc *yara.ScanContext, r *yara.Rule) (bool, error) {
+	if err := c.ctx.Err(); err != nil {
+		return true, err
+	}
+	return c.matches.RuleMatching(sc, r)
+}
+
+func convertMatch(m yara.MatchRule) domain.YaraMatch {
+	match := domain.YaraMatch{
+		Rule:      m.Rule,
+		Namespace: m.Namespace,
+		Tags:      append([]string{}, m.Tags...),
+		Meta:      make(map[string]any, len(m.Metas)),
+		Strings:   make([]domain.YaraString, 0, len(m.Strings)),
+	}
+	for _, meta := range m.Metas {
+		if v, ok := meta.Value.(int); ok {
+			match.Meta[meta.Identifier] = int64(v)
+			continue
+		}
+		match.Meta[meta.Identifier] = meta.Value
+	}
+	for _, str := range m.Strings {
+		match.Strings = append(match.Strings, domain.YaraString{
+			Identifier: str.Name,
+			Offset:     str.Base + str.Offset,
+			Data:       str.Data,
+		})
+	}
+	return match
+}
+
+// compileError adds the compiler's per-line messages to err.
+func compileError(c *yara.Compiler, err error) error {
+	if len(c.Errors) == 0 {
+		return fmt.Errorf("yara compile failed: %w", err)
+	}
+	msgs := make([]string, 0, len(c.Errors))
+	for _, m := range c.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s:%d: %s", m.Filename, m.Line, m.Text))
+	}
+	return fmt.Errorf("yara compile failed: %s", strings.Join(msgs, "; "))
+}
@@ -0,0 +1,7 @@
+//go:build !yara
+
+package scanner
+
+func newNative(Config) (Scanner, error) {
+	return nil, ErrNativeUnavailable
+}
@@ -0,0 +1,272 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+const (
+	rulesetExt  = ".yar"
+	disabledDir = "disabled"
+)
+
+var (
+	ErrRulesetNotFound = errors.New("ruleset not found")
+	ErrInvalidName     = errors.New("ruleset names may only contain letters, digits, '-' and '_'")
+	// ErrRulesRejected wraps compile errors, both for a single upload and
+	// for the combined ruleset after a change.
+	ErrRulesRejected = errors.New("rules rejected")
+
+	rulesetName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	ruleDecl    = regexp.MustCompile(`(?m)^\s*(?:(?:private|global)\s+)*rule\s+([A-Za-z_][A-Za-z0-9_]*)`)
+)
+
+// Ruleset is one rule file managed by a RuleStore.
+type Ruleset struct {
+	Name      string    `json:"name"`
+	Enabled   bool      `json:"enabled"`
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	Rules     []string  `json:"rules"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// RuleStore manages the rule files a Scanner loads. Enabled rulesets live
+// in Dir as <name>.yar, disabled ones in Dir/disabled. Every change is
+// compiled before it lands and rolled back if the scanner cannot load the
+// result, so the live ruleset is never broken. Disabling or deleting the
+// last enabled ruleset is allowed and leaves the scanner at NoRules.
+type RuleStore struct {
+	Dir     string
+	Scanner Scanner
+
+	mu sync.Mutex
+}
+
+// List returns every ruleset, enabled or not, sorted by name.
+func (rs *RuleStore) List() ([]Ruleset, error) {
+	var out []Ruleset
+	for _, enabled := range []bool{true, false} {
+		entries, err := os.ReadDir(rs.dir(enabled))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		for _, e := range entries {
+			name, ok := strings.CutSuffix(e.Name(), rulesetExt)
+			if !ok || !e.Type().IsRegular() {
+				continue
+			}
+			r, _, err := rs.load(name, enabled)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// Get returns a ruleset and its source.
+func (rs *RuleStore) Get(name string) (Ruleset, []byte, error) {
+	if !rulesetName.MatchString(name) {
+		return Ruleset{}, nil, ErrInvalidName
+	}
+	for _, enabled := range []bool{true, false} {
+		r, src, err := rs.load(name, enabled)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return r, src, err
+	}
+	return Ruleset{}, nil, ErrRulesetNotFound
+}
+
+// Put creates or replaces a ruleset. New rulesets start enabled; replacing
+// a disabled one keeps it disabled.
+func (rs *RuleStore) Put(name string, source []byte) (Ruleset, error) {
+	if !rulesetName.MatchString(name) {
+		return Ruleset{}, ErrInvalidName
+	}
+	if err := rs.Scanner.Check(name, source); err != nil {
+		return Ruleset{}, fmt.Errorf("%w: %v", ErrRulesRejected, err)
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	enabled := true
+	if _, err := os.Stat(rs.path(name, false)); err == nil {
+		enabled = false
+	}
+	path := rs.path(name, enabled)
+	previous, err := os.ReadFile(path)
+	existed := err == nil
+
+	if err := writeAtomic(path, source); err != nil {
+		return Ruleset{}, err
+	}
+	if enabled {
+		if err := rs.Scanner.Reload(); err != nil {
+			if existed {
+				writeAtomic(path, previous)
+			} else {
+				os.Remove(path)
+			}
+			return Ruleset{}, fmt.Errorf("%w: %v", ErrRulesRejected, err)
+		}
+	}
+	r, _, err := rs.load(name, enabled)
+	return r, err
+}
+
+// SetEnabled moves a ruleset in or out of the live set.
+func (rs *RuleStore) SetEnabled(name string, enabled bool) (Ruleset, error) {
+	if !rulesetName.MatchString(name) {
+		return Ruleset{}, ErrInvalidName
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	from, to := rs.path(name, !enabled), rs.path(name, enabled)
+	if _, err := os.Stat(to); err == nil {
+		r, _, err := rs.load(name, enabled)
+		return r, err
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return Ruleset{}, err
+	}
+	if err := os.Rename(from, to); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Ruleset{}, ErrRulesetNotFound
+		}
+		return Ruleset{}, err
+	}
+	if err := rs.Scanner.Reload(); err != nil {
+		os.Rename(to, from)
+		return Ruleset{}, fmt.Errorf("%w: %v", ErrRulesRejected, err)
+	}
+	r, _, err := rs.load(name, enabled)
+	return r, err
+}
+
+// Delete removes a ruleset, enabled or not.
+func (rs *RuleStore) Delete(name string) error {
+	if !rulesetName.MatchString(name) {
+		return ErrInvalidName
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if err := os.Remove(rs.path(name, false)); err == nil {
+		return nil
+	}
+	path := rs.path(name, true)
+	source, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrRulesetNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if err := rs.Scanner.Reload(); err != nil {
+		writeAtomic(path, source)
+		return fmt.Errorf("%w: %v", ErrRulesRejected, err)
+	}
+	return nil
+}
+
+// Snapshot returns the sources of every enabled ruleset, for recording the
+// version the scanner currently runs.
+func (rs *RuleStore) Snapshot() ([]domain.YaraRuleset, error) {
+	files, err := ruleFiles(rs.Dir)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]domain.YaraRuleset, 0, len(files))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		out = append(out, domain.YaraRuleset{
+			Name:   filepath.Base(f),
+			SHA256: hex.EncodeToString(sum[:]),
+			Source: string(data),
+		})
+	}
+	return out, nil
+}
+
+func (rs *RuleStore) dir(enabled bool) string {
+	if enabled {
+		return rs.Dir
+	}
+	return filepath.Join(rs.Dir, disabledDir)
+}
+
+func (rs *RuleStore) path(name string, enabled bool) string {
+	return filepath.Join(rs.dir(enabled), name+rulesetExt)
+}
+
+func (rs *RuleStore) load(name string, enabled bool) (Ruleset, []byte, error) {
+	path := rs.path(name, enabled)
+	info, err := os.Stat(path)
+	if err != nil {
+		return Ruleset{}, nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Ruleset{}, nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	r := Ruleset{
+		Name:      name,
+		Enabled:   enabled,
+		SHA256:    hex.EncodeToString(sum[:]),
+		Size:      int64(len(data)),
+		Rules:     []string{},
+		UpdatedAt: info.ModTime(),
+	}
+	for _, m := range ruleDecl.FindAllSubmatch(data, -1) {
+		r.Rules = append(r.Rules, string(m[1]))
+	}
+	return r, data, nil
+}
+
+// writeAtomic replaces path so a concurrent Reload never reads a partial file.
+func writeAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".rules-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
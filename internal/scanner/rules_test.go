@@ -0,0 +1,99 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dirScanner loads whatever ruleFiles finds, without compiling anything.
+type dirScanner struct {
+	dir  string
+	info RulesetInfo
+}
+
+func (s *dirScanner) ScanFile(ctx context.Context, path string) (*Result, error) {
+	return &Result{RulesVersion: s.info.Version}, nil
+}
+
+func (s *dirScanner) Reload() error {
+	files, err := ruleFiles(s.dir)
+	if err != nil {
+		return err
+	}
+	s.info = RulesetInfo{Files: files, Version: Version(files)}
+	return nil
+}
+
+func (s *dirScanner) Info() RulesetInfo                        { return s.info }
+func (s *dirScanner) Check(namespace string, src []byte) error { return nil }
+func (s *dirScanner) Close() error                             { return nil }
+
+func TestRuleStoreNoRules(t *testing.T) {
+	dir := t.TempDir()
+	s := &dirScanner{dir: dir}
+	store := &RuleStore{Dir: dir, Scanner: s}
+
+	if _, err := store.Put("only", []byte("rule a { condition: true }")); err != nil {
+		t.Fatal(err)
+	}
+	if s.info.Version == NoRules || len(s.info.Files) != 1 {
+		t.Fatalf("after Put: %+v", s.info)
+	}
+
+	if _, err := store.SetEnabled("only", false); err != nil {
+		t.Fatalf("disabling the last ruleset: %v", err)
+	}
+	if s.info.Version != NoRules || len(s.info.Files) != 0 {
+		t.Errorf("with nothing enabled: %+v, want version %s", s.info, NoRules)
+	}
+	snap, err := store.Snapshot()
+	if err != nil || len(snap) != 0 {
+		t.Errorf("Snapshot() = %v, %v, want nothing", snap, err)
+	}
+
+	if _, err := store.SetEnabled("only", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("only"); err != nil {
+		t.Fatalf("deleting the last ruleset: %v", err)
+	}
+	if s.info.Version != NoRules {
+		t.Errorf("after Delete: version %s, want %s", s.info.Version, NoRules)
+	}
+}
+
+func TestRuleFilesMatchStore(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.yar", "a.yar", "c.yara", "d.txt", ".rules-tmp"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("rule x { condition: true }"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Mkdir(filepath.Join(dir, disabledDir), 0755)
+
+	files, err := ruleFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &RuleStore{Dir: dir}
+	listed, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := store.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a", "b"}
+	if len(files) != len(want) || len(listed) != len(want) || len(snap) != len(want) {
+		t.Fatalf("scanner loads %v, List has %d, Snapshot has %d; want %v in each", files, len(listed), len(snap), want)
+	}
+	for i, name := range want {
+		if filepath.Base(files[i]) != name+rulesetExt || listed[i].Name != name || snap[i].Name != name+rulesetExt {
+			t.Errorf("entry %d: scanner %s, List %s, Snapshot %s; want %s", i, files[i], listed[i].Name, snap[i].Name, name)
+		}
+	}
+}
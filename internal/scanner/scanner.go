@@ -0,0 +1,165 @@
+package scanner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+// Scan engines reported in RulesetInfo.Engine.
+const (
+	EngineLibyara = "libyara"
+	EngineCLI     = "yara-cli"
+)
+
+// NoRules is the ruleset version while no rule file is enabled. Scans
+// still run and report no matches.
+const NoRules = "none"
+
+// ErrNativeUnavailable is returned when the binary was built without the
+// yara build tag, so only the CLI engine exists.
+var ErrNativeUnavailable = errors.New("built without libyara support")
+
+// Scanner matches files against a compiled YARA ruleset. Implementations
+// are safe for concurrent use; Reload swaps the ruleset atomically and keeps
+// the previous one if compilation fails.
+type Scanner interface {
+	ScanFile(ctx context.Context, path string) (*Result, error)
+	Reload() error
+	Info() RulesetInfo
+
+	// Check compiles source on its own, in namespace, without loading it.
+	Check(namespace string, source []byte) error
+	Close() error
+}
+
+// Result is one scan and the ruleset version it ran against.
+type Result struct {
+	Matches      []domain.YaraMatch `json:"matches"`
+	RulesVersion string             `json:"rulesVersion"`
+}
+
+// Config selects the rules and limits for a Scanner.
+type Config struct {
+	RulesDir string        // every *.yar file, one namespace per file
+	Timeout  time.Duration // per scan; defaults to one minute
+	CacheDir string        // where the CLI engine keeps compiled rules
+}
+
+// RulesetInfo describes the ruleset currently in use.
+type RulesetInfo struct {
+	Engine   string    `json:"engine"`
+	Files    []string  `json:"files"`
+	Version  string    `json:"version"` // content hash of Files
+	LoadedAt time.Time `json:"loadedAt"`
+}
+
+// New returns the libyara scanner when it is compiled in and the CLI
+// fallback otherwise. Rules are compiled before New returns.
+func New(cfg Config) (Scanner, error) {
+	s, err := newNative(cfg)
+	if err == nil {
+		return s, nil
+	}
+	if !errors.Is(err, ErrNativeUnavailable) {
+		return nil, err
+	}
+	return NewCLI(cfg)
+}
+
+// Watch reloads s whenever a rule file under rulesDir is added, removed or
+// modified, and calls onReload, if set, after each successful reload. It
+// polls every interval and returns when ctx is done.
+func Watch(ctx context.Context, s Scanner, rulesDir string, interval time.Duration, onReload func(RulesetInfo)) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		files, err := ruleFiles(rulesDir)
+		if err != nil {
+			log.Printf("yara rules not readable: dir=%s err=%v", rulesDir, err)
+			continue
+		}
+		if Version(files) == s.Info().Version {
+			continue
+		}
+		if err := s.Reload(); err != nil {
+			log.Printf("yara reload failed, keeping previous rules: %v", err)
+			continue
+		}
+		info := s.Info()
+		log.Printf("yara rules reloaded: files=%d version=%s", len(files), info.Version)
+		if onReload != nil {
+			onReload(info)
+		}
+	}
+}
+
+func (cfg Config) timeout() time.Duration {
+	if cfg.Timeout <= 0 {
+		return time.Minute
+	}
+	return cfg.Timeout
+}
+
+// ruleFiles lists the rule sources in dir in a stable order. It takes the
+// same files a RuleStore manages, and an empty list is not an error.
+func ruleFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasSuffix(e.Name(), rulesetExt) {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// namespace is the YARA namespace for a rule file: its base name without
+// the extension.
+func namespace(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// Version identifies a ruleset by the names and contents of its files, so
+// the same rules always get the same version wherever they live.
+func Version(files []string) string {
+	if len(files) == 0 {
+		return NoRules
+	}
+	h := sha256.New()
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			fmt.Fprintf(h, "%s\x00missing\n", filepath.Base(f))
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00%d\n", filepath.Base(f), len(data))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
@@ -0,0 +1,143 @@
+package similarity
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/database"
+	"github.com/sudankdk/firecracker/internal/hashing"
+)
+
+const (
+	gramSize       = 7 // ssdeep only scores digests sharing a 7-character run
+	tlshBandWidth  = 4 // bytes of TLSH code per band key
+	maxCandidates  = 500
+	backfillBatch  = 500
+	backfillPause  = 50 * time.Millisecond
+	DefaultMinimum = 40
+
+	// noKeys marks a sample whose digests are too short to index, so the
+	// backfill does not revisit it
+	noKeys = "-"
+)
+
+// Match is a stored sample similar to the query. Score is the better of
+// the ssdeep score and the TLSH distance mapped onto 0-100.
+type Match struct {
+	Hash         string        `json:"hash"`
+	Score        int           `json:"score"`
+	SSDeepScore  int           `json:"ssdeepScore"`
+	TLSHDistance *int          `json:"tlshDistance,omitempty"`
+	Job          *database.Job `json:"job"` // newest job for the sample
+}
+
+// Keys lists the index keys for a sample's fuzzy hashes: every 7-character
+// run of each ssdeep part, tagged with the block size it was taken at, and
+// the TLSH code split into bands. Two samples can only score above zero
+// if they share at least one ssdeep key.
+func Keys(ssdeep, tlsh string) []string {
+	var keys []string
+	if bs, part1, part2, err := hashing.SSDeepParts(ssdeep); err == nil {
+		keys = appendGrams(keys, bs, part1)
+		keys = appendGrams(keys, bs*2, part2)
+	}
+	if bands, err := hashing.TLSHBands(tlsh, tlshBandWidth); err == nil {
+		for i, band := range bands {
+			keys = append(keys, fmt.Sprintf("t:%d:%s", i, band))
+		}
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+func appendGrams(keys []string, blockSize uint64, part string) []string {
+	for i := 0; i+gramSize <= len(part); i++ {
+		keys = append(keys, fmt.Sprintf("s:%d:%s", blockSize, part[i:i+gramSize]))
+	}
+	return keys
+}
+
+// Index adds a sample to the similarity index.
+func Index(hash, ssdeep, tlsh string) error {
+	keys := Keys(ssdeep, tlsh)
+	if len(keys) == 0 {
+		keys = []string{noKeys}
+	}
+	return database.IndexSimilarity(hash, keys)
+}
+
+// Search ranks stored samples by similarity to the given digests, keeping
+// those scoring at least minScore.
+func Search(hash, ssdeep, tlsh string, minScore, limit int) ([]Match, error) {
+	candidates, err := database.SimilarityCandidates(Keys(ssdeep, tlsh), hash, maxCandidates)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(candidates))
+	for i, c := range candidates {
+		hashes[i] = c.Hash
+	}
+	jobs, err := database.LatestJobs(hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []Match{}
+	for _, h := range hashes {
+		job, ok := jobs[h]
+		if !ok {
+			continue
+		}
+		m := Match{Hash: h, Job: &job}
+		if ssdeep != "" && job.SSDeep != "" {
+			m.SSDeepScore, _ = hashing.CompareSSDeep(ssdeep, job.SSDeep)
+		}
+		m.Score = m.SSDeepScore
+		if tlsh != "" && job.TLSH != "" {
+			if d, err := hashing.TLSHDistance(tlsh, job.TLSH); err == nil {
+				m.TLSHDistance = &d
+				m.Score = max(m.Score, 100-min(d, 100))
+			}
+		}
+		if m.Score >= minScore {
+			matches = append(matches, m)
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b Match) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// Backfill indexes samples recorded before the index existed. It works in
+// small batches so it can run alongside uploads.
+func Backfill() {
+	indexed := 0
+	for {
+		jobs, err := database.UnindexedJobs(backfillBatch)
+		if err != nil {
+			log.Printf("similarity backfill failed: %v", err)
+			return
+		}
+		if len(jobs) == 0 {
+			break
+		}
+		for _, job := range jobs {
+			if err := Index(job.Hash, job.SSDeep, job.TLSH); err != nil {
+				log.Printf("similarity backfill failed: hash=%s err=%v", job.Hash, err)
+				return
+			}
+			indexed++
+		}
+		time.Sleep(backfillPause)
+	}
+	if indexed > 0 {
+		log.Printf("similarity index backfilled: samples=%d", indexed)
+	}
+}
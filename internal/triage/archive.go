@@ -0,0 +1,116 @@
+package triage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+const maxArchiveEntries = 1000
+
+// ArchiveAnalyzer lists the members of ZIP, tar and gzip files, including
+// tar inside gzip. Other archive kinds are identified but not opened.
+type ArchiveAnalyzer struct{}
+
+func (ArchiveAnalyzer) Name() string { return "archive" }
+
+func (ArchiveAnalyzer) Analyze(ctx context.Context, s *Sample, r *domain.StaticReport) error {
+	switch r.FileType.Kind {
+	case KindZIP:
+		return listZIP(s, r)
+	case KindTar, KindGzip:
+	case Kind7z, KindRAR, KindCAB, KindBzip2, KindXZ, KindZstd, KindISO:
+		r.Archive = &domain.ArchiveInfo{Format: r.FileType.Kind}
+		return nil
+	default:
+		return nil
+	}
+
+	f, err := s.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var src io.Reader = f
+	format := KindTar
+	if r.FileType.Kind == KindGzip {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		// Only the first member's header is needed to tell tar.gz apart
+		header := make([]byte, 512)
+		n, _ := io.ReadFull(gz, header)
+		if DetectType(header[:n], int64(n)).Kind != KindTar {
+			r.Archive = &domain.ArchiveInfo{
+				Format:  KindGzip,
+				Entries: []domain.ArchiveEntry{{Name: gz.Name}},
+			}
+			return nil
+		}
+		src = io.MultiReader(bytes.NewReader(header[:n]), gz)
+		format = "tar.gz"
+	}
+	return listTar(ctx, src, format, r)
+}
+
+func listZIP(s *Sample, r *domain.StaticReport) error {
+	zr, err := zip.OpenReader(s.Path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	info := &domain.ArchiveInfo{Format: KindZIP, Entries: []domain.ArchiveEntry{}}
+	for _, f := range zr.File {
+		encrypted := f.Flags&0x1 != 0
+		info.Encrypted = info.Encrypted || encrypted
+		if len(info.Entries) == maxArchiveEntries {
+			info.Truncated = true
+			continue
+		}
+		info.Entries = append(info.Entries, domain.ArchiveEntry{
+			Name:       f.Name,
+			Size:       int64(f.UncompressedSize64),
+			Compressed: int64(f.CompressedSize64),
+			Dir:        f.FileInfo().IsDir(),
+			Encrypted:  encrypted,
+		})
+	}
+	r.Archive = info
+	return nil
+}
+
+func listTar(ctx context.Context, src io.Reader, format string, r *domain.StaticReport) error {
+	info := &domain.ArchiveInfo{Format: format, Entries: []domain.ArchiveEntry{}}
+	r.Archive = info
+	tr := tar.NewReader(src)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(info.Entries) == maxArchiveEntries {
+			info.Truncated = true
+			return nil
+		}
+		info.Entries = append(info.Entries, domain.ArchiveEntry{
+			Name: h.Name,
+			Size: h.Size,
+			Dir:  h.Typeflag == tar.TypeDir,
+		})
+	}
+}
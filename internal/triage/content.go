@@ -0,0 +1,178 @@
+package triage
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+const (
+	minStringLen  = 6
+	maxStringLen  = 4096
+	maxIndicators = 100
+	stringScanMax = 64 << 20 // strings are only pulled from the first 64 MiB
+)
+
+var (
+	urlPattern  = regexp.MustCompile(`(?i)\b(?:https?|ftp)://[a-z0-9\-._~:/?#\[\]@!$&'()*+,;=%]+`)
+	ipv4Pattern = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+)
+
+// ContentAnalyzer reads the whole file once for its byte entropy and the
+// URLs and IPv4 addresses in its ASCII and UTF-16LE strings.
+type ContentAnalyzer struct{}
+
+func (ContentAnalyzer) Name() string { return "content" }
+
+func (ContentAnalyzer) Analyze(ctx context.Context, s *Sample, r *domain.StaticReport) error {
+	f, err := s.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var hist histogram
+	ex := newExtractor()
+	br := bufio.NewReaderSize(f, 64<<10)
+	buf := make([]byte, 64<<10)
+	var read int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := br.Read(buf)
+		hist.add(buf[:n])
+		if read < stringScanMax {
+			ex.feed(buf[:min(int64(n), stringScanMax-read)])
+		}
+		read += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	ex.flush()
+
+	r.Entropy = hist.entropy()
+	r.URLs = ex.urls
+	r.IPs = ex.ips
+	return nil
+}
+
+type histogram struct {
+	counts [256]uint64
+	total  uint64
+}
+
+func (h *histogram) add(p []byte) {
+	for _, b := range p {
+		h.counts[b]++
+	}
+	h.total += uint64(len(p))
+}
+
+// entropy is the Shannon entropy in bits per byte, 0 to 8.
+func (h *histogram) entropy() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	var e float64
+	for _, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / float64(h.total)
+		e -= p * math.Log2(p)
+	}
+	return math.Round(e*1000) / 1000
+}
+
+// extractor pulls printable runs out of a byte stream, both plain ASCII and
+// UTF-16LE, and keeps the indicators found in them.
+type extractor struct {
+	ascii    []byte
+	wide     []byte
+	wantZero bool // the last wide character still needs its 0x00 byte
+	urls     []string
+	ips      []string
+	seen     map[string]bool
+}
+
+func newExtractor() *extractor {
+	return &extractor{seen: make(map[string]bool)}
+}
+
+func printable(b byte) bool { return b >= 0x20 && b < 0x7f || b == '\t' }
+
+func (e *extractor) feed(p []byte) {
+	for _, b := range p {
+		if printable(b) {
+			if len(e.ascii) < maxStringLen {
+				e.ascii = append(e.ascii, b)
+			}
+		} else {
+			e.emit(e.ascii)
+			e.ascii = e.ascii[:0]
+		}
+
+		switch {
+		case e.wantZero && b == 0:
+			e.wantZero = false
+		case !e.wantZero && printable(b):
+			if len(e.wide) < maxStringLen {
+				e.wide = append(e.wide, b)
+			}
+			e.wantZero = true
+		default:
+			e.emit(e.wide)
+			e.wide = e.wide[:0]
+			e.wantZero = false
+			if printable(b) {
+				e.wide = append(e.wide, b)
+				e.wantZero = true
+			}
+		}
+	}
+}
+
+func (e *extractor) flush() {
+	e.emit(e.ascii)
+	e.emit(e.wide)
+	e.ascii, e.wide = e.ascii[:0], e.wide[:0]
+}
+
+func (e *extractor) emit(run []byte) {
+	if len(run) < minStringLen {
+		return
+	}
+	s := string(run)
+	if len(e.urls) < maxIndicators {
+		for _, u := range urlPattern.FindAllString(s, -1) {
+			e.add(&e.urls, strings.TrimRight(u, ".,;:'\")]"))
+		}
+	}
+	if len(e.ips) < maxIndicators {
+		for _, ip := range ipv4Pattern.FindAllString(s, -1) {
+			if parsed := net.ParseIP(ip); parsed != nil && !parsed.IsUnspecified() &&
+				!parsed.IsMulticast() && !parsed.Equal(net.IPv4bcast) {
+				e.add(&e.ips, ip)
+			}
+		}
+	}
+}
+
+func (e *extractor) add(list *[]string, v string) {
+	if e.seen[v] || len(*list) >= maxIndicators {
+		return
+	}
+	e.seen[v] = true
+	*list = append(*list, v)
+}
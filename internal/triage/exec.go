@@ -0,0 +1,359 @@
+package triage
+
+import (
+	"context"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+const (
+	maxImports         = 2000
+	packedEntropy      = 7.2  // code above this is likely packed or encrypted
+	packedMinSize      = 1024 // smaller sections give noisy entropy
+	maxSectionEntropy  = 64 << 20
+	imageFileDLL       = 0x2000
+	imageScnMemExecute = 0x20000000
+	imageScnMemRead    = 0x40000000
+	imageScnMemWrite   = 0x80000000
+	machoZerofill      = 0x1
+	machoSectionType   = 0xff
+)
+
+// ExecutableAnalyzer parses PE, ELF and Mach-O headers for sections,
+// imports and signs of packing.
+type ExecutableAnalyzer struct{}
+
+func (ExecutableAnalyzer) Name() string { return "executable" }
+
+func (ExecutableAnalyzer) Analyze(ctx context.Context, s *Sample, r *domain.StaticReport) error {
+	var parse func(io.ReaderAt) (*domain.ExecutableInfo, error)
+	switch r.FileType.Kind {
+	case KindPE:
+		if r.FileType.Description != "PE executable" {
+			return nil // bare DOS program
+		}
+		parse = func(ra io.ReaderAt) (*domain.ExecutableInfo, error) { return parsePE(ra, s.Size) }
+	case KindELF:
+		parse = parseELF
+	case KindMachO:
+		parse = parseMachO
+	default:
+		return nil
+	}
+
+	f, err := s.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := parse(f)
+	if err != nil {
+		return err
+	}
+	flagSections(info)
+	r.Executable = info
+	return nil
+}
+
+func parsePE(ra io.ReaderAt, size int64) (*domain.ExecutableInfo, error) {
+	f, err := pe.NewFile(ra)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info := &domain.ExecutableInfo{Format: "pe", Type: "exe", Bits: 32}
+	info.Arch = peMachines[f.Machine]
+	if info.Arch == "" {
+		info.Arch = fmt.Sprintf("0x%x", f.Machine)
+	}
+	if f.Characteristics&imageFileDLL != 0 {
+		info.Type = "dll"
+	}
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		info.EntryPoint = uint64(oh.ImageBase) + uint64(oh.AddressOfEntryPoint)
+	case *pe.OptionalHeader64:
+		info.Bits = 64
+		info.EntryPoint = oh.ImageBase + uint64(oh.AddressOfEntryPoint)
+	}
+	if f.TimeDateStamp != 0 {
+		ts := time.Unix(int64(f.TimeDateStamp), 0).UTC()
+		info.Timestamp = &ts
+		if ts.After(time.Now().Add(24 * time.Hour)) {
+			info.Anomalies = append(info.Anomalies, "link timestamp is in the future")
+		}
+	}
+
+	var end int64
+	for _, sec := range f.Sections {
+		flags := ""
+		if sec.Characteristics&imageScnMemRead != 0 {
+			flags += "r"
+		}
+		if sec.Characteristics&imageScnMemWrite != 0 {
+			flags += "w"
+		}
+		if sec.Characteristics&imageScnMemExecute != 0 {
+			flags += "x"
+		}
+		info.Sections = append(info.Sections, domain.Section{
+			Name:        sec.Name,
+			Size:        uint64(sec.Size),
+			VirtualSize: uint64(sec.VirtualSize),
+			Entropy:     readerEntropy(sec.Open(), int64(sec.Size)),
+			Flags:       flags,
+		})
+		end = max(end, int64(sec.Offset)+int64(sec.Size))
+	}
+	if end > 0 && size > end {
+		info.Overlay = size - end
+		info.Anomalies = append(info.Anomalies, fmt.Sprintf("%d bytes of overlay after the last section", info.Overlay))
+	}
+
+	// ImportedSymbols returns "symbol:library"
+	syms, err := f.ImportedSymbols()
+	if err != nil {
+		info.Anomalies = append(info.Anomalies, "import table unreadable: "+err.Error())
+	}
+	for _, s := range syms {
+		sym, lib, _ := strings.Cut(s, ":")
+		lib = strings.ToLower(lib)
+		if !slices.Contains(info.Libraries, lib) {
+			info.Libraries = append(info.Libraries, lib)
+		}
+		if len(info.Imports) < maxImports {
+			info.Imports = append(info.Imports, lib+"!"+sym)
+		}
+	}
+	if err == nil && len(syms) == 0 {
+		info.Anomalies = append(info.Anomalies, "no imports")
+	}
+	return info, nil
+}
+
+// Architectures are named as ELF names its machines, so Policy.GuestArch
+// means the same CPU whatever the format.
+var peMachines = map[uint16]string{
+	pe.IMAGE_FILE_MACHINE_I386:  "386",
+	pe.IMAGE_FILE_MACHINE_AMD64: "x86_64",
+	pe.IMAGE_FILE_MACHINE_ARM:   "arm",
+	pe.IMAGE_FILE_MACHINE_ARMNT: "arm",
+	pe.IMAGE_FILE_MACHINE_ARM64: "aarch64",
+	pe.IMAGE_FILE_MACHINE_IA64:  "ia_64",
+}
+
+var machoCPUs = map[macho.Cpu]string{
+	macho.Cpu386:   "386",
+	macho.CpuAmd64: "x86_64",
+	macho.CpuArm:   "arm",
+	macho.CpuArm64: "aarch64",
+	macho.CpuPpc:   "ppc",
+	macho.CpuPpc64: "ppc64",
+}
+
+func parseELF(ra io.ReaderAt) (*domain.ExecutableInfo, error) {
+	f, err := elf.NewFile(ra)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info := &domain.ExecutableInfo{
+		Format:     "elf",
+		Arch:       strings.ToLower(strings.TrimPrefix(f.Machine.String(), "EM_")),
+		Bits:       32,
+		EntryPoint: f.Entry,
+		Stripped:   f.Section(".symtab") == nil,
+	}
+	if f.Class == elf.ELFCLASS64 {
+		info.Bits = 64
+	}
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_INTERP {
+			b, err := io.ReadAll(io.LimitReader(p.Open(), 4096))
+			if err == nil {
+				info.Interpreter = strings.TrimRight(string(b), "\x00")
+			}
+		}
+	}
+	switch f.Type {
+	case elf.ET_EXEC:
+		info.Type = "executable"
+	case elf.ET_DYN:
+		info.Type = "shared object"
+		if info.Interpreter != "" {
+			info.Type = "pie executable"
+		}
+	case elf.ET_REL:
+		info.Type = "relocatable"
+	case elf.ET_CORE:
+		info.Type = "core dump"
+	default:
+		info.Type = f.Type.String()
+	}
+
+	for _, sec := range f.Sections {
+		if sec.Type == elf.SHT_NULL {
+			continue
+		}
+		flags := ""
+		if sec.Flags&elf.SHF_ALLOC != 0 {
+			flags += "r"
+		}
+		if sec.Flags&elf.SHF_WRITE != 0 {
+			flags += "w"
+		}
+		if sec.Flags&elf.SHF_EXECINSTR != 0 {
+			flags += "x"
+		}
+		s := domain.Section{Name: sec.Name, Size: sec.Size, Flags: flags}
+		if sec.Type != elf.SHT_NOBITS {
+			s.Entropy = readerEntropy(sec.Open(), int64(sec.Size))
+		}
+		info.Sections = append(info.Sections, s)
+	}
+	if len(f.Sections) == 0 {
+		info.Anomalies = append(info.Anomalies, "no section headers")
+	}
+
+	// Static binaries have no dynamic section; both calls then fail
+	if libs, err := f.ImportedLibraries(); err == nil {
+		info.Libraries = libs
+	}
+	if syms, err := f.ImportedSymbols(); err == nil {
+		for _, s := range syms[:min(len(syms), maxImports)] {
+			if s.Library != "" {
+				info.Imports = append(info.Imports, s.Library+"!"+s.Name)
+			} else {
+				info.Imports = append(info.Imports, s.Name)
+			}
+		}
+	}
+	return info, nil
+}
+
+func parseMachO(ra io.ReaderAt) (*domain.ExecutableInfo, error) {
+	var arches []string
+	f, err := macho.NewFile(ra)
+	if err != nil {
+		fat, ferr := macho.NewFatFile(ra)
+		if ferr != nil {
+			return nil, err
+		}
+		defer fat.Close()
+		if len(fat.Arches) == 0 {
+			return nil, fmt.Errorf("universal binary has no architectures")
+		}
+		for _, a := range fat.Arches {
+			arches = append(arches, machoArch(a.Cpu))
+		}
+		f = fat.Arches[0].File
+	} else {
+		defer f.Close()
+	}
+
+	info := &domain.ExecutableInfo{
+		Format:    "macho",
+		Arch:      machoArch(f.Cpu),
+		Bits:      32,
+		Universal: arches,
+	}
+	if f.Magic == macho.Magic64 {
+		info.Bits = 64
+	}
+	switch f.Type {
+	case macho.TypeExec:
+		info.Type = "executable"
+	case macho.TypeDylib:
+		info.Type = "dylib"
+	case macho.TypeBundle:
+		info.Type = "bundle"
+	case macho.TypeObj:
+		info.Type = "object"
+	default:
+		info.Type = f.Type.String()
+	}
+	info.Stripped = f.Symtab == nil || len(f.Symtab.Syms) == 0
+
+	for _, sec := range f.Sections {
+		s := domain.Section{Name: sec.Seg + "," + sec.Name, Size: sec.Size}
+		if sec.Flags&machoSectionType != machoZerofill {
+			s.Entropy = readerEntropy(sec.Open(), int64(sec.Size))
+		}
+		if seg := f.Segment(sec.Seg); seg != nil {
+			s.Flags = protFlags(seg.Prot)
+		}
+		info.Sections = append(info.Sections, s)
+	}
+
+	if libs, err := f.ImportedLibraries(); err == nil {
+		info.Libraries = libs
+	}
+	if syms, err := f.ImportedSymbols(); err == nil {
+		info.Imports = syms[:min(len(syms), maxImports)]
+	}
+	return info, nil
+}
+
+func machoArch(cpu macho.Cpu) string {
+	if arch, ok := machoCPUs[cpu]; ok {
+		return arch
+	}
+	return strings.ToLower(strings.TrimPrefix(cpu.String(), "Cpu"))
+}
+
+func protFlags(prot uint32) string {
+	flags := ""
+	if prot&1 != 0 {
+		flags += "r"
+	}
+	if prot&2 != 0 {
+		flags += "w"
+	}
+	if prot&4 != 0 {
+		flags += "x"
+	}
+	return flags
+}
+
+// flagSections notes sections that are writable and executable, or code
+// whose entropy suggests it is packed or encrypted. Compressed debug info
+// is routinely near 8 bits per byte, so only executable sections count.
+func flagSections(info *domain.ExecutableInfo) {
+	for _, s := range info.Sections {
+		exec := strings.Contains(s.Flags, "x")
+		if exec && strings.Contains(s.Flags, "w") {
+			info.Anomalies = append(info.Anomalies, "writable and executable section "+s.Name)
+		}
+		if exec && s.Entropy > packedEntropy && s.Size >= packedMinSize {
+			info.Anomalies = append(info.Anomalies, fmt.Sprintf("high entropy section %s (%.2f)", s.Name, s.Entropy))
+		}
+	}
+}
+
+// readerEntropy measures a section's contents, skipping ones too large or
+// unreadable to bother with.
+func readerEntropy(r io.Reader, size int64) float64 {
+	if size <= 0 || size > maxSectionEntropy {
+		return 0
+	}
+	var h histogram
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := r.Read(buf)
+		h.add(buf[:n])
+		if err != nil {
+			break
+		}
+	}
+	return h.entropy()
+}
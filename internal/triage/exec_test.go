@@ -0,0 +1,73 @@
+package triage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+// goTestdata reads a sample binary shipped with the Go source tree.
+func goTestdata(t *testing.T, pkg, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(runtime.GOROOT(), "src", "debug", pkg, "testdata", name))
+	if err != nil {
+		t.Skipf("Go testdata not available: %v", err)
+	}
+	if strings.HasSuffix(name, ".base64") {
+		data, err = base64.StdEncoding.DecodeString(string(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return data
+}
+
+// parseSample runs the parser for pkg's format over data.
+func parseSample(pkg string, data []byte) (*domain.ExecutableInfo, error) {
+	ra := bytes.NewReader(data)
+	switch pkg {
+	case "pe":
+		return parsePE(ra, int64(len(data)))
+	case "elf":
+		return parseELF(ra)
+	}
+	return parseMachO(ra)
+}
+
+func TestArchNamesAgree(t *testing.T) {
+	tests := []struct {
+		pkg, name, arch string
+	}{
+		{"pe", "gcc-amd64-mingw-exec", "x86_64"},
+		{"pe", "gcc-386-mingw-exec", "386"},
+		{"elf", "gcc-amd64-linux-exec", "x86_64"},
+		{"elf", "gcc-386-freebsd-exec", "386"},
+		{"macho", "gcc-amd64-darwin-exec.base64", "x86_64"},
+		{"macho", "gcc-386-darwin-exec.base64", "386"},
+	}
+	for _, tc := range tests {
+		info, err := parseSample(tc.pkg, goTestdata(t, tc.pkg, tc.name))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if info.Arch != tc.arch {
+			t.Errorf("%s: arch %q, want %q", tc.name, info.Arch, tc.arch)
+		}
+	}
+
+	info, err := parseSample("macho", goTestdata(t, "macho", "fat-gcc-386-amd64-darwin-exec.base64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(info.Universal, []string{"386", "x86_64"}) {
+		t.Errorf("universal binary arches %v, want [386 x86_64]", info.Universal)
+	}
+}
@@ -0,0 +1,152 @@
+package triage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+// File kinds reported by DetectType
+const (
+	KindEmpty  = "empty"
+	KindData   = "data"
+	KindText   = "text"
+	KindScript = "script"
+	KindPE     = "pe"
+	KindELF    = "elf"
+	KindMachO  = "macho"
+	KindClass  = "java-class"
+	KindDEX    = "dex"
+	KindZIP    = "zip"
+	KindGzip   = "gzip"
+	KindBzip2  = "bzip2"
+	KindXZ     = "xz"
+	KindZstd   = "zstd"
+	Kind7z     = "7z"
+	KindRAR    = "rar"
+	KindTar    = "tar"
+	KindCAB    = "cab"
+	KindISO    = "iso"
+	KindPDF    = "pdf"
+	KindOLE    = "ole"
+	KindRTF    = "rtf"
+	KindLNK    = "lnk"
+	KindPNG    = "png"
+	KindJPEG   = "jpeg"
+	KindGIF    = "gif"
+	KindBMP    = "bmp"
+	KindWebP   = "webp"
+)
+
+type magic struct {
+	offset int
+	bytes  string
+	kind   string
+	desc   string
+	mime   string
+}
+
+// magics are checked in order; the first match wins.
+var magics = []magic{
+	{0, "\x7fELF", KindELF, "ELF executable", "application/x-elf"},
+	{0, "\xfe\xed\xfa\xce", KindMachO, "Mach-O executable", "application/x-mach-binary"},
+	{0, "\xfe\xed\xfa\xcf", KindMachO, "Mach-O executable", "application/x-mach-binary"},
+	{0, "\xce\xfa\xed\xfe", KindMachO, "Mach-O executable", "application/x-mach-binary"},
+	{0, "\xcf\xfa\xed\xfe", KindMachO, "Mach-O executable", "application/x-mach-binary"},
+	{0, "dex\n", KindDEX, "Android DEX bytecode", "application/vnd.android.dex"},
+	{0, "PK\x03\x04", KindZIP, "ZIP archive", "application/zip"},
+	{0, "PK\x05\x06", KindZIP, "ZIP archive (empty)", "application/zip"},
+	{0, "\x1f\x8b", KindGzip, "gzip compressed data", "application/gzip"},
+	{0, "BZh", KindBzip2, "bzip2 compressed data", "application/x-bzip2"},
+	{0, "\xfd7zXZ\x00", KindXZ, "XZ compressed data", "application/x-xz"},
+	{0, "\x28\xb5\x2f\xfd", KindZstd, "Zstandard compressed data", "application/zstd"},
+	{0, "7z\xbc\xaf\x27\x1c", Kind7z, "7-Zip archive", "application/x-7z-compressed"},
+	{0, "Rar!\x1a\x07", KindRAR, "RAR archive", "application/vnd.rar"},
+	{0, "MSCF\x00\x00\x00\x00", KindCAB, "Microsoft Cabinet archive", "application/vnd.ms-cab-compressed"},
+	{257, "ustar", KindTar, "tar archive", "application/x-tar"},
+	{0x8001, "CD001", KindISO, "ISO 9660 disk image", "application/x-iso9660-image"},
+	{0, "%PDF-", KindPDF, "PDF document", "application/pdf"},
+	{0, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", KindOLE, "OLE2 compound document (Office, MSI)", "application/x-ole-storage"},
+	{0, "{\\rtf", KindRTF, "RTF document", "application/rtf"},
+	{0, "L\x00\x00\x00\x01\x14\x02\x00", KindLNK, "Windows shortcut", "application/x-ms-shortcut"},
+	{0, "\x89PNG\r\n\x1a\n", KindPNG, "PNG image", "image/png"},
+	{0, "\xff\xd8\xff", KindJPEG, "JPEG image", "image/jpeg"},
+	{0, "GIF87a", KindGIF, "GIF image", "image/gif"},
+	{0, "GIF89a", KindGIF, "GIF image", "image/gif"},
+}
+
+// DetectType identifies a file from its leading bytes.
+func DetectType(header []byte, size int64) domain.FileType {
+	if size == 0 {
+		return domain.FileType{Kind: KindEmpty, Description: "empty file", MIME: "application/x-empty"}
+	}
+	if isPE(header) {
+		return domain.FileType{Kind: KindPE, Description: "PE executable", MIME: "application/vnd.microsoft.portable-executable"}
+	}
+	if bytes.HasPrefix(header, []byte("MZ")) {
+		return domain.FileType{Kind: KindPE, Description: "DOS executable", MIME: "application/x-dosexec"}
+	}
+	if bytes.HasPrefix(header, []byte("\xca\xfe\xba\xbe")) && len(header) >= 8 {
+		// Fat Mach-O and Java classes share a magic; a fat header holds a
+		// small arch count where a class file has its version (45 and up)
+		if binary.BigEndian.Uint32(header[4:]) < 20 {
+			return domain.FileType{Kind: KindMachO, Description: "Mach-O universal binary", MIME: "application/x-mach-binary"}
+		}
+		return domain.FileType{Kind: KindClass, Description: "Java class file", MIME: "application/java-vm"}
+	}
+	for _, m := range magics {
+		end := m.offset + len(m.bytes)
+		if len(header) >= end && string(header[m.offset:end]) == m.bytes {
+			return domain.FileType{Kind: m.kind, Description: m.desc, MIME: m.mime}
+		}
+	}
+	if len(header) >= 26 && string(header[:2]) == "BM" && binary.LittleEndian.Uint32(header[14:]) <= 124 {
+		return domain.FileType{Kind: KindBMP, Description: "BMP image", MIME: "image/bmp"}
+	}
+	if len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WEBP" {
+		return domain.FileType{Kind: KindWebP, Description: "WebP image", MIME: "image/webp"}
+	}
+
+	mime := http.DetectContentType(header[:min(len(header), 512)])
+	if isText(header) {
+		if bytes.HasPrefix(header, []byte("#!")) {
+			line, _, _ := bytes.Cut(header[2:], []byte("\n"))
+			return domain.FileType{
+				Kind:        KindScript,
+				Description: "script for " + strings.TrimSpace(string(line)),
+				MIME:        "text/x-script",
+			}
+		}
+		return domain.FileType{Kind: KindText, Description: "text", MIME: mime}
+	}
+	return domain.FileType{Kind: KindData, Description: "data", MIME: mime}
+}
+
+// isPE checks for a DOS stub pointing at a PE signature.
+func isPE(h []byte) bool {
+	if len(h) < 0x40 || string(h[:2]) != "MZ" {
+		return false
+	}
+	off := int(binary.LittleEndian.Uint32(h[0x3c:]))
+	return off > 0 && off+4 <= len(h) && string(h[off:off+4]) == "PE\x00\x00"
+}
+
+// isText reports whether the header looks like UTF-8 text. A multibyte
+// rune cut off at the end of the header is allowed.
+func isText(h []byte) bool {
+	if bytes.IndexByte(h, 0) >= 0 {
+		return false
+	}
+	for len(h) > 0 {
+		r, size := utf8.DecodeRune(h)
+		if r == utf8.RuneError && size == 1 {
+			return len(h) < utf8.UTFMax && !utf8.FullRune(h)
+		}
+		h = h[size:]
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+package triage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+// headerSize covers every magic number checked, the deepest being the ISO
+// 9660 volume descriptor at 0x8001.
+const headerSize = 64 << 10
+
+// Sample is the file being triaged.
+type Sample struct {
+	Path   string
+	Size   int64
+	Header []byte // up to the first headerSize bytes
+}
+
+// Open returns the file for analyzers that need more than the header.
+func (s *Sample) Open() (*os.File, error) {
+	return os.Open(s.Path)
+}
+
+// Analyzer is one stage of static analysis. It adds what it finds to the
+// report; an error is recorded against the report without stopping later
+// stages.
+type Analyzer interface {
+	Name() string
+	Analyze(ctx context.Context, s *Sample, r *domain.StaticReport) error
+}
+
+// Pipeline runs analyzers in order. File type detection always runs first
+// so every analyzer can rely on r.FileType.
+type Pipeline struct {
+	Analyzers []Analyzer
+	Policy    Policy
+}
+
+// Default runs every built-in analyzer under DefaultPolicy.
+func Default() *Pipeline {
+	return &Pipeline{
+		Analyzers: []Analyzer{
+			ContentAnalyzer{},
+			ExecutableAnalyzer{},
+			ArchiveAnalyzer{},
+		},
+		Policy: DefaultPolicy(),
+	}
+}
+
+// Run analyzes the file at path. The report's Decision is left to Decide,
+// which also weighs the host YARA verdict.
+func (p *Pipeline) Run(ctx context.Context, path string) (*domain.StaticReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, headerSize)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+
+	s := &Sample{Path: path, Size: info.Size(), Header: header[:n]}
+	r := &domain.StaticReport{
+		FileType:   DetectType(s.Header, s.Size),
+		Size:       s.Size,
+		AnalyzedAt: time.Now(),
+	}
+	for _, a := range p.Analyzers {
+		if err := ctx.Err(); err != nil {
+			return r, err
+		}
+		if err := analyze(ctx, a, s, r); err != nil {
+			r.Errors = append(r.Errors, fmt.Sprintf("%s: %v", a.Name(), err))
+		}
+	}
+	return r, nil
+}
+
+// analyze runs one analyzer, turning a panic from a parser fed hostile
+// input into an error.
+func analyze(ctx context.Context, a Analyzer, s *Sample, r *domain.StaticReport) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return a.Analyze(ctx, s, r)
+}
+
+// Policy decides which files need a sandbox VM at all, and what the
+// guest does with the ones that do.
+type Policy struct {
+	MaxSize   int64    // larger files are rejected; 0 for no limit
+	Reject    []string // file kinds never analysed
+	Benign    []string // kinds finished without a VM when nothing else is suspicious
+	GuestArch string   // ELF machine the guest runs natively, e.g. "x86_64"
+}
+
+// DefaultPolicy skips empty files and plain images, and rejects nothing.
+func DefaultPolicy() Policy {
+	return Policy{
+		Benign:    []string{KindEmpty, KindPNG, KindJPEG, KindGIF, KindBMP, KindWebP},
+		GuestArch: "x86_64",
+	}
+}
+
+// Decide returns what to do with a triaged file and why. v is the host
+// YARA verdict, if the file was scanned; any match keeps the file on the
+// VM path.
+func (p Policy) Decide(r *domain.StaticReport, v *domain.Verdict) (decision, reason string) {
+	if slices.Contains(p.Reject, r.FileType.Kind) {
+		return domain.TriageReject, "file type " + r.FileType.Kind + " is not accepted"
+	}
+	if p.MaxSize > 0 && r.Size > p.MaxSize {
+		return domain.TriageReject, fmt.Sprintf("file is %d bytes, over the %d byte limit", r.Size, p.MaxSize)
+	}
+	if v != nil && v.Verdict != domain.VerdictClean {
+		return domain.TriageAnalyze, ""
+	}
+	if !slices.Contains(p.Benign, r.FileType.Kind) {
+		return domain.TriageAnalyze, ""
+	}
+	if r.FileType.Kind == KindEmpty {
+		return domain.TriageSkip, "empty file"
+	}
+	if len(r.URLs) > 0 || len(r.IPs) > 0 {
+		return domain.TriageAnalyze, ""
+	}
+	return domain.TriageSkip, r.FileType.Description + " with no embedded indicators"
+}
+
+// Plan is the guest's execution plan for a triaged file: ELF programs the
+// guest can run and scripts with an interpreter line are run, anything
+// else only scanned. A nil report, when triage failed, means scan.
+func (p Policy) Plan(r *domain.StaticReport) domain.ExecPlan {
+	if r == nil {
+		return domain.ExecPlan{Mode: domain.ExecScan, Reason: "file type unknown"}
+	}
+	switch r.FileType.Kind {
+	case KindScript:
+		return domain.ExecPlan{Mode: domain.ExecRun, Reason: r.FileType.Description}
+	case KindELF:
+		x := r.Executable
+		switch {
+		case x == nil:
+			return domain.ExecPlan{Mode: domain.ExecScan, Reason: "ELF headers did not parse"}
+		case x.Arch != p.GuestArch:
+			return domain.ExecPlan{Mode: domain.ExecScan, Reason: "ELF for " + x.Arch + ", guest is " + p.GuestArch}
+		case x.Type == "executable" || x.Type == "pie executable":
+			return domain.ExecPlan{Mode: domain.ExecRun, Reason: x.Type}
+		}
+		return domain.ExecPlan{Mode: domain.ExecScan, Reason: "ELF " + x.Type + " is not runnable"}
+	}
+	return domain.ExecPlan{Mode: domain.ExecScan, Reason: r.FileType.Description + " does not run in the guest"}
+}
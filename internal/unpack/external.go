@@ -0,0 +1,211 @@
+package unpack
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// decompressors handles single-stream formats Go has no reader for.
+var decompressors = map[string][]string{
+	"xz":   {"xz", "-dc"},
+	"zstd": {"zstd", "-dcq"},
+}
+
+// extractExternal hands formats the standard library cannot read to 7-Zip,
+// which can check sizes before writing anything and knows passwords, or
+// failing that to bsdtar, whose output is streamed through the writer so
+// limits still hold.
+func extractExternal(w *writer, path string, passwords []string) error {
+	if argv, ok := decompressors[w.res.Format]; ok {
+		return extractCommand(w, path, argv)
+	}
+	for _, name := range []string{"7zz", "7z", "7za"} {
+		if bin, err := exec.LookPath(name); err == nil {
+			return extract7z(w, bin, path, passwords)
+		}
+	}
+	if bin, err := exec.LookPath("bsdtar"); err == nil {
+		// Re-archive as tar on stdout; bsdtar cannot take a passphrase here
+		return extractPipe(w, exec.CommandContext(w.ctx, bin, "-c", "-f", "-", "@"+path), extractTar)
+	}
+	return fmt.Errorf("%w: %s needs 7z or bsdtar", ErrUnsupported, w.res.Format)
+}
+
+// extractCommand decompresses with an external tool and treats the output
+// the way extractStream treats gzip.
+func extractCommand(w *writer, path string, argv []string) error {
+	bin, err := exec.LookPath(argv[0])
+	if err != nil {
+		return fmt.Errorf("%w: %s needs %s", ErrUnsupported, w.res.Format, argv[0])
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	cmd := exec.CommandContext(w.ctx, bin, append(argv[1:], path)...)
+	return extractPipe(w, cmd, func(w *writer, r io.Reader) error {
+		return extractSniffed(w, r, name)
+	})
+}
+
+// extractPipe runs cmd and extracts from its stdout, killing it as soon as
+// extraction stops so a bomb is never fully expanded.
+func extractPipe(w *writer, cmd *exec.Cmd, extract func(*writer, io.Reader) error) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	err = extract(w, stdout)
+	cmd.Process.Kill()
+	werr := cmd.Wait()
+	if err != nil {
+		return err
+	}
+	if werr != nil && len(w.res.Members) == 0 {
+		return fmt.Errorf("%s: %s", filepath.Base(cmd.Path), firstLine(stderr.String(), werr))
+	}
+	return nil
+}
+
+func firstLine(s string, fallback error) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return fallback.Error()
+	}
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+type listed struct {
+	name      string
+	size      int64
+	encrypted bool
+}
+
+// extract7z lists the archive first and refuses anything over the limits
+// before 7-Zip writes a byte, then extracts to a scratch directory and moves
+// the files through the writer. Listing only needs the password when the
+// headers are encrypted, so each candidate is tried through extraction too
+// and kept once 7-Zip stops calling it wrong.
+func extract7z(w *writer, bin, path string, passwords []string) error {
+	scratch, err := os.MkdirTemp(w.dst, "7z-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(scratch)
+
+	var lastErr error
+	for i, pw := range append([]string{""}, passwords...) {
+		entries, err := list7z(w, bin, path, pw)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := w.fits(entries); err != nil {
+			return err
+		}
+		if pw == "" && slices.ContainsFunc(entries, func(e listed) bool { return e.encrypted }) {
+			// An empty -p makes 7-Zip prompt rather than fail
+			lastErr = errWrongPassword
+			continue
+		}
+
+		out := filepath.Join(scratch, strconv.Itoa(i))
+		cmd := exec.CommandContext(w.ctx, bin, "x", "-y", "-bd", "-p"+pw, "-o"+out, path)
+		if msg, err := cmd.CombinedOutput(); err != nil {
+			if wrongPassword(msg) {
+				os.RemoveAll(out)
+				lastErr = errWrongPassword
+				continue
+			}
+			w.skip("(archive)", firstLine(string(msg), err))
+		}
+		if pw != "" {
+			w.res.Password = pw
+		}
+		return w.addTree(out)
+	}
+	if errors.Is(lastErr, errWrongPassword) {
+		w.skip("(archive)", "encrypted with an unknown password")
+		return nil
+	}
+	return lastErr
+}
+
+// fits checks a listing against the limits left.
+func (w *writer) fits(entries []listed) error {
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+	if room, why := w.remaining(); total > room {
+		return fmt.Errorf("%w: %s", errLimit, why)
+	}
+	if len(entries) > w.budget.Files-len(w.res.Members) {
+		return fmt.Errorf("%w: file count limit", errLimit)
+	}
+	return nil
+}
+
+// addTree moves every regular file under dir through the writer.
+func (w *writer) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		name, _ := filepath.Rel(dir, p)
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return w.add(filepath.ToSlash(name), -1, f, nil)
+	})
+}
+
+// wrongPassword spots 7-Zip's complaints about a bad or missing password,
+// which it words differently per format and version.
+func wrongPassword(out []byte) bool {
+	return bytes.Contains(bytes.ToLower(out), []byte("wrong password"))
+}
+
+// list7z reads the technical listing; with encrypted headers it fails until
+// given the right password.
+func list7z(w *writer, bin, path, pw string) ([]listed, error) {
+	out, err := exec.CommandContext(w.ctx, bin, "l", "-slt", "-ba", "-p"+pw, path).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filepath.Base(bin), firstLine(string(out), err))
+	}
+	var entries []listed
+	var cur *listed
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		k, v, ok := strings.Cut(sc.Text(), " = ")
+		switch {
+		case !ok:
+		case k == "Path":
+			entries = append(entries, listed{name: v})
+			cur = &entries[len(entries)-1]
+		case k == "Size" && cur != nil:
+			cur.size, _ = strconv.ParseInt(v, 10, 64)
+		case k == "Encrypted" && cur != nil:
+			cur.encrypted = v == "+"
+		case k == "Folder" && v == "+" && cur != nil:
+			entries = entries[:len(entries)-1]
+			cur = nil
+		}
+	}
+	return entries, nil
+}
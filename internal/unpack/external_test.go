@@ -0,0 +1,77 @@
+package unpack
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fake7z stands in for 7-Zip: its listing shows one encrypted member
+// without asking for a password, as 7z does when only the data is
+// encrypted, and extraction only succeeds with "infected".
+const fake7z = `#!/bin/sh
+PATH=/usr/bin:/bin
+cmd=$1; shift
+pw=; out=
+for a in "$@"; do
+	case $a in
+	-p*) pw=${a#-p} ;;
+	-o*) out=${a#-o} ;;
+	esac
+done
+echo "$cmd $pw" >> "$(dirname "$0")/calls"
+case $cmd in
+l)
+	printf 'Path = sample.exe\nSize = 12\nFolder = -\nEncrypted = +\n\n'
+	;;
+x)
+	if [ "$pw" != infected ]; then
+		echo "ERROR: Wrong password : sample.exe"
+		exit 2
+	fi
+	mkdir -p "$out" && printf 'MZ fake body' > "$out/sample.exe"
+	;;
+esac
+`
+
+func TestExtract7zTriesEachPassword(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "7z"), []byte(fake7z), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	archive := filepath.Join(t.TempDir(), "sample.7z")
+	os.WriteFile(archive, []byte("7z\xbc\xaf\x27\x1c not really"), 0644)
+
+	cfg := DefaultConfig()
+	cfg.Passwords = []string{"malware", "infected", "virus"}
+	res, err := cfg.Extract(context.Background(), archive, "7z", t.TempDir(), Budget{Files: 10, Bytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Members) != 1 || res.Members[0].Name != "sample.exe" || res.Password != "infected" {
+		t.Fatalf("result %+v", res)
+	}
+	if len(res.Skipped) != 0 {
+		t.Errorf("skipped %v", res.Skipped)
+	}
+
+	calls, _ := os.ReadFile(filepath.Join(bin, "calls"))
+	// No extraction without a password, and none after the right one
+	want := "l \nl malware\nx malware\nl infected\nx infected\n"
+	if string(calls) != want {
+		t.Errorf("7z calls:\n%s\nwant:\n%s", calls, want)
+	}
+
+	cfg.Passwords = []string{"nope"}
+	res, err = cfg.Extract(context.Background(), archive, "7z", t.TempDir(), Budget{Files: 10, Bytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Members) != 0 || len(res.Skipped) != 1 || !strings.Contains(res.Skipped[0], "unknown password") {
+		t.Errorf("unknown password: %+v", res)
+	}
+}
@@ -0,0 +1,95 @@
+package unpack
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tarMagic sits at offset 257 of every POSIX and GNU tar header.
+const tarMagic = "ustar"
+
+// extractStream handles tar and single-stream compressors, unwrapping a tar
+// inside gzip or bzip2 in the same level.
+func extractStream(w *writer, path, kind string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var src io.Reader = f
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	switch kind {
+	case "gzip":
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		if gz.Name != "" {
+			name = gz.Name
+		}
+		src = gz
+	case "bzip2":
+		src = bzip2.NewReader(f)
+	}
+	if kind == "tar" {
+		return extractTar(w, src)
+	}
+	return extractSniffed(w, src, name)
+}
+
+// extractSniffed takes a decompressed stream as a tar if it looks like one,
+// otherwise as the single member name.
+func extractSniffed(w *writer, src io.Reader, name string) error {
+	br := bufio.NewReaderSize(src, 512)
+	header, _ := br.Peek(512)
+	if len(header) == 512 && string(header[257:257+len(tarMagic)]) == tarMagic {
+		w.res.Format += "+tar"
+		return extractTar(w, br)
+	}
+	err := w.add(name, -1, br, nil)
+	if isStreamCorrupt(err) {
+		w.skip(name, err.Error())
+		return nil
+	}
+	return err
+}
+
+func extractTar(w *writer, src io.Reader) error {
+	tr := tar.NewReader(src)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// A truncated tar still yields the members before the damage
+			w.skip("(rest of archive)", err.Error())
+			return nil
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		err = w.add(h.Name, h.Size, tr, nil)
+		if isStreamCorrupt(err) {
+			w.skip(h.Name, err.Error())
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func isStreamCorrupt(err error) bool {
+	var se bzip2.StructuralError
+	return isCorrupt(err) || errors.Is(err, gzip.ErrChecksum) || errors.Is(err, gzip.ErrHeader) || errors.As(err, &se)
+}
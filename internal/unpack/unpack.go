@@ -0,0 +1,217 @@
+package unpack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnsupported is returned for archive kinds Extract cannot open.
+	ErrUnsupported = errors.New("unsupported archive format")
+
+	// errLimit stops extraction once a Limits bound is reached; what was
+	// extracted before it is kept.
+	errLimit = errors.New("extraction limit reached")
+)
+
+// ratioFloor is how much an archive may expand to regardless of MaxRatio,
+// so small archives of compressible text are not taken for bombs.
+const ratioFloor = 1 << 20
+
+// Limits bound a whole tree of nested archives, not just one of them.
+type Limits struct {
+	MaxDepth      int   // nesting levels unpacked below the upload
+	MaxFiles      int   // members extracted across the tree
+	MaxMembers    int   // members extracted from any one archive
+	MaxTotalBytes int64 // bytes extracted across the tree
+	MaxFileBytes  int64 // largest single member
+	MaxRatio      int64 // bytes out per byte of archive, per archive
+}
+
+// Config enables recursive unpacking of uploads.
+type Config struct {
+	Limits    Limits
+	Passwords []string // tried in order on encrypted members
+	Timeout   time.Duration
+}
+
+// DefaultConfig tries the passwords malware archives are conventionally
+// shared with. Each member becomes a queued job, so MaxMembers stays well
+// under the scheduler's queue length.
+func DefaultConfig() Config {
+	return Config{
+		Limits: Limits{
+			MaxDepth:      3,
+			MaxFiles:      500,
+			MaxMembers:    32,
+			MaxTotalBytes: 1 << 30,
+			MaxFileBytes:  256 << 20,
+			MaxRatio:      100,
+		},
+		Passwords: []string{"infected", "malware", "virus", "password", "1234"},
+		Timeout:   2 * time.Minute,
+	}
+}
+
+// Budget is what is left of Limits for the tree an archive belongs to.
+type Budget struct {
+	Files int
+	Bytes int64
+}
+
+// Member is one extracted file. Path is a flat name under the destination
+// directory; Name is the member's path inside the archive.
+type Member struct {
+	Name string
+	Path string
+	Size int64
+}
+
+// Result describes one extraction, complete or not.
+type Result struct {
+	Format   string
+	Members  []Member
+	Bytes    int64
+	Password string   // the password that opened encrypted members
+	Skipped  []string // members not extracted, with the reason
+	Stopped  string   // the limit that ended extraction early
+}
+
+// Extract unpacks one level of the archive at path into dst, which must
+// exist. kind is the triage file kind. Nested archives come back as
+// ordinary members. A limit being reached is not an error: the result
+// holds what was extracted before it, with Stopped set.
+func (c Config) Extract(ctx context.Context, path, kind, dst string, budget Budget) (*Result, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	w := &writer{
+		ctx:      ctx,
+		limits:   c.Limits,
+		budget:   budget,
+		ratioCap: max(ratioFloor, c.Limits.MaxRatio*info.Size()),
+		dst:      dst,
+		res:      &Result{Format: kind},
+	}
+
+	switch kind {
+	case "zip":
+		err = extractZIP(w, path, c.Passwords)
+	case "tar", "gzip", "bzip2":
+		err = extractStream(w, path, kind)
+	case "7z", "rar", "xz", "zstd", "cab", "iso":
+		err = extractExternal(w, path, c.Passwords)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, kind)
+	}
+	if errors.Is(err, errLimit) {
+		w.res.Stopped = strings.TrimPrefix(err.Error(), errLimit.Error()+": ")
+		return w.res, nil
+	}
+	return w.res, err
+}
+
+// writer enforces Limits on everything an extractor writes out.
+type writer struct {
+	ctx      context.Context
+	limits   Limits
+	budget   Budget
+	ratioCap int64
+	dst      string
+	res      *Result
+}
+
+// remaining is how many more bytes may be written, and which limit says so.
+func (w *writer) remaining() (int64, string) {
+	n, why := w.budget.Bytes-w.res.Bytes, "total size limit"
+	if r := w.ratioCap - w.res.Bytes; r < n {
+		n, why = r, "expansion ratio limit (possible archive bomb)"
+	}
+	return n, why
+}
+
+func (w *writer) skip(name, reason string) {
+	w.res.Skipped = append(w.res.Skipped, name+": "+reason)
+}
+
+// add copies one member out of r. declared is the size the archive claims,
+// or -1; the copy is bounded regardless. check, if set, runs after the copy
+// and a failure discards the member.
+func (w *writer) add(name string, declared int64, r io.Reader, check func() error) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	if len(w.res.Members) >= w.budget.Files {
+		return fmt.Errorf("%w: file count limit", errLimit)
+	}
+	if w.limits.MaxMembers > 0 && len(w.res.Members) >= w.limits.MaxMembers {
+		return fmt.Errorf("%w: member limit per archive", errLimit)
+	}
+	if w.limits.MaxFileBytes > 0 && declared > w.limits.MaxFileBytes {
+		w.skip(name, "larger than the member size limit")
+		return nil
+	}
+	room, why := w.remaining()
+	if declared > room {
+		return fmt.Errorf("%w: %s", errLimit, why)
+	}
+	limit, limitWhy := room, why
+	if w.limits.MaxFileBytes > 0 && w.limits.MaxFileBytes < limit {
+		limit, limitWhy = w.limits.MaxFileBytes, "member size limit"
+	}
+
+	path := filepath.Join(w.dst, fmt.Sprintf("%06d", len(w.res.Members)))
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, io.LimitReader(r, limit+1))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > limit {
+		err = fmt.Errorf("%w: %s", errLimit, limitWhy)
+		if limitWhy == "member size limit" {
+			// Only this member is too big; carry on with the rest
+			os.Remove(path)
+			w.skip(name, "larger than the member size limit")
+			return nil
+		}
+	}
+	if err == nil && check != nil {
+		err = check()
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	w.res.Members = append(w.res.Members, Member{Name: name, Path: path, Size: n})
+	w.res.Bytes += n
+	return nil
+}
+
+// crcReader checksums what is read through it.
+type crcReader struct {
+	r   io.Reader
+	crc uint32
+}
+
+func (c *crcReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.crc = crc32.Update(c.crc, crc32.IEEETable, p[:n])
+	return n, err
+}
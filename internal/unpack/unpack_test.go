@@ -0,0 +1,57 @@
+package unpack
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeZip stores files, in order, in a new archive under t's temp dir.
+func writeZip(t *testing.T, files ...[2]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, file := range files {
+		w, err := zw.Create(file[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(file[1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMemberLimitPerArchive(t *testing.T) {
+	var files [][2]string
+	for i := range 5 {
+		files = append(files, [2]string{fmt.Sprintf("f%d.txt", i), "body"})
+	}
+	archive := writeZip(t, files...)
+
+	cfg := DefaultConfig()
+	cfg.Limits.MaxMembers = 3
+	res, err := cfg.Extract(context.Background(), archive, "zip", t.TempDir(), Budget{Files: 100, Bytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Members) != 3 || res.Stopped != "member limit per archive" {
+		t.Errorf("members=%d stopped=%q", len(res.Members), res.Stopped)
+	}
+
+	// The tree's own budget still applies below the per-archive cap
+	res, _ = cfg.Extract(context.Background(), archive, "zip", t.TempDir(), Budget{Files: 2, Bytes: 1 << 20})
+	if len(res.Members) != 2 || res.Stopped != "file count limit" {
+		t.Errorf("members=%d stopped=%q", len(res.Members), res.Stopped)
+	}
+}
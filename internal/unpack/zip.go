@@ -0,0 +1,305 @@
+package unpack
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	zipFlagEncrypted  = 0x1
+	zipFlagDescriptor = 0x8
+	zipMethodAES      = 99
+	zipExtraAES       = 0x9901
+)
+
+var errWrongPassword = errors.New("wrong password")
+
+func extractZIP(w *writer, path string, passwords []string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if f.Flags&zipFlagEncrypted == 0 {
+			if err := extractZIPFile(w, f); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := extractEncrypted(w, f, passwords); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractZIPFile(w *writer, f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		w.skip(f.Name, err.Error())
+		return nil
+	}
+	defer rc.Close()
+	err = w.add(f.Name, int64(f.UncompressedSize64), rc, nil)
+	if errors.Is(err, zip.ErrChecksum) || errors.Is(err, zip.ErrFormat) || isCorrupt(err) {
+		w.skip(f.Name, err.Error())
+		return nil
+	}
+	return err
+}
+
+// extractEncrypted tries each password on a ZipCrypto or WinZip AES member.
+// A password is only accepted once the whole member decrypts and checks
+// out, since the ZipCrypto header check passes one wrong password in 256.
+func extractEncrypted(w *writer, f *zip.File, passwords []string) error {
+	if w.res.Password != "" {
+		// Archives nearly always use one password for every member
+		passwords = append([]string{w.res.Password}, passwords...)
+	}
+	for _, pw := range passwords {
+		r, check, err := openEncrypted(f, pw)
+		if errors.Is(err, errWrongPassword) {
+			continue
+		}
+		if err != nil {
+			w.skip(f.Name, err.Error())
+			return nil
+		}
+		err = w.add(f.Name, int64(f.UncompressedSize64), r, check)
+		if errors.Is(err, errWrongPassword) || isCorrupt(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		w.res.Password = pw
+		return nil
+	}
+	w.skip(f.Name, "encrypted with an unknown password")
+	return nil
+}
+
+func isCorrupt(err error) bool {
+	var ce flate.CorruptInputError
+	return errors.As(err, &ce) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// openEncrypted returns the decrypted, decompressed member and a check to
+// run once it has been read to the end.
+func openEncrypted(f *zip.File, password string) (io.Reader, func() error, error) {
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, nil, err
+	}
+	method := f.Method
+	var plain io.Reader
+	var check func() error
+
+	if f.Method == zipMethodAES {
+		var aesCheck func() error
+		plain, aesCheck, method, err = openAES(f, raw, password)
+		if err != nil {
+			return nil, nil, err
+		}
+		check = aesCheck
+	} else {
+		plain, err = openZipCrypto(f, raw, password)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var data io.Reader
+	switch method {
+	case zip.Store:
+		data = plain
+	case zip.Deflate:
+		data = flate.NewReader(plain)
+	default:
+		return nil, nil, fmt.Errorf("compression method %d not supported", method)
+	}
+
+	// AE-2 members carry no CRC; their MAC stands in for it
+	cr := &crcReader{r: data}
+	return cr, func() error {
+		if check != nil {
+			if err := check(); err != nil {
+				return err
+			}
+			if f.CRC32 == 0 {
+				return nil
+			}
+		}
+		if cr.crc != f.CRC32 {
+			return errWrongPassword
+		}
+		return nil
+	}, nil
+}
+
+// PKWARE traditional encryption ("ZipCrypto")
+type zipCrypto struct{ k0, k1, k2 uint32 }
+
+func crcByte(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ crc>>8
+}
+
+func newZipCrypto(password string) *zipCrypto {
+	z := &zipCrypto{0x12345678, 0x23456789, 0x34567890}
+	for i := 0; i < len(password); i++ {
+		z.update(password[i])
+	}
+	return z
+}
+
+func (z *zipCrypto) update(c byte) {
+	z.k0 = crcByte(z.k0, c)
+	z.k1 = (z.k1+z.k0&0xff)*134775813 + 1
+	z.k2 = crcByte(z.k2, byte(z.k1>>24))
+}
+
+func (z *zipCrypto) Read(r io.Reader, p []byte) (int, error) {
+	n, err := r.Read(p)
+	for i := range p[:n] {
+		t := z.k2 | 2
+		p[i] ^= byte((t * (t ^ 1)) >> 8)
+		z.update(p[i])
+	}
+	return n, err
+}
+
+type zipCryptoReader struct {
+	r io.Reader
+	z *zipCrypto
+}
+
+func (r *zipCryptoReader) Read(p []byte) (int, error) { return r.z.Read(r.r, p) }
+
+func openZipCrypto(f *zip.File, raw io.Reader, password string) (io.Reader, error) {
+	zr := &zipCryptoReader{r: raw, z: newZipCrypto(password)}
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(zr, header); err != nil {
+		return nil, err
+	}
+	want := byte(f.CRC32 >> 24)
+	if f.Flags&zipFlagDescriptor != 0 {
+		want = byte(f.ModifiedTime >> 8)
+	}
+	if header[11] != want {
+		return nil, errWrongPassword
+	}
+	return zr, nil
+}
+
+// openAES decrypts a WinZip AE-1/AE-2 member and returns its real
+// compression method.
+func openAES(f *zip.File, raw io.Reader, password string) (io.Reader, func() error, uint16, error) {
+	strength, method, ok := aesExtra(f.Extra)
+	if !ok {
+		return nil, nil, 0, errors.New("AES member without its extra field")
+	}
+	keyLen := 8 + 8*int(strength) // 16, 24 or 32
+	saltLen := keyLen / 2
+	dataLen := int64(f.CompressedSize64) - int64(saltLen) - 2 - 10
+	if strength < 1 || strength > 3 || dataLen < 0 {
+		return nil, nil, 0, errors.New("malformed AES member")
+	}
+
+	head := make([]byte, saltLen+2)
+	if _, err := io.ReadFull(raw, head); err != nil {
+		return nil, nil, 0, err
+	}
+	dk, err := pbkdf2.Key(sha1.New, password, head[:saltLen], 1000, 2*keyLen+2)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if !bytes.Equal(dk[2*keyLen:], head[saltLen:]) {
+		return nil, nil, 0, errWrongPassword
+	}
+	block, err := aes.NewCipher(dk[:keyLen])
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	mac := hmac.New(sha1.New, dk[keyLen:2*keyLen])
+	body := io.TeeReader(io.LimitReader(raw, dataLen), mac)
+	plain := cipher.StreamReader{S: newWinZipCTR(block), R: body}
+
+	check := func() error {
+		return checkAESMAC(raw, mac)
+	}
+	return plain, check, method, nil
+}
+
+func checkAESMAC(raw io.Reader, mac hash.Hash) error {
+	want := make([]byte, 10)
+	if _, err := io.ReadFull(raw, want); err != nil {
+		return err
+	}
+	if !hmac.Equal(mac.Sum(nil)[:10], want) {
+		return errWrongPassword
+	}
+	return nil
+}
+
+func aesExtra(extra []byte) (strength byte, method uint16, ok bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			break
+		}
+		if id == zipExtraAES && size >= 7 {
+			data := extra[4 : 4+size]
+			return data[4], binary.LittleEndian.Uint16(data[5:]), true
+		}
+		extra = extra[4+size:]
+	}
+	return 0, 0, false
+}
+
+// winZipCTR is AES in counter mode with the little-endian counter, starting
+// at one, that WinZip uses instead of the standard big-endian one.
+type winZipCTR struct {
+	block cipher.Block
+	ctr   [aes.BlockSize]byte
+	ks    [aes.BlockSize]byte
+	pos   int
+}
+
+func newWinZipCTR(block cipher.Block) *winZipCTR {
+	return &winZipCTR{block: block, pos: aes.BlockSize}
+}
+
+func (c *winZipCTR) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.pos == aes.BlockSize {
+			for j := range c.ctr {
+				c.ctr[j]++
+				if c.ctr[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.ks[:], c.ctr[:])
+			c.pos = 0
+		}
+		dst[i] = src[i] ^ c.ks[c.pos]
+		c.pos++
+	}
+}
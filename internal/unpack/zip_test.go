@@ -0,0 +1,188 @@
+package unpack
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// extractWith unpacks archive trying passwords, and returns the result and
+// each member's contents.
+func extractWith(t *testing.T, archive string, passwords ...string) (*Result, []string) {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.Passwords = passwords
+	res, err := cfg.Extract(context.Background(), archive, "zip", t.TempDir(), Budget{Files: 100, Bytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bodies []string
+	for _, m := range res.Members {
+		data, err := os.ReadFile(m.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, string(data))
+	}
+	return res, bodies
+}
+
+// The ZipCrypto fixtures were written by Info-ZIP with password
+// "infected": zip -P infected, and for the stream one, input piped to
+// zip so the member has a data descriptor.
+func TestZipCrypto(t *testing.T) {
+	tests := []struct {
+		archive string
+		want    []string
+	}{
+		{"zipcrypto.zip", []string{"MZ first member of a ZipCrypto archive\n", "second member, stored\n"}},
+		{"zipcrypto-stream.zip", []string{"streamed through a pipe, so sizes follow in a data descriptor\n"}},
+	}
+	for _, tc := range tests {
+		archive := filepath.Join("testdata", tc.archive)
+
+		res, got := extractWith(t, archive, "1234", "infected", "malware")
+		if !slices.Equal(got, tc.want) || res.Password != "infected" || len(res.Skipped) != 0 {
+			t.Errorf("%s: got %q with password %q, skipped %v", tc.archive, got, res.Password, res.Skipped)
+		}
+
+		res, got = extractWith(t, archive, "1234", "malware")
+		if len(got) != 0 || len(res.Skipped) != len(tc.want) || res.Password != "" {
+			t.Errorf("%s with wrong passwords: got %q, skipped %v", tc.archive, got, res.Skipped)
+		}
+	}
+}
+
+// aesMember describes one WinZip AES member for writeAESZip.
+type aesMember struct {
+	name     string
+	content  string
+	password string
+	strength byte // 1, 2 or 3 for AES-128, 192 or 256
+	ae2      bool // AE-2 stores no CRC
+	deflate  bool
+}
+
+// writeAESZip builds a WinZip AES archive following the AE-x spec:
+// PBKDF2-HMAC-SHA1 with 1000 rounds gives the key, the MAC key and a
+// 2-byte verifier; data is AES-CTR with a little-endian counter from 1,
+// followed by the first 10 bytes of HMAC-SHA1 over the ciphertext.
+func writeAESZip(t *testing.T, members ...aesMember) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "aes.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+
+	for _, m := range members {
+		data, method := []byte(m.content), zip.Store
+		if m.deflate {
+			var b bytes.Buffer
+			fw, _ := flate.NewWriter(&b, flate.BestCompression)
+			fw.Write(data)
+			fw.Close()
+			data, method = b.Bytes(), zip.Deflate
+		}
+
+		keyLen := 8 + 8*int(m.strength)
+		salt := bytes.Repeat([]byte{0xa5}, keyLen/2)
+		dk, err := pbkdf2.Key(sha1.New, m.password, salt, 1000, 2*keyLen+2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err := aes.NewCipher(dk[:keyLen])
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc := make([]byte, len(data))
+		var ctr, ks [aes.BlockSize]byte
+		for i := range data {
+			if i%aes.BlockSize == 0 {
+				binary.LittleEndian.PutUint64(ctr[:], uint64(i/aes.BlockSize+1))
+				block.Encrypt(ks[:], ctr[:])
+			}
+			enc[i] = data[i] ^ ks[i%aes.BlockSize]
+		}
+		mac := hmac.New(sha1.New, dk[keyLen:2*keyLen])
+		mac.Write(enc)
+		body := slices.Concat(salt, dk[2*keyLen:], enc, mac.Sum(nil)[:10])
+
+		version := byte(1)
+		if m.ae2 {
+			version = 2
+		}
+		fh := &zip.FileHeader{
+			Name:               m.name,
+			Method:             zipMethodAES,
+			Flags:              zipFlagEncrypted,
+			Extra:              []byte{0x01, 0x99, 7, 0, version, 0, 'A', 'E', m.strength, byte(method), 0},
+			CompressedSize64:   uint64(len(body)),
+			UncompressedSize64: uint64(len(m.content)),
+		}
+		if !m.ae2 {
+			fh.CRC32 = crc32.ChecksumIEEE([]byte(m.content))
+		}
+		w, err := zw.CreateRaw(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(body)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWinZipAES(t *testing.T) {
+	long := string(bytes.Repeat([]byte("spans several AES blocks. "), 20))
+	archive := writeAESZip(t,
+		aesMember{name: "ae1-256.exe", content: "MZ" + long, password: "infected", strength: 3, deflate: true},
+		aesMember{name: "ae2-128.txt", content: "short", password: "infected", strength: 1, ae2: true},
+		aesMember{name: "ae2-192.bin", content: long, password: "infected", strength: 2, ae2: true, deflate: true},
+	)
+
+	res, got := extractWith(t, archive, "virus", "infected")
+	want := []string{"MZ" + long, "short", long}
+	if !slices.Equal(got, want) || res.Password != "infected" || len(res.Skipped) != 0 {
+		t.Errorf("got %d members with password %q, skipped %v", len(got), res.Password, res.Skipped)
+	}
+
+	res, got = extractWith(t, archive, "virus")
+	if len(got) != 0 || len(res.Skipped) != 3 {
+		t.Errorf("wrong password: got %d members, skipped %v", len(got), res.Skipped)
+	}
+}
+
+func TestWinZipAESBadMAC(t *testing.T) {
+	archive := writeAESZip(t, aesMember{name: "a.bin", content: "tampered", password: "infected", strength: 3, ae2: true})
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The MAC is the last 10 bytes of the member's data
+	at := bytes.Index(data, []byte("PK\x01\x02")) - 1
+	data[at] ^= 0xff
+	if err := os.WriteFile(archive, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, got := extractWith(t, archive, "infected")
+	if len(got) != 0 || len(res.Skipped) != 1 {
+		t.Errorf("bad MAC: got %q, skipped %v", got, res.Skipped)
+	}
+}
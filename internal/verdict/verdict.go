@@ -0,0 +1,246 @@
+package verdict
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+// Severities recognised in rule meta. Anything else counts as
+// DefaultSeverity.
+const (
+	SeverityInfo     = "info"
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// DefaultSeverity applies to rules, YARA or network, that do not state a
+// severity. It is low so that one unlabelled rule on its own leaves a file
+// clean.
+const DefaultSeverity = SeverityLow
+
+const maxScore = 100
+
+// Config maps rule severities to scores and scores to verdicts. Zero
+// fields take the defaults from DefaultConfig.
+type Config struct {
+	// Weights is the score a matching rule adds per severity, unless the
+	// rule sets its own score meta.
+	Weights map[string]int
+
+	// The total score, capped at 100, at or above which each verdict applies.
+	SuspiciousAt int
+	MaliciousAt  int
+	CriticalAt   int
+}
+
+// DefaultConfig scores info rules at zero, so a lone informational match
+// like Suspicious_EXE_Header leaves a file clean.
+func DefaultConfig() Config {
+	return Config{
+		Weights: map[string]int{
+			SeverityInfo:     0,
+			SeverityLow:      10,
+			SeverityMedium:   30,
+			SeverityHigh:     60,
+			SeverityCritical: 100,
+		},
+		SuspiciousAt: 20,
+		MaliciousAt:  60,
+		CriticalAt:   100,
+	}
+}
+
+func (c Config) withDefaults() Config {
+	d := DefaultConfig()
+	if c.Weights == nil {
+		c.Weights = d.Weights
+	}
+	if c.SuspiciousAt <= 0 {
+		c.SuspiciousAt = d.SuspiciousAt
+	}
+	if c.MaliciousAt <= 0 {
+		c.MaliciousAt = d.MaliciousAt
+	}
+	if c.CriticalAt <= 0 {
+		c.CriticalAt = d.CriticalAt
+	}
+	return c
+}
+
+// Evaluate parses each match's meta, sums the rule scores and maps the
+// total onto a verdict. A single critical rule is enough for critical.
+func (c Config) Evaluate(matches []domain.YaraMatch) *domain.Verdict {
+	rules := make([]domain.RuleWeight, 0, len(matches))
+	for _, m := range matches {
+		rules = append(rules, c.ParseRule(m))
+	}
+	return c.score(rules, len(matches))
+}
+
+// WithNetwork folds network signature hits into v, a YARA verdict or nil,
+// scoring each signature once by its severity as a YARA rule without a
+// score meta would be.
+func (c Config) WithNetwork(v *domain.Verdict, hits []domain.NetworkDetection) *domain.Verdict {
+	c = c.withDefaults()
+	var rules []domain.RuleWeight
+	matches := 0
+	if v != nil {
+		rules = append(rules, v.Rules...)
+		matches = v.Matches
+	}
+	scored := make(map[int]bool)
+	for _, h := range hits {
+		if scored[h.SID] {
+			continue
+		}
+		scored[h.SID] = true
+		sev := normalizeSeverity(h.Severity)
+		name := h.Rule
+		if name == "" {
+			name = fmt.Sprintf("sid:%d", h.SID)
+		}
+		rules = append(rules, domain.RuleWeight{
+			Rule:        name,
+			Namespace:   "network",
+			Severity:    sev,
+			Description: h.Classtype,
+			Score:       c.Weights[sev],
+		})
+	}
+	return c.score(rules, matches+len(scored))
+}
+
+// score sums rules into a verdict over matches matched rules. Every rule
+// is listed in the verdict, zero-scoring ones included, since a critical
+// rule decides the verdict whatever its score.
+func (c Config) score(rules []domain.RuleWeight, matches int) *domain.Verdict {
+	c = c.withDefaults()
+	v := &domain.Verdict{
+		Verdict:    domain.VerdictClean,
+		Matches:    matches,
+		Rules:      append([]domain.RuleWeight{}, rules...),
+		ComputedAt: time.Now(),
+	}
+
+	critical := false
+	for _, rw := range rules {
+		if rw.Severity == SeverityCritical {
+			critical = true
+		}
+		if rw.Score > 0 {
+			v.Score += rw.Score
+		}
+	}
+	v.Score = min(v.Score, maxScore)
+	sort.SliceStable(v.Rules, func(i, j int) bool { return v.Rules[i].Score > v.Rules[j].Score })
+
+	switch {
+	case critical || v.Score >= c.CriticalAt:
+		v.Verdict = domain.VerdictCritical
+	case v.Score >= c.MaliciousAt:
+		v.Verdict = domain.VerdictMalicious
+	case v.Score >= c.SuspiciousAt:
+		v.Verdict = domain.VerdictSuspicious
+	}
+	return v
+}
+
+// ParseRule reads severity, description, score, author, reference and
+// mitre_attack from a match's meta.
+func (c Config) ParseRule(m domain.YaraMatch) domain.RuleWeight {
+	c = c.withDefaults()
+	rw := domain.RuleWeight{
+		Rule:        m.Rule,
+		Namespace:   m.Namespace,
+		Severity:    normalizeSeverity(metaString(m.Meta, "severity")),
+		Description: metaString(m.Meta, "description"),
+		Author:      metaString(m.Meta, "author"),
+		References:  metaList(m.Meta, "reference"),
+		MitreAttack: metaList(m.Meta, "mitre_attack"),
+	}
+
+	if score, ok := metaInt(m.Meta, "score"); ok {
+		rw.Score = max(0, min(score, maxScore))
+	} else {
+		rw.Score = c.Weights[rw.Severity]
+	}
+	return rw
+}
+
+// Rank orders verdict labels from clean (0) to critical (3); unknown
+// labels rank as clean.
+func Rank(label string) int {
+	switch label {
+	case domain.VerdictSuspicious:
+		return 1
+	case domain.VerdictMalicious:
+		return 2
+	case domain.VerdictCritical:
+		return 3
+	}
+	return 0
+}
+
+// Worse returns whichever of two verdict labels is more severe.
+func Worse(a, b string) string {
+	if Rank(b) > Rank(a) {
+		return b
+	}
+	return a
+}
+
+func normalizeSeverity(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case SeverityInfo, SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical:
+		return s
+	case "informational":
+		return SeverityInfo
+	}
+	return DefaultSeverity
+}
+
+func metaString(meta map[string]any, key string) string {
+	switch v := meta[key].(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// metaInt accepts integer meta as well as numeric strings, since rule
+// authors write both score = 80 and score = "80".
+func metaInt(meta map[string]any, key string) (int, bool) {
+	switch v := meta[key].(type) {
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// metaList splits comma-separated meta such as mitre_attack = "T1055, T1059".
+func metaList(meta map[string]any, key string) []string {
+	var out []string
+	for _, part := range strings.Split(metaString(meta, key), ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,86 @@
+package verdict
+
+import (
+	"testing"
+
+	"github.com/sudankdk/firecracker/internal/domain"
+)
+
+func match(rule, severity string) domain.YaraMatch {
+	meta := map[string]any{}
+	if severity != "" {
+		meta["severity"] = severity
+	}
+	return domain.YaraMatch{Rule: rule, Namespace: "test", Meta: meta}
+}
+
+func TestMissingSeverity(t *testing.T) {
+	c := DefaultConfig()
+	for _, sev := range []string{"", "moderate"} {
+		rw := c.ParseRule(match("unlabelled", sev))
+		if rw.Severity != DefaultSeverity || rw.Score != c.Weights[DefaultSeverity] {
+			t.Errorf("severity %q: got %s scoring %d, want %s", sev, rw.Severity, rw.Score, DefaultSeverity)
+		}
+	}
+
+	// One unlabelled rule leaves a file clean; a second makes it suspicious
+	if v := c.Evaluate([]domain.YaraMatch{match("a", "")}); v.Verdict != domain.VerdictClean {
+		t.Errorf("one unlabelled rule: got %s (score %d), want clean", v.Verdict, v.Score)
+	}
+	if v := c.Evaluate([]domain.YaraMatch{match("a", ""), match("b", "")}); v.Verdict != domain.VerdictSuspicious {
+		t.Errorf("two unlabelled rules: got %s (score %d), want suspicious", v.Verdict, v.Score)
+	}
+
+	v := c.WithNetwork(nil, []domain.NetworkDetection{{SID: 1, Rule: "net"}})
+	if len(v.Rules) != 1 || v.Rules[0].Severity != DefaultSeverity {
+		t.Errorf("network hit without severity: got %+v", v.Rules)
+	}
+}
+
+func TestSeverityNames(t *testing.T) {
+	c := DefaultConfig()
+	tests := map[string]string{
+		"info":          SeverityInfo,
+		"Informational": SeverityInfo,
+		" HIGH ":        SeverityHigh,
+		"critical":      SeverityCritical,
+		"medium":        SeverityMedium,
+	}
+	for in, want := range tests {
+		if got := c.ParseRule(match("r", in)).Severity; got != want {
+			t.Errorf("severity %q: got %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestZeroScoreRulesListed(t *testing.T) {
+	c := DefaultConfig()
+	critical := match("Ransom_Note", "critical")
+	critical.Meta["score"] = int64(0)
+	v := c.Evaluate([]domain.YaraMatch{critical, match("Header", "info"), match("Packed", "medium")})
+
+	if v.Verdict != domain.VerdictCritical || v.Score != 30 {
+		t.Errorf("got %s scoring %d, want critical scoring 30", v.Verdict, v.Score)
+	}
+	var names []string
+	for _, rw := range v.Rules {
+		names = append(names, rw.Rule)
+	}
+	if len(names) != 3 || names[0] != "Packed" {
+		t.Errorf("rules %v: want all three, highest score first", names)
+	}
+
+	// The critical rule carries the verdict through the network fold
+	nv := c.WithNetwork(v, []domain.NetworkDetection{{SID: 7, Severity: "high"}, {SID: 7}})
+	if nv.Verdict != domain.VerdictCritical || len(nv.Rules) != 4 || nv.Matches != 4 {
+		t.Fatalf("with network: %s, %d rules over %d matches", nv.Verdict, len(nv.Rules), nv.Matches)
+	}
+	for _, rw := range nv.Rules {
+		if rw.Rule == "" {
+			t.Errorf("unnamed rule in the verdict: %+v", rw)
+		}
+	}
+	if nv.Rules[0].Rule != "sid:7" || nv.Rules[0].Namespace != "network" {
+		t.Errorf("network hit without a msg: got %+v, want it named by SID", nv.Rules[0])
+	}
+}
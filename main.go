@@ -1,254 +1,435 @@
-package main
-
-import (
-	"log"
-	"net/http"
-	"os"
-
-	handler "github.com/sudankdk/firecracker/internal/Handler"
-	"github.com/sudankdk/firecracker/internal/sandboxing"
-)
-
-// JobStatus is an alias for Job (for backwards compatibility)
-// type JobStatus = Job
-
-// func initDirectories() error {
-// 	dirs := []string{
-// 		"/mnt/d/firecracker/uploads",
-// 		"/mnt/d/firecracker/disks",
-// 		"/mnt/d/firecracker/mnt",
-// 	}
-
-// 	for _, dir := range dirs {
-// 		if err := os.MkdirAll(dir, 0755); err != nil {
-// 			return fmt.Errorf("failed to create directory %s: %w", dir, err)
-// 		}
-// 		log.Printf("Initialized directory: %s", dir)
-// 	}
-
-// 	// Initialize YARA environment
-// 	if err := PrepareYaraEnvironment(); err != nil {
-// 		log.Printf("Warning: YARA initialization failed: %v", err)
-// 	}
-
-// 	// Initialize database
-// 	if err := InitDatabase(); err != nil {
-// 		return fmt.Errorf("failed to initialize database: %w", err)
-// 	}
-
-// 	return nil
-// }
-
-// func jobStatusHandler(w http.ResponseWriter, r *http.Request) {
-// 	// Extract jobID from URL path: /jobs/{jobID}
-// 	path := strings.TrimPrefix(r.URL.Path, "/jobs/")
-// 	jobID := path
-
-// 	if jobID == "" {
-// 		http.Error(w, "Job ID required", 400)
-// 		return
-// 	}
-
-// 	job, err := GetJob(jobID)
-// 	if err != nil {
-// 		http.Error(w, "Job not found", 404)
-// 		return
-// 	}
-
-// 	w.Header().Set("Content-Type", "application/json")
-// 	json.NewEncoder(w).Encode(job)
-// }
-
-// func vmScanHandler(w http.ResponseWriter, r *http.Request) {
-// 	if r.Method != "POST" {
-// 		http.Error(w, "Method not allowed", 405)
-// 		return
-// 	}
-
-// 	// Extract jobID from URL path: /vm/scan/{jobID}
-// 	path := strings.TrimPrefix(r.URL.Path, "/vm/scan/")
-// 	jobID := path
-
-// 	if jobID == "" {
-// 		http.Error(w, "Job ID required", 400)
-// 		return
-// 	}
-
-// 	// Check if job exists
-// 	job, err := GetJob(jobID)
-// 	if err != nil {
-// 		http.Error(w, "Job not found", 404)
-// 		return
-// 	}
-
-// 	// Construct paths for VM
-// 	sock := fmt.Sprintf("/tmp/firecracker-%s.sock", jobID)
-// 	kernel := "/mnt/d/firecracker/hello-vmlinux.bin"
-// 	rootfs := "/mnt/d/firecracker/hello-rootfs.ext4"
-// 	inputDrive := fmt.Sprintf("/mnt/d/firecracker/disks/input-%s.ext4", jobID)
-
-// 	// Verify input drive exists
-// 	if _, err := os.Stat(inputDrive); os.IsNotExist(err) {
-// 		http.Error(w, "Disk image not found for job", 404)
-// 		return
-// 	}
-
-// 	log.Printf("Starting VM for job %s with input drive: %s", jobID, inputDrive)
-
-// 	// Start VM with input drive attached
-// 	if err := StartVM(sock, kernel, rootfs, inputDrive); err != nil {
-// 		http.Error(w, "Failed to start VM: "+err.Error(), 500)
-// 		UpdateJobStatus(jobID, "failed", job.ScanResult)
-// 		return
-// 	}
-
-// 	// Update job status
-// 	UpdateJobStatus(jobID, "running", "scanning...")
-
-// 	log.Printf("VM started successfully for job %s", jobID)
-
-// 	w.Header().Set("Content-Type", "application/json")
-// 	json.NewEncoder(w).Encode(map[string]string{
-// 		"status": "vm_started",
-// 		"jobID":  jobID,
-// 		"socket": sock,
-// 	})
-// }
-
-func main() {
-	// Initialize required directories
-	// if err := initDirectories(); err != nil {
-	// 	log.Fatalf("Failed to initialize directories: %v", err)
-	// }
-
-	// Register handlers
-	// http.HandleFunc("/upload", uploadHandler)   // From drives.go
-	// http.HandleFunc("/vm/scan/", vmScanHandler) // VM launch endpoint
-	// http.HandleFunc("/jobs/", func(w http.ResponseWriter, r *http.Request) {
-	// 	switch r.Method {
-	// 	case "DELETE":
-	// 		cleanupHandler(w, r)
-	// 	case "GET":
-	// 		jobStatusHandler(w, r)
-	// 	default:
-	// 		http.Error(w, "Method not allowed", 405)
-	// 	}
-	// })
-	// http.HandleFunc("/jobs", func(w http.ResponseWriter, r *http.Request) {
-	// 	// List all jobs
-	// 	jobs, err := GetAllJobs()
-	// 	if err != nil {
-	// 		http.Error(w, "Failed to retrieve jobs", 500)
-	// 		return
-	// 	}
-	// 	w.Header().Set("Content-Type", "application/json")
-	// 	json.NewEncoder(w).Encode(jobs)
-	// })
-
-	// // Legacy VM start endpoint (for testing)
-	// http.HandleFunc("/vm/start", func(w http.ResponseWriter, r *http.Request) {
-	// 	err := StartVM(
-	// 		"/tmp/firecracker.sock",
-	// 		"/mnt/d/firecracker/hello-vmlinux.bin",
-	// 		"/mnt/d/firecracker/hello-rootfs.ext4",
-	// 		"", // No input drive
-	// 	)
-	// 	if err != nil {
-	// 		http.Error(w, err.Error(), 500)
-	// 		return
-	// 	}
-	// 	w.Write([]byte("VM started"))
-	// })
-
-	// // New scan endpoint
-	// http.HandleFunc("/scan/", func(w http.ResponseWriter, r *http.Request) {
-	// 	path := strings.TrimPrefix(r.URL.Path, "/scan/")
-	// 	jobID := path
-
-	// 	if jobID == "" {
-	// 		http.Error(w, "Job ID required", 400)
-	// 		return
-	// 	}
-
-	// 	// Get existing results if available
-	// 	if r.Method == "GET" {
-	// 		result, err := GetYaraResults(jobID)
-	// 		if err != nil {
-	// 			http.Error(w, "Scan results not found", 404)
-	// 			return
-	// 		}
-	// 		w.Header().Set("Content-Type", "application/json")
-	// 		json.NewEncoder(w).Encode(result)
-	// 		return
-	// 	}
-
-	// 	//POST - trigger new scan
-	// 	if r.Method == "POST" {
-	// 		result, err := ScanFileWithYara(jobID)
-	// 		if err != nil {
-	// 			log.Printf("YARA scan error: %v", err)
-	// 		}
-
-	// 		// Update job status in database
-	// 		if result != nil {
-	// 			scanStatus := result.Status
-	// 			if result.MatchCount > 0 {
-	// 				scanStatus = fmt.Sprintf("%s (%d detections)", result.Status, result.MatchCount)
-	// 			}
-	// 			job, _ := GetJob(jobID)
-	// 			if job != nil {
-	// 				UpdateJobStatus(jobID, job.VMStatus, scanStatus)
-	// 			}
-	// 		}
-
-	// 		w.Header().Set("Content-Type", "application/json")
-	// 		json.NewEncoder(w).Encode(result)
-	// 		return
-	// 	}
-
-	// 	http.Error(w, "Method not allowed", 405)
-	// })
-
-	// // Stats endpoint
-	// http.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
-	// 	stats, err := GetJobStats()
-	// 	if err != nil {
-	// 		http.Error(w, "Failed to get stats", 500)
-	// 		return
-	// 	}
-	// 	w.Header().Set("Content-Type", "application/json")
-	// 	json.NewEncoder(w).Encode(stats)
-	// })
-
-	if err := os.MkdirAll("/tmp/uploads", 0755); err != nil {
-		log.Fatal(err)
-	}
-
-	if err := os.MkdirAll("/tmp/vms", 0755); err != nil {
-		log.Fatal(err)
-	}
-
-	vmManager := &sandboxing.VMManager{
-		BaseChrootDir:   "/tmp/vms",
-		BaseUploadDir:   "/tmp/uploads",
-		KernelPath:      "/mnt/d/firecracker/hello-vmlinux.bin",
-		RootfsPath:      "/mnt/d/firecracker/hello-rootfs.ext4",
-		JailerPath:      "/mnt/d/firecracker/release-v1.7.0-x86_64/jailer-v1.7.0-x86_64",
-		FirecrackerPath: "/mnt/d/firecracker/release-v1.7.0-x86_64/firecracker-v1.7.0-x86_64",
-		// BaseChrootDir:   "/srv/vms",
-		// BaseUploadDir:   "/srv/uploads",
-		// KernelPath:      "/mnt/d/firecracker/hello-vmlinux.bin",
-		// RootfsPath:      "/mnt/d/firecracker/hello-rootfs.ext4",
-		// JailerPath:      "/opt/firecracker/jailer",
-		// FirecrackerPath: "/opt/firecracker/firecracker",
-	}
-
-	uploadHandler := &handler.UploadHandler{
-		VM: vmManager,
-	}
-
-	http.Handle("/upload", uploadHandler)
-
-	log.Println("listening on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
-}
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	handler "github.com/sudankdk/firecracker/internal/Handler"
+	"github.com/sudankdk/firecracker/internal/database"
+	"github.com/sudankdk/firecracker/internal/netsig"
+	"github.com/sudankdk/firecracker/internal/quota"
+	"github.com/sudankdk/firecracker/internal/rescan"
+	"github.com/sudankdk/firecracker/internal/samples"
+	"github.com/sudankdk/firecracker/internal/sandboxing"
+	"github.com/sudankdk/firecracker/internal/scanner"
+	"github.com/sudankdk/firecracker/internal/similarity"
+	"github.com/sudankdk/firecracker/internal/triage"
+	"github.com/sudankdk/firecracker/internal/unpack"
+	"github.com/sudankdk/firecracker/internal/verdict"
+)
+
+// JobStatus is an alias for Job (for backwards compatibility)
+// type JobStatus = Job
+
+// func initDirectories() error {
+// 	dirs := []string{
+// 		"/mnt/d/firecracker/uploads",
+// 		"/mnt/d/firecracker/disks",
+// 		"/mnt/d/firecracker/mnt",
+// 	}
+
+// 	for _, dir := range dirs {
+// 		if err := os.MkdirAll(dir, 0755); err != nil {
+// 			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+// 		}
+// 		log.Printf("Initialized directory: %s", dir)
+// 	}
+
+// 	// Initialize YARA environment
+// 	if err := PrepareYaraEnvironment(); err != nil {
+// 		log.Printf("Warning: YARA initialization failed: %v", err)
+// 	}
+
+// 	// Initialize database
+// 	if err := InitDatabase(); err != nil {
+// 		return fmt.Errorf("failed to initialize database: %w", err)
+// 	}
+
+// 	return nil
+// }
+
+// func jobStatusHandler(w http.ResponseWriter, r *http.Request) {
+// 	// Extract jobID from URL path: /jobs/{jobID}
+// 	path := strings.TrimPrefix(r.URL.Path, "/jobs/")
+// 	jobID := path
+
+// 	if jobID == "" {
+// 		http.Error(w, "Job ID required", 400)
+// 		return
+// 	}
+
+// 	job, err := GetJob(jobID)
+// 	if err != nil {
+// 		http.Error(w, "Job not found", 404)
+// 		return
+// 	}
+
+// 	w.Header().Set("Content-Type", "application/json")
+// 	json.NewEncoder(w).Encode(job)
+// }
+
+// func vmScanHandler(w http.ResponseWriter, r *http.Request) {
+// 	if r.Method != "POST" {
+// 		http.Error(w, "Method not allowed", 405)
+// 		return
+// 	}
+
+// 	// Extract jobID from URL path: /vm/scan/{jobID}
+// 	path := strings.TrimPrefix(r.URL.Path, "/vm/scan/")
+// 	jobID := path
+
+// 	if jobID == "" {
+// 		http.Error(w, "Job ID required", 400)
+// 		return
+// 	}
+
+// 	// Check if job exists
+// 	job, err := GetJob(jobID)
+// 	if err != nil {
+// 		http.Error(w, "Job not found", 404)
+// 		return
+// 	}
+
+// 	// Construct paths for VM
+// 	sock := fmt.Sprintf("/tmp/firecracker-%s.sock", jobID)
+// 	kernel := "/mnt/d/firecracker/hello-vmlinux.bin"
+// 	rootfs := "/mnt/d/firecracker/hello-rootfs.ext4"
+// 	inputDrive := fmt.Sprintf("/mnt/d/firecracker/disks/input-%s.ext4", jobID)
+
+// 	// Verify input drive exists
+// 	if _, err := os.Stat(inputDrive); os.IsNotExist(err) {
+// 		http.Error(w, "Disk image not found for job", 404)
+// 		return
+// 	}
+
+// 	log.Printf("Starting VM for job %s with input drive: %s", jobID, inputDrive)
+
+// 	// Start VM with input drive attached
+// 	if err := StartVM(sock, kernel, rootfs, inputDrive); err != nil {
+// 		http.Error(w, "Failed to start VM: "+err.Error(), 500)
+// 		UpdateJobStatus(jobID, "failed", job.ScanResult)
+// 		return
+// 	}
+
+// 	// Update job status
+// 	UpdateJobStatus(jobID, "running", "scanning...")
+
+// 	log.Printf("VM started successfully for job %s", jobID)
+
+// 	w.Header().Set("Content-Type", "application/json")
+// 	json.NewEncoder(w).Encode(map[string]string{
+// 		"status": "vm_started",
+// 		"jobID":  jobID,
+// 		"socket": sock,
+// 	})
+// }
+
+func main() {
+	// Initialize required directories
+	// if err := initDirectories(); err != nil {
+	// 	log.Fatalf("Failed to initialize directories: %v", err)
+	// }
+
+	// Register handlers
+	// http.HandleFunc("/upload", uploadHandler)   // From drives.go
+	// http.HandleFunc("/vm/scan/", vmScanHandler) // VM launch endpoint
+	// http.HandleFunc("/jobs/", func(w http.ResponseWriter, r *http.Request) {
+	// 	switch r.Method {
+	// 	case "DELETE":
+	// 		cleanupHandler(w, r)
+	// 	case "GET":
+	// 		jobStatusHandler(w, r)
+	// 	default:
+	// 		http.Error(w, "Method not allowed", 405)
+	// 	}
+	// })
+	// http.HandleFunc("/jobs", func(w http.ResponseWriter, r *http.Request) {
+	// 	// List all jobs
+	// 	jobs, err := GetAllJobs()
+	// 	if err != nil {
+	// 		http.Error(w, "Failed to retrieve jobs", 500)
+	// 		return
+	// 	}
+	// 	w.Header().Set("Content-Type", "application/json")
+	// 	json.NewEncoder(w).Encode(jobs)
+	// })
+
+	// // Legacy VM start endpoint (for testing)
+	// http.HandleFunc("/vm/start", func(w http.ResponseWriter, r *http.Request) {
+	// 	err := StartVM(
+	// 		"/tmp/firecracker.sock",
+	// 		"/mnt/d/firecracker/hello-vmlinux.bin",
+	// 		"/mnt/d/firecracker/hello-rootfs.ext4",
+	// 		"", // No input drive
+	// 	)
+	// 	if err != nil {
+	// 		http.Error(w, err.Error(), 500)
+	// 		return
+	// 	}
+	// 	w.Write([]byte("VM started"))
+	// })
+
+	// // New scan endpoint
+	// http.HandleFunc("/scan/", func(w http.ResponseWriter, r *http.Request) {
+	// 	path := strings.TrimPrefix(r.URL.Path, "/scan/")
+	// 	jobID := path
+
+	// 	if jobID == "" {
+	// 		http.Error(w, "Job ID required", 400)
+	// 		return
+	// 	}
+
+	// 	// Get existing results if available
+	// 	if r.Method == "GET" {
+	// 		result, err := GetYaraResults(jobID)
+	// 		if err != nil {
+	// 			http.Error(w, "Scan results not found", 404)
+	// 			return
+	// 		}
+	// 		w.Header().Set("Content-Type", "application/json")
+	// 		json.NewEncoder(w).Encode(result)
+	// 		return
+	// 	}
+
+	// 	//POST - trigger new scan
+	// 	if r.Method == "POST" {
+	// 		result, err := ScanFileWithYara(jobID)
+	// 		if err != nil {
+	// 			log.Printf("YARA scan error: %v", err)
+	// 		}
+
+	// 		// Update job status in database
+	// 		if result != nil {
+	// 			scanStatus := result.Status
+	// 			if result.MatchCount > 0 {
+	// 				scanStatus = fmt.Sprintf("%s (%d detections)", result.Status, result.MatchCount)
+	// 			}
+	// 			job, _ := GetJob(jobID)
+	// 			if job != nil {
+	// 				UpdateJobStatus(jobID, job.VMStatus, scanStatus)
+	// 			}
+	// 		}
+
+	// 		w.Header().Set("Content-Type", "application/json")
+	// 		json.NewEncoder(w).Encode(result)
+	// 		return
+	// 	}
+
+	// 	http.Error(w, "Method not allowed", 405)
+	// })
+
+	// // Stats endpoint
+	// http.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+	// 	stats, err := GetJobStats()
+	// 	if err != nil {
+	// 		http.Error(w, "Failed to get stats", 500)
+	// 		return
+	// 	}
+	// 	w.Header().Set("Content-Type", "application/json")
+	// 	json.NewEncoder(w).Encode(stats)
+	// })
+
+	if err := os.MkdirAll("/tmp/uploads", 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.MkdirAll("/tmp/vms", 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := database.InitDatabase("/tmp/firecracker.db"); err != nil {
+		log.Fatal(err)
+	}
+	rescan.Recover()
+
+	vmManager := &sandboxing.VMManager{
+		BaseChrootDir:   "/tmp/vms",
+		BaseUploadDir:   "/tmp/uploads",
+		BaseArtifactDir: "/tmp/artifacts",
+		KernelPath:      "/mnt/d/firecracker/hello-vmlinux.bin",
+		RootfsPath:      "/mnt/d/firecracker/hello-rootfs.ext4",
+		JailerPath:      "/mnt/d/firecracker/release-v1.7.0-x86_64/jailer-v1.7.0-x86_64",
+		FirecrackerPath: "/mnt/d/firecracker/release-v1.7.0-x86_64/firecracker-v1.7.0-x86_64",
+		DefaultTimeout:  2 * time.Minute,
+		MaxTimeout:      10 * time.Minute,
+		ShutdownGrace:   10 * time.Second,
+		Snapshots: sandboxing.SnapshotConfig{
+			Enabled: false,
+			Dir:     "/tmp/vms/snapshots",
+		},
+		Pool: sandboxing.PoolConfig{
+			Size:        0,
+			RefillEvery: 2 * time.Second,
+			MaxIdle:     10 * time.Minute,
+		},
+		Network: sandboxing.NetworkConfig{
+			Enabled:         false, // needs root; allows ?network=simulated
+			CaptureMaxBytes: sandboxing.DefaultCaptureBytes,
+		},
+		Metadata: sandboxing.MetadataConfig{
+			Enabled: false, // needs root and an agent that sends its token
+		},
+		Console: sandboxing.ConsoleConfig{
+			MaxBytes: 1 << 20, // per file, with 3 rotated files kept
+		},
+		// BaseChrootDir:   "/srv/vms",
+		// BaseUploadDir:   "/srv/uploads",
+		// KernelPath:      "/mnt/d/firecracker/hello-vmlinux.bin",
+		// RootfsPath:      "/mnt/d/firecracker/hello-rootfs.ext4",
+		// JailerPath:      "/opt/firecracker/jailer",
+		// FirecrackerPath: "/opt/firecracker/firecracker",
+		// Jailer: sandboxing.JailerConfig{
+		// 	Enabled: true,
+		// 	UIDBase: 10000,
+		// 	GIDBase: 10000,
+		// 	IDRange: 1000,
+		// 	Cgroups: []string{"memory.max=600M", "cpu.max=100000 100000", "pids.max=64"},
+		// 	NetNS:   true,
+		// },
+	}
+
+	if vmManager.Snapshots.Enabled {
+		if _, err := vmManager.PrepareGoldenSnapshot(); err != nil {
+			log.Printf("golden snapshot unavailable, cold booting: %v", err)
+		}
+	}
+
+	vmManager.StartPool()
+
+	// Host-wide limits; the warm pool's VMs come out of the same budget
+	schedulerCfg, err := sandboxing.SchedulerConfig{
+		MaxVMs:     8,
+		MaxVCPUs:   8,
+		MaxMemMiB:  4096,
+		MaxQueue:   100,
+		RetryAfter: 30 * time.Second,
+	}.ReservePool(vmManager.Pool, vmManager.VMVcpus(), vmManager.VMMemMib())
+	if err != nil {
+		log.Fatal(err)
+	}
+	scheduler := sandboxing.NewScheduler(schedulerCfg)
+
+	yaraCfg := scanner.Config{
+		RulesDir: "yara_rules",
+		Timeout:  time.Minute,
+		CacheDir: "/tmp/yara-cache",
+	}
+	yaraScanner, err := scanner.New(yaraCfg)
+	if err != nil {
+		log.Printf("YARA scanning disabled: %v", err)
+	} else {
+		log.Printf("YARA rules loaded: engine=%s files=%d version=%s",
+			yaraScanner.Info().Engine, len(yaraScanner.Info().Files), yaraScanner.Info().Version)
+		yaraEngine = yaraScanner
+	}
+
+	// Severity weights and verdict thresholds for YARA matches
+	yaraVerdicts = verdict.DefaultConfig()
+
+	// Suricata-style signatures over captured guest traffic; rules that
+	// fail to parse are skipped and logged
+	netRules, err := netsig.Load("network_rules")
+	if netRules == nil {
+		log.Printf("network signatures disabled: %v", err)
+	} else {
+		if err != nil {
+			log.Printf("network rules skipped: %v", err)
+		}
+		log.Printf("network rules loaded: files=%d rules=%d version=%s",
+			len(netRules.Files), len(netRules.Rules), netRules.Version)
+	}
+
+	// Encrypted copies of every upload, for rescans when rules change
+	sampleCfg := samples.Config{
+		Enabled: false,
+		Dir:     "/tmp/samples",
+		KeyFile: "/tmp/samples.key",
+	}
+	var sampleStore *samples.Store
+	if sampleCfg.Enabled {
+		if sampleStore, err = samples.Open(sampleCfg); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Archives are unpacked into child jobs, each analysed on its own
+	unpackCfg := unpack.DefaultConfig()
+
+	// Upload size, per-client daily bytes and free disk in BaseUploadDir
+	uploadLimits := quota.New(quota.DefaultConfig(), vmManager.BaseUploadDir)
+
+	uploadHandler := &handler.UploadHandler{
+		VM:        vmManager,
+		Scheduler: scheduler,
+		Scanner:   yaraEngine,
+		Verdicts:  yaraVerdicts,
+		Samples:   sampleStore,
+		Triage:    triage.Default(),
+		Unpack:    &unpackCfg,
+		Quota:     uploadLimits,
+		NetRules:  netRules,
+	}
+
+	http.Handle("POST /jobs", uploadHandler)
+	http.Handle("POST /upload", uploadHandler) // legacy alias for POST /jobs
+	http.HandleFunc("GET /jobs", uploadHandler.ListJobs)
+	http.HandleFunc("GET /jobs/{id}", uploadHandler.GetJob)
+	http.HandleFunc("DELETE /jobs/{id}", uploadHandler.CancelJob)
+	http.HandleFunc("GET /jobs/{id}/artifacts", uploadHandler.ListArtifacts)
+	http.HandleFunc("GET /jobs/{id}/artifacts/{name}", uploadHandler.GetArtifact)
+	http.HandleFunc("GET /jobs/{id}/console", uploadHandler.StreamConsole)
+	http.HandleFunc("GET /queue", uploadHandler.QueueStats)
+	http.HandleFunc("GET /pool", uploadHandler.PoolStats)
+	http.HandleFunc("GET /metrics/storage", uploadHandler.StorageStats)
+
+	// Fuzzy-hash similarity across every sample seen
+	go similarity.Backfill()
+	sampleHandler := &handler.SampleHandler{MinScore: similarity.DefaultMinimum}
+	http.HandleFunc("GET /samples/{hash}/similar", sampleHandler.Similar)
+
+	if yaraEngine != nil {
+		ruleHandler := &handler.RuleHandler{
+			Rules: &scanner.RuleStore{Dir: yaraCfg.RulesDir, Scanner: yaraEngine},
+		}
+		if _, err := ruleHandler.RecordVersion("startup"); err != nil {
+			log.Printf("rule version not recorded: %v", err)
+		}
+		go scanner.Watch(context.Background(), yaraEngine, yaraCfg.RulesDir, 10*time.Second,
+			func(scanner.RulesetInfo) {
+				if _, err := ruleHandler.RecordVersion("reload from disk"); err != nil {
+					log.Printf("rule version not recorded: %v", err)
+				}
+			})
+
+		http.HandleFunc("GET /rules", ruleHandler.ListRules)
+		http.HandleFunc("POST /rules", ruleHandler.UploadRules)
+		http.HandleFunc("GET /rules/versions", ruleHandler.ListRuleVersions)
+		http.HandleFunc("GET /rules/versions/{id}", ruleHandler.GetRuleVersion)
+		http.HandleFunc("GET /rules/{name}", ruleHandler.GetRules)
+		http.HandleFunc("PUT /rules/{name}", ruleHandler.PutRules)
+		http.HandleFunc("DELETE /rules/{name}", ruleHandler.DeleteRules)
+		http.HandleFunc("POST /rules/{name}/enable", ruleHandler.EnableRules)
+		http.HandleFunc("POST /rules/{name}/disable", ruleHandler.DisableRules)
+
+		if sampleStore != nil {
+			rescanHandler := &handler.RescanHandler{
+				Rescanner: &rescan.Rescanner{
+					Store:    sampleStore,
+					Scanner:  yaraEngine,
+					Verdicts: yaraVerdicts,
+					Workers:  2,
+					TmpDir:   "/tmp/uploads",
+				},
+			}
+			http.HandleFunc("POST /rescan", rescanHandler.StartRescan)
+			http.HandleFunc("GET /rescan", rescanHandler.ListRescans)
+			http.HandleFunc("GET /rescan/{id}", rescanHandler.GetRescan)
+		}
+	}
+
+	log.Println("listening on :8080")
+	log.Fatal(http.ListenAndServe(":8080", nil))
+}